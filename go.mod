@@ -2,10 +2,13 @@ module HTTPBreakoutBox
 
 go 1.24.0
 
-require github.com/elazarl/goproxy v1.7.2
+require (
+	github.com/elazarl/goproxy v1.7.2
+	golang.org/x/net v0.46.1-0.20251013234738-63d1a5100f82
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	golang.org/x/net v0.46.1-0.20251013234738-63d1a5100f82 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251029180050-ab9386a59fda // indirect
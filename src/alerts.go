@@ -0,0 +1,823 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// Alert rules watch the capture stream and analyzer snapshots and notify
+// through SSE, webhooks or local commands when a condition starts or stops
+// holding.
+
+// Rule kinds.
+const (
+	alertMatch        = "match"         // any capture matching Query
+	alertRate         = "rate"          // Metric over captures matching Query within Window
+	alertRetryBurst   = "retry_burst"   // largest retry burst (retry analyzer)
+	alertAuthFlapping = "auth_flapping" // auth header changes within Window (authcookie analyzer)
+	alertAnomaly      = "anomaly"       // active anomalies (anomaly analyzer)
+)
+
+// Metrics of rate rules. Rates are fractions (0.05 = 5%).
+const (
+	alertCount     = "count"
+	alertErrorRate = "error_rate" // 5xx + network errors
+	alert5xxRate   = "5xx_rate"
+	alert4xxRate   = "4xx_rate"
+	alertP95       = "p95_ms"
+)
+
+// Sink types.
+const (
+	sinkSSE     = "sse"
+	sinkWebhook = "webhook"
+	sinkExec    = "exec"
+)
+
+const (
+	defaultAlertWindow   = time.Minute
+	defaultAlertCooldown = time.Minute
+	maxAlertSamples      = 10000 // per rate rule
+	maxAlertHistory      = 200
+	alertSinkTimeout     = 10 * time.Second
+)
+
+// alertDuration is a time.Duration written as "1m30s" in JSON; plain
+// numbers are read as nanoseconds.
+type alertDuration time.Duration
+
+func (d alertDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *alertDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("duration: want a string like \"1m\" or nanoseconds")
+		}
+		*d = alertDuration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*d = alertDuration(v)
+	return nil
+}
+
+// AlertSink is one notification target of a rule.
+type AlertSink struct {
+	Type    string   `json:"type"`              // sse, webhook or exec
+	URL     string   `json:"url,omitempty"`     // webhook: receives the AlertEvent as a JSON POST
+	Command []string `json:"command,omitempty"` // exec: argv; the AlertEvent is written to stdin
+}
+
+// AlertRule is a declarative alert condition.
+type AlertRule struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled *bool  `json:"enabled,omitempty"` // default true; false keeps the rule but never evaluates it
+	Kind    string `json:"kind"`
+
+	Query  string `json:"query,omitempty"`  // match/rate: capture filter (search bar syntax); rate: empty = all
+	Host   string `json:"host,omitempty"`   // analyzer rules: only this host
+	Metric string `json:"metric,omitempty"` // rate: count, error_rate, 5xx_rate, 4xx_rate, p95_ms; anomaly: rate, error_rate, p95_ms
+
+	Op        string   `json:"op,omitempty"` // >, >=, <, <= (default >=)
+	Threshold float64  `json:"threshold"`
+	Clear     *float64 `json:"clear,omitempty"` // resolve once the value no longer passes Clear (hysteresis); default Threshold
+
+	Window   alertDuration `json:"window,omitempty"`    // rate and auth_flapping lookback; default 1m
+	MinCount int           `json:"min_count,omitempty"` // rate: captures needed before the rule is evaluated
+	Cooldown alertDuration `json:"cooldown,omitempty"`  // minimum gap between firing notifications; default 1m, negative = none
+
+	Sinks []AlertSink `json:"sinks,omitempty"` // default: sse
+}
+
+// enabled reports whether the rule is evaluated; rules are on unless
+// "enabled": false is given.
+func (r *AlertRule) enabled() bool { return r.Enabled == nil || *r.Enabled }
+
+// AlertEvent is what sinks receive.
+type AlertEvent struct {
+	RuleID     string    `json:"rule_id"`
+	Rule       string    `json:"rule"`
+	Kind       string    `json:"kind"`
+	State      string    `json:"state"` // firing or resolved
+	Value      float64   `json:"value"`
+	Threshold  float64   `json:"threshold"`
+	Message    string    `json:"message"`
+	Time       time.Time `json:"time"`
+	CaptureID  int64     `json:"capture_id,omitempty"` // match rules: the capture that fired
+	Suppressed int64     `json:"suppressed,omitempty"` // firings swallowed by the cooldown since the previous notification
+}
+
+// AlertStatus is the live state of one rule.
+type AlertStatus struct {
+	Firing       bool      `json:"firing"`
+	Since        time.Time `json:"since,omitempty"`
+	Value        float64   `json:"value"`
+	Evaluated    time.Time `json:"evaluated,omitempty"`
+	Fired        int64     `json:"fired"`
+	Suppressed   int64     `json:"suppressed"`
+	LastNotified time.Time `json:"last_notified,omitempty"`
+}
+
+type alertSample struct {
+	t       time.Time
+	status  int
+	latency time.Duration
+}
+
+type alertTotal struct {
+	t     time.Time
+	total int64
+}
+
+// alertState is a rule with its compiled filter and evaluation state.
+type alertState struct {
+	rule    AlertRule
+	filter  *captureFilter
+	samples []alertSample // rate: matching captures, oldest first
+	totals  []alertTotal  // auth_flapping: change counter history
+	status  AlertStatus
+	quiet   int64 // suppressed since the last notification
+}
+
+type alertEngine struct {
+	mu        sync.Mutex
+	rules     []*alertState
+	history   []AlertEvent // newest last
+	publish   func(name string, payload any)
+	allowExec bool
+	client    *http.Client
+}
+
+// alerting is the process-wide rule engine fed by the proxy.
+var alerting = newAlertEngine()
+
+func newAlertEngine() *alertEngine {
+	return &alertEngine{client: &http.Client{Timeout: alertSinkTimeout}}
+}
+
+// validateAlertRule checks r and fills in defaults.
+func validateAlertRule(r *AlertRule) error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Kind = strings.ToLower(strings.TrimSpace(r.Kind))
+	r.Query = strings.TrimSpace(r.Query)
+	if r.Name == "" {
+		r.Name = r.Kind
+	}
+	switch r.Kind {
+	case alertMatch:
+		if r.Query == "" {
+			return fmt.Errorf("%s: match rules need a query", r.Name)
+		}
+	case alertRate:
+		switch r.Metric {
+		case alertCount, alertErrorRate, alert5xxRate, alert4xxRate, alertP95:
+		case "":
+			r.Metric = alertErrorRate
+		default:
+			return fmt.Errorf("%s: unknown rate metric %q (want count, error_rate, 5xx_rate, 4xx_rate or p95_ms)", r.Name, r.Metric)
+		}
+	case alertRetryBurst, alertAuthFlapping:
+		if r.Threshold == 0 {
+			r.Threshold = 1
+		}
+	case alertAnomaly:
+		switch r.Metric {
+		case "", analysis.MetricRate, analysis.MetricErrorRate, analysis.MetricP95:
+		default:
+			return fmt.Errorf("%s: unknown anomaly metric %q", r.Name, r.Metric)
+		}
+		if r.Threshold == 0 {
+			r.Threshold = 1
+		}
+	default:
+		return fmt.Errorf("%s: unknown kind %q (want match, rate, retry_burst, auth_flapping or anomaly)", r.Name, r.Kind)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=":
+	case "":
+		r.Op = ">="
+	default:
+		return fmt.Errorf("%s: unknown op %q", r.Name, r.Op)
+	}
+	if r.Window <= 0 {
+		r.Window = alertDuration(defaultAlertWindow)
+	}
+	if r.Cooldown == 0 {
+		r.Cooldown = alertDuration(defaultAlertCooldown)
+	}
+	for _, s := range r.Sinks {
+		switch s.Type {
+		case sinkSSE:
+		case sinkWebhook:
+			if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+				return fmt.Errorf("%s: webhook sink needs an http(s) url", r.Name)
+			}
+		case sinkExec:
+			if len(s.Command) == 0 || s.Command[0] == "" {
+				return fmt.Errorf("%s: exec sink needs a command", r.Name)
+			}
+		default:
+			return fmt.Errorf("%s: unknown sink %q (want sse, webhook or exec)", r.Name, s.Type)
+		}
+	}
+	return nil
+}
+
+// checkExec rejects exec sinks unless the engine was started with them
+// enabled; rules arrive over the API, and a command sink runs with the
+// proxy's privileges.
+func (e *alertEngine) checkExec(r AlertRule) error {
+	if e.allowExec {
+		return nil
+	}
+	for _, s := range r.Sinks {
+		if s.Type == sinkExec {
+			return fmt.Errorf("%s: exec sinks are disabled (start with -alert-exec)", r.Name)
+		}
+	}
+	return nil
+}
+
+func compileAlert(r AlertRule) *alertState {
+	st := &alertState{rule: r}
+	if r.Query != "" {
+		st.filter = compileCaptureFilter(r.Query, nil)
+	}
+	return st
+}
+
+// replace swaps in a new rule set. State is kept for rules whose ID and
+// definition are unchanged.
+func (e *alertEngine) replace(rules []AlertRule) error {
+	for i := range rules {
+		if err := validateAlertRule(&rules[i]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(rules[i].ID) == "" {
+			rules[i].ID = fmt.Sprintf("a-%d", time.Now().UnixNano()+int64(i))
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	old := make(map[string]*alertState, len(e.rules))
+	for _, st := range e.rules {
+		old[st.rule.ID] = st
+	}
+	e.rules = e.rules[:0:0]
+	for _, r := range rules {
+		if st, ok := old[r.ID]; ok && alertRuleEqual(st.rule, r) {
+			e.rules = append(e.rules, st)
+			continue
+		}
+		e.rules = append(e.rules, compileAlert(r))
+	}
+	return nil
+}
+
+func alertRuleEqual(a, b AlertRule) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+// add validates r, assigns an ID if needed and appends it.
+func (e *alertEngine) add(r AlertRule) (AlertRule, error) {
+	if err := validateAlertRule(&r); err != nil {
+		return r, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if strings.TrimSpace(r.ID) == "" {
+		r.ID = fmt.Sprintf("a-%d", time.Now().UnixNano())
+	}
+	for _, st := range e.rules {
+		if st.rule.ID == r.ID {
+			return r, fmt.Errorf("rule %q already exists", r.ID)
+		}
+	}
+	e.rules = append(e.rules, compileAlert(r))
+	return r, nil
+}
+
+func (e *alertEngine) remove(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, st := range e.rules {
+		if st.rule.ID == id {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// getAll returns the rule definitions, for persistence.
+func (e *alertEngine) getAll() []AlertRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]AlertRule, len(e.rules))
+	for i, st := range e.rules {
+		out[i] = st.rule
+	}
+	return out
+}
+
+// alertRuleView is a rule with its live status.
+type alertRuleView struct {
+	AlertRule
+	Status AlertStatus `json:"status"`
+}
+
+func (e *alertEngine) list() []alertRuleView {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]alertRuleView, len(e.rules))
+	for i, st := range e.rules {
+		out[i] = alertRuleView{AlertRule: st.rule, Status: st.status}
+	}
+	return out
+}
+
+func (e *alertEngine) get(id string) (alertRuleView, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, st := range e.rules {
+		if st.rule.ID == id {
+			return alertRuleView{AlertRule: st.rule, Status: st.status}, true
+		}
+	}
+	return alertRuleView{}, false
+}
+
+// recent returns up to limit notifications, newest first.
+func (e *alertEngine) recent(limit int) []AlertEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := len(e.history)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	out := make([]AlertEvent, 0, n)
+	for i := len(e.history) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, e.history[i])
+	}
+	return out
+}
+
+// observe feeds one finished capture to the match and rate rules.
+func (e *alertEngine) observe(c *Capture) {
+	if e == nil || c == nil {
+		return
+	}
+	var fired []pendingAlert
+	e.mu.Lock()
+	for _, st := range e.rules {
+		r := &st.rule
+		if !r.enabled() || (r.Kind != alertMatch && r.Kind != alertRate) {
+			continue
+		}
+		if st.filter != nil && !st.filter.match(c) {
+			continue
+		}
+		if r.Kind == alertRate {
+			st.samples = append(st.samples, alertSample{t: c.Time, status: c.ResponseStatus, latency: captureLatency(c)})
+			if len(st.samples) > maxAlertSamples {
+				st.samples = st.samples[len(st.samples)-maxAlertSamples:]
+			}
+			continue
+		}
+		now := c.Time
+		if now.IsZero() {
+			now = time.Now()
+		}
+		st.status.Value++
+		st.status.Evaluated = now
+		if ev, ok := e.fire(st, now, st.status.Value); ok {
+			ev.CaptureID = c.ID
+			ev.Message = fmt.Sprintf("%s: %s %s matched %q", r.Name, c.Method, alertTarget(c), r.Query)
+			fired = append(fired, pendingAlert{ev, r.Sinks})
+		}
+		st.status.Firing = false // match rules never stay firing
+	}
+	e.mu.Unlock()
+	e.dispatch(fired)
+}
+
+func captureLatency(c *Capture) time.Duration {
+	if c.TotalMs > 0 {
+		return time.Duration(c.TotalMs) * time.Millisecond
+	}
+	return time.Duration(c.DurationMs) * time.Millisecond
+}
+
+type pendingAlert struct {
+	ev    AlertEvent
+	sinks []AlertSink
+}
+
+// evaluate re-computes every threshold rule at now.
+func (e *alertEngine) evaluate(now time.Time) {
+	if e == nil {
+		return
+	}
+	reg := analysisRegistry
+	var fired []pendingAlert
+	e.mu.Lock()
+	for _, st := range e.rules {
+		r := &st.rule
+		if !r.enabled() || r.Kind == alertMatch {
+			continue
+		}
+		value, ok := st.measure(reg, now)
+		st.status.Evaluated = now
+		if !ok {
+			continue
+		}
+		st.status.Value = value
+		clear := r.Threshold
+		if r.Clear != nil {
+			clear = *r.Clear
+		}
+		switch {
+		case !st.status.Firing && alertPasses(value, r.Op, r.Threshold):
+			if ev, ok := e.fire(st, now, value); ok {
+				ev.Message = fmt.Sprintf("%s: %s %s %g (value %g)", r.Name, alertSubject(r), r.Op, r.Threshold, round3(value))
+				fired = append(fired, pendingAlert{ev, r.Sinks})
+			}
+		case st.status.Firing && !alertPasses(value, r.Op, clear):
+			st.status.Firing = false
+			st.status.Since = now
+			if !st.status.LastNotified.IsZero() && st.quiet == 0 {
+				ev := st.event(now, "resolved", value)
+				ev.Message = fmt.Sprintf("%s: resolved (value %g)", r.Name, round3(value))
+				e.record(ev)
+				fired = append(fired, pendingAlert{ev, r.Sinks})
+			}
+		}
+	}
+	e.mu.Unlock()
+	e.dispatch(fired)
+}
+
+// fire marks st as firing and returns the notification unless the cooldown
+// swallows it. The caller holds the lock.
+func (e *alertEngine) fire(st *alertState, now time.Time, value float64) (AlertEvent, bool) {
+	st.status.Firing = true
+	st.status.Since = now
+	st.status.Fired++
+	cd := time.Duration(st.rule.Cooldown)
+	if cd > 0 && !st.status.LastNotified.IsZero() && now.Sub(st.status.LastNotified) < cd {
+		st.status.Suppressed++
+		st.quiet++
+		return AlertEvent{}, false
+	}
+	ev := st.event(now, "firing", value)
+	ev.Suppressed = st.quiet
+	st.quiet = 0
+	st.status.LastNotified = now
+	e.record(ev)
+	return ev, true
+}
+
+func (st *alertState) event(now time.Time, state string, value float64) AlertEvent {
+	return AlertEvent{
+		RuleID:    st.rule.ID,
+		Rule:      st.rule.Name,
+		Kind:      st.rule.Kind,
+		State:     state,
+		Value:     round3(value),
+		Threshold: st.rule.Threshold,
+		Time:      now,
+	}
+}
+
+func (e *alertEngine) record(ev AlertEvent) {
+	e.history = append(e.history, ev)
+	if len(e.history) > maxAlertHistory {
+		e.history = e.history[len(e.history)-maxAlertHistory:]
+	}
+}
+
+// alertTarget names a capture's route in a notification. The full URL is
+// left out: its query string may carry the very credentials a rule looks for.
+func alertTarget(c *Capture) string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "?"
+	}
+	if c.RouteTemplate != "" {
+		return u.Host + c.RouteTemplate
+	}
+	return u.Host + u.Path
+}
+
+func alertSubject(r *AlertRule) string {
+	switch r.Kind {
+	case alertRate:
+		return fmt.Sprintf("%s of %q over %s", r.Metric, r.Query, time.Duration(r.Window))
+	case alertRetryBurst:
+		return "largest retry burst"
+	case alertAuthFlapping:
+		return fmt.Sprintf("auth changes over %s", time.Duration(r.Window))
+	case alertAnomaly:
+		return "active anomalies"
+	}
+	return r.Kind
+}
+
+func alertPasses(v float64, op string, t float64) bool {
+	switch op {
+	case ">":
+		return v > t
+	case "<":
+		return v < t
+	case "<=":
+		return v <= t
+	}
+	return v >= t
+}
+
+func round3(v float64) float64 { return math.Round(v*1000) / 1000 }
+
+// measure computes the rule's current value. ok is false when there is not
+// enough data to judge (the state is then left alone).
+func (st *alertState) measure(reg *analysis.Registry, now time.Time) (float64, bool) {
+	r := &st.rule
+	switch r.Kind {
+	case alertRate:
+		return st.measureRate(now)
+	case alertRetryBurst:
+		ra := reg.Retry()
+		if ra == nil {
+			return 0, false
+		}
+		var top int64
+		for _, s := range ra.Snapshot(1) {
+			if (r.Host == "" || strings.EqualFold(s.Host, r.Host)) && s.Count > top {
+				top = s.Count
+			}
+		}
+		return float64(top), true
+	case alertAuthFlapping:
+		ac := reg.AuthCookie()
+		if ac == nil {
+			return 0, false
+		}
+		var total int64
+		for _, s := range ac.Snapshot(0, 0) {
+			if r.Host == "" || strings.EqualFold(s.Host, r.Host) {
+				total += s.AuthChangeCount
+			}
+		}
+		if n := len(st.totals); n > 0 && total < st.totals[n-1].total {
+			st.totals = st.totals[:0] // analyzer was reset or keys were evicted
+		}
+		st.totals = append(st.totals, alertTotal{t: now, total: total})
+		cut := now.Add(-time.Duration(r.Window))
+		base := st.totals[0]
+		for len(st.totals) > 1 && !st.totals[1].t.After(cut) {
+			st.totals = st.totals[1:]
+			base = st.totals[0]
+		}
+		return float64(total - base.total), true
+	case alertAnomaly:
+		an := reg.Anomalies()
+		if an == nil {
+			return 0, false
+		}
+		active := an.Recent(analysis.AnomalyFilter{ActiveOnly: true, Metric: r.Metric, Host: r.Host}, 0)
+		return float64(len(active)), true
+	}
+	return 0, false
+}
+
+func (st *alertState) measureRate(now time.Time) (float64, bool) {
+	cut := now.Add(-time.Duration(st.rule.Window))
+	i := sort.Search(len(st.samples), func(i int) bool { return st.samples[i].t.After(cut) })
+	st.samples = st.samples[i:]
+	n := len(st.samples)
+	if n == 0 {
+		// An empty window can only resolve a rule, never fire one.
+		return 0, st.status.Firing || st.rule.Metric == alertCount
+	}
+	if n < st.rule.MinCount {
+		return 0, false
+	}
+	var hits int
+	switch st.rule.Metric {
+	case alertCount:
+		return float64(n), true
+	case alertP95:
+		lat := make([]time.Duration, n)
+		for i, s := range st.samples {
+			lat[i] = s.latency
+		}
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		return float64(lat[(n*95-1)/100]) / 1e6, true
+	case alert5xxRate:
+		for _, s := range st.samples {
+			if s.status >= 500 {
+				hits++
+			}
+		}
+	case alert4xxRate:
+		for _, s := range st.samples {
+			if s.status >= 400 && s.status < 500 {
+				hits++
+			}
+		}
+	default: // error_rate
+		for _, s := range st.samples {
+			if s.status >= 500 || s.status == 0 {
+				hits++
+			}
+		}
+	}
+	return float64(hits) / float64(n), true
+}
+
+// dispatch delivers notifications outside the lock; webhooks and commands
+// run in their own goroutines so a slow sink never stalls the proxy.
+func (e *alertEngine) dispatch(fired []pendingAlert) {
+	for _, p := range fired {
+		log.Printf("Alert %s: %s", p.ev.State, p.ev.Message)
+		sinks := p.sinks
+		if len(sinks) == 0 {
+			sinks = []AlertSink{{Type: sinkSSE}}
+		}
+		for _, s := range sinks {
+			switch s.Type {
+			case sinkSSE:
+				if e.publish != nil {
+					e.publish("alert", p.ev)
+				}
+			case sinkWebhook:
+				go e.postWebhook(s.URL, p.ev)
+			case sinkExec:
+				if !e.allowExec {
+					log.Printf("Alert %s: exec sink skipped (start with -alert-exec)", p.ev.Rule)
+					continue
+				}
+				go runAlertCommand(s.Command, p.ev)
+			}
+		}
+	}
+}
+
+func (e *alertEngine) postWebhook(url string, ev AlertEvent) {
+	body, _ := json.Marshal(ev)
+	resp, err := e.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Alert %s: webhook %s: %v", ev.Rule, url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("Alert %s: webhook %s: %s", ev.Rule, url, resp.Status)
+	}
+}
+
+// runAlertCommand runs argv with the event as JSON on stdin and its main
+// fields in ALERT_* environment variables.
+func runAlertCommand(argv []string, ev AlertEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertSinkTimeout)
+	defer cancel()
+	body, _ := json.Marshal(ev)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"ALERT_RULE="+ev.Rule,
+		"ALERT_RULE_ID="+ev.RuleID,
+		"ALERT_STATE="+ev.State,
+		"ALERT_VALUE="+strconv.FormatFloat(ev.Value, 'g', -1, 64),
+		"ALERT_MESSAGE="+ev.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("Alert %s: command %s: %v: %s", ev.Rule, argv[0], err, bytes.TrimSpace(out))
+	}
+}
+
+// run evaluates the threshold rules every interval.
+func (e *alertEngine) run(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		e.evaluate(now)
+	}
+}
+
+// GET  /api/alerts -> []alertRuleView (rules with live status)
+// PUT  /api/alerts <- []AlertRule (replaces the rule set)
+// POST /api/alerts <- AlertRule -> AlertRule (adds one rule)
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if isVerbose() {
+		log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(alerting.list())
+	case http.MethodPut:
+		var incoming []AlertRule
+		if err := json.NewDecoder(r.Body).Decode(&incoming); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		for _, rule := range incoming {
+			if err := alerting.checkExec(rule); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := alerting.replace(incoming); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"updated": len(incoming)})
+	case http.MethodPost:
+		var rule AlertRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		if err := alerting.checkExec(rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rule, err := alerting.add(rule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(rule)
+	default:
+		http.Error(w, "method", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET    /api/alerts/history[?limit=] -> []AlertEvent, newest first
+// GET    /api/alerts/{id} -> alertRuleView
+// DELETE /api/alerts/{id}
+func handleAlert(w http.ResponseWriter, r *http.Request) {
+	if isVerbose() {
+		log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/alerts/")
+	if id == "history" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(alerting.recent(limit))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		v, ok := alerting.get(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	case http.MethodDelete:
+		if !alerting.remove(id) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// recordAlerts collects the SSE alert events published by e.
+func recordAlerts(e *alertEngine) func() []AlertEvent {
+	var mu sync.Mutex
+	var got []AlertEvent
+	e.publish = func(name string, payload any) {
+		if name != "alert" {
+			return
+		}
+		mu.Lock()
+		got = append(got, payload.(AlertEvent))
+		mu.Unlock()
+	}
+	return func() []AlertEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]AlertEvent(nil), got...)
+	}
+}
+
+func TestAlertRateHysteresisAndCooldown(t *testing.T) {
+	e := newAlertEngine()
+	events := recordAlerts(e)
+	clear := 0.02
+	if err := e.replace([]AlertRule{{
+		ID: "r1", Name: "payments 5xx", Kind: alertRate,
+		Query: "host:payments", Metric: alert5xxRate, Op: ">", Threshold: 0.05, Clear: &clear,
+		Window: alertDuration(time.Minute), Cooldown: alertDuration(10 * time.Minute),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	add := func(n, status int, at time.Time) {
+		for i := 0; i < n; i++ {
+			e.observe(&Capture{Time: at, Method: "GET", URL: "http://payments/charge", ResponseStatus: status})
+		}
+	}
+	add(9, 200, t0)
+	add(1, 503, t0)
+	e.observe(&Capture{Time: t0, URL: "http://search/q", ResponseStatus: 500}) // other host: ignored
+
+	e.evaluate(t0.Add(time.Second))
+	if got := events(); len(got) != 1 || got[0].State != "firing" || got[0].Value != 0.1 {
+		t.Fatalf("want one firing event at 10%%, got %+v", got)
+	}
+
+	// 3% is below the threshold but above the clear level: still firing.
+	add(23, 200, t0.Add(2*time.Second))
+	e.evaluate(t0.Add(3 * time.Second))
+	if v, _ := e.get("r1"); !v.Status.Firing || len(events()) != 1 {
+		t.Fatalf("resolved inside the hysteresis band: %+v", v.Status)
+	}
+
+	add(20, 200, t0.Add(4*time.Second))
+	e.evaluate(t0.Add(5 * time.Second))
+	if got := events(); len(got) != 2 || got[1].State != "resolved" {
+		t.Fatalf("want resolved event, got %+v", got)
+	}
+
+	// Re-firing within the cooldown is counted, not announced, and so is
+	// its recovery.
+	add(50, 503, t0.Add(6*time.Second))
+	e.evaluate(t0.Add(7 * time.Second))
+	e.evaluate(t0.Add(2 * time.Minute)) // window empty: resolves
+	if got := events(); len(got) != 2 {
+		t.Fatalf("cooldown not applied: %+v", got)
+	}
+	v, _ := e.get("r1")
+	if v.Status.Suppressed != 1 || v.Status.Fired != 2 || v.Status.Firing {
+		t.Fatalf("status = %+v", v.Status)
+	}
+
+	// After the cooldown the next firing goes out and reports what was swallowed.
+	later := t0.Add(20 * time.Minute)
+	add(5, 503, later)
+	e.evaluate(later)
+	if got := events(); len(got) != 3 || got[2].Suppressed != 1 {
+		t.Fatalf("want third event with suppressed=1, got %+v", got)
+	}
+}
+
+func TestAlertMatchRuleAndWebhook(t *testing.T) {
+	hooks := make(chan AlertEvent, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev AlertEvent
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&ev) != nil {
+			t.Errorf("webhook got %s with bad body", r.Method)
+		}
+		hooks <- ev
+	}))
+	defer srv.Close()
+
+	e := newAlertEngine()
+	events := recordAlerts(e)
+	if _, err := e.add(AlertRule{
+		ID: "pw", Kind: alertMatch, Query: "/password=/",
+		Sinks: []AlertSink{{Type: sinkSSE}, {Type: sinkWebhook, URL: srv.URL}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	off := false
+	if _, err := e.add(AlertRule{ID: "off", Enabled: &off, Kind: alertMatch, Query: "/password=/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Now()
+	e.observe(&Capture{ID: 1, Time: t0, Method: "GET", URL: "http://a/login?user=x"})
+	e.observe(&Capture{ID: 2, Time: t0, Method: "GET", URL: "http://a/login?password=hunter2"})
+	e.observe(&Capture{ID: 3, Time: t0.Add(time.Second), Method: "GET", URL: "http://a/login?password=again"})
+
+	got := events()
+	if len(got) != 1 || got[0].CaptureID != 2 || got[0].Kind != alertMatch {
+		t.Fatalf("want one alert for capture 2 (second inside the cooldown), got %+v", got)
+	}
+	if strings.Contains(got[0].Message, "hunter2") || !strings.Contains(got[0].Message, "GET a/login") {
+		t.Fatalf("message should name the route, not the URL: %q", got[0].Message)
+	}
+	select {
+	case ev := <-hooks:
+		if ev.CaptureID != 2 || ev.State != "firing" {
+			t.Fatalf("webhook event = %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	if v, _ := e.get("pw"); v.Status.Value != 2 || v.Status.Suppressed != 1 {
+		t.Fatalf("status = %+v", v.Status)
+	}
+}
+
+func TestAlertRetryBurstFromAnalyzer(t *testing.T) {
+	old := analysisRegistry
+	defer SetAnalysisRegistry(old)
+	reg := analysis.NewDefaultRegistry()
+	SetAnalysisRegistry(reg)
+
+	e := newAlertEngine()
+	events := recordAlerts(e)
+	if err := e.replace([]AlertRule{{ID: "rb", Kind: alertRetryBurst, Threshold: 10, Host: "api"}}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 12; i++ {
+		reg.OnRequest(&analysis.ObservedRequest{
+			Timestamp: now, Method: "POST", Path: "/pay", StatusCode: 503, Outcome: analysis.Outcome5xx,
+			Client: analysis.ClientID{IP: "10.0.0.1"},
+			Route:  analysis.RouteKey{Host: "api", Method: "POST", Path: "/pay"},
+		})
+	}
+	e.evaluate(now)
+	if got := events(); len(got) != 1 || got[0].Value != 12 {
+		t.Fatalf("want a retry burst alert with value 12, got %+v", got)
+	}
+}
+
+func TestAlertsAPI(t *testing.T) {
+	old := alerting
+	defer func() { alerting = old }()
+	alerting = newAlertEngine()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleAlerts(rec, httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader(body)))
+		return rec
+	}
+	if rec := post(`{"kind":"rate","metric":"bogus"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad metric accepted: %d", rec.Code)
+	}
+	if rec := post(`{"kind":"match","query":"x","sinks":[{"type":"exec","command":["true"]}]}`); rec.Code != http.StatusBadRequest ||
+		!strings.Contains(rec.Body.String(), "-alert-exec") {
+		t.Fatalf("exec sink accepted without -alert-exec: %d %s", rec.Code, rec.Body)
+	}
+	rec := post(`{"name":"slow","kind":"rate","metric":"p95_ms","threshold":500,"window":"5m"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	var created AlertRule
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.ID == "" || time.Duration(created.Window) != 5*time.Minute || created.Op != ">=" || !created.enabled() {
+		t.Fatalf("created = %+v", created)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAlert(rec, httptest.NewRequest(http.MethodGet, "/api/alerts/"+created.ID, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"window":"5m0s"`) {
+		t.Fatalf("get: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handleAlert(rec, httptest.NewRequest(http.MethodDelete, "/api/alerts/"+created.ID, nil))
+	if rec.Code != http.StatusNoContent || len(alerting.getAll()) != 0 {
+		t.Fatalf("delete: %d, %d rules left", rec.Code, len(alerting.getAll()))
+	}
+}
+
+func TestAlertRulesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "captures.json")
+	rules := []AlertRule{{ID: "a", Name: "pw", Kind: alertMatch, Query: "/password=/", Cooldown: alertDuration(time.Minute)}}
+	if err := saveAll(path, nil, nil, rules); err != nil {
+		t.Fatal(err)
+	}
+	_, _, got, err := loadAll(path)
+	if err != nil || len(got) != 1 || got[0].Query != "/password=/" || time.Duration(got[0].Cooldown) != time.Minute {
+		t.Fatalf("loadAll = %+v, %v", got, err)
+	}
+}
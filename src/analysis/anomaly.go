@@ -0,0 +1,577 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//
+// 16. Change-point / anomaly detection on per-host and per-route series
+//
+
+// Anomaly metrics.
+const (
+	MetricRate      = "rate"       // requests per second
+	MetricErrorRate = "error_rate" // 5xx + network errors / requests
+	MetricP95       = "p95_ms"     // 95th percentile latency in ms
+)
+
+// Anomaly scopes.
+const (
+	ScopeHost  = "host"
+	ScopeRoute = "route"
+)
+
+// Defaults for NewAnomalyAnalyzer.
+const (
+	DefaultAnomalyStep       = 10 * time.Second
+	DefaultAnomalyHistory    = 30  // windows in the baseline
+	DefaultAnomalyMinHistory = 6   // windows needed before detecting
+	DefaultAnomalyThreshold  = 4.0 // robust z-score
+	DefaultAnomalyMinCount   = 5   // requests in a window for error/p95 checks
+	maxRecentAnomalies       = 200
+	maxAnomalySamples        = 10
+	anomalySamplesPerWindow  = 5
+)
+
+// AnomalyKey identifies the series an anomaly was found in. For host scope
+// Method and Path are empty.
+type AnomalyKey struct {
+	Scope  string `json:"scope"`
+	Host   string `json:"host"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// Anomaly is a detected shift in one metric of one series. It stays Active
+// while consecutive windows remain anomalous; End is set on the first
+// normal window.
+type Anomaly struct {
+	ID        string     `json:"id"`
+	Key       AnomalyKey `json:"key"`
+	Metric    string     `json:"metric"`
+	Direction string     `json:"direction"` // "up" | "down"
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+	Active    bool       `json:"active"`
+	Windows   int        `json:"windows"`  // anomalous windows so far
+	Value     float64    `json:"value"`    // worst window value
+	Baseline  float64    `json:"baseline"` // median of the history
+	Score     float64    `json:"score"`    // worst robust z-score
+	Magnitude float64    `json:"magnitude"`
+	Samples   []string   `json:"samples"` // capture IDs from anomalous windows
+}
+
+// anomalySamples remembers a few capture IDs of one window of one series.
+// The counts themselves come from the temporal rollups, which keep no IDs.
+type anomalySamples struct {
+	ids    []string // first few captures
+	errIDs []string // first few failing captures
+	slow   []slowSample
+}
+
+type slowSample struct {
+	id  string
+	lat time.Duration
+}
+
+func (w *anomalySamples) add(ev *ObservedRequest) {
+	if len(w.ids) < anomalySamplesPerWindow {
+		w.ids = append(w.ids, ev.ID)
+	}
+	if (ev.Outcome == Outcome5xx || ev.Outcome == OutcomeNetworkError) && len(w.errIDs) < anomalySamplesPerWindow {
+		w.errIDs = append(w.errIDs, ev.ID)
+	}
+	if len(w.slow) < anomalySamplesPerWindow {
+		w.slow = append(w.slow, slowSample{ev.ID, ev.Latency})
+		return
+	}
+	min := 0
+	for i := range w.slow {
+		if w.slow[i].lat < w.slow[min].lat {
+			min = i
+		}
+	}
+	if ev.Latency > w.slow[min].lat {
+		w.slow[min] = slowSample{ev.ID, ev.Latency}
+	}
+}
+
+// anomalySeries is the state of one host or route.
+type anomalySeries struct {
+	key     AnomalyKey
+	first   time.Time                 // first window with traffic
+	samples map[int64]*anomalySamples // window start (unix ns) -> samples
+	hist    map[string][]float64      // metric -> recent window values, oldest first
+	active  map[string]*Anomaly       // metric -> ongoing anomaly
+}
+
+// AnomalyAnalyzer watches request rate, error rate and p95 latency per host
+// and per route and flags windows whose value is far from the recent median,
+// measured in median absolute deviations (a robust z-score that a few
+// outliers in the baseline do not skew).
+//
+// The windows are the temporal analyzer's rollup buckets at Step (see
+// UseRollups); without one the analyzer keeps a private single-tier rollup.
+// Windows close when a later request arrives or on Tick, so silence is
+// scored too: a drop to zero is flagged and open anomalies end.
+type AnomalyAnalyzer struct {
+	*boundedBase
+	Step       time.Duration
+	History    int
+	MinHistory int
+	Threshold  float64
+	MinCount   int64
+
+	source    *TemporalAnalyzer
+	ownSource bool // fed by OnRequest rather than by the registry
+
+	series    *boundedMap[AnomalyKey, *anomalySeries]
+	clock     time.Time // start of the oldest window not yet evaluated
+	recent    []*Anomaly
+	seq       int64
+	onAnomaly func(Anomaly)
+}
+
+// NewAnomalyAnalyzer constructs an analyzer with default settings.
+func NewAnomalyAnalyzer() *AnomalyAnalyzer {
+	series := newBoundedMap[AnomalyKey, *anomalySeries](DefaultLimits)
+	return &AnomalyAnalyzer{
+		boundedBase: newBoundedBase("anomaly", series),
+		Step:        DefaultAnomalyStep,
+		History:     DefaultAnomalyHistory,
+		MinHistory:  DefaultAnomalyMinHistory,
+		Threshold:   DefaultAnomalyThreshold,
+		MinCount:    DefaultAnomalyMinCount,
+		series:      series,
+	}
+}
+
+// UseRollups makes the analyzer read its windows from t, which the registry
+// feeds. It reports false (and keeps a private rollup) when t has no tier
+// at Step.
+func (a *AnomalyAnalyzer) UseRollups(t *TemporalAnalyzer) bool {
+	if t == nil {
+		return false
+	}
+	for _, r := range t.Resolutions() {
+		if r.Step == a.Step {
+			a.mu.Lock()
+			a.source, a.ownSource = t, false
+			a.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// rollups returns the source of the windows, creating a private one on
+// first use; the caller holds the lock.
+func (a *AnomalyAnalyzer) rollups() *TemporalAnalyzer {
+	if a.source == nil {
+		t := NewTemporalAnalyzer(a.Step, 1)
+		t.SetRollups([]Resolution{{Step: a.Step, Buckets: a.History + 2}}, DefaultMaxSeries)
+		a.source, a.ownSource = t, true
+	}
+	return a.source
+}
+
+// SetAnomalyHandler installs a callback invoked (outside the analyzer's
+// lock) when an anomaly starts.
+func (a *AnomalyAnalyzer) SetAnomalyHandler(fn func(Anomaly)) {
+	a.mu.Lock()
+	a.onAnomaly = fn
+	a.mu.Unlock()
+}
+
+// OnRequest keeps sample capture IDs for the request's host and route
+// windows. Crossing into a new window closes the previous ones.
+func (a *AnomalyAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || ev.Timestamp.IsZero() {
+		return
+	}
+	start := ev.Timestamp.Truncate(a.Step)
+
+	a.mu.Lock()
+	if src := a.rollups(); a.ownSource {
+		src.OnRequest(ev)
+	}
+	var started []Anomaly
+	switch {
+	case a.clock.IsZero():
+		a.clock = start
+	case start.After(a.clock):
+		started = a.closeBefore(start)
+	}
+	if start.Before(a.clock) {
+		// Window already evaluated; too late to count.
+		a.mu.Unlock()
+		a.emit(started)
+		return
+	}
+	if ev.ID != "" {
+		for _, key := range anomalyKeys(ev.Route.Host, ev.Route.Method, ev.Route.Path) {
+			s := a.seriesFor(key, start)
+			w := s.samples[start.UnixNano()]
+			if w == nil {
+				w = &anomalySamples{}
+				s.samples[start.UnixNano()] = w
+			}
+			w.add(ev)
+		}
+	}
+	a.mu.Unlock()
+	a.emit(started)
+}
+
+// Tick closes and evaluates every window that ended by now. The live
+// registry calls it on a timer so that quiet series are still scored.
+func (a *AnomalyAnalyzer) Tick(now time.Time) {
+	a.mu.Lock()
+	var started []Anomaly
+	if end := now.Truncate(a.Step); !a.clock.IsZero() && end.After(a.clock) {
+		started = a.closeBefore(end)
+	}
+	a.mu.Unlock()
+	a.emit(started)
+}
+
+func anomalyKeys(host, method, path string) [2]AnomalyKey {
+	return [2]AnomalyKey{
+		{Scope: ScopeHost, Host: host},
+		{Scope: ScopeRoute, Host: host, Method: method, Path: path},
+	}
+}
+
+// seriesFor returns the state of key, creating it with first window start.
+func (a *AnomalyAnalyzer) seriesFor(key AnomalyKey, start time.Time) *anomalySeries {
+	s, ok := a.series.get(key, start)
+	if !ok {
+		s = &anomalySeries{
+			key:     key,
+			first:   start,
+			samples: make(map[int64]*anomalySamples),
+			hist:    make(map[string][]float64),
+			active:  make(map[string]*Anomaly),
+		}
+		a.series.put(key, s, start)
+	}
+	if start.Before(s.first) {
+		s.first = start
+	}
+	return s
+}
+
+// mergeRoutes drops the series of routes that rename folds into a template.
+// Their traffic continues on the template's own series; keeping them would
+// score the silence that follows as an outage, and merging baselines of
+// different sizes would score the template as a spike.
+func (a *AnomalyAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var gone []AnomalyKey
+	a.series.each(func(key AnomalyKey, s *anomalySeries) bool {
+		if key.Scope != ScopeRoute {
+			return true
+		}
+		rk := RouteKey{Host: key.Host, Method: key.Method, Path: key.Path}
+		if rename(rk) == rk {
+			return true
+		}
+		for metric, an := range s.active {
+			end := a.clock
+			an.End, an.Active = &end, false
+			delete(s.active, metric)
+		}
+		gone = append(gone, key)
+		return true
+	})
+	for _, key := range gone {
+		a.series.remove(key)
+	}
+}
+
+func (a *AnomalyAnalyzer) emit(started []Anomaly) {
+	if len(started) == 0 {
+		return
+	}
+	a.mu.Lock()
+	fn := a.onAnomaly
+	a.mu.Unlock()
+	if fn != nil {
+		for _, an := range started {
+			fn(an)
+		}
+	}
+}
+
+// closeBefore evaluates every window from the clock up to end, reading the
+// counts from the rollups. Windows without traffic count as empty; after a
+// long idle period only the last History+1 windows are replayed.
+func (a *AnomalyAnalyzer) closeBefore(end time.Time) []Anomaly {
+	from := a.clock
+	if limit := end.Add(-time.Duration(a.History+1) * a.Step); from.Before(limit) {
+		from = limit
+	}
+	a.clock = end
+
+	buckets := make(map[AnomalyKey]map[int64]*SeriesBucket)
+	src := a.rollups()
+	for _, group := range []string{GroupHost, GroupRoute} {
+		series, _, err := src.Rollup(TemporalQuery{Step: a.Step, GroupBy: []string{group}, From: from, To: end.Add(-1)})
+		if err != nil {
+			continue
+		}
+		for _, sr := range series {
+			if sr.Key.Host == otherSeries {
+				continue // overflow of the rollup's series cap
+			}
+			key := AnomalyKey{Scope: ScopeHost, Host: sr.Key.Host}
+			if group == GroupRoute {
+				key = AnomalyKey{Scope: ScopeRoute, Host: sr.Key.Host, Method: sr.Key.Method, Path: sr.Key.Path}
+			}
+			m := make(map[int64]*SeriesBucket, len(sr.Buckets))
+			for i := range sr.Buckets {
+				b := &sr.Buckets[i]
+				if b.Count == 0 || b.WindowStart.Before(from) || !b.WindowStart.Before(end) {
+					continue
+				}
+				m[b.WindowStart.UnixNano()] = b
+				a.seriesFor(key, b.WindowStart)
+			}
+			buckets[key] = m
+		}
+	}
+
+	var started []Anomaly
+	a.series.each(func(key AnomalyKey, s *anomalySeries) bool {
+		for w := from; w.Before(end); w = w.Add(a.Step) {
+			if w.Before(s.first) {
+				continue
+			}
+			started = append(started, a.evaluate(s, w, buckets[key][w.UnixNano()])...)
+		}
+		for start := range s.samples {
+			if start < end.UnixNano() {
+				delete(s.samples, start)
+			}
+		}
+		return true
+	})
+	return started
+}
+
+// evaluate scores window start of s (b is nil for an empty window) and
+// updates its history.
+func (a *AnomalyAnalyzer) evaluate(s *anomalySeries, start time.Time, b *SeriesBucket) []Anomaly {
+	var count, errors int64
+	if b != nil {
+		count, errors = b.Count, b.Errors
+	}
+	values := map[string]float64{MetricRate: float64(count) / a.Step.Seconds()}
+	if count >= a.MinCount {
+		values[MetricErrorRate] = float64(errors) / float64(count)
+		values[MetricP95] = float64(b.Sketch.Quantile(0.95)) / 1e6
+	}
+	w := s.samples[start.UnixNano()]
+	if w == nil {
+		w = &anomalySamples{}
+	}
+
+	var started []Anomaly
+	for _, metric := range []string{MetricRate, MetricErrorRate, MetricP95} {
+		v, ok := values[metric]
+		hist := s.hist[metric]
+		if ok && len(hist) >= a.MinHistory {
+			med, spread := robustBaseline(hist, metric, a.Step)
+			score := (v - med) / spread
+			dir := "up"
+			if score < 0 {
+				dir = "down"
+			}
+			anomalous := math.Abs(score) >= a.Threshold &&
+				(metric == MetricRate || dir == "up") && // falling errors or latency are good news
+				(dir == "up" || med*a.Step.Seconds() >= float64(a.MinCount)) // ignore drops on quiet series
+			if anomalous {
+				if an := a.record(s, metric, dir, start, w, v, med, score); an != nil {
+					cp := *an
+					cp.Samples = append([]string(nil), an.Samples...)
+					started = append(started, cp)
+				}
+			} else if an := s.active[metric]; an != nil {
+				end := start
+				an.End, an.Active = &end, false
+				delete(s.active, metric)
+			}
+		} else if an := s.active[metric]; an != nil && !ok {
+			// Too few requests to score error rate or p95 any more.
+			end := start
+			an.End, an.Active = &end, false
+			delete(s.active, metric)
+		}
+		if ok {
+			hist = append(hist, v)
+			if len(hist) > a.History {
+				hist = hist[len(hist)-a.History:]
+			}
+			s.hist[metric] = hist
+		}
+	}
+	return started
+}
+
+// record starts or extends an anomaly; it returns the anomaly if it is new.
+func (a *AnomalyAnalyzer) record(s *anomalySeries, metric, dir string, start time.Time, w *anomalySamples, v, med, score float64) *Anomaly {
+	samples := w.ids
+	switch metric {
+	case MetricErrorRate:
+		samples = w.errIDs
+	case MetricP95:
+		sort.Slice(w.slow, func(i, j int) bool { return w.slow[i].lat > w.slow[j].lat })
+		samples = make([]string, len(w.slow))
+		for i, sl := range w.slow {
+			samples[i] = sl.id
+		}
+	}
+
+	if an := s.active[metric]; an != nil && an.Direction == dir {
+		an.Windows++
+		if math.Abs(score) > math.Abs(an.Score) {
+			an.Value, an.Score, an.Magnitude = v, score, magnitude(v, med)
+		}
+		for _, id := range samples {
+			if len(an.Samples) < maxAnomalySamples {
+				an.Samples = append(an.Samples, id)
+			}
+		}
+		return nil
+	}
+
+	a.seq++
+	an := &Anomaly{
+		ID:        strconv.FormatInt(a.seq, 10),
+		Key:       s.key,
+		Metric:    metric,
+		Direction: dir,
+		Start:     start,
+		Active:    true,
+		Windows:   1,
+		Value:     v,
+		Baseline:  med,
+		Score:     score,
+		Magnitude: magnitude(v, med),
+		Samples:   append([]string(nil), samples...),
+	}
+	s.active[metric] = an
+	a.recent = append(a.recent, an)
+	if n := len(a.recent) - maxRecentAnomalies; n > 0 {
+		a.recent = append([]*Anomaly(nil), a.recent[n:]...)
+	}
+	return an
+}
+
+// magnitude is value relative to baseline (2 = doubled); the absolute
+// change when the baseline is zero.
+func magnitude(v, base float64) float64 {
+	if base == 0 {
+		return v
+	}
+	return v / base
+}
+
+// robustBaseline returns the median of hist and a scale for deviations:
+// 1.4826 * MAD (the normal-consistent MAD), floored so that a perfectly
+// flat history does not turn every small wobble into an anomaly.
+func robustBaseline(hist []float64, metric string, step time.Duration) (median, scale float64) {
+	median = medianOf(hist)
+	dev := make([]float64, len(hist))
+	for i, x := range hist {
+		dev[i] = math.Abs(x - median)
+	}
+	scale = 1.4826 * medianOf(dev)
+	floor := 0.1 * median
+	switch metric {
+	case MetricRate:
+		floor = math.Max(floor, 1/step.Seconds()) // one request per window
+	case MetricErrorRate:
+		floor = math.Max(floor, 0.02)
+	case MetricP95:
+		floor = math.Max(floor, 5) // ms
+	}
+	return median, math.Max(scale, floor)
+}
+
+func medianOf(xs []float64) float64 {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// AnomalyFilter narrows Recent.
+type AnomalyFilter struct {
+	ActiveOnly bool
+	Metric     string
+	Host       string
+	Scope      string
+}
+
+// Recent returns up to limit anomalies, newest first.
+func (a *AnomalyAnalyzer) Recent(f AnomalyFilter, limit int) []Anomaly {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []Anomaly
+	for i := len(a.recent) - 1; i >= 0; i-- {
+		an := a.recent[i]
+		if (f.ActiveOnly && !an.Active) ||
+			(f.Metric != "" && an.Metric != f.Metric) ||
+			(f.Host != "" && an.Key.Host != f.Host) ||
+			(f.Scope != "" && an.Key.Scope != f.Scope) {
+			continue
+		}
+		cp := *an
+		cp.Samples = append([]string(nil), an.Samples...)
+		out = append(out, cp)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
+
+// Anomalies returns the AnomalyAnalyzer registered in this registry, if any.
+func (r *Registry) Anomalies() *AnomalyAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if aa, ok := a.(*AnomalyAnalyzer); ok {
+			return aa
+		}
+	}
+	return nil
+}
+
+// Reset forgets all series and recorded anomalies, and the private rollup
+// if the analyzer keeps one.
+func (a *AnomalyAnalyzer) Reset() {
+	a.mu.Lock()
+	a.series.reset()
+	a.recent = nil
+	a.clock = time.Time{}
+	if a.ownSource {
+		a.source.Reset()
+	}
+	a.mu.Unlock()
+}
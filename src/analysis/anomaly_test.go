@@ -0,0 +1,119 @@
+package analysis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAnomalyAnalyzerFlagsErrorRateSpike(t *testing.T) {
+	a := NewAnomalyAnalyzer()
+	var alerts []Anomaly
+	a.SetAnomalyHandler(func(an Anomaly) { alerts = append(alerts, an) })
+
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	id := 0
+	send := func(window, n, failures int) {
+		for i := 0; i < n; i++ {
+			id++
+			status := 200
+			if i < failures {
+				status = 503
+			}
+			a.OnRequest(&ObservedRequest{
+				ID:         strconv.Itoa(id),
+				Timestamp:  base.Add(time.Duration(window)*a.Step + time.Duration(i)*time.Millisecond),
+				Route:      RouteKey{Host: "payments", Method: "POST", Path: "/charge"},
+				StatusCode: status,
+				Outcome:    ClassifyOutcome(status),
+				Latency:    20 * time.Millisecond,
+			})
+		}
+	}
+	for w := 0; w < 10; w++ {
+		send(w, 20, w%2) // steady: 0-5% errors
+	}
+	send(10, 20, 12) // 60% errors
+	send(11, 20, 0)  // closes window 10 and recovers
+	send(12, 20, 0)  // closes window 11
+
+	var errAlerts []Anomaly
+	for _, an := range alerts {
+		if an.Metric == MetricErrorRate {
+			errAlerts = append(errAlerts, an)
+		}
+	}
+	if len(errAlerts) != 2 { // host and route scope
+		t.Fatalf("expected error-rate anomalies for host and route, got %+v", alerts)
+	}
+	an := errAlerts[0]
+	if an.Direction != "up" || an.Value < 0.5 || !an.Start.Equal(base.Add(10*a.Step)) || len(an.Samples) == 0 {
+		t.Fatalf("unexpected anomaly %+v", an)
+	}
+	if an.Samples[0] != "201" {
+		t.Fatalf("samples should be failing captures, got %v", an.Samples)
+	}
+
+	recent := a.Recent(AnomalyFilter{Metric: MetricErrorRate, Scope: ScopeRoute}, 0)
+	if len(recent) != 1 || recent[0].Active || recent[0].End == nil {
+		t.Fatalf("anomaly should have ended after recovery: %+v", recent)
+	}
+	if got := a.Recent(AnomalyFilter{ActiveOnly: true}, 0); len(got) != 0 {
+		t.Fatalf("no anomaly should still be active, got %+v", got)
+	}
+}
+
+func TestAnomalyAnalyzerIgnoresSteadyTraffic(t *testing.T) {
+	a := NewAnomalyAnalyzer()
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	for w := 0; w < 40; w++ {
+		n := 18 + w%5 // mild jitter
+		for i := 0; i < n; i++ {
+			a.OnRequest(&ObservedRequest{
+				Timestamp: base.Add(time.Duration(w)*a.Step + time.Duration(i)*time.Millisecond),
+				Route:     RouteKey{Host: "search", Method: "GET", Path: "/q"},
+				Outcome:   Outcome2xx,
+				Latency:   time.Duration(10+i%7) * time.Millisecond,
+			})
+		}
+	}
+	if got := a.Recent(AnomalyFilter{}, 0); len(got) != 0 {
+		t.Fatalf("steady traffic flagged: %+v", got)
+	}
+}
+
+func TestAnomalyAnalyzerFlagsOutageOnTick(t *testing.T) {
+	reg := NewDefaultRegistry()
+	a := reg.Anomalies()
+	if a == nil || a.ownSource {
+		t.Fatal("registry anomaly analyzer should read the temporal rollups")
+	}
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	send := func(window int) {
+		for i := 0; i < 20; i++ {
+			reg.OnRequest(&ObservedRequest{
+				ID:        strconv.Itoa(window*100 + i),
+				Timestamp: base.Add(time.Duration(window)*a.Step + time.Duration(i)*time.Millisecond),
+				Route:     RouteKey{Host: "orders", Method: "GET", Path: "/list"},
+				Outcome:   Outcome2xx,
+				Latency:   15 * time.Millisecond,
+			})
+		}
+	}
+	for w := 0; w < 10; w++ {
+		send(w)
+	}
+	a.Tick(base.Add(12 * a.Step)) // windows 10 and 11 had no traffic
+
+	active := a.Recent(AnomalyFilter{Metric: MetricRate, Scope: ScopeHost, ActiveOnly: true}, 0)
+	if len(active) != 1 || active[0].Direction != "down" || active[0].Value != 0 || active[0].Windows != 2 {
+		t.Fatalf("expected an active rate drop, got %+v", active)
+	}
+
+	send(12)
+	send(13)
+	a.Tick(base.Add(14 * a.Step))
+	if got := a.Recent(AnomalyFilter{ActiveOnly: true}, 0); len(got) != 0 {
+		t.Fatalf("outage should have ended once traffic returned, got %+v", got)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -25,9 +24,8 @@ type AuthCookieState struct {
 	AuthPresentCount int64
 	AuthMissingCount int64
 
-	// For privacy and cardinality, we do not store the full tokens;
-	// we only track the raw header string counts.
-	// If you prefer, you can truncate or hash.
+	// Raw header string counts, capped at maxValueCounts distinct values
+	// (least frequent dropped first).
 	AuthValues map[string]int64
 
 	// Tracks how often auth presence/value "flaps".
@@ -67,14 +65,16 @@ type AuthCookieSnapshot struct {
 
 // AuthCookieAnalyzer maintains auth/cookie stability state keyed by (ClientID, Host).
 type AuthCookieAnalyzer struct {
-	mu    sync.RWMutex
-	byKey map[AuthCookieKey]*AuthCookieState
+	*boundedBase
+	byKey *boundedMap[AuthCookieKey, *AuthCookieState]
 }
 
 // NewAuthCookieAnalyzer constructs an empty analyzer.
 func NewAuthCookieAnalyzer() *AuthCookieAnalyzer {
+	byKey := newBoundedMap[AuthCookieKey, *AuthCookieState](DefaultLimits)
 	return &AuthCookieAnalyzer{
-		byKey: make(map[AuthCookieKey]*AuthCookieState),
+		boundedBase: newBoundedBase("authcookie", byKey),
+		byKey:       byKey,
 	}
 }
 
@@ -105,14 +105,14 @@ func (a *AuthCookieAnalyzer) OnRequest(ev *ObservedRequest) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	st, ok := a.byKey[key]
+	st, ok := a.byKey.get(key, now)
 	if !ok {
 		st = &AuthCookieState{
 			AuthValues:     make(map[string]int64),
 			CookiePatterns: make(map[string]int64),
 		}
 		st.FirstSeen = now
-		a.byKey[key] = st
+		a.byKey.put(key, st, now)
 	}
 
 	st.LastSeen = now
@@ -121,7 +121,7 @@ func (a *AuthCookieAnalyzer) OnRequest(ev *ObservedRequest) {
 	// --- Authorization stability tracking ---
 	if authPresent {
 		st.AuthPresentCount++
-		st.AuthValues[authVal]++
+		addCount(st.AuthValues, authVal, maxValueCounts)
 	} else {
 		st.AuthMissingCount++
 	}
@@ -141,7 +141,7 @@ func (a *AuthCookieAnalyzer) OnRequest(ev *ObservedRequest) {
 
 	// --- Cookie pattern stability tracking ---
 	if cookiePattern != "" {
-		st.CookiePatterns[cookiePattern]++
+		addCount(st.CookiePatterns, cookiePattern, maxValueCounts)
 	}
 
 	if st.TotalRequests == 1 {
@@ -205,14 +205,14 @@ func (a *AuthCookieAnalyzer) Snapshot(minRequests, minChanges int64) []AuthCooki
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	out := make([]AuthCookieSnapshot, 0, len(a.byKey))
-	for key, st := range a.byKey {
+	out := make([]AuthCookieSnapshot, 0, a.byKey.len())
+	a.byKey.each(func(key AuthCookieKey, st *AuthCookieState) bool {
 		if minRequests > 0 && st.TotalRequests < minRequests {
-			continue
+			return true
 		}
 		totalChanges := st.AuthChangeCount + st.CookiePatternChangeCount
 		if minChanges > 0 && totalChanges < minChanges {
-			continue
+			return true
 		}
 
 		// Copy maps to keep internal state immutable to callers.
@@ -247,7 +247,8 @@ func (a *AuthCookieAnalyzer) Snapshot(minRequests, minChanges int64) []AuthCooki
 			HasCookieDrift:  st.CookiePatternChangeCount > 0,
 		}
 		out = append(out, snap)
-	}
+		return true
+	})
 
 	return out
 }
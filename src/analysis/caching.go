@@ -0,0 +1,497 @@
+package analysis
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// 21. HTTP caching correctness
+//
+
+// Defaults for NewCachingAnalyzer.
+const (
+	DefaultCachingMinRequests = 20  // GET/HEAD requests before a route is flagged
+	DefaultWasteShare         = 0.1 // share of refetches that flags a route
+	maxCachingVary            = 16  // distinct Vary values kept per route
+	cachingUnspecifiedShare   = 0.5 // share of responses without caching headers that flags a route
+	cachingMissingValidators  = 0.5 // share of cacheable 200s without ETag/Last-Modified that flags a route
+)
+
+// Cacheability classes of a response.
+const (
+	CacheNoStore     = "no_store"
+	CachePrivate     = "private"     // explicit lifetime, private caches only
+	CacheNoCache     = "no_cache"    // must revalidate on every use
+	CacheFresh       = "fresh"       // explicit positive lifetime
+	CacheHeuristic   = "heuristic"   // no lifetime given; caches may guess from Last-Modified
+	CacheUnspecified = "unspecified" // no Cache-Control, Expires or Last-Modified
+	CacheUncacheable = "uncacheable" // status not cacheable by default and no lifetime given
+)
+
+// Caching flags.
+const (
+	FlagMissingValidators  = "missing_validators"
+	FlagRedundantFetches   = "refetched_while_fresh"
+	FlagRefetchIdentical   = "refetched_instead_of_revalidated"
+	FlagConditionalIgnored = "conditional_ignored"
+	FlagVaryFragmentation  = "vary_fragmentation"
+	FlagNoCachingHeaders   = "no_caching_headers"
+)
+
+// cachingResourceKey is one URL as seen by one client.
+type cachingResourceKey struct {
+	Client ClientID
+	Host   string
+	Path   string
+	Query  string
+}
+
+// cachingResource is the last full response a client got for a URL.
+type cachingResource struct {
+	hash       uint64
+	size       int64
+	validators bool // ETag or Last-Modified
+	freshUntil time.Time
+}
+
+type cachingState struct {
+	first, last time.Time
+	requests    int64 // GET and HEAD
+	classes     map[string]int64
+	lifetime    *LatencySketch
+
+	ok                int64 // 200 responses
+	etags, weakETags  int64
+	lastModified      int64
+	missingValidators int64 // cacheable 200s with neither validator
+	fromCache         int64 // responses carrying Age
+	vary              map[string]int64
+
+	conditional int64 // requests with If-None-Match / If-Modified-Since
+	notModified int64 // 304s
+
+	refetches          int64 // unconditional requests for a URL the client already had
+	identical          int64 // of which returned the same bytes
+	identicalFresh     int64 // ...while the previous copy was still fresh
+	identicalRevalid   int64 // ...after it went stale, although it carried a validator
+	conditionalIgnored int64 // conditional requests answered with the same bytes in full
+	wastedBytes        int64 // response bytes of identical refetches
+}
+
+// CachingSnapshot is a read-only view of one route.
+type CachingSnapshot struct {
+	Route     RouteKey
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Requests  int64
+
+	// Classes counts full responses by cacheability; Cacheable is the
+	// share that is fresh, private or heuristically cacheable.
+	Classes   map[string]int64
+	Cacheable float64
+	Lifetime  QuantileEstimate // explicit freshness lifetimes
+	Lifetimes int64
+
+	OK                int64
+	ETags             int64
+	WeakETags         int64
+	LastModified      int64
+	MissingValidators int64
+	FromCache         int64
+	Vary              map[string]int64
+
+	Conditional int64
+	NotModified int64
+	HitRatio    float64 // NotModified / Conditional
+
+	Refetches          int64
+	Identical          int64
+	IdenticalFresh     int64
+	IdenticalRevalid   int64
+	ConditionalIgnored int64
+	WastedBytes        int64
+
+	Flags []string
+}
+
+// CachingAnalyzer checks how well each route uses HTTP caching: what its
+// Cache-Control, Expires, ETag, Last-Modified, Vary and Age headers allow,
+// how often clients revalidate and get 304s, and how often they download
+// byte-identical bodies they already had (compared by hash per client and
+// URL), whether still fresh or merely revalidatable.
+type CachingAnalyzer struct {
+	*boundedBase
+	byRoute   *boundedMap[RouteKey, *cachingState]
+	resources *boundedMap[cachingResourceKey, *cachingResource]
+
+	MinRequests int64
+	WasteShare  float64
+}
+
+// NewCachingAnalyzer constructs a CachingAnalyzer with defaults.
+func NewCachingAnalyzer() *CachingAnalyzer {
+	byRoute := newBoundedMap[RouteKey, *cachingState](DefaultLimits)
+	resources := newBoundedMap[cachingResourceKey, *cachingResource](DefaultLimits)
+	return &CachingAnalyzer{
+		boundedBase: newBoundedBase("caching", byRoute, resources),
+		byRoute:     byRoute,
+		resources:   resources,
+		MinRequests: DefaultCachingMinRequests,
+		WasteShare:  DefaultWasteShare,
+	}
+}
+
+// cacheControl splits a Cache-Control header into lower-cased directives.
+func cacheControl(h http.Header) map[string]string {
+	out := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			name, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				out[name] = strings.Trim(strings.TrimSpace(val), `"`)
+			}
+		}
+	}
+	return out
+}
+
+// freshnessLifetime returns the response's explicit lifetime for a private
+// cache (max-age, else Expires - Date) minus its Age, and whether one was
+// given at all.
+func freshnessLifetime(h http.Header, cc map[string]string, received time.Time) (time.Duration, bool) {
+	var life time.Duration
+	switch {
+	case cc["max-age"] != "":
+		n, err := strconv.ParseInt(cc["max-age"], 10, 64)
+		if err != nil {
+			return 0, true // invalid max-age means stale
+		}
+		life = time.Duration(n) * time.Second
+	case h.Get("Expires") != "":
+		exp, err := http.ParseTime(h.Get("Expires"))
+		if err != nil {
+			return 0, true // invalid Expires, e.g. "0", means already expired
+		}
+		date := received
+		if d, err := http.ParseTime(h.Get("Date")); err == nil {
+			date = d
+		}
+		life = exp.Sub(date)
+	default:
+		return 0, false
+	}
+	if age, err := strconv.ParseInt(strings.TrimSpace(h.Get("Age")), 10, 64); err == nil && age > 0 {
+		life -= time.Duration(age) * time.Second
+	}
+	return max(life, 0), true
+}
+
+// heuristicallyCacheable reports whether RFC 9110 lets caches store status
+// without explicit freshness.
+func heuristicallyCacheable(status int) bool {
+	switch status {
+	case 200, 203, 204, 206, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+// classifyCaching names the cacheability of a full response.
+func classifyCaching(h http.Header, cc map[string]string, status int, lifetime time.Duration, explicit bool) string {
+	_, noStore := cc["no-store"]
+	_, private := cc["private"]
+	_, noCache := cc["no-cache"]
+	switch {
+	case noStore:
+		return CacheNoStore
+	case noCache || (explicit && lifetime <= 0):
+		return CacheNoCache
+	case explicit && private:
+		return CachePrivate
+	case explicit:
+		return CacheFresh
+	case !heuristicallyCacheable(status):
+		return CacheUncacheable
+	case len(cc) == 0 && h.Get("Last-Modified") == "":
+		return CacheUnspecified
+	}
+	return CacheHeuristic
+}
+
+// OnRequest ingests an ObservedRequest.
+func (a *CachingAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || ev.StatusCode == 0 {
+		return
+	}
+	if m := strings.ToUpper(ev.Method); m != http.MethodGet && m != http.MethodHead {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	received := now.Add(max(ev.Latency, 0))
+	resp := ev.RespHeaders
+	if resp == nil {
+		resp = http.Header{}
+	}
+	req := ev.ReqHeaders
+	if req == nil {
+		req = http.Header{}
+	}
+	cc := cacheControl(resp)
+	lifetime, explicit := freshnessLifetime(resp, cc, received)
+	conditional := req.Get("If-None-Match") != "" || req.Get("If-Modified-Since") != ""
+	etag := resp.Get("ETag")
+	validators := etag != "" || resp.Get("Last-Modified") != ""
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, ok := a.byRoute.get(ev.Route, now)
+	if !ok {
+		st = &cachingState{
+			first:    now,
+			classes:  make(map[string]int64),
+			lifetime: NewLatencySketch(),
+			vary:     make(map[string]int64),
+		}
+		a.byRoute.put(ev.Route, st, now)
+	}
+	st.requests++
+	if now.After(st.last) {
+		st.last = now
+	}
+	if conditional {
+		st.conditional++
+	}
+	if resp.Get("Age") != "" {
+		st.fromCache++
+	}
+	if v := strings.ToLower(strings.Join(resp.Values("Vary"), ", ")); v != "" {
+		addCount(st.vary, v, maxCachingVary)
+	}
+
+	rkey := cachingResourceKey{Client: ev.Client, Host: ev.Route.Host, Path: ev.ConcretePath(), Query: ev.Query}
+	prev, had := a.resources.get(rkey, now)
+
+	if ev.StatusCode == http.StatusNotModified {
+		st.notModified++
+		// A 304 refreshes the stored copy's freshness.
+		if had && explicit {
+			prev.freshUntil = received.Add(lifetime)
+		}
+		return
+	}
+
+	class := classifyCaching(resp, cc, ev.StatusCode, lifetime, explicit)
+	st.classes[class]++
+	if explicit && lifetime > 0 {
+		st.lifetime.Add(lifetime)
+	}
+	if ev.StatusCode != http.StatusOK {
+		return
+	}
+	st.ok++
+	if etag != "" {
+		st.etags++
+		if strings.HasPrefix(etag, "W/") {
+			st.weakETags++
+		}
+	}
+	if resp.Get("Last-Modified") != "" {
+		st.lastModified++
+	}
+	if !validators && class != CacheNoStore {
+		st.missingValidators++
+	}
+	if ev.RespBodyTruncated || len(ev.RespBody) == 0 {
+		// HEAD, empty or truncated bodies cannot be compared.
+		if had && !conditional {
+			st.refetches++
+		}
+		return
+	}
+
+	cur := &cachingResource{
+		hash:       hashBody(ev.RespBody),
+		size:       ev.RespBytes,
+		validators: validators,
+	}
+	if explicit && class != CacheNoStore && class != CacheNoCache {
+		cur.freshUntil = received.Add(lifetime)
+	}
+	if had {
+		same := prev.hash == cur.hash && prev.size == cur.size
+		switch {
+		case conditional:
+			if same {
+				st.conditionalIgnored++
+				st.wastedBytes += cur.size
+			}
+		default:
+			st.refetches++
+			if same {
+				st.identical++
+				st.wastedBytes += cur.size
+				if now.Before(prev.freshUntil) {
+					st.identicalFresh++
+				} else if prev.validators {
+					st.identicalRevalid++
+				}
+			}
+		}
+	}
+	if class == CacheNoStore {
+		return
+	}
+	a.resources.put(rkey, cur, now)
+}
+
+// merge folds the counts of o into s.
+func (s *cachingState) merge(o *cachingState) {
+	if o.first.Before(s.first) {
+		s.first = o.first
+	}
+	if o.last.After(s.last) {
+		s.last = o.last
+	}
+	s.requests += o.requests
+	mergeCounts(s.classes, o.classes, 0)
+	s.lifetime.Merge(o.lifetime)
+	s.ok += o.ok
+	s.etags += o.etags
+	s.weakETags += o.weakETags
+	s.lastModified += o.lastModified
+	s.missingValidators += o.missingValidators
+	s.fromCache += o.fromCache
+	mergeCounts(s.vary, o.vary, maxCachingVary)
+	s.conditional += o.conditional
+	s.notModified += o.notModified
+	s.refetches += o.refetches
+	s.identical += o.identical
+	s.identicalFresh += o.identicalFresh
+	s.identicalRevalid += o.identicalRevalid
+	s.conditionalIgnored += o.conditionalIgnored
+	s.wastedBytes += o.wastedBytes
+}
+
+func (a *CachingAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byRoute.rekey(rename, (*cachingState).merge)
+	a.mu.Unlock()
+}
+
+// Snapshot returns routes with at least minRequests GET/HEAD requests, most
+// wasted bytes first.
+func (a *CachingAnalyzer) Snapshot(minRequests int64) []CachingSnapshot {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]CachingSnapshot, 0)
+	a.byRoute.each(func(route RouteKey, st *cachingState) bool {
+		if st.requests < minRequests {
+			return true
+		}
+		s := CachingSnapshot{
+			Route:              route,
+			FirstSeen:          st.first,
+			LastSeen:           st.last,
+			Requests:           st.requests,
+			Classes:            make(map[string]int64, len(st.classes)),
+			Lifetime:           st.lifetime.Estimate(),
+			Lifetimes:          st.lifetime.Count(),
+			OK:                 st.ok,
+			ETags:              st.etags,
+			WeakETags:          st.weakETags,
+			LastModified:       st.lastModified,
+			MissingValidators:  st.missingValidators,
+			FromCache:          st.fromCache,
+			Vary:               make(map[string]int64, len(st.vary)),
+			Conditional:        st.conditional,
+			NotModified:        st.notModified,
+			Refetches:          st.refetches,
+			Identical:          st.identical,
+			IdenticalFresh:     st.identicalFresh,
+			IdenticalRevalid:   st.identicalRevalid,
+			ConditionalIgnored: st.conditionalIgnored,
+			WastedBytes:        st.wastedBytes,
+		}
+		var full int64
+		for k, v := range st.classes {
+			s.Classes[k] = v
+			full += v
+		}
+		if full > 0 {
+			s.Cacheable = float64(st.classes[CacheFresh]+st.classes[CachePrivate]+st.classes[CacheHeuristic]) / float64(full)
+		}
+		for k, v := range st.vary {
+			s.Vary[k] = v
+		}
+		if st.conditional > 0 {
+			s.HitRatio = float64(st.notModified) / float64(st.conditional)
+		}
+		s.Flags = a.flags(&s, full)
+		out = append(out, s)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].WastedBytes != out[j].WastedBytes {
+			return out[i].WastedBytes > out[j].WastedBytes
+		}
+		return out[i].Requests > out[j].Requests
+	})
+	return out
+}
+
+// flags names the caching problems of s; the caller holds the lock.
+func (a *CachingAnalyzer) flags(s *CachingSnapshot, full int64) []string {
+	if s.Requests < a.MinRequests {
+		return nil
+	}
+	var out []string
+	if validatable := s.OK - s.Classes[CacheNoStore]; validatable > 0 && float64(s.MissingValidators) >= cachingMissingValidators*float64(validatable) {
+		out = append(out, FlagMissingValidators)
+	}
+	if s.Refetches > 0 {
+		if float64(s.IdenticalFresh) >= a.WasteShare*float64(s.Refetches) && s.IdenticalFresh > 0 {
+			out = append(out, FlagRedundantFetches)
+		}
+		if float64(s.IdenticalRevalid) >= a.WasteShare*float64(s.Refetches) && s.IdenticalRevalid > 0 {
+			out = append(out, FlagRefetchIdentical)
+		}
+	}
+	if s.ConditionalIgnored > 0 {
+		out = append(out, FlagConditionalIgnored)
+	}
+	for v := range s.Vary {
+		if strings.Contains(v, "*") || strings.Contains(v, "user-agent") || strings.Contains(v, "cookie") {
+			out = append(out, FlagVaryFragmentation)
+			break
+		}
+	}
+	if full > 0 && float64(s.Classes[CacheUnspecified]) >= cachingUnspecifiedShare*float64(full) {
+		out = append(out, FlagNoCachingHeaders)
+	}
+	return out
+}
+
+// Caching returns the CachingAnalyzer registered in this registry, if any.
+func (r *Registry) Caching() *CachingAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if ca, ok := a.(*CachingAnalyzer); ok {
+			return ca
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCachingRevalidationAndIdenticalRefetches(t *testing.T) {
+	a := NewCachingAnalyzer()
+	a.MinRequests = 1
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	send := func(path string, at time.Duration, conditional bool, status int, resp http.Header, body string) {
+		req := http.Header{}
+		if conditional {
+			req.Set("If-None-Match", `"v1"`)
+		}
+		a.OnRequest(&ObservedRequest{
+			Timestamp:   base.Add(at),
+			Client:      ClientID{IP: "10.0.0.1"},
+			Route:       RouteKey{Host: "cdn", Method: "GET", Path: path},
+			Method:      "GET",
+			Path:        path,
+			StatusCode:  status,
+			ReqHeaders:  req,
+			RespHeaders: resp,
+			RespBody:    []byte(body),
+			RespBytes:   int64(len(body)),
+		})
+	}
+	logo := func() http.Header {
+		return http.Header{"Cache-Control": {"public, max-age=60"}, "Etag": {`"v1"`}}
+	}
+
+	send("/logo", 0, false, 200, logo(), "PNG-BYTES")
+	send("/logo", 10*time.Second, false, 200, logo(), "PNG-BYTES")           // still fresh
+	send("/logo", 2*time.Minute, false, 200, logo(), "PNG-BYTES")            // stale, could have revalidated
+	send("/logo", 3*time.Minute, true, 304, logo(), "")                      // revalidated
+	send("/logo", 4*time.Minute+time.Second, true, 200, logo(), "PNG-BYTES") // validator ignored
+
+	feed := http.Header{"Vary": {"User-Agent"}}
+	send("/feed", 0, false, 200, feed, "a")
+	send("/feed", time.Second, false, 200, feed, "b")
+
+	snap := a.Snapshot(0)
+	if len(snap) != 2 {
+		t.Fatalf("want 2 routes, got %d", len(snap))
+	}
+	logoS, feedS := snap[0], snap[1]
+	if logoS.Route.Path != "/logo" || logoS.Requests != 5 || logoS.Classes[CacheFresh] != 4 || logoS.Cacheable != 1 {
+		t.Fatalf("logo = %+v", logoS)
+	}
+	if logoS.Conditional != 2 || logoS.NotModified != 1 || logoS.HitRatio != 0.5 || logoS.ETags != 4 || logoS.MissingValidators != 0 {
+		t.Fatalf("logo revalidation = %+v", logoS)
+	}
+	if logoS.Refetches != 2 || logoS.IdenticalFresh != 1 || logoS.IdenticalRevalid != 1 || logoS.ConditionalIgnored != 1 || logoS.WastedBytes != 27 {
+		t.Fatalf("logo refetches = %+v", logoS)
+	}
+	want := map[string]bool{FlagRedundantFetches: true, FlagRefetchIdentical: true, FlagConditionalIgnored: true}
+	if len(logoS.Flags) != len(want) {
+		t.Fatalf("logo flags = %v", logoS.Flags)
+	}
+	for _, f := range logoS.Flags {
+		if !want[f] {
+			t.Fatalf("unexpected flag %q in %v", f, logoS.Flags)
+		}
+	}
+
+	if feedS.Classes[CacheUnspecified] != 2 || feedS.Refetches != 1 || feedS.Identical != 0 || feedS.MissingValidators != 2 {
+		t.Fatalf("feed = %+v", feedS)
+	}
+	want = map[string]bool{FlagMissingValidators: true, FlagVaryFragmentation: true, FlagNoCachingHeaders: true}
+	if len(feedS.Flags) != len(want) {
+		t.Fatalf("feed flags = %v", feedS.Flags)
+	}
+	for _, f := range feedS.Flags {
+		if !want[f] {
+			t.Fatalf("unexpected flag %q in %v", f, feedS.Flags)
+		}
+	}
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	h := http.Header{"Age": {"30"}}
+	if d, ok := freshnessLifetime(h, map[string]string{"max-age": "120"}, now); !ok || d != 90*time.Second {
+		t.Fatalf("max-age with age = %v %v", d, ok)
+	}
+	h = http.Header{"Date": {now.Format(http.TimeFormat)}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}
+	if d, ok := freshnessLifetime(h, nil, now.Add(time.Minute)); !ok || d != time.Hour {
+		t.Fatalf("expires = %v %v", d, ok)
+	}
+	if d, ok := freshnessLifetime(http.Header{"Expires": {"0"}}, nil, now); !ok || d != 0 {
+		t.Fatalf("invalid expires = %v %v", d, ok)
+	}
+	if _, ok := freshnessLifetime(http.Header{}, nil, now); ok {
+		t.Fatal("lifetime without headers")
+	}
+}
@@ -3,7 +3,6 @@ package analysis
 import (
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -73,14 +72,16 @@ type ClientFingerprintSnapshot struct {
 
 // ClientFingerprintAnalyzer tracks per-client fingerprint evolution.
 type ClientFingerprintAnalyzer struct {
-	mu       sync.RWMutex
-	byClient map[fingerprintKey]*ClientFingerprint
+	*boundedBase
+	byClient *boundedMap[fingerprintKey, *ClientFingerprint]
 }
 
 // NewClientFingerprintAnalyzer constructs an empty analyzer.
 func NewClientFingerprintAnalyzer() *ClientFingerprintAnalyzer {
+	byClient := newBoundedMap[fingerprintKey, *ClientFingerprint](DefaultLimits)
 	return &ClientFingerprintAnalyzer{
-		byClient: make(map[fingerprintKey]*ClientFingerprint),
+		boundedBase: newBoundedBase("clientfingerprint", byClient),
+		byClient:    byClient,
 	}
 }
 
@@ -106,7 +107,7 @@ func (a *ClientFingerprintAnalyzer) OnRequest(ev *ObservedRequest) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	fp, ok := a.byClient[key]
+	fp, ok := a.byClient.get(key, now)
 	if !ok {
 		fp = &ClientFingerprint{
 			FirstSeen:       now,
@@ -114,7 +115,7 @@ func (a *ClientFingerprintAnalyzer) OnRequest(ev *ObservedRequest) {
 			TLSSignatures:   make(map[TLSSignature]int64),
 			HeaderKeyCounts: make(map[string]int64),
 		}
-		a.byClient[key] = fp
+		a.byClient.put(key, fp, now)
 	}
 
 	fp.LastSeen = now
@@ -128,7 +129,7 @@ func (a *ClientFingerprintAnalyzer) OnRequest(ev *ObservedRequest) {
 		fp.CurrentUA = ua
 	}
 	if ua != "" {
-		fp.UserAgents[ua]++
+		addCount(fp.UserAgents, ua, maxValueCounts)
 	}
 
 	// TLS drift (only if we got a non-zero TLS signature)
@@ -139,7 +140,7 @@ func (a *ClientFingerprintAnalyzer) OnRequest(ev *ObservedRequest) {
 			fp.TLSChangeCount++
 			fp.CurrentTLS = tls
 		}
-		fp.TLSSignatures[tls]++
+		addCount(fp.TLSSignatures, tls, maxValueCounts)
 	}
 
 	// Header shape: count which headers tend to appear
@@ -166,7 +167,7 @@ func recordHeaderKeys(m map[string]int64, h http.Header) {
 		}
 		// Normalize to canonical header key representation.
 		ck := http.CanonicalHeaderKey(k)
-		m[ck]++
+		addCount(m, ck, maxValueCounts)
 	}
 }
 
@@ -182,11 +183,11 @@ func (a *ClientFingerprintAnalyzer) Snapshot(minChanges int64) []ClientFingerpri
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	out := make([]ClientFingerprintSnapshot, 0, len(a.byClient))
-	for key, fp := range a.byClient {
+	out := make([]ClientFingerprintSnapshot, 0, a.byClient.len())
+	a.byClient.each(func(key fingerprintKey, fp *ClientFingerprint) bool {
 		totalChanges := fp.UAChangeCount + fp.TLSChangeCount
 		if minChanges > 0 && totalChanges < minChanges {
-			continue
+			return true
 		}
 
 		// Copy maps to keep internal state immutable to callers.
@@ -227,7 +228,8 @@ func (a *ClientFingerprintAnalyzer) Snapshot(minChanges int64) []ClientFingerpri
 		}
 
 		out = append(out, snap)
-	}
+		return true
+	})
 	return out
 }
 
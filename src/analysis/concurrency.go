@@ -0,0 +1,452 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+//
+// 18. In-flight concurrency and connection pool saturation
+//
+
+// Concurrency scopes.
+const (
+	ScopeAll    = "all"
+	ScopeClient = "client"
+	// ScopeHost is shared with the anomaly analyzer.
+)
+
+// Defaults for NewConcurrencyAnalyzer.
+const (
+	DefaultConcurrencyStep    = time.Second
+	DefaultConcurrencyBuckets = 300
+	DefaultConcurrencyHorizon = time.Minute           // how long finished requests are kept for overlap counting
+	DefaultPoolWait           = 50 * time.Millisecond // GotConn wait beyond dialing that counts as queueing
+	DefaultConcurrencyMin     = 20                    // requests before a key is flagged
+	maxConcurrencyIntervals   = 1024                  // per key
+)
+
+// Concurrency flags.
+const (
+	FlagTTFBGrowsWithConcurrency = "ttfb_grows_with_concurrency"
+	FlagConnPoolWait             = "conn_pool_wait"
+)
+
+// ConcurrencyKey identifies one concurrency series. For ScopeAll both Host
+// and Client are empty; for ScopeHost only Host is set.
+type ConcurrencyKey struct {
+	Scope  string
+	Host   string
+	Client ClientID
+}
+
+// concInterval is one finished request.
+type concInterval struct {
+	start, end time.Time
+	ttfb       time.Duration
+	peak       int // requests in flight when this one started, itself included
+}
+
+// ConcurrencyPoint is one timeline window.
+type ConcurrencyPoint struct {
+	Start   time.Time
+	Mean    float64 // average requests in flight over the window
+	Peak    int     // most requests in flight at any request start in the window
+	Started int64
+}
+
+type concBucket struct {
+	busy    time.Duration // summed request time overlapping the window
+	peak    int
+	started int64
+}
+
+type concurrencyState struct {
+	first, last time.Time
+	requests    int64
+	busy        time.Duration
+	peak        int
+	peakAt      time.Time
+	intervals   []concInterval // newest end last
+	timeline    map[int64]*concBucket
+
+	// Connection acquisition: GotConn wait vs. the dial (dns+connect+tls)
+	// it contained.
+	wait      *LatencySketch
+	dial      *LatencySketch
+	waited    int64 // requests with a measured wait
+	poolWaits int64 // of which waited PoolWait longer than their dial
+}
+
+// ConcurrencySnapshot is a read-only view of one key.
+type ConcurrencySnapshot struct {
+	Key       ConcurrencyKey
+	Requests  int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Mean is the time-averaged number of requests in flight while the key
+	// was active; Peak the most at once.
+	Mean   float64
+	Peak   int
+	PeakAt time.Time
+
+	// TTFB against concurrency at request start, over the retained
+	// requests: Pearson correlation, least-squares slope (ms per extra
+	// request in flight), and mean TTFB per concurrency level.
+	TTFBCorrelation float64
+	TTFBSlopeMs     float64
+	TTFBByLevel     []ConcurrencyLevel
+
+	ConnWait  QuantileEstimate
+	Dial      QuantileEstimate
+	Waited    int64
+	PoolWaits int64
+
+	Flags []string
+}
+
+// ConcurrencyLevel is the mean TTFB of requests that started with between
+// Min and Max requests in flight (Max 0 = unbounded).
+type ConcurrencyLevel struct {
+	Min, Max int
+	Count    int64
+	MeanTTFB time.Duration
+}
+
+var concurrencyLevels = [][2]int{{1, 1}, {2, 4}, {5, 8}, {9, 16}, {17, 32}, {33, 0}}
+
+// ConcurrencyAnalyzer reconstructs how many requests were in flight at once,
+// per client, per upstream host and overall, from each request's start
+// time and duration. Requests are reported when they finish, so a request's
+// own concurrency count keeps growing while later-finishing overlaps arrive.
+type ConcurrencyAnalyzer struct {
+	*boundedBase
+	byKey *boundedMap[ConcurrencyKey, *concurrencyState]
+
+	Step        time.Duration
+	Buckets     int
+	Horizon     time.Duration
+	PoolWait    time.Duration
+	MinRequests int64
+}
+
+// NewConcurrencyAnalyzer constructs a ConcurrencyAnalyzer with defaults.
+func NewConcurrencyAnalyzer() *ConcurrencyAnalyzer {
+	byKey := newBoundedMap[ConcurrencyKey, *concurrencyState](DefaultLimits)
+	return &ConcurrencyAnalyzer{
+		boundedBase: newBoundedBase("concurrency", byKey),
+		byKey:       byKey,
+		Step:        DefaultConcurrencyStep,
+		Buckets:     DefaultConcurrencyBuckets,
+		Horizon:     DefaultConcurrencyHorizon,
+		PoolWait:    DefaultPoolWait,
+		MinRequests: DefaultConcurrencyMin,
+	}
+}
+
+// OnRequest ingests an ObservedRequest.
+func (a *ConcurrencyAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || ev.Timestamp.IsZero() {
+		return
+	}
+	lat := ev.Latency
+	if lat < 0 {
+		lat = 0
+	}
+	iv := concInterval{start: ev.Timestamp, end: ev.Timestamp.Add(lat), ttfb: ev.Phases.TTFB}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range []ConcurrencyKey{
+		{Scope: ScopeAll},
+		{Scope: ScopeHost, Host: ev.Route.Host},
+		{Scope: ScopeClient, Client: ev.Client},
+	} {
+		if key.Scope == ScopeHost && key.Host == "" {
+			continue
+		}
+		st, ok := a.byKey.get(key, iv.end)
+		if !ok {
+			st = &concurrencyState{
+				first:    iv.start,
+				timeline: make(map[int64]*concBucket),
+				wait:     NewLatencySketch(),
+				dial:     NewLatencySketch(),
+			}
+			a.byKey.put(key, st, iv.end)
+		}
+		a.add(st, iv)
+		if key.Scope != ScopeClient {
+			a.addWait(st, ev.Phases)
+		}
+	}
+}
+
+func (a *ConcurrencyAnalyzer) addWait(st *concurrencyState, ph PhaseTimings) {
+	if ph.ConnWait <= 0 {
+		return
+	}
+	dial := ph.DNS + ph.Connect + ph.TLS
+	st.wait.Add(ph.ConnWait)
+	if dial > 0 {
+		st.dial.Add(dial)
+	}
+	st.waited++
+	if ph.ConnWait-dial > a.PoolWait {
+		st.poolWaits++
+	}
+}
+
+// add records iv in st; the caller holds the lock.
+func (a *ConcurrencyAnalyzer) add(st *concurrencyState, iv concInterval) {
+	st.requests++
+	if iv.start.Before(st.first) {
+		st.first = iv.start
+	}
+	if iv.end.After(st.last) {
+		st.last = iv.end
+	}
+	st.busy += iv.end.Sub(iv.start)
+
+	// Overlaps with the retained requests: iv's own count is everything
+	// running at its start; requests that started while iv ran gain one.
+	iv.peak = 1
+	for i := range st.intervals {
+		o := &st.intervals[i]
+		if !o.start.After(iv.start) && o.end.After(iv.start) {
+			iv.peak++
+		}
+		if !o.start.Before(iv.start) && o.start.Before(iv.end) {
+			o.peak++
+			a.notePeak(st, o)
+		}
+	}
+	a.notePeak(st, &iv)
+
+	a.spread(st, iv)
+	st.intervals = append(st.intervals, iv)
+
+	// Forget requests that ended long before the newest one; later arrivals
+	// can no longer overlap them.
+	cut := st.last.Add(-a.Horizon)
+	keep := st.intervals[:0]
+	for _, o := range st.intervals {
+		if o.end.After(cut) {
+			keep = append(keep, o)
+		}
+	}
+	st.intervals = keep
+	if n := len(st.intervals); n > maxConcurrencyIntervals {
+		st.intervals = append(st.intervals[:0], st.intervals[n-maxConcurrencyIntervals:]...)
+	}
+}
+
+func (a *ConcurrencyAnalyzer) notePeak(st *concurrencyState, iv *concInterval) {
+	if iv.peak > st.peak {
+		st.peak = iv.peak
+		st.peakAt = iv.start
+	}
+	if b := a.bucket(st, iv.start); b != nil && iv.peak > b.peak {
+		b.peak = iv.peak
+	}
+}
+
+func (a *ConcurrencyAnalyzer) bucket(st *concurrencyState, t time.Time) *concBucket {
+	if a.Step <= 0 || a.Buckets <= 0 {
+		return nil
+	}
+	idx := t.UnixNano() / int64(a.Step)
+	newest := st.last.UnixNano() / int64(a.Step)
+	if idx <= newest-int64(a.Buckets) {
+		return nil
+	}
+	b := st.timeline[idx]
+	if b == nil {
+		b = &concBucket{}
+		st.timeline[idx] = b
+		for k := range st.timeline {
+			if k <= newest-int64(a.Buckets) {
+				delete(st.timeline, k)
+			}
+		}
+	}
+	return b
+}
+
+// spread adds iv's running time to every timeline window it overlaps.
+func (a *ConcurrencyAnalyzer) spread(st *concurrencyState, iv concInterval) {
+	if b := a.bucket(st, iv.start); b != nil {
+		b.started++
+	}
+	if a.Step <= 0 || a.Buckets <= 0 {
+		return
+	}
+	start := iv.start
+	oldest := st.last.Truncate(a.Step).Add(-a.Step * time.Duration(a.Buckets-1))
+	if start.Before(oldest) {
+		start = oldest
+	}
+	for t := start.Truncate(a.Step); t.Before(iv.end); t = t.Add(a.Step) {
+		from, to := t, t.Add(a.Step)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(iv.end) {
+			to = iv.end
+		}
+		if b := a.bucket(st, t); b != nil && to.After(from) {
+			b.busy += to.Sub(from)
+		}
+	}
+}
+
+// Snapshot returns every key of the given scope ("" = all scopes) with at
+// least minRequests requests, busiest peak first.
+func (a *ConcurrencyAnalyzer) Snapshot(scope string, minRequests int64) []ConcurrencySnapshot {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]ConcurrencySnapshot, 0)
+	a.byKey.each(func(key ConcurrencyKey, st *concurrencyState) bool {
+		if (scope != "" && key.Scope != scope) || st.requests < minRequests {
+			return true
+		}
+		s := ConcurrencySnapshot{
+			Key:       key,
+			Requests:  st.requests,
+			FirstSeen: st.first,
+			LastSeen:  st.last,
+			Peak:      st.peak,
+			PeakAt:    st.peakAt,
+			ConnWait:  st.wait.Estimate(),
+			Dial:      st.dial.Estimate(),
+			Waited:    st.waited,
+			PoolWaits: st.poolWaits,
+		}
+		if span := st.last.Sub(st.first); span > 0 {
+			s.Mean = float64(st.busy) / float64(span)
+		}
+		s.TTFBCorrelation, s.TTFBSlopeMs, s.TTFBByLevel = ttfbVsConcurrency(st.intervals)
+		s.Flags = a.flags(&s)
+		out = append(out, s)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Peak != out[j].Peak {
+			return out[i].Peak > out[j].Peak
+		}
+		return out[i].Requests > out[j].Requests
+	})
+	return out
+}
+
+// ttfbVsConcurrency regresses TTFB on the concurrency at request start.
+func ttfbVsConcurrency(ivs []concInterval) (corr, slopeMs float64, levels []ConcurrencyLevel) {
+	var n, sx, sy, sxx, syy, sxy float64
+	sums := make([]time.Duration, len(concurrencyLevels))
+	counts := make([]int64, len(concurrencyLevels))
+	for _, iv := range ivs {
+		if iv.ttfb <= 0 {
+			continue
+		}
+		x, y := float64(iv.peak), float64(iv.ttfb)/1e6
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		syy += y * y
+		sxy += x * y
+		for i, l := range concurrencyLevels {
+			if iv.peak >= l[0] && (l[1] == 0 || iv.peak <= l[1]) {
+				sums[i] += iv.ttfb
+				counts[i]++
+				break
+			}
+		}
+	}
+	for i, l := range concurrencyLevels {
+		if counts[i] > 0 {
+			levels = append(levels, ConcurrencyLevel{Min: l[0], Max: l[1], Count: counts[i], MeanTTFB: sums[i] / time.Duration(counts[i])})
+		}
+	}
+	if n < 2 {
+		return 0, 0, levels
+	}
+	vx := n*sxx - sx*sx
+	vy := n*syy - sy*sy
+	if vx <= 0 {
+		return 0, 0, levels
+	}
+	slopeMs = (n*sxy - sx*sy) / vx
+	if vy > 0 {
+		corr = (n*sxy - sx*sy) / math.Sqrt(vx*vy)
+	}
+	return corr, slopeMs, levels
+}
+
+// flags names the queueing symptoms of s; the caller holds the lock.
+func (a *ConcurrencyAnalyzer) flags(s *ConcurrencySnapshot) []string {
+	if s.Requests < a.MinRequests {
+		return nil
+	}
+	var out []string
+	if len(s.TTFBByLevel) > 1 && s.TTFBCorrelation >= 0.5 && s.TTFBSlopeMs > 0 {
+		out = append(out, FlagTTFBGrowsWithConcurrency)
+	}
+	if s.Waited > 0 && s.PoolWaits*10 >= s.Waited {
+		out = append(out, FlagConnPoolWait)
+	}
+	return out
+}
+
+// Timeline returns the windows of key between from and to (zero = open),
+// oldest first. Windows without traffic are included as zero points.
+func (a *ConcurrencyAnalyzer) Timeline(key ConcurrencyKey, from, to time.Time) []ConcurrencyPoint {
+	if a == nil || a.Step <= 0 {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	st, ok := a.byKey.peek(key)
+	if !ok || len(st.timeline) == 0 {
+		return nil
+	}
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	for k := range st.timeline {
+		first = min(first, k)
+		last = max(last, k)
+	}
+	out := make([]ConcurrencyPoint, 0, last-first+1)
+	for k := first; k <= last; k++ {
+		start := time.Unix(0, k*int64(a.Step)).UTC()
+		if (!from.IsZero() && start.Add(a.Step).Before(from)) || (!to.IsZero() && start.After(to)) {
+			continue
+		}
+		p := ConcurrencyPoint{Start: start}
+		if b := st.timeline[k]; b != nil {
+			p.Mean = float64(b.busy) / float64(a.Step)
+			p.Peak = b.peak
+			p.Started = b.started
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// Concurrency returns the ConcurrencyAnalyzer registered in this registry, if any.
+func (r *Registry) Concurrency() *ConcurrencyAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if ca, ok := a.(*ConcurrencyAnalyzer); ok {
+			return ca
+		}
+	}
+	return nil
+}
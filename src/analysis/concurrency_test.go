@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConcurrencyPeaksAndTimeline(t *testing.T) {
+	a := NewConcurrencyAnalyzer()
+	a.MinRequests = 1
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	send := func(client string, start, dur time.Duration) {
+		a.OnRequest(&ObservedRequest{
+			Timestamp: base.Add(start),
+			Latency:   dur,
+			Client:    ClientID{IP: client},
+			Route:     RouteKey{Host: "api", Method: "GET", Path: "/"},
+			Phases:    PhaseTimings{TTFB: dur / 2},
+		})
+	}
+
+	// Reported at completion: the long request arrives last, so the two
+	// that started while it ran must still count it.
+	send("10.0.0.1", 100*time.Millisecond, 200*time.Millisecond)
+	send("10.0.0.2", 200*time.Millisecond, 200*time.Millisecond)
+	send("10.0.0.1", 0, 2*time.Second)
+
+	var host, client ConcurrencySnapshot
+	for _, s := range a.Snapshot("", 0) {
+		switch {
+		case s.Key.Scope == ScopeHost:
+			host = s
+		case s.Key.Scope == ScopeClient && s.Key.Client.IP == "10.0.0.1":
+			client = s
+		}
+	}
+	if host.Requests != 3 || host.Peak != 3 || !host.PeakAt.Equal(base.Add(200*time.Millisecond)) {
+		t.Fatalf("host = %+v", host)
+	}
+	if client.Requests != 2 || client.Peak != 2 {
+		t.Fatalf("client = %+v", client)
+	}
+
+	// 1.4s of request time in the first 1s window, 1s in the second.
+	tl := a.Timeline(ConcurrencyKey{Scope: ScopeHost, Host: "api"}, time.Time{}, time.Time{})
+	if len(tl) != 2 || tl[0].Mean != 1.4 || tl[0].Peak != 3 || tl[0].Started != 3 || tl[1].Mean != 1 {
+		t.Fatalf("timeline = %+v", tl)
+	}
+	if got := a.Timeline(ConcurrencyKey{Scope: ScopeHost, Host: "api"}, base.Add(1500*time.Millisecond), time.Time{}); len(got) != 1 {
+		t.Fatalf("from-bounded timeline = %+v", got)
+	}
+}
+
+func TestConcurrencyQueueingFlags(t *testing.T) {
+	a := NewConcurrencyAnalyzer()
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	// Bursts of growing size; TTFB grows with the burst, and every request
+	// waits far longer for its connection than dialing takes.
+	at := time.Duration(0)
+	for burst := 1; burst <= 6; burst++ {
+		for i := 0; i < burst; i++ {
+			ttfb := time.Duration(burst) * 20 * time.Millisecond
+			a.OnRequest(&ObservedRequest{
+				Timestamp: base.Add(at),
+				Latency:   ttfb + 100*time.Millisecond,
+				Client:    ClientID{IP: "10.0.0.1"},
+				Route:     RouteKey{Host: "pool", Method: "GET", Path: "/"},
+				Phases: PhaseTimings{
+					Connect:  5 * time.Millisecond,
+					ConnWait: 80 * time.Millisecond,
+					TTFB:     ttfb,
+				},
+			})
+		}
+		at += 5 * time.Second
+	}
+
+	snap := a.Snapshot(ScopeHost, 0)
+	if len(snap) != 1 {
+		t.Fatalf("want 1 host, got %d", len(snap))
+	}
+	s := snap[0]
+	if s.Peak != 6 || s.TTFBCorrelation < 0.9 || s.TTFBSlopeMs < 15 {
+		t.Fatalf("peak=%d corr=%v slope=%v", s.Peak, s.TTFBCorrelation, s.TTFBSlopeMs)
+	}
+	if s.Waited != 21 || s.PoolWaits != 21 {
+		t.Fatalf("waited=%d pool waits=%d", s.Waited, s.PoolWaits)
+	}
+	want := map[string]bool{FlagTTFBGrowsWithConcurrency: true, FlagConnPoolWait: true}
+	if len(s.Flags) != len(want) {
+		t.Fatalf("flags = %v", s.Flags)
+	}
+	for _, f := range s.Flags {
+		if !want[f] {
+			t.Fatalf("unexpected flag %q in %v", f, s.Flags)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// 15. Registry configuration
+//
+
+// ParamSpec documents one tunable parameter of an analyzer.
+type ParamSpec struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	Help    string `json:"help"`
+}
+
+// AnalyzerSpec describes an analyzer that can be enabled by name.
+type AnalyzerSpec struct {
+	Name        string
+	Description string
+	// Heavy marks analyzers that are expensive per request (body parsing,
+	// per-client histograms); worth switching off on busy proxies.
+	Heavy bool
+	// Disabled analyzers are only built when a config enables them.
+	Disabled bool
+	Params   []ParamSpec
+	New      func(p Params) (Analyzer, error)
+}
+
+// Params holds an analyzer's effective parameters (defaults merged with
+// overrides), as strings.
+type Params map[string]string
+
+// Int parses the named parameter as an integer.
+func (p Params) Int(name string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(p[name]))
+	if err != nil {
+		return 0, fmt.Errorf("%s: want an integer, got %q", name, p[name])
+	}
+	return n, nil
+}
+
+// Float parses the named parameter as a number.
+func (p Params) Float(name string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(p[name]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: want a number, got %q", name, p[name])
+	}
+	return f, nil
+}
+
+// Duration parses the named parameter as a duration ("30s", "1h").
+func (p Params) Duration(name string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(p[name]))
+	if err != nil {
+		return 0, fmt.Errorf("%s: want a duration like 30s, got %q", name, p[name])
+	}
+	return d, nil
+}
+
+// limitParams are accepted by every analyzer that implements
+// BoundedAnalyzer and override the registry-wide Limits for it.
+var limitParams = []ParamSpec{
+	{Name: "max_entries", Help: "keys kept before LRU eviction (0 = unlimited)"},
+	{Name: "max_age", Help: "drop keys idle for this long (0 = keep forever)"},
+}
+
+var (
+	specsMu sync.RWMutex
+	specs   = builtinAnalyzers()
+)
+
+func builtinAnalyzers() []AnalyzerSpec {
+	simple := func(fn func() Analyzer) func(Params) (Analyzer, error) {
+		return func(Params) (Analyzer, error) { return fn(), nil }
+	}
+	return []AnalyzerSpec{
+		{
+			Name:        "temporal",
+			Description: "request rate and latency in fixed time buckets",
+			Params: []ParamSpec{
+				{Name: "resolution", Default: "1s", Help: "bucket width"},
+				{Name: "buckets", Default: "300", Help: "number of buckets kept"},
+				{Name: "rollups", Default: FormatResolutions(DefaultResolutions), Help: "per-series rollup tiers as step:buckets, or off"},
+				{Name: "max_series", Default: strconv.Itoa(DefaultMaxSeries), Help: "series per rollup window before folding into host \"other\" (0 = unlimited)"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				res, err := p.Duration("resolution")
+				if err != nil {
+					return nil, err
+				}
+				n, err := p.Int("buckets")
+				if err != nil {
+					return nil, err
+				}
+				rollups, err := ParseResolutions(p["rollups"])
+				if err != nil {
+					return nil, err
+				}
+				maxSeries, err := p.Int("max_series")
+				if err != nil {
+					return nil, err
+				}
+				t := NewTemporalAnalyzer(res, n)
+				t.SetRollups(rollups, maxSeries)
+				return t, nil
+			},
+		},
+		{
+			Name:        "retry",
+			Description: "bursts of identical requests from one client",
+			Params: []ParamSpec{
+				{Name: "window", Default: "30s", Help: "maximum gap between requests of one burst"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				w, err := p.Duration("window")
+				if err != nil {
+					return nil, err
+				}
+				return NewRetryAnalyzer(w), nil
+			},
+		},
+		{Name: "latency", Description: "per-route latency percentiles and phases", New: simple(func() Analyzer { return NewLatencyAnalyzer() })},
+		{Name: "errortransitions", Description: "per-client outcome transitions and error streaks", New: simple(func() Analyzer { return NewErrorTransitionAnalyzer() })},
+		{Name: "size", Description: "per-route request and response sizes", New: simple(func() Analyzer { return NewSizeAnalyzer() })},
+		{Name: "clientfingerprint", Description: "per-client user agent, TLS and header drift", Heavy: true, New: simple(func() Analyzer { return NewClientFingerprintAnalyzer() })},
+		{Name: "methodpath", Description: "method/path usage and anomalies", New: simple(func() Analyzer { return NewMethodPathAnalyzer() })},
+		{Name: "authcookie", Description: "authorization and cookie stability per client and host", Heavy: true, New: simple(func() Analyzer { return NewAuthCookieAnalyzer() })},
+		{Name: "responseprofile", Description: "per-route content types, encodings and status mix", New: simple(func() Analyzer { return NewResponseProfileAnalyzer() })},
+		{Name: "contract", Description: "OpenAPI contract violations per route", New: simple(func() Analyzer { return NewContractAnalyzer() })},
+		{Name: "coverage", Description: "OpenAPI operation coverage", New: simple(func() Analyzer { return NewCoverageAnalyzer() })},
+		{
+			Name:        "schema",
+			Description: "JSON body schema inference and drift",
+			Heavy:       true,
+			Params: []ParamSpec{
+				{Name: "min_samples", Default: strconv.Itoa(DefaultSchemaMinSamples), Help: "samples learned before drift is reported"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				n, err := p.Int("min_samples")
+				if err != nil {
+					return nil, err
+				}
+				a := NewSchemaDriftAnalyzer()
+				a.MinSamples = int64(n)
+				return a, nil
+			},
+		},
+		{
+			Name:        "anomaly",
+			Description: "rate, error rate and p95 latency shifts per host and route",
+			Params: []ParamSpec{
+				{Name: "step", Default: DefaultAnomalyStep.String(), Help: "window width"},
+				{Name: "history", Default: strconv.Itoa(DefaultAnomalyHistory), Help: "windows in the baseline"},
+				{Name: "min_history", Default: strconv.Itoa(DefaultAnomalyMinHistory), Help: "windows needed before detecting"},
+				{Name: "threshold", Default: strconv.FormatFloat(DefaultAnomalyThreshold, 'f', -1, 64), Help: "robust z-score that counts as anomalous"},
+				{Name: "min_count", Default: strconv.Itoa(DefaultAnomalyMinCount), Help: "requests per window before error rate and p95 are scored"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				a := NewAnomalyAnalyzer()
+				var err error
+				if a.Step, err = p.Duration("step"); err != nil {
+					return nil, err
+				}
+				if a.History, err = p.Int("history"); err != nil {
+					return nil, err
+				}
+				if a.MinHistory, err = p.Int("min_history"); err != nil {
+					return nil, err
+				}
+				if a.Threshold, err = p.Float("threshold"); err != nil {
+					return nil, err
+				}
+				n, err := p.Int("min_count")
+				if err != nil {
+					return nil, err
+				}
+				a.MinCount = int64(n)
+				if a.Step <= 0 || a.History < 1 || a.MinHistory < 1 || a.MinHistory > a.History {
+					return nil, fmt.Errorf("need step > 0 and 1 <= min_history <= history")
+				}
+				return a, nil
+			},
+		},
+		{
+			Name:        "hosts",
+			Description: "per-host connection reuse, handshake phases and upstream addresses",
+			Params: []ParamSpec{
+				{Name: "slow_handshake", Default: DefaultSlowHandshake.String(), Help: "dns, connect or tls p95 above this is flagged"},
+				{Name: "min_reuse", Default: strconv.FormatFloat(DefaultMinReuse, 'f', -1, 64), Help: "connection reuse ratio below this is flagged"},
+				{Name: "min_requests", Default: strconv.Itoa(DefaultHostMinRequests), Help: "requests before a host is flagged"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				a := NewHostHealthAnalyzer()
+				var err error
+				if a.SlowHandshake, err = p.Duration("slow_handshake"); err != nil {
+					return nil, err
+				}
+				if a.MinReuse, err = p.Float("min_reuse"); err != nil {
+					return nil, err
+				}
+				n, err := p.Int("min_requests")
+				if err != nil {
+					return nil, err
+				}
+				a.MinRequests = int64(n)
+				return a, nil
+			},
+		},
+		{
+			Name:        "concurrency",
+			Description: "requests in flight per client and host, and connection pool queueing",
+			Params: []ParamSpec{
+				{Name: "step", Default: DefaultConcurrencyStep.String(), Help: "timeline window width"},
+				{Name: "buckets", Default: strconv.Itoa(DefaultConcurrencyBuckets), Help: "timeline windows kept"},
+				{Name: "horizon", Default: DefaultConcurrencyHorizon.String(), Help: "how long finished requests are kept for overlap counting"},
+				{Name: "pool_wait", Default: DefaultPoolWait.String(), Help: "GotConn wait beyond dialing that counts as queueing"},
+				{Name: "min_requests", Default: strconv.Itoa(DefaultConcurrencyMin), Help: "requests before a key is flagged"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				a := NewConcurrencyAnalyzer()
+				var err error
+				if a.Step, err = p.Duration("step"); err != nil {
+					return nil, err
+				}
+				if a.Buckets, err = p.Int("buckets"); err != nil {
+					return nil, err
+				}
+				if a.Horizon, err = p.Duration("horizon"); err != nil {
+					return nil, err
+				}
+				if a.PoolWait, err = p.Duration("pool_wait"); err != nil {
+					return nil, err
+				}
+				n, err := p.Int("min_requests")
+				if err != nil {
+					return nil, err
+				}
+				a.MinRequests = int64(n)
+				if a.Step <= 0 || a.Buckets < 1 {
+					return nil, fmt.Errorf("need step > 0 and buckets >= 1")
+				}
+				return a, nil
+			},
+		},
+		{
+			Name:        "retrysemantics",
+			Description: "retry bursts by method idempotency, Idempotency-Key, Retry-After and backoff",
+			Params: []ParamSpec{
+				{Name: "window", Default: DefaultRetrySemanticsWindow.String(), Help: "maximum gap between attempts of one burst"},
+				{Name: "no_backoff", Default: DefaultNoBackoff.String(), Help: "gaps below this count as immediate retries"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				a := NewRetrySemanticsAnalyzer()
+				var err error
+				if a.Window, err = p.Duration("window"); err != nil {
+					return nil, err
+				}
+				if a.NoBackoff, err = p.Duration("no_backoff"); err != nil {
+					return nil, err
+				}
+				if a.Window <= 0 {
+					return nil, fmt.Errorf("need window > 0")
+				}
+				return a, nil
+			},
+		},
+		{
+			Name:        "ratelimit",
+			Description: "RateLimit/X-RateLimit quota per host and credential, and behavior after 429s",
+			Params: []ParamSpec{
+				{Name: "near_limit", Default: strconv.FormatFloat(DefaultNearLimit, 'f', -1, 64), Help: "remaining share at or below which a quota is near its limit"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				a := NewRateLimitAnalyzer()
+				var err error
+				if a.NearLimit, err = p.Float("near_limit"); err != nil {
+					return nil, err
+				}
+				return a, nil
+			},
+		},
+		{
+			Name:        "caching",
+			Description: "HTTP caching headers, revalidation and redundant downloads per route",
+			Params: []ParamSpec{
+				{Name: "min_requests", Default: strconv.Itoa(DefaultCachingMinRequests), Help: "GET/HEAD requests before a route is flagged"},
+				{Name: "waste_share", Default: strconv.FormatFloat(DefaultWasteShare, 'f', -1, 64), Help: "share of identical refetches that flags a route"},
+			},
+			New: func(p Params) (Analyzer, error) {
+				a := NewCachingAnalyzer()
+				n, err := p.Int("min_requests")
+				if err != nil {
+					return nil, err
+				}
+				a.MinRequests = int64(n)
+				if a.WasteShare, err = p.Float("waste_share"); err != nil {
+					return nil, err
+				}
+				return a, nil
+			},
+		},
+		{Name: "security", Description: "security headers, Set-Cookie attributes and mixed content per host", Heavy: true, New: simple(func() Analyzer { return NewSecurityHeadersAnalyzer() })},
+		{Name: "sensitive", Description: "secrets and PII found in captures per route", New: simple(func() Analyzer { return NewSensitiveAnalyzer() })},
+	}
+}
+
+// RegisterAnalyzer makes an analyzer available to registry configs by name.
+// It panics if the name is empty, taken, or New is nil, like other
+// init-time registration functions.
+func RegisterAnalyzer(spec AnalyzerSpec) {
+	if spec.Name == "" || spec.New == nil {
+		panic("analysis: RegisterAnalyzer needs a name and a constructor")
+	}
+	specsMu.Lock()
+	defer specsMu.Unlock()
+	for _, s := range specs {
+		if s.Name == spec.Name {
+			panic("analysis: analyzer " + spec.Name + " registered twice")
+		}
+	}
+	specs = append(specs, spec)
+}
+
+// RegisteredAnalyzers returns every known analyzer, in registry order.
+func RegisteredAnalyzers() []AnalyzerSpec {
+	specsMu.RLock()
+	defer specsMu.RUnlock()
+	return append([]AnalyzerSpec(nil), specs...)
+}
+
+// AnalyzerConfig enables or tunes one analyzer.
+type AnalyzerConfig struct {
+	Enabled *bool  // nil = the analyzer's default
+	Params  Params // overrides, by parameter name
+}
+
+// RegistryConfig selects and tunes analyzers. The zero value builds the
+// default set with default parameters.
+type RegistryConfig struct {
+	Limits    *Limits // applied to every bounded analyzer; nil = DefaultLimits
+	Analyzers map[string]AnalyzerConfig
+}
+
+func (c *RegistryConfig) entry(name string) AnalyzerConfig {
+	if c.Analyzers == nil {
+		c.Analyzers = make(map[string]AnalyzerConfig)
+	}
+	return c.Analyzers[name]
+}
+
+// ParseRegistryConfig reads the JSON config file format:
+//
+//	{"analyzers": {"schema": {"enabled": false}, "retry": {"window": "10s"}}}
+//
+// Every key other than "enabled" is a parameter; numbers and booleans are
+// accepted as well as strings.
+func ParseRegistryConfig(data []byte) (RegistryConfig, error) {
+	var raw struct {
+		Analyzers map[string]map[string]any `json:"analyzers"`
+	}
+	var cfg RegistryConfig
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return cfg, err
+	}
+	for name, fields := range raw.Analyzers {
+		ac := cfg.entry(name)
+		for k, v := range fields {
+			if k == "enabled" {
+				b, ok := v.(bool)
+				if !ok {
+					return cfg, fmt.Errorf("analyzer %s: enabled must be true or false", name)
+				}
+				ac.Enabled = &b
+				continue
+			}
+			if ac.Params == nil {
+				ac.Params = make(Params)
+			}
+			switch x := v.(type) {
+			case string:
+				ac.Params[k] = x
+			case float64:
+				ac.Params[k] = strconv.FormatFloat(x, 'f', -1, 64)
+			case bool:
+				ac.Params[k] = strconv.FormatBool(x)
+			default:
+				return cfg, fmt.Errorf("analyzer %s: parameter %s must be a string, number or boolean", name, k)
+			}
+		}
+		cfg.Analyzers[name] = ac
+	}
+	return cfg, nil
+}
+
+// Apply merges a comma-separated override list on top of c:
+// "name" enables, "-name" disables and "name.param=value" sets a parameter,
+// e.g. "-schema,retry.window=10s".
+func (c *RegistryConfig) Apply(list string) error {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if key, val, ok := strings.Cut(item, "="); ok {
+			name, param, ok := strings.Cut(key, ".")
+			if !ok || name == "" || param == "" {
+				return fmt.Errorf("%q: want name.param=value", item)
+			}
+			ac := c.entry(name)
+			if ac.Params == nil {
+				ac.Params = make(Params)
+			}
+			ac.Params[param] = val
+			c.Analyzers[name] = ac
+			continue
+		}
+		enabled := !strings.HasPrefix(item, "-")
+		name := strings.TrimLeft(item, "+-")
+		ac := c.entry(name)
+		ac.Enabled = &enabled
+		c.Analyzers[name] = ac
+	}
+	return nil
+}
+
+// AnalyzerInfo describes one analyzer of a registry, enabled or not.
+type AnalyzerInfo struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Enabled     bool              `json:"enabled"`
+	Heavy       bool              `json:"heavy,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+}
+
+// NewRegistryFromConfig builds a registry from the registered analyzers.
+// Unknown analyzer or parameter names are errors, so typos fail at startup.
+func NewRegistryFromConfig(cfg RegistryConfig) (*Registry, error) {
+	all := RegisteredAnalyzers()
+	known := make(map[string]AnalyzerSpec, len(all))
+	for _, s := range all {
+		known[s.Name] = s
+	}
+	for name := range cfg.Analyzers {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown analyzer %q", name)
+		}
+	}
+	lim := DefaultLimits
+	if cfg.Limits != nil {
+		lim = *cfg.Limits
+	}
+
+	reg := &Registry{}
+	for _, spec := range all {
+		ac := cfg.Analyzers[spec.Name]
+		enabled := !spec.Disabled
+		if ac.Enabled != nil {
+			enabled = *ac.Enabled
+		}
+
+		params := make(Params, len(spec.Params))
+		allowed := make(map[string]bool)
+		for _, ps := range spec.Params {
+			params[ps.Name] = ps.Default
+			allowed[ps.Name] = true
+		}
+		for _, ps := range limitParams {
+			allowed[ps.Name] = true
+		}
+		for k, v := range ac.Params {
+			if !allowed[k] {
+				return nil, fmt.Errorf("analyzer %s: unknown parameter %q", spec.Name, k)
+			}
+			params[k] = v
+		}
+
+		info := AnalyzerInfo{Name: spec.Name, Description: spec.Description, Enabled: enabled, Heavy: spec.Heavy, Params: params}
+		if !enabled {
+			reg.info = append(reg.info, info)
+			continue
+		}
+		a, err := spec.New(params)
+		if err != nil {
+			return nil, fmt.Errorf("analyzer %s: %w", spec.Name, err)
+		}
+		if b, ok := a.(BoundedAnalyzer); ok {
+			l := lim
+			if _, ok := params["max_entries"]; ok {
+				if l.MaxEntries, err = params.Int("max_entries"); err != nil {
+					return nil, fmt.Errorf("analyzer %s: %w", spec.Name, err)
+				}
+			}
+			if _, ok := params["max_age"]; ok {
+				if l.MaxAge, err = params.Duration("max_age"); err != nil {
+					return nil, fmt.Errorf("analyzer %s: %w", spec.Name, err)
+				}
+			}
+			b.SetLimits(l)
+		} else {
+			delete(params, "max_entries")
+			delete(params, "max_age")
+		}
+		reg.analyzers = append(reg.analyzers, a)
+		reg.info = append(reg.info, info)
+	}
+	// Anomaly detection reads the temporal rollups when they cover its step.
+	if an := reg.Anomalies(); an != nil {
+		an.UseRollups(reg.Temporal())
+	}
+	return reg, nil
+}
+
+// Info lists every registered analyzer with whether this registry runs it
+// and its effective parameters.
+func (r *Registry) Info() []AnalyzerInfo {
+	if r == nil {
+		return nil
+	}
+	if r.info == nil {
+		// Built with NewRegistry: describe what is there.
+		out := make([]AnalyzerInfo, 0, len(r.analyzers))
+		for _, name := range r.Analyzers() {
+			out = append(out, AnalyzerInfo{Name: name, Enabled: true})
+		}
+		return out
+	}
+	out := make([]AnalyzerInfo, len(r.info))
+	for i, in := range r.info {
+		in.Params = make(map[string]string, len(r.info[i].Params))
+		for k, v := range r.info[i].Params {
+			in.Params[k] = v
+		}
+		out[i] = in
+	}
+	return out
+}
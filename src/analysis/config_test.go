@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryConfigDisablesAndTunesAnalyzers(t *testing.T) {
+	cfg, err := ParseRegistryConfig([]byte(`{"analyzers": {
+		"schema": {"enabled": false},
+		"temporal": {"buckets": 60, "resolution": "10s"},
+		"latency": {"max_entries": 2}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Apply("-clientfingerprint, retry.window=5s"); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := NewRegistryFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reg.SchemaDrift() != nil || reg.ClientFingerprint() != nil {
+		t.Fatalf("disabled analyzers were built")
+	}
+	if reg.Retry() == nil || reg.Retry().Window != 5*time.Second {
+		t.Fatalf("retry window not applied")
+	}
+	if n := len(reg.Temporal().Snapshot()); n != 60 {
+		t.Fatalf("temporal buckets = %d, want 60", n)
+	}
+	for _, c := range reg.Capacity() {
+		if c.Analyzer == "latency" && c.MaxEntries != 2 {
+			t.Fatalf("latency max_entries = %d, want 2", c.MaxEntries)
+		}
+		if c.Analyzer == "size" && c.MaxEntries != DefaultLimits.MaxEntries {
+			t.Fatalf("size should keep the default limit, got %d", c.MaxEntries)
+		}
+	}
+
+	var schema, temporal AnalyzerInfo
+	for _, in := range reg.Info() {
+		switch in.Name {
+		case "schema":
+			schema = in
+		case "temporal":
+			temporal = in
+		}
+	}
+	if schema.Enabled || !temporal.Enabled || temporal.Params["resolution"] != "10s" {
+		t.Fatalf("unexpected info schema=%+v temporal=%+v", schema, temporal)
+	}
+}
+
+func TestRegistryConfigRejectsTypos(t *testing.T) {
+	for spec, want := range map[string]string{
+		"-latncy":           "unknown analyzer",
+		"retry.windw=1s":    "unknown parameter",
+		"retry.window=soon": "want a duration",
+		"temporal.buckets":  "unknown analyzer", // missing "=value"
+	} {
+		var cfg RegistryConfig
+		if err := cfg.Apply(spec); err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		_, err := NewRegistryFromConfig(cfg)
+		if err == nil {
+			t.Fatalf("%s: expected an error", spec)
+		}
+		if want != "" && !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: error %q, want %q", spec, err, want)
+		}
+	}
+}
+
+func TestRegisterAnalyzerAddsOptInAnalyzer(t *testing.T) {
+	var seen int
+	RegisterAnalyzer(AnalyzerSpec{
+		Name:     "test-counter",
+		Disabled: true,
+		New: func(Params) (Analyzer, error) {
+			return analyzerFunc(func(*ObservedRequest) { seen++ }), nil
+		},
+	})
+
+	NewDefaultRegistry().OnRequest(&ObservedRequest{})
+	if seen != 0 {
+		t.Fatalf("opt-in analyzer ran without being enabled")
+	}
+
+	var cfg RegistryConfig
+	_ = cfg.Apply("test-counter")
+	reg, err := NewRegistryFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.OnRequest(&ObservedRequest{})
+	if seen != 1 {
+		t.Fatalf("enabled analyzer saw %d events, want 1", seen)
+	}
+}
@@ -0,0 +1,168 @@
+package analysis
+
+import (
+	"time"
+)
+
+//
+// 11. API contract conformance per route
+//
+
+// Contract violation kinds.
+const (
+	ContractUnknownPath        = "unknown_path"
+	ContractUnknownMethod      = "unknown_method"
+	ContractMissingParameter   = "missing_parameter"
+	ContractInvalidParameter   = "invalid_parameter"
+	ContractRequestBody        = "request_body"
+	ContractResponseBody       = "response_body"
+	ContractUndocumentedStatus = "undocumented_status"
+	ContractUndocumentedType   = "undocumented_content_type"
+)
+
+// ContractViolation is one way a capture diverged from the host's contract.
+type ContractViolation struct {
+	Kind     string `json:"kind"`
+	Where    string `json:"where"`             // "request" | "response"
+	Pointer  string `json:"pointer,omitempty"` // JSON pointer into the body, or parameter name
+	Message  string `json:"message"`
+	SpecPath string `json:"spec_path,omitempty"` // matched OpenAPI path, if any
+}
+
+// ContractStats aggregates contract checks for a route.
+type ContractStats struct {
+	Checked       int64
+	Violating     int64
+	ByKind        map[string]int64
+	FirstSeen     time.Time
+	LastViolation time.Time
+	LastSample    []ContractViolation
+}
+
+// ContractSnapshot is a read-only view for one route.
+type ContractSnapshot struct {
+	Route         RouteKey            `json:"route"`
+	Checked       int64               `json:"checked"`
+	Violating     int64               `json:"violating"`
+	ViolationRate float64             `json:"violation_rate"`
+	ByKind        map[string]int64    `json:"by_kind"`
+	LastViolation time.Time           `json:"last_violation,omitempty"`
+	LastSample    []ContractViolation `json:"last_sample,omitempty"`
+}
+
+// ContractAnalyzer counts contract violations per route. Only requests that
+// were checked against a contract (ObservedRequest.ContractChecked) count.
+type ContractAnalyzer struct {
+	*boundedBase
+	byRoute *boundedMap[RouteKey, *ContractStats]
+}
+
+// NewContractAnalyzer constructs an empty analyzer.
+func NewContractAnalyzer() *ContractAnalyzer {
+	byRoute := newBoundedMap[RouteKey, *ContractStats](DefaultLimits)
+	return &ContractAnalyzer{
+		boundedBase: newBoundedBase("contract", byRoute),
+		byRoute:     byRoute,
+	}
+}
+
+// OnRequest ingests an ObservedRequest and updates the route's contract stats.
+func (a *ContractAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || !ev.ContractChecked {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, ok := a.byRoute.get(ev.Route, now)
+	if !ok {
+		st = &ContractStats{ByKind: make(map[string]int64), FirstSeen: now}
+		a.byRoute.put(ev.Route, st, now)
+	}
+	st.Checked++
+	if len(ev.ContractViolations) == 0 {
+		return
+	}
+	st.Violating++
+	seen := make(map[string]bool, len(ev.ContractViolations))
+	for _, v := range ev.ContractViolations {
+		// count each kind once per request
+		if !seen[v.Kind] {
+			seen[v.Kind] = true
+			st.ByKind[v.Kind]++
+		}
+	}
+	st.LastViolation = now
+	st.LastSample = append([]ContractViolation(nil), ev.ContractViolations...)
+}
+
+func (a *ContractAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byRoute.rekey(rename, func(dst, src *ContractStats) {
+		dst.Checked += src.Checked
+		dst.Violating += src.Violating
+		mergeCounts(dst.ByKind, src.ByKind, 0)
+		if src.FirstSeen.Before(dst.FirstSeen) {
+			dst.FirstSeen = src.FirstSeen
+		}
+		if src.LastViolation.After(dst.LastViolation) {
+			dst.LastViolation = src.LastViolation
+			dst.LastSample = src.LastSample
+		}
+	})
+	a.mu.Unlock()
+}
+
+// Snapshot returns routes with at least minViolations violating requests.
+// Pass 0 to include every checked route.
+func (a *ContractAnalyzer) Snapshot(minViolations int64) []ContractSnapshot {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]ContractSnapshot, 0, a.byRoute.len())
+	a.byRoute.each(func(route RouteKey, st *ContractStats) bool {
+		if st.Violating < minViolations {
+			return true
+		}
+		kinds := make(map[string]int64, len(st.ByKind))
+		for k, n := range st.ByKind {
+			kinds[k] = n
+		}
+		snap := ContractSnapshot{
+			Route:         route,
+			Checked:       st.Checked,
+			Violating:     st.Violating,
+			ByKind:        kinds,
+			LastViolation: st.LastViolation,
+			LastSample:    append([]ContractViolation(nil), st.LastSample...),
+		}
+		if st.Checked > 0 {
+			snap.ViolationRate = float64(st.Violating) / float64(st.Checked)
+		}
+		out = append(out, snap)
+		return true
+	})
+	return out
+}
+
+// Contract returns the ContractAnalyzer registered in this registry, if any.
+func (r *Registry) Contract() *ContractAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if ca, ok := a.(*ContractAnalyzer); ok {
+			return ca
+		}
+	}
+	return nil
+}
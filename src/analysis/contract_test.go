@@ -0,0 +1,31 @@
+package analysis
+
+import "testing"
+
+func TestContractAnalyzerCountsCheckedRequests(t *testing.T) {
+	a := NewContractAnalyzer()
+	route := RouteKey{Host: "api", Path: "/users/{id}", Method: "GET"}
+
+	a.OnRequest(&ObservedRequest{Route: route}) // no contract for host: ignored
+	a.OnRequest(&ObservedRequest{Route: route, ContractChecked: true})
+	a.OnRequest(&ObservedRequest{Route: route, ContractChecked: true, ContractViolations: []ContractViolation{
+		{Kind: ContractResponseBody, Where: "response", Pointer: "/id", Message: "expected integer"},
+		{Kind: ContractResponseBody, Where: "response", Pointer: "/name", Message: "required"},
+		{Kind: ContractUndocumentedStatus, Where: "response", Message: "418"},
+	}})
+
+	snaps := a.Snapshot(1)
+	if len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(snaps))
+	}
+	s := snaps[0]
+	if s.Checked != 2 || s.Violating != 1 || s.ViolationRate != 0.5 {
+		t.Fatalf("unexpected counts: %+v", s)
+	}
+	if s.ByKind[ContractResponseBody] != 1 || s.ByKind[ContractUndocumentedStatus] != 1 {
+		t.Fatalf("kinds should be counted once per request: %v", s.ByKind)
+	}
+	if len(s.LastSample) != 3 {
+		t.Fatalf("expected last sample to keep all violations, got %d", len(s.LastSample))
+	}
+}
@@ -0,0 +1,408 @@
+package analysis
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// 12. API spec coverage per operation
+//
+
+// CoverageParam is a parameter declared by a spec operation.
+type CoverageParam struct {
+	Name     string
+	In       string // "path" | "query" | "header" | "cookie"
+	Required bool
+	Enum     []string // declared enum values, stringified
+}
+
+// CoverageOperation is one operation of a spec (method + path template).
+type CoverageOperation struct {
+	Method      string
+	Path        string // spec path template, e.g. /users/{id}
+	OperationID string
+	Statuses    []string // declared response keys: "200", "4XX", "default"
+	Params      []CoverageParam
+}
+
+// CoverageAnalyzer maps requests onto the operations of per-host specs and
+// records what was exercised: hits, status codes, parameters and enum values.
+// Unlike MethodPathAnalyzer it only knows routes the spec declares, so
+// operations that were never called show up with zero hits.
+type CoverageAnalyzer struct {
+	mu    sync.RWMutex
+	hosts map[string]*coverageHost
+}
+
+type coverageHost struct {
+	basePath string
+	ops      []*operationCoverage // most literal segments first
+}
+
+type operationCoverage struct {
+	op       CoverageOperation
+	literals int
+	hits     int64
+	first    time.Time
+	last     time.Time
+	statuses map[int]int64
+	params   map[string]int64            // in + "\x00" + name -> requests carrying it
+	enums    map[string]map[string]int64 // same key -> value -> count
+}
+
+// NewCoverageAnalyzer constructs an analyzer with no specs loaded.
+func NewCoverageAnalyzer() *CoverageAnalyzer {
+	return &CoverageAnalyzer{hosts: make(map[string]*coverageHost)}
+}
+
+func coverageParamKey(in, name string) string {
+	if in == "header" {
+		name = strings.ToLower(name)
+	}
+	return in + "\x00" + name
+}
+
+// SetOperations installs (or replaces) the operations for a host and resets
+// its counters. basePath is the spec's server path prefix, if any.
+func (a *CoverageAnalyzer) SetOperations(host, basePath string, ops []CoverageOperation) {
+	h := &coverageHost{basePath: strings.TrimRight(basePath, "/")}
+	for _, op := range ops {
+		lit := 0
+		for _, seg := range strings.Split(strings.Trim(op.Path, "/"), "/") {
+			if !strings.Contains(seg, "{") {
+				lit++
+			}
+		}
+		h.ops = append(h.ops, &operationCoverage{
+			op:       op,
+			literals: lit,
+			statuses: make(map[int]int64),
+			params:   make(map[string]int64),
+			enums:    make(map[string]map[string]int64),
+		})
+	}
+	sort.SliceStable(h.ops, func(i, j int) bool { return h.ops[i].literals > h.ops[j].literals })
+
+	a.mu.Lock()
+	a.hosts[strings.ToLower(host)] = h
+	a.mu.Unlock()
+}
+
+// RemoveHost forgets a host's spec and counters.
+func (a *CoverageAnalyzer) RemoveHost(host string) {
+	a.mu.Lock()
+	delete(a.hosts, strings.ToLower(host))
+	a.mu.Unlock()
+}
+
+// hostFor finds the spec for a request host, trying host:port then hostname.
+func (a *CoverageAnalyzer) hostFor(host string) *coverageHost {
+	host = strings.ToLower(host)
+	if h := a.hosts[host]; h != nil {
+		return h
+	}
+	if name, _, ok := strings.Cut(host, ":"); ok {
+		return a.hosts[name]
+	}
+	return nil
+}
+
+// OnRequest matches the request to an operation and records its coverage.
+func (a *CoverageAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	h := a.hostFor(ev.Route.Host)
+	if h == nil {
+		return
+	}
+	path := ev.Path
+	if h.basePath != "" {
+		if path != h.basePath && !strings.HasPrefix(path, h.basePath+"/") {
+			return
+		}
+		path = strings.TrimPrefix(path, h.basePath)
+	}
+
+	var oc *operationCoverage
+	var pathParams map[string]string
+	for _, c := range h.ops {
+		if !strings.EqualFold(c.op.Method, ev.Method) {
+			continue
+		}
+		if params, ok := MatchPathTemplate(c.op.Path, path); ok {
+			oc, pathParams = c, params
+			break
+		}
+	}
+	if oc == nil {
+		return
+	}
+
+	oc.hits++
+	if oc.first.IsZero() {
+		oc.first = now
+	}
+	oc.last = now
+	oc.statuses[ev.StatusCode]++
+
+	query, _ := url.ParseQuery(ev.Query)
+	cookies := (&http.Request{Header: http.Header{"Cookie": ev.ReqHeaders.Values("Cookie")}}).Cookies()
+	for _, p := range oc.op.Params {
+		var values []string
+		switch p.In {
+		case "path":
+			if v, ok := pathParams[p.Name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = ev.ReqHeaders.Values(p.Name)
+		case "cookie":
+			for _, c := range cookies {
+				if c.Name == p.Name {
+					values = append(values, c.Value)
+				}
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		key := coverageParamKey(p.In, p.Name)
+		oc.params[key]++
+		if len(p.Enum) == 0 {
+			continue
+		}
+		seen := oc.enums[key]
+		if seen == nil {
+			seen = make(map[string]int64)
+			oc.enums[key] = seen
+		}
+		for _, v := range values {
+			for _, e := range p.Enum {
+				if v == e {
+					seen[v]++
+					break
+				}
+			}
+		}
+	}
+}
+
+// ParamCoverage reports how a declared parameter was exercised.
+type ParamCoverage struct {
+	Name        string           `json:"name"`
+	In          string           `json:"in"`
+	Required    bool             `json:"required,omitempty"`
+	Hits        int64            `json:"hits"`
+	Enum        []string         `json:"enum,omitempty"`
+	EnumSeen    map[string]int64 `json:"enum_seen,omitempty"`
+	EnumMissing []string         `json:"enum_missing,omitempty"`
+}
+
+// OperationCoverage is the read-only view of one spec operation.
+type OperationCoverage struct {
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	OperationID string    `json:"operation_id,omitempty"`
+	Hits        int64     `json:"hits"`
+	FirstHit    time.Time `json:"first_hit,omitempty"`
+	LastHit     time.Time `json:"last_hit,omitempty"`
+
+	DeclaredStatuses   []string         `json:"declared_statuses"`
+	SeenStatuses       map[string]int64 `json:"seen_statuses,omitempty"`
+	UncoveredStatuses  []string         `json:"uncovered_statuses,omitempty"`  // declared, never seen
+	UndeclaredStatuses []string         `json:"undeclared_statuses,omitempty"` // seen, not declared
+
+	Params []ParamCoverage `json:"params,omitempty"`
+}
+
+// CoverageSnapshot is the coverage report for one host.
+type CoverageSnapshot struct {
+	Host       string              `json:"host"`
+	BasePath   string              `json:"base_path,omitempty"`
+	Operations int                 `json:"operations"`
+	Covered    int                 `json:"covered"`
+	Ratio      float64             `json:"ratio"`
+	Ops        []OperationCoverage `json:"ops"`
+}
+
+// statusMatches reports whether a declared response key covers a status.
+func statusMatches(key string, status int) bool {
+	s := strconv.Itoa(status)
+	if key == s {
+		return true
+	}
+	return len(key) == 3 && strings.EqualFold(key[1:], "XX") && len(s) == 3 && key[0] == s[0]
+}
+
+// statusKeyFor returns the declared key a status falls under, preferring an
+// exact code, then a range, then "default"; "" if undeclared.
+func statusKeyFor(declared []string, status int) string {
+	var rng, def string
+	for _, k := range declared {
+		switch {
+		case k == strconv.Itoa(status):
+			return k
+		case statusMatches(k, status):
+			rng = k
+		case k == "default":
+			def = k
+		}
+	}
+	if rng != "" {
+		return rng
+	}
+	return def
+}
+
+// Snapshot returns coverage per host; pass "" for every host.
+func (a *CoverageAnalyzer) Snapshot(host string) []CoverageSnapshot {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]CoverageSnapshot, 0, len(a.hosts))
+	for name, h := range a.hosts {
+		if host != "" && !strings.EqualFold(host, name) {
+			continue
+		}
+		snap := CoverageSnapshot{Host: name, BasePath: h.basePath, Operations: len(h.ops)}
+		for _, oc := range h.ops {
+			snap.Ops = append(snap.Ops, oc.snapshot())
+			if oc.hits > 0 {
+				snap.Covered++
+			}
+		}
+		if snap.Operations > 0 {
+			snap.Ratio = float64(snap.Covered) / float64(snap.Operations)
+		}
+		sort.Slice(snap.Ops, func(i, j int) bool {
+			if snap.Ops[i].Path != snap.Ops[j].Path {
+				return snap.Ops[i].Path < snap.Ops[j].Path
+			}
+			return snap.Ops[i].Method < snap.Ops[j].Method
+		})
+		out = append(out, snap)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+func (oc *operationCoverage) snapshot() OperationCoverage {
+	s := OperationCoverage{
+		Method:           oc.op.Method,
+		Path:             oc.op.Path,
+		OperationID:      oc.op.OperationID,
+		Hits:             oc.hits,
+		FirstHit:         oc.first,
+		LastHit:          oc.last,
+		DeclaredStatuses: append([]string(nil), oc.op.Statuses...),
+	}
+
+	covered := make(map[string]bool)
+	if len(oc.statuses) > 0 {
+		s.SeenStatuses = make(map[string]int64, len(oc.statuses))
+	}
+	for code, n := range oc.statuses {
+		s.SeenStatuses[strconv.Itoa(code)] = n
+		if k := statusKeyFor(oc.op.Statuses, code); k != "" {
+			covered[k] = true
+		} else {
+			s.UndeclaredStatuses = append(s.UndeclaredStatuses, strconv.Itoa(code))
+		}
+	}
+	sort.Strings(s.UndeclaredStatuses)
+	for _, k := range oc.op.Statuses {
+		if !covered[k] {
+			s.UncoveredStatuses = append(s.UncoveredStatuses, k)
+		}
+	}
+
+	for _, p := range oc.op.Params {
+		key := coverageParamKey(p.In, p.Name)
+		pc := ParamCoverage{
+			Name:     p.Name,
+			In:       p.In,
+			Required: p.Required,
+			Hits:     oc.params[key],
+			Enum:     append([]string(nil), p.Enum...),
+		}
+		if seen := oc.enums[key]; len(seen) > 0 {
+			pc.EnumSeen = make(map[string]int64, len(seen))
+			for v, n := range seen {
+				pc.EnumSeen[v] = n
+			}
+		}
+		for _, e := range p.Enum {
+			if pc.EnumSeen[e] == 0 {
+				pc.EnumMissing = append(pc.EnumMissing, e)
+			}
+		}
+		s.Params = append(s.Params, pc)
+	}
+	return s
+}
+
+// Coverage returns the CoverageAnalyzer registered in this registry, if any.
+func (r *Registry) Coverage() *CoverageAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if ca, ok := a.(*CoverageAnalyzer); ok {
+			return ca
+		}
+	}
+	return nil
+}
+
+// Name identifies the analyzer for /metrics/reset and /metrics/capacity.
+func (a *CoverageAnalyzer) Name() string { return "coverage" }
+
+// SetLimits is a no-op: state is bounded by the loaded specs.
+func (a *CoverageAnalyzer) SetLimits(Limits) {}
+
+// Capacity reports the number of spec operations tracked.
+func (a *CoverageAnalyzer) Capacity() CapacityStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	n := 0
+	for _, h := range a.hosts {
+		n += len(h.ops)
+	}
+	return CapacityStats{Analyzer: a.Name(), Entries: n}
+}
+
+// Reset zeroes the counters of every operation but keeps the loaded specs.
+func (a *CoverageAnalyzer) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, h := range a.hosts {
+		for _, oc := range h.ops {
+			oc.hits = 0
+			oc.first, oc.last = time.Time{}, time.Time{}
+			clear(oc.statuses)
+			clear(oc.params)
+			clear(oc.enums)
+		}
+	}
+}
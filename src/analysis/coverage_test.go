@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCoverageAnalyzer(t *testing.T) {
+	a := NewCoverageAnalyzer()
+	a.SetOperations("api.example.com", "/v1", []CoverageOperation{
+		{Method: "GET", Path: "/users/{id}", Statuses: []string{"200", "404"}, Params: []CoverageParam{
+			{Name: "id", In: "path", Required: true},
+			{Name: "view", In: "query", Enum: []string{"full", "short"}},
+		}},
+		{Method: "GET", Path: "/users/me", Statuses: []string{"2XX", "default"}},
+		{Method: "DELETE", Path: "/users/{id}", Statuses: []string{"204"}},
+	})
+
+	req := func(method, path, query string, status int) {
+		a.OnRequest(&ObservedRequest{
+			Route:  RouteKey{Host: "api.example.com:443", Method: method},
+			Method: method, Path: path, Query: query, StatusCode: status,
+			ReqHeaders: http.Header{},
+		})
+	}
+	req("GET", "/v1/users/7", "view=full", 200)
+	req("GET", "/v1/users/8", "view=bogus", 500)
+	req("GET", "/v1/users/me", "", 200)
+	req("GET", "/other/users/7", "", 200) // outside base path: ignored
+
+	snaps := a.Snapshot("")
+	if len(snaps) != 1 {
+		t.Fatalf("expected 1 host, got %d", len(snaps))
+	}
+	s := snaps[0]
+	if s.Operations != 3 || s.Covered != 2 {
+		t.Fatalf("covered %d of %d, want 2 of 3", s.Covered, s.Operations)
+	}
+
+	byKey := make(map[string]OperationCoverage)
+	for _, op := range s.Ops {
+		byKey[op.Method+" "+op.Path] = op
+	}
+	user := byKey["GET /users/{id}"]
+	if user.Hits != 2 {
+		t.Errorf("GET /users/{id} hits = %d, want 2", user.Hits)
+	}
+	if len(user.UncoveredStatuses) != 1 || user.UncoveredStatuses[0] != "404" {
+		t.Errorf("uncovered = %v, want [404]", user.UncoveredStatuses)
+	}
+	if len(user.UndeclaredStatuses) != 1 || user.UndeclaredStatuses[0] != "500" {
+		t.Errorf("undeclared = %v, want [500]", user.UndeclaredStatuses)
+	}
+	view := user.Params[1]
+	if view.Hits != 2 || view.EnumSeen["full"] != 1 || len(view.EnumMissing) != 1 || view.EnumMissing[0] != "short" {
+		t.Errorf("view param coverage = %+v", view)
+	}
+
+	me := byKey["GET /users/me"]
+	if me.Hits != 1 || len(me.UncoveredStatuses) != 1 || me.UncoveredStatuses[0] != "default" {
+		t.Errorf("literal path should win and 2XX should cover 200: %+v", me)
+	}
+	if byKey["DELETE /users/{id}"].Hits != 0 {
+		t.Errorf("DELETE should be uncovered")
+	}
+
+	a.RemoveHost("api.example.com")
+	if len(a.Snapshot("")) != 0 {
+		t.Errorf("RemoveHost should drop the host")
+	}
+}
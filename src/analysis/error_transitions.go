@@ -1,7 +1,6 @@
 package analysis
 
 import (
-	"sync"
 	"time"
 )
 
@@ -45,14 +44,16 @@ type ClientErrorSnapshot struct {
 
 // ErrorTransitionAnalyzer keeps state per client and tracks error transitions.
 type ErrorTransitionAnalyzer struct {
-	mu       sync.RWMutex
-	byClient map[ClientID]*ErrorTransitionState
+	*boundedBase
+	byClient *boundedMap[ClientID, *ErrorTransitionState]
 }
 
 // NewErrorTransitionAnalyzer constructs an empty analyzer.
 func NewErrorTransitionAnalyzer() *ErrorTransitionAnalyzer {
+	byClient := newBoundedMap[ClientID, *ErrorTransitionState](DefaultLimits)
 	return &ErrorTransitionAnalyzer{
-		byClient: make(map[ClientID]*ErrorTransitionState),
+		boundedBase: newBoundedBase("errortransitions", byClient),
+		byClient:    byClient,
 	}
 }
 
@@ -71,12 +72,12 @@ func (a *ErrorTransitionAnalyzer) OnRequest(ev *ObservedRequest) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	st, ok := a.byClient[client]
+	st, ok := a.byClient.get(client, now)
 	if !ok {
 		st = &ErrorTransitionState{
 			Transitions: make(map[Outcome]map[Outcome]uint64),
 		}
-		a.byClient[client] = st
+		a.byClient.put(client, st, now)
 	}
 
 	// Transition matrix update.
@@ -127,14 +128,14 @@ func (a *ErrorTransitionAnalyzer) Snapshot(minErrors int64) []ClientErrorSnapsho
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	out := make([]ClientErrorSnapshot, 0, len(a.byClient))
-	for client, st := range a.byClient {
+	out := make([]ClientErrorSnapshot, 0, a.byClient.len())
+	a.byClient.each(func(client ClientID, st *ErrorTransitionState) bool {
 		// Filter by minErrors threshold.
 		if minErrors > 0 &&
 			st.ConsecutiveErrors < minErrors &&
 			st.Consecutive5xx < minErrors &&
 			st.Consecutive4xx < minErrors {
-			continue
+			return true
 		}
 
 		// Shallow copy of transitions; values are maps but we treat them as read-only.
@@ -157,7 +158,8 @@ func (a *ErrorTransitionAnalyzer) Snapshot(minErrors int64) []ClientErrorSnapsho
 			Transitions:       transCopy,
 		}
 		out = append(out, snap)
-	}
+		return true
+	})
 	return out
 }
 
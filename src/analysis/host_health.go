@@ -0,0 +1,317 @@
+package analysis
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+//
+// 17. Per-host connection and phase health
+//
+
+// Defaults for NewHostHealthAnalyzer.
+const (
+	DefaultSlowHandshake   = 200 * time.Millisecond // p95 of dns, connect or tls above this is flagged
+	DefaultMinReuse        = 0.5                    // reuse ratio below this is poor keep-alive
+	DefaultHostMinRequests = 20                     // requests before a host is flagged
+)
+
+// Host health flags.
+const (
+	FlagPoorKeepAlive = "poor_keepalive"
+	FlagSlowDNS       = "slow_dns"
+	FlagSlowConnect   = "slow_connect"
+	FlagSlowTLS       = "slow_tls"
+)
+
+// HostIP is one upstream address a host resolved to.
+type HostIP struct {
+	IP        string    `json:"ip"`
+	Count     int64     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// hostHealthState aggregates one host.
+type hostHealthState struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Requests  int64
+	Conns     int64 // requests that went over an upstream connection
+	NewConns  int64
+	HTTP2     int64
+	phases    map[string]*LatencySketch
+
+	// Upstream addresses, capped at maxValueCounts (least recently seen
+	// dropped first).
+	ips          map[string]*HostIP
+	lastIP       string
+	IPChanges    int64 // times the upstream address differed from the previous request's
+	LastIPChange time.Time
+	newIPs       int64 // addresses first seen after the host's first one
+
+	// New connections in the current and previous minute of event time.
+	minute           time.Time
+	thisMin, prevMin int64
+}
+
+// HostHealthSnapshot is a read-only view of one host.
+type HostHealthSnapshot struct {
+	Host      string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Requests  int64
+	Conns     int64
+	NewConns  int64
+	Reused    int64
+	// ReuseRatio is Reused / Conns: the share of requests that rode an
+	// existing connection.
+	ReuseRatio float64
+	// NewConnsPerMin averages over the time the host was seen;
+	// NewConnsLastMin is the count in the most recent full minute.
+	NewConnsPerMin  float64
+	NewConnsLastMin int64
+	HTTP2Share      float64
+	Phases          map[string]QuantileEstimate // dns, connect, tls, ttfb, read
+	PhaseN          map[string]int64
+	IPs             []HostIP // most used first
+	IPChanges       int64
+	NewIPs          int64 // addresses first seen after the host's first one
+	LastIPChange    time.Time
+	Flags           []string
+}
+
+// HostHealthAnalyzer tracks upstream connection reuse, handshake phases and
+// resolved addresses per host.
+type HostHealthAnalyzer struct {
+	*boundedBase
+	byHost *boundedMap[string, *hostHealthState]
+
+	SlowHandshake time.Duration
+	MinReuse      float64
+	MinRequests   int64
+}
+
+// NewHostHealthAnalyzer constructs a HostHealthAnalyzer with default
+// thresholds.
+func NewHostHealthAnalyzer() *HostHealthAnalyzer {
+	byHost := newBoundedMap[string, *hostHealthState](DefaultLimits)
+	return &HostHealthAnalyzer{
+		boundedBase:   newBoundedBase("hosts", byHost),
+		byHost:        byHost,
+		SlowHandshake: DefaultSlowHandshake,
+		MinReuse:      DefaultMinReuse,
+		MinRequests:   DefaultHostMinRequests,
+	}
+}
+
+// OnRequest ingests an ObservedRequest.
+func (a *HostHealthAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || ev.Route.Host == "" {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, ok := a.byHost.get(ev.Route.Host, now)
+	if !ok {
+		st = &hostHealthState{
+			FirstSeen: now,
+			phases:    make(map[string]*LatencySketch),
+			ips:       make(map[string]*HostIP),
+		}
+		a.byHost.put(ev.Route.Host, st, now)
+	}
+	st.Requests++
+	if now.After(st.LastSeen) {
+		st.LastSeen = now
+	}
+	if now.Before(st.FirstSeen) {
+		st.FirstSeen = now
+	}
+	if ev.HTTP2 {
+		st.HTTP2++
+	}
+	ev.Phases.each(func(name string, d time.Duration) {
+		sk := st.phases[name]
+		if sk == nil {
+			sk = NewLatencySketch()
+			st.phases[name] = sk
+		}
+		sk.Add(d)
+	})
+
+	// Requests that failed before reaching the origin carry no connection.
+	if ev.ServerAddr == "" && !ev.ReusedConn && ev.Phases.Connect == 0 {
+		return
+	}
+	st.Conns++
+	if !ev.ReusedConn {
+		st.NewConns++
+		minute := now.Truncate(time.Minute)
+		switch {
+		case minute.Equal(st.minute):
+		case minute.Sub(st.minute) == time.Minute:
+			st.minute, st.prevMin, st.thisMin = minute, st.thisMin, 0
+		case minute.After(st.minute):
+			st.minute, st.prevMin, st.thisMin = minute, 0, 0
+		}
+		if minute.Equal(st.minute) {
+			st.thisMin++
+		}
+	}
+
+	ip := ev.ServerAddr
+	if h, _, err := net.SplitHostPort(ip); err == nil {
+		ip = h
+	}
+	if ip == "" {
+		return
+	}
+	hip := st.ips[ip]
+	if hip == nil {
+		if len(st.ips) >= maxValueCounts {
+			st.evictIP()
+		}
+		hip = &HostIP{IP: ip, FirstSeen: now}
+		st.ips[ip] = hip
+		if st.lastIP != "" {
+			st.newIPs++
+		}
+	}
+	hip.Count++
+	hip.LastSeen = now
+	if st.lastIP != "" && st.lastIP != ip {
+		st.IPChanges++
+		st.LastIPChange = now
+	}
+	st.lastIP = ip
+}
+
+// evictIP drops the least recently seen address.
+func (st *hostHealthState) evictIP() {
+	var oldest *HostIP
+	for _, h := range st.ips {
+		if oldest == nil || h.LastSeen.Before(oldest.LastSeen) {
+			oldest = h
+		}
+	}
+	if oldest != nil {
+		delete(st.ips, oldest.IP)
+	}
+}
+
+// pruneBefore drops addresses last seen before cutoff (see agingEntry).
+func (st *hostHealthState) pruneBefore(cutoff time.Time) {
+	for ip, h := range st.ips {
+		if h.LastSeen.Before(cutoff) {
+			delete(st.ips, ip)
+		}
+	}
+}
+
+// Snapshot returns per-host health for hosts with at least minRequests
+// requests, sorted by host.
+func (a *HostHealthAnalyzer) Snapshot(minRequests int64) []HostHealthSnapshot {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]HostHealthSnapshot, 0, a.byHost.len())
+	a.byHost.each(func(host string, st *hostHealthState) bool {
+		if st.Requests < minRequests {
+			return true
+		}
+		s := HostHealthSnapshot{
+			Host:         host,
+			FirstSeen:    st.FirstSeen,
+			LastSeen:     st.LastSeen,
+			Requests:     st.Requests,
+			Conns:        st.Conns,
+			NewConns:     st.NewConns,
+			Reused:       st.Conns - st.NewConns,
+			IPChanges:    st.IPChanges,
+			NewIPs:       st.newIPs,
+			LastIPChange: st.LastIPChange,
+			HTTP2Share:   float64(st.HTTP2) / float64(st.Requests),
+		}
+		if st.Conns > 0 {
+			s.ReuseRatio = float64(s.Reused) / float64(st.Conns)
+		}
+		minutes := st.LastSeen.Sub(st.FirstSeen).Minutes()
+		if minutes < 1 {
+			minutes = 1
+		}
+		s.NewConnsPerMin = float64(st.NewConns) / minutes
+		switch last := st.LastSeen.Truncate(time.Minute); {
+		case last.Equal(st.minute):
+			s.NewConnsLastMin = st.prevMin
+		case last.Sub(st.minute) == time.Minute:
+			s.NewConnsLastMin = st.thisMin
+		}
+		if len(st.phases) > 0 {
+			s.Phases = make(map[string]QuantileEstimate, len(st.phases))
+			s.PhaseN = make(map[string]int64, len(st.phases))
+			for name, sk := range st.phases {
+				s.Phases[name] = sk.Estimate()
+				s.PhaseN[name] = sk.Count()
+			}
+		}
+		for _, h := range st.ips {
+			s.IPs = append(s.IPs, *h)
+		}
+		sort.Slice(s.IPs, func(i, j int) bool {
+			if s.IPs[i].Count != s.IPs[j].Count {
+				return s.IPs[i].Count > s.IPs[j].Count
+			}
+			return s.IPs[i].IP < s.IPs[j].IP
+		})
+		s.Flags = a.flags(&s)
+		out = append(out, s)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// flags names what looks unhealthy about s; the caller holds the lock.
+func (a *HostHealthAnalyzer) flags(s *HostHealthSnapshot) []string {
+	if s.Requests < a.MinRequests {
+		return nil
+	}
+	var out []string
+	if s.Conns > 0 && s.ReuseRatio < a.MinReuse {
+		out = append(out, FlagPoorKeepAlive)
+	}
+	for _, ph := range []struct{ phase, flag string }{
+		{PhaseDNS, FlagSlowDNS},
+		{PhaseConnect, FlagSlowConnect},
+		{PhaseTLS, FlagSlowTLS},
+	} {
+		if q, ok := s.Phases[ph.phase]; ok && a.SlowHandshake > 0 && q.P95 > a.SlowHandshake {
+			out = append(out, ph.flag)
+		}
+	}
+	return out
+}
+
+// HostHealth returns the HostHealthAnalyzer registered in this registry, if any.
+func (r *Registry) HostHealth() *HostHealthAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if ha, ok := a.(*HostHealthAnalyzer); ok {
+			return ha
+		}
+	}
+	return nil
+}
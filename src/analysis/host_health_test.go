@@ -0,0 +1,78 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostHealthReuseHandshakesAndAddresses(t *testing.T) {
+	a := NewHostHealthAnalyzer()
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	send := func(host string, at time.Duration, reused bool, addr string, tls time.Duration, h2 bool) {
+		ev := &ObservedRequest{
+			Timestamp:  base.Add(at),
+			Route:      RouteKey{Host: host, Method: "GET", Path: "/"},
+			ServerAddr: addr,
+			ReusedConn: reused,
+			HTTP2:      h2,
+			Phases:     PhaseTimings{TTFB: 30 * time.Millisecond, Read: 5 * time.Millisecond},
+		}
+		if !reused {
+			ev.Phases.DNS = 2 * time.Millisecond
+			ev.Phases.Connect = 10 * time.Millisecond
+			ev.Phases.TLS = tls
+		}
+		a.OnRequest(ev)
+	}
+
+	// api: one connection reused for everything, over h2.
+	for i := 0; i < 30; i++ {
+		send("api", time.Duration(i)*time.Second, i > 0, "10.0.0.1:443", 20*time.Millisecond, true)
+	}
+	// legacy: a new, slow TLS connection per request, alternating between two addresses.
+	for i := 0; i < 30; i++ {
+		addr := "10.0.1.1:443"
+		if i%2 == 1 {
+			addr = "10.0.1.2:443"
+		}
+		send("legacy", time.Duration(i)*4*time.Second, false, addr, 400*time.Millisecond, false)
+	}
+	// failed before connecting: counted as a request, not as a connection.
+	a.OnRequest(&ObservedRequest{Timestamp: base, Route: RouteKey{Host: "api"}})
+
+	snap := a.Snapshot(0)
+	if len(snap) != 2 {
+		t.Fatalf("want 2 hosts, got %d", len(snap))
+	}
+	api, legacy := snap[0], snap[1]
+
+	if api.Requests != 31 || api.Conns != 30 || api.NewConns != 1 || api.HTTP2Share < 0.96 {
+		t.Fatalf("api = %+v", api)
+	}
+	if len(api.Flags) != 0 || len(api.IPs) != 1 || api.IPChanges != 0 {
+		t.Fatalf("api flags=%v ips=%v changes=%d", api.Flags, api.IPs, api.IPChanges)
+	}
+
+	if legacy.ReuseRatio != 0 || legacy.NewConns != 30 || legacy.NewConnsPerMin < 15 {
+		t.Fatalf("legacy reuse=%v new=%d per-min=%v", legacy.ReuseRatio, legacy.NewConns, legacy.NewConnsPerMin)
+	}
+	// 30 connections over 116s: 15 in minute 0, 15 in minute 1 (the last).
+	if legacy.NewConnsLastMin != 15 {
+		t.Fatalf("new conns last minute = %d, want 15", legacy.NewConnsLastMin)
+	}
+	if len(legacy.IPs) != 2 || legacy.IPChanges != 29 || legacy.NewIPs != 1 {
+		t.Fatalf("legacy ips=%v changes=%d new=%d", legacy.IPs, legacy.IPChanges, legacy.NewIPs)
+	}
+	if p := legacy.Phases[PhaseTLS].P95; p < 350*time.Millisecond {
+		t.Fatalf("legacy tls p95 = %v", p)
+	}
+	want := map[string]bool{FlagPoorKeepAlive: true, FlagSlowTLS: true}
+	if len(legacy.Flags) != len(want) {
+		t.Fatalf("legacy flags = %v", legacy.Flags)
+	}
+	for _, f := range legacy.Flags {
+		if !want[f] {
+			t.Fatalf("unexpected flag %q in %v", f, legacy.Flags)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+//
+// JSON helpers shared by the schema features: drift detection here, and
+// OpenAPI inference and contract validation in the proxy.
+//
+
+// IsJSONMediaType reports whether a Content-Type (parameters allowed)
+// carries JSON: application/json or any +json suffix.
+func IsJSONMediaType(ct string) bool {
+	mt := normalizeContentType(ct)
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// DecodeJSON parses a body holding exactly one JSON value. Numbers are kept
+// as json.Number so integers and decimals stay distinguishable.
+func DecodeJSON(body []byte) (any, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+// JSONType returns the JSON Schema type of a decoded value: null, boolean,
+// string, integer, number, array or object. Integral numbers written without
+// a fraction or exponent are "integer", even beyond int64.
+func JSONType(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := x.Float64(); err == nil && f == math.Trunc(f) && !strings.ContainsAny(string(x), ".eE") {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
@@ -2,10 +2,26 @@ package analysis
 
 import (
 	"math"
-	"sync"
 	"time"
 )
 
+// LatencyBucketBounds are the inclusive upper bounds of the fixed latency
+// histogram kept per route. Observations above the last bound land in an
+// implicit +Inf bucket.
+var LatencyBucketBounds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
 // LatencyStats holds aggregated latency metrics for a single route.
 type LatencyStats struct {
 	Count       int64         // number of observations
@@ -14,6 +30,22 @@ type LatencyStats struct {
 	Max         time.Duration // max latency
 	Min         time.Duration // min latency
 	LastUpdated time.Time     // last time this route saw traffic
+	Buckets     []int64       // per-bucket counts, len(LatencyBucketBounds)+1 (last = +Inf)
+
+	Sketch *LatencySketch            // total latency quantile sketch
+	Phases map[string]*LatencySketch // per-phase sketches (PhaseDNS, ...)
+}
+
+// observe adds one latency to the histogram buckets.
+func (s *LatencyStats) observe(lat time.Duration) {
+	if s.Buckets == nil {
+		s.Buckets = make([]int64, len(LatencyBucketBounds)+1)
+	}
+	i := 0
+	for i < len(LatencyBucketBounds) && lat > LatencyBucketBounds[i] {
+		i++
+	}
+	s.Buckets[i]++
 }
 
 // Mean returns the average latency for the route.
@@ -46,19 +78,27 @@ type RouteLatencySnapshot struct {
 	StdDev      time.Duration // stddev
 	Min         time.Duration // min latency
 	Max         time.Duration // max latency
+	Total       time.Duration // sum of latencies
+	Buckets     []int64       // histogram counts aligned with LatencyBucketBounds (+Inf last)
 	LastUpdated time.Time     // last seen
+
+	Quantiles QuantileEstimate            // P50..P99.9 of total latency
+	Phases    map[string]QuantileEstimate // per-phase quantiles, only for phases seen
+	PhaseN    map[string]int64            // observations per phase
 }
 
 // LatencyAnalyzer aggregates latency distributions per route (RouteKey).
 type LatencyAnalyzer struct {
-	mu      sync.RWMutex
-	byRoute map[RouteKey]*LatencyStats
+	*boundedBase
+	byRoute *boundedMap[RouteKey, *LatencyStats]
 }
 
 // NewLatencyAnalyzer constructs an empty LatencyAnalyzer.
 func NewLatencyAnalyzer() *LatencyAnalyzer {
+	byRoute := newBoundedMap[RouteKey, *LatencyStats](DefaultLimits)
 	return &LatencyAnalyzer{
-		byRoute: make(map[RouteKey]*LatencyStats),
+		boundedBase: newBoundedBase("latency", byRoute),
+		byRoute:     byRoute,
 	}
 }
 
@@ -80,7 +120,7 @@ func (a *LatencyAnalyzer) OnRequest(ev *ObservedRequest) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	stats, ok := a.byRoute[ev.Route]
+	stats, ok := a.byRoute.get(ev.Route, now)
 	if !ok {
 		stats = &LatencyStats{
 			Count:       0,
@@ -89,8 +129,10 @@ func (a *LatencyAnalyzer) OnRequest(ev *ObservedRequest) {
 			Max:         0,
 			Min:         0,
 			LastUpdated: now,
+			Sketch:      NewLatencySketch(),
+			Phases:      make(map[string]*LatencySketch),
 		}
-		a.byRoute[ev.Route] = stats
+		a.byRoute.put(ev.Route, stats, now)
 	}
 
 	stats.Count++
@@ -109,9 +151,56 @@ func (a *LatencyAnalyzer) OnRequest(ev *ObservedRequest) {
 
 	ns := float64(lat)
 	stats.SquaredNS += ns * ns
+	stats.observe(lat)
+	stats.Sketch.Add(lat)
+	ev.Phases.each(func(name string, d time.Duration) {
+		sk := stats.Phases[name]
+		if sk == nil {
+			sk = NewLatencySketch()
+			stats.Phases[name] = sk
+		}
+		sk.Add(d)
+	})
 	stats.LastUpdated = now
 }
 
+// merge folds the observations of o into s.
+func (s *LatencyStats) merge(o *LatencyStats) {
+	if o.Count > 0 && (s.Count == 0 || o.Min < s.Min) {
+		s.Min = o.Min
+	}
+	if o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Count += o.Count
+	s.Total += o.Total
+	s.SquaredNS += o.SquaredNS
+	if o.LastUpdated.After(s.LastUpdated) {
+		s.LastUpdated = o.LastUpdated
+	}
+	if len(o.Buckets) > 0 {
+		if s.Buckets == nil {
+			s.Buckets = make([]int64, len(o.Buckets))
+		}
+		for i, n := range o.Buckets {
+			s.Buckets[i] += n
+		}
+	}
+	s.Sketch.Merge(o.Sketch)
+	for name, sk := range o.Phases {
+		if s.Phases[name] == nil {
+			s.Phases[name] = NewLatencySketch()
+		}
+		s.Phases[name].Merge(sk)
+	}
+}
+
+func (a *LatencyAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byRoute.rekey(rename, (*LatencyStats).merge)
+	a.mu.Unlock()
+}
+
 // Snapshot returns a snapshot of per-route latency stats.
 // If minCount > 0, routes with fewer than minCount observations are filtered out.
 func (a *LatencyAnalyzer) Snapshot(minCount int64) []RouteLatencySnapshot {
@@ -122,10 +211,10 @@ func (a *LatencyAnalyzer) Snapshot(minCount int64) []RouteLatencySnapshot {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	out := make([]RouteLatencySnapshot, 0, len(a.byRoute))
-	for route, stats := range a.byRoute {
+	out := make([]RouteLatencySnapshot, 0, a.byRoute.len())
+	a.byRoute.each(func(route RouteKey, stats *LatencyStats) bool {
 		if minCount > 0 && stats.Count < minCount {
-			continue
+			return true
 		}
 
 		snap := RouteLatencySnapshot{
@@ -135,10 +224,40 @@ func (a *LatencyAnalyzer) Snapshot(minCount int64) []RouteLatencySnapshot {
 			StdDev:      stats.StdDev(),
 			Min:         stats.Min,
 			Max:         stats.Max,
+			Total:       stats.Total,
+			Buckets:     append([]int64(nil), stats.Buckets...),
 			LastUpdated: stats.LastUpdated,
+			Quantiles:   stats.Sketch.Estimate(),
+		}
+		if len(stats.Phases) > 0 {
+			snap.Phases = make(map[string]QuantileEstimate, len(stats.Phases))
+			snap.PhaseN = make(map[string]int64, len(stats.Phases))
+			for name, sk := range stats.Phases {
+				snap.Phases[name] = sk.Estimate()
+				snap.PhaseN[name] = sk.Count()
+			}
 		}
 		out = append(out, snap)
+		return true
+	})
+	return out
+}
+
+// MergedSketch combines the total-latency sketches of every route accepted by
+// keep (nil = all routes), e.g. to get quantiles for a whole host.
+func (a *LatencyAnalyzer) MergedSketch(keep func(RouteKey) bool) *LatencySketch {
+	out := NewLatencySketch()
+	if a == nil {
+		return out
 	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	a.byRoute.each(func(route RouteKey, stats *LatencyStats) bool {
+		if keep == nil || keep(route) {
+			out.Merge(stats.Sketch)
+		}
+		return true
+	})
 	return out
 }
 
@@ -64,3 +64,57 @@ func TestLatencyAnalyzerSnapshotMinCount(t *testing.T) {
 		t.Fatalf("expected route2 in snapshot, got %#v", snaps[0].Route)
 	}
 }
+
+func TestLatencyAnalyzerHistogramBuckets(t *testing.T) {
+	a := NewLatencyAnalyzer()
+	route := RouteKey{Host: "h", Path: "/p", Method: "GET"}
+	for _, d := range []time.Duration{
+		3 * time.Millisecond,  // <= 5ms
+		5 * time.Millisecond,  // <= 5ms (bounds are inclusive)
+		70 * time.Millisecond, // <= 100ms
+		time.Minute,           // +Inf
+	} {
+		a.OnRequest(&ObservedRequest{Route: route, Latency: d})
+	}
+
+	s := a.Snapshot(0)[0]
+	if len(s.Buckets) != len(LatencyBucketBounds)+1 {
+		t.Fatalf("expected %d buckets, got %d", len(LatencyBucketBounds)+1, len(s.Buckets))
+	}
+	if s.Buckets[0] != 2 || s.Buckets[4] != 1 || s.Buckets[len(s.Buckets)-1] != 1 {
+		t.Fatalf("unexpected buckets: %v", s.Buckets)
+	}
+	if s.Total != 3*time.Millisecond+5*time.Millisecond+70*time.Millisecond+time.Minute {
+		t.Fatalf("unexpected Total: %s", s.Total)
+	}
+}
+
+func TestLatencyAnalyzerQuantilesAndPhases(t *testing.T) {
+	a := NewLatencyAnalyzer()
+	route := RouteKey{Host: "h", Path: "/p", Method: "GET"}
+	for i := 1; i <= 100; i++ {
+		ev := &ObservedRequest{
+			Route:   route,
+			Latency: time.Duration(i) * time.Millisecond,
+			Phases:  PhaseTimings{TTFB: time.Duration(i) * time.Millisecond / 2},
+		}
+		if i%10 == 0 {
+			ev.Phases.DNS = 4 * time.Millisecond // only new connections resolve
+		}
+		a.OnRequest(ev)
+	}
+
+	s := a.Snapshot(0)[0]
+	if s.Quantiles.P99 < 97*time.Millisecond || s.Quantiles.P99 > 100*time.Millisecond {
+		t.Fatalf("unexpected P99: %s", s.Quantiles.P99)
+	}
+	if s.PhaseN[PhaseDNS] != 10 || s.PhaseN[PhaseTTFB] != 100 {
+		t.Fatalf("unexpected phase counts: %v", s.PhaseN)
+	}
+	if _, ok := s.Phases[PhaseTLS]; ok {
+		t.Fatalf("unobserved phase should be absent: %v", s.Phases)
+	}
+	if p := s.Phases[PhaseDNS].P50; p != 4*time.Millisecond {
+		t.Fatalf("unexpected DNS P50: %s", p)
+	}
+}
@@ -0,0 +1,408 @@
+package analysis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+//
+// Bounded analyzer state
+//
+
+// Limits bounds the per-key state an analyzer keeps (routes, clients, ...).
+type Limits struct {
+	// MaxEntries caps the number of keys; the least recently updated key is
+	// evicted beyond it. 0 = unlimited.
+	MaxEntries int `json:"max_entries"`
+	// MaxAge drops keys not updated within this sliding window, measured
+	// against the newest event seen (so replays of old captures behave like
+	// live traffic). 0 = keep forever.
+	MaxAge time.Duration `json:"max_age_ns"`
+}
+
+// DefaultLimits is what the analyzer constructors start with; use
+// Registry.SetLimits to change it.
+var DefaultLimits = Limits{MaxEntries: 10000}
+
+// CapacityStats reports how full an analyzer is and what it has dropped.
+type CapacityStats struct {
+	Analyzer   string        `json:"analyzer"`
+	Entries    int           `json:"entries"`
+	MaxEntries int           `json:"max_entries"` // 0 = unlimited
+	MaxAge     time.Duration `json:"max_age_ns,omitempty"`
+	Evicted    int64         `json:"evicted"` // dropped by the entry cap (LRU)
+	Expired    int64         `json:"expired"` // dropped by the MaxAge window
+}
+
+// BoundedAnalyzer is implemented by analyzers whose memory can be capped,
+// inspected and cleared at runtime.
+type BoundedAnalyzer interface {
+	Analyzer
+	Name() string
+	SetLimits(Limits)
+	Capacity() CapacityStats
+	Reset()
+}
+
+// boundedStore is the management side of a boundedMap, whatever its types.
+type boundedStore interface {
+	setLimits(Limits)
+	reset()
+	capacity(name string) CapacityStats
+}
+
+// boundedBase implements the BoundedAnalyzer management methods for an
+// analyzer whose state lives in boundedMaps. Analyzers embed it and guard
+// their own state with its mu; one with more to clear wraps Reset.
+type boundedBase struct {
+	mu     sync.RWMutex
+	name   string
+	stores []boundedStore
+}
+
+func newBoundedBase(name string, stores ...boundedStore) *boundedBase {
+	return &boundedBase{name: name, stores: stores}
+}
+
+// Name identifies the analyzer for /metrics/reset and /metrics/capacity.
+func (b *boundedBase) Name() string { return b.name }
+
+// SetLimits applies entry caps and the idle window.
+func (b *boundedBase) SetLimits(lim Limits) {
+	b.mu.Lock()
+	for _, s := range b.stores {
+		s.setLimits(lim)
+	}
+	b.mu.Unlock()
+}
+
+// Capacity reports the number of tracked keys and what was dropped.
+func (b *boundedBase) Capacity() CapacityStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	c := CapacityStats{Analyzer: b.name}
+	for i, s := range b.stores {
+		sc := s.capacity(b.name)
+		if i == 0 {
+			c = sc
+			continue
+		}
+		c.Entries += sc.Entries
+		c.Evicted += sc.Evicted
+		c.Expired += sc.Expired
+	}
+	return c
+}
+
+// Reset forgets all accumulated state.
+func (b *boundedBase) Reset() {
+	b.mu.Lock()
+	for _, s := range b.stores {
+		s.reset()
+	}
+	b.mu.Unlock()
+}
+
+// agingEntry is implemented by values that keep timestamped history. With a
+// MaxAge set, a boundedMap prunes that history whenever the entry is used, so
+// a key that stays active does not keep samples from outside the window.
+type agingEntry interface {
+	pruneBefore(cutoff time.Time)
+}
+
+// boundedMap is a map with LRU eviction and idle expiry. It is not safe for
+// concurrent use; analyzers guard it with their own mutex. get and put count
+// as use, so callers must hold the write lock for them; each, peek and len
+// are read-only.
+type boundedMap[K comparable, V any] struct {
+	limits  Limits
+	items   map[K]*list.Element
+	order   *list.List // front = most recently updated
+	newest  time.Time  // high-water mark of event time
+	evicted int64
+	expired int64
+}
+
+type boundedEntry[K comparable, V any] struct {
+	key  K
+	val  V
+	seen time.Time
+}
+
+func newBoundedMap[K comparable, V any](lim Limits) *boundedMap[K, V] {
+	return &boundedMap[K, V]{
+		limits: lim,
+		items:  make(map[K]*list.Element),
+		order:  list.New(),
+	}
+}
+
+// advance moves the clock forward and drops entries outside the window.
+func (m *boundedMap[K, V]) advance(now time.Time) {
+	if now.After(m.newest) {
+		m.newest = now
+	}
+	if m.limits.MaxAge <= 0 {
+		return
+	}
+	cutoff := m.newest.Add(-m.limits.MaxAge)
+	for e := m.order.Back(); e != nil; e = m.order.Back() {
+		be := e.Value.(*boundedEntry[K, V])
+		if !be.seen.Before(cutoff) {
+			break
+		}
+		m.order.Remove(e)
+		delete(m.items, be.key)
+		m.expired++
+	}
+}
+
+// get returns the value for k and marks it used at now.
+func (m *boundedMap[K, V]) get(k K, now time.Time) (V, bool) {
+	m.advance(now)
+	e, ok := m.items[k]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	be := e.Value.(*boundedEntry[K, V])
+	if now.After(be.seen) {
+		be.seen = now
+	}
+	m.order.MoveToFront(e)
+	m.prune(be.val)
+	return be.val, true
+}
+
+// prune drops v's history from before the MaxAge window.
+func (m *boundedMap[K, V]) prune(v V) {
+	if m.limits.MaxAge <= 0 {
+		return
+	}
+	if ae, ok := any(v).(agingEntry); ok {
+		ae.pruneBefore(m.newest.Add(-m.limits.MaxAge))
+	}
+}
+
+// put stores v under k, evicting the least recently used key if over cap.
+func (m *boundedMap[K, V]) put(k K, v V, now time.Time) {
+	m.advance(now)
+	if e, ok := m.items[k]; ok {
+		be := e.Value.(*boundedEntry[K, V])
+		be.val = v
+		if now.After(be.seen) {
+			be.seen = now
+		}
+		m.order.MoveToFront(e)
+		m.prune(v)
+		return
+	}
+	m.items[k] = m.order.PushFront(&boundedEntry[K, V]{key: k, val: v, seen: now})
+	for m.limits.MaxEntries > 0 && len(m.items) > m.limits.MaxEntries {
+		e := m.order.Back()
+		delete(m.items, e.Value.(*boundedEntry[K, V]).key)
+		m.order.Remove(e)
+		m.evicted++
+	}
+}
+
+// each visits live entries, most recently used first, until fn returns false.
+func (m *boundedMap[K, V]) each(fn func(K, V) bool) {
+	var cutoff time.Time
+	if m.limits.MaxAge > 0 {
+		cutoff = m.newest.Add(-m.limits.MaxAge)
+	}
+	for e := m.order.Front(); e != nil; e = e.Next() {
+		be := e.Value.(*boundedEntry[K, V])
+		if !cutoff.IsZero() && be.seen.Before(cutoff) {
+			break
+		}
+		if !fn(be.key, be.val) {
+			return
+		}
+	}
+}
+
+// peek returns the value for k without marking it used; read-only.
+func (m *boundedMap[K, V]) peek(k K) (V, bool) {
+	var zero V
+	e, ok := m.items[k]
+	if !ok {
+		return zero, false
+	}
+	be := e.Value.(*boundedEntry[K, V])
+	if m.limits.MaxAge > 0 && be.seen.Before(m.newest.Add(-m.limits.MaxAge)) {
+		return zero, false
+	}
+	return be.val, true
+}
+
+func (m *boundedMap[K, V]) len() int { return len(m.items) }
+
+// remove drops k, if present.
+func (m *boundedMap[K, V]) remove(k K) {
+	if e, ok := m.items[k]; ok {
+		m.order.Remove(e)
+		delete(m.items, k)
+	}
+}
+
+// rekey moves every entry to rename(key). An entry whose new key is already
+// taken is folded into that entry with merge(dst, src), which keeps the more
+// recent use time and list position of the two.
+func (m *boundedMap[K, V]) rekey(rename func(K) K, merge func(dst, src V)) {
+	var moved []*list.Element
+	for e := m.order.Front(); e != nil; e = e.Next() {
+		be := e.Value.(*boundedEntry[K, V])
+		if rename(be.key) != be.key {
+			moved = append(moved, e)
+		}
+	}
+	for _, e := range moved {
+		be := e.Value.(*boundedEntry[K, V])
+		nk := rename(be.key)
+		delete(m.items, be.key)
+		de, ok := m.items[nk]
+		if !ok {
+			be.key = nk
+			m.items[nk] = e
+			continue
+		}
+		dst := de.Value.(*boundedEntry[K, V])
+		merge(dst.val, be.val)
+		if be.seen.After(dst.seen) {
+			dst.seen = be.seen
+			m.order.MoveBefore(de, e)
+		}
+		m.order.Remove(e)
+	}
+}
+
+// setLimits applies new limits, trimming immediately.
+func (m *boundedMap[K, V]) setLimits(lim Limits) {
+	m.limits = lim
+	m.advance(m.newest)
+	for e := m.order.Front(); e != nil; e = e.Next() {
+		m.prune(e.Value.(*boundedEntry[K, V]).val)
+	}
+	for lim.MaxEntries > 0 && len(m.items) > lim.MaxEntries {
+		e := m.order.Back()
+		delete(m.items, e.Value.(*boundedEntry[K, V]).key)
+		m.order.Remove(e)
+		m.evicted++
+	}
+}
+
+// reset drops every entry and the eviction counters.
+func (m *boundedMap[K, V]) reset() {
+	m.items = make(map[K]*list.Element)
+	m.order.Init()
+	m.newest = time.Time{}
+	m.evicted, m.expired = 0, 0
+}
+
+func (m *boundedMap[K, V]) capacity(name string) CapacityStats {
+	return CapacityStats{
+		Analyzer:   name,
+		Entries:    len(m.items),
+		MaxEntries: m.limits.MaxEntries,
+		MaxAge:     m.limits.MaxAge,
+		Evicted:    m.evicted,
+		Expired:    m.expired,
+	}
+}
+
+// maxValueCounts caps per-entry value histograms so a client rotating tokens
+// or user agents cannot grow one entry without bound.
+const maxValueCounts = 64
+
+// addCount increments m[k], keeping m at most max keys: a new key first
+// evicts the least frequent existing one, so a fresh value is always
+// recorded. Used for per-entry value histograms (auth values, UAs, ...).
+func addCount[K comparable](m map[K]int64, k K, max int) {
+	if _, ok := m[k]; !ok && max > 0 {
+		for len(m) >= max {
+			var victim K
+			least := int64(-1)
+			for key, n := range m {
+				if least < 0 || n < least {
+					victim, least = key, n
+				}
+			}
+			delete(m, victim)
+		}
+	}
+	m[k]++
+}
+
+// mergeCounts adds the counts of src into dst. With max > 0, keys new to dst
+// are only added while it holds fewer than max.
+func mergeCounts[K comparable](dst, src map[K]int64, max int) {
+	for k, n := range src {
+		if _, ok := dst[k]; !ok && max > 0 && len(dst) >= max {
+			continue
+		}
+		dst[k] += n
+	}
+}
+
+//
+// Registry-level management
+//
+
+// Analyzers returns the names of analyzers that support limits and reset.
+func (r *Registry) Analyzers() []string {
+	if r == nil {
+		return nil
+	}
+	var out []string
+	for _, a := range r.analyzers {
+		if b, ok := a.(BoundedAnalyzer); ok {
+			out = append(out, b.Name())
+		}
+	}
+	return out
+}
+
+// SetLimits applies limits to every bounded analyzer.
+func (r *Registry) SetLimits(lim Limits) {
+	if r == nil {
+		return
+	}
+	for _, a := range r.analyzers {
+		if b, ok := a.(BoundedAnalyzer); ok {
+			b.SetLimits(lim)
+		}
+	}
+}
+
+// Capacity reports the state size of every bounded analyzer.
+func (r *Registry) Capacity() []CapacityStats {
+	if r == nil {
+		return nil
+	}
+	var out []CapacityStats
+	for _, a := range r.analyzers {
+		if b, ok := a.(BoundedAnalyzer); ok {
+			out = append(out, b.Capacity())
+		}
+	}
+	return out
+}
+
+// Reset clears the named analyzer, or all of them when name is "". It
+// reports whether anything matched.
+func (r *Registry) Reset(name string) bool {
+	if r == nil {
+		return false
+	}
+	found := false
+	for _, a := range r.analyzers {
+		if b, ok := a.(BoundedAnalyzer); ok && (name == "" || b.Name() == name) {
+			b.Reset()
+			found = true
+		}
+	}
+	return found
+}
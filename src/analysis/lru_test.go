@@ -0,0 +1,145 @@
+package analysis
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBoundedMapEvictsLeastRecentlyUsed(t *testing.T) {
+	m := newBoundedMap[string, int](Limits{MaxEntries: 2})
+	now := time.Unix(1000, 0)
+
+	m.put("a", 1, now)
+	m.put("b", 2, now.Add(time.Second))
+	m.get("a", now.Add(2*time.Second)) // a is now more recent than b
+	m.put("c", 3, now.Add(3*time.Second))
+
+	if _, ok := m.get("b", now.Add(3*time.Second)); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	if _, ok := m.get("a", now.Add(3*time.Second)); !ok {
+		t.Fatalf("expected a to survive")
+	}
+	if c := m.capacity("x"); c.Entries != 2 || c.Evicted != 1 {
+		t.Fatalf("unexpected capacity %+v", c)
+	}
+}
+
+func TestBoundedMapExpiresIdleEntries(t *testing.T) {
+	m := newBoundedMap[string, int](Limits{MaxAge: time.Minute})
+	now := time.Unix(1000, 0)
+
+	m.put("old", 1, now)
+	m.put("new", 2, now.Add(50*time.Second))
+	m.put("newer", 3, now.Add(90*time.Second))
+
+	var keys []string
+	m.each(func(k string, _ int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if len(keys) != 2 || keys[0] != "newer" || keys[1] != "new" {
+		t.Fatalf("unexpected live keys %v", keys)
+	}
+	if c := m.capacity("x"); c.Expired != 1 {
+		t.Fatalf("expected one expiry, got %+v", c)
+	}
+}
+
+func TestMaxAgePrunesHistoryOfActiveKeys(t *testing.T) {
+	a := NewHostHealthAnalyzer()
+	a.SetLimits(Limits{MaxAge: time.Hour})
+	t0 := time.Unix(1000, 0)
+	send := func(at time.Time, addr string) {
+		a.OnRequest(&ObservedRequest{Timestamp: at, Route: RouteKey{Host: "api"}, ServerAddr: addr})
+	}
+	send(t0, "10.0.0.1:443")
+	for i := 1; i <= 3; i++ {
+		send(t0.Add(time.Duration(i)*time.Hour), "10.0.0.2:443") // the host never goes idle
+	}
+	snaps := a.Snapshot(0)
+	if len(snaps) != 1 || len(snaps[0].IPs) != 1 || snaps[0].IPs[0].IP != "10.0.0.2" {
+		t.Fatalf("stale address kept: %+v", snaps)
+	}
+}
+
+func TestRegistryLimitsAndReset(t *testing.T) {
+	reg := NewDefaultRegistry()
+	reg.SetLimits(Limits{MaxEntries: 3})
+
+	base := time.Unix(1000, 0)
+	for i := 0; i < 10; i++ {
+		reg.OnRequest(&ObservedRequest{
+			Timestamp:  base.Add(time.Duration(i) * time.Second),
+			Client:     ClientID{IP: "10.0.0." + strconv.Itoa(i)},
+			Route:      RouteKey{Host: "example.com", Method: "GET", Path: "/r/" + strconv.Itoa(i)},
+			Method:     "GET",
+			Path:       "/r/" + strconv.Itoa(i),
+			StatusCode: 200,
+			Outcome:    Outcome2xx,
+			Latency:    time.Millisecond,
+		})
+	}
+
+	if got := len(reg.Latency().Snapshot(0)); got != 3 {
+		t.Fatalf("expected latency capped at 3 routes, got %d", got)
+	}
+	var lat CapacityStats
+	for _, c := range reg.Capacity() {
+		if c.Analyzer == "latency" {
+			lat = c
+		}
+	}
+	if lat.Entries != 3 || lat.MaxEntries != 3 || lat.Evicted != 7 {
+		t.Fatalf("unexpected latency capacity %+v", lat)
+	}
+
+	if !reg.Reset("latency") {
+		t.Fatalf("expected latency to be known")
+	}
+	if got := len(reg.Latency().Snapshot(0)); got != 0 {
+		t.Fatalf("expected empty latency after reset, got %d", got)
+	}
+	if got := len(reg.MethodPath().Snapshot(0)); got != 3 {
+		t.Fatalf("reset of latency should not touch method/path, got %d", got)
+	}
+	if reg.Reset("nope") {
+		t.Fatalf("unknown analyzer should not match")
+	}
+	reg.Reset("")
+	if got := len(reg.MethodPath().Snapshot(0)); got != 0 {
+		t.Fatalf("expected everything cleared, got %d", got)
+	}
+}
+
+func TestAuthValuesAreCapped(t *testing.T) {
+	a := NewAuthCookieAnalyzer()
+	for i := 0; i < 5*maxValueCounts; i++ {
+		ev := &ObservedRequest{
+			Timestamp:  time.Unix(1000, 0),
+			Client:     ClientID{IP: "1.2.3.4"},
+			Route:      RouteKey{Host: "example.com"},
+			ReqHeaders: map[string][]string{"Authorization": {"Bearer " + strconv.Itoa(i)}},
+		}
+		a.OnRequest(ev)
+	}
+	snaps := a.Snapshot(0, 0)
+	if len(snaps) != 1 {
+		t.Fatalf("expected one snapshot, got %d", len(snaps))
+	}
+	if n := len(snaps[0].AuthValues); n > maxValueCounts {
+		t.Fatalf("auth values not capped: %d", n)
+	}
+}
+
+func TestAddCountKeepsTheNewKey(t *testing.T) {
+	m := map[string]int64{}
+	addCount(m, "a", 2)
+	addCount(m, "a", 2)
+	addCount(m, "b", 2)
+	addCount(m, "c", 2) // evicts b, the least frequent, not c
+	if len(m) != 2 || m["a"] != 2 || m["c"] != 1 {
+		t.Fatalf("counts = %v", m)
+	}
+}
@@ -2,7 +2,6 @@ package analysis
 
 import (
 	"strings"
-	"sync"
 	"time"
 	"unicode"
 )
@@ -39,14 +38,16 @@ type MethodPathSnapshot struct {
 // MethodPathAnalyzer maps RouteKey -> EndpointUsage and applies simple
 // heuristics for anomaly detection.
 type MethodPathAnalyzer struct {
-	mu      sync.RWMutex
-	byRoute map[RouteKey]*EndpointUsage
+	*boundedBase
+	byRoute *boundedMap[RouteKey, *EndpointUsage]
 }
 
 // NewMethodPathAnalyzer constructs an empty analyzer.
 func NewMethodPathAnalyzer() *MethodPathAnalyzer {
+	byRoute := newBoundedMap[RouteKey, *EndpointUsage](DefaultLimits)
 	return &MethodPathAnalyzer{
-		byRoute: make(map[RouteKey]*EndpointUsage),
+		boundedBase: newBoundedBase("methodpath", byRoute),
+		byRoute:     byRoute,
 	}
 }
 
@@ -64,18 +65,19 @@ func (a *MethodPathAnalyzer) OnRequest(ev *ObservedRequest) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	u, ok := a.byRoute[ev.Route]
+	u, ok := a.byRoute.get(ev.Route, now)
 	if !ok {
 		u = &EndpointUsage{
 			StatusCount: make(map[int]int64),
 		}
 		u.FirstSeen = now
-		a.byRoute[ev.Route] = u
+		a.byRoute.put(ev.Route, u, now)
 
 		// Method anomaly only needs to be computed once.
 		u.NonStandardMethod = isNonStandardMethod(ev.Method)
-		// High-entropy path anomaly only needs to be computed once.
-		u.HighEntropyPath = isHighEntropyPath(ev.Route.Path)
+		// High-entropy path anomaly only needs to be computed once. Route
+		// paths are templated, so look at the concrete path when we have it.
+		u.HighEntropyPath = isHighEntropyPath(ev.ConcretePath())
 	}
 
 	u.Count++
@@ -83,6 +85,23 @@ func (a *MethodPathAnalyzer) OnRequest(ev *ObservedRequest) {
 	u.StatusCount[ev.StatusCode]++
 }
 
+func (a *MethodPathAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byRoute.rekey(rename, func(dst, src *EndpointUsage) {
+		dst.Count += src.Count
+		if src.FirstSeen.Before(dst.FirstSeen) {
+			dst.FirstSeen = src.FirstSeen
+		}
+		if src.LastSeen.After(dst.LastSeen) {
+			dst.LastSeen = src.LastSeen
+		}
+		mergeCounts(dst.StatusCount, src.StatusCount, 0)
+		dst.NonStandardMethod = dst.NonStandardMethod || src.NonStandardMethod
+		dst.HighEntropyPath = dst.HighEntropyPath || src.HighEntropyPath
+	})
+	a.mu.Unlock()
+}
+
 // Snapshot returns a snapshot of method-path density and anomaly hints.
 //
 // minCount: if > 0, routes with Count < minCount are suppressed *unless*
@@ -98,14 +117,14 @@ func (a *MethodPathAnalyzer) Snapshot(minCount int64) []MethodPathSnapshot {
 
 	const rareThreshold int64 = 5 // heuristic "low density" threshold
 
-	out := make([]MethodPathSnapshot, 0, len(a.byRoute))
-	for route, usage := range a.byRoute {
+	out := make([]MethodPathSnapshot, 0, a.byRoute.len())
+	a.byRoute.each(func(route RouteKey, usage *EndpointUsage) bool {
 		// Filter: keep endpoints with enough density OR anomalous endpoints.
 		if minCount > 0 &&
 			usage.Count < minCount &&
 			!usage.NonStandardMethod &&
 			!usage.HighEntropyPath {
-			continue
+			return true
 		}
 
 		// Copy status counts so caller cannot mutate internal state.
@@ -126,7 +145,8 @@ func (a *MethodPathAnalyzer) Snapshot(minCount int64) []MethodPathSnapshot {
 			Rare:              usage.Count < rareThreshold,
 		}
 		out = append(out, snap)
-	}
+		return true
+	})
 
 	return out
 }
@@ -150,42 +170,43 @@ func isHighEntropyPath(path string) bool {
 		return false
 	}
 
-	segments := strings.Split(path, "/")
-	for _, seg := range segments {
-		if len(seg) < 12 {
-			continue
-		}
-		var letterCount, digitCount, otherCount int
-		for _, r := range seg {
-			switch {
-			case unicode.IsLetter(r):
-				letterCount++
-			case unicode.IsDigit(r):
-				digitCount++
-			default:
-				if r != '-' && r != '_' && r != '.' {
-					otherCount++
-				}
-			}
-		}
-		length := len(seg)
-		if length == 0 {
-			continue
-		}
-		// Heuristic: long segments with mostly letters+digits and
-		// enough "entropy" are considered suspicious.
-		alnum := letterCount + digitCount
-		if alnum >= int(float64(length)*0.8) && length >= 16 {
-			return true
-		}
-		// Or segments where digits dominate strongly, like numeric IDs.
-		if digitCount >= int(float64(length)*0.9) && length >= 10 {
+	for _, seg := range strings.Split(path, "/") {
+		if isHighEntropySegment(seg) {
 			return true
 		}
 	}
 	return false
 }
 
+// isHighEntropySegment is the per-segment test behind isHighEntropyPath.
+func isHighEntropySegment(seg string) bool {
+	if len(seg) < 12 {
+		return false
+	}
+	var letterCount, digitCount, otherCount int
+	for _, r := range seg {
+		switch {
+		case unicode.IsLetter(r):
+			letterCount++
+		case unicode.IsDigit(r):
+			digitCount++
+		default:
+			if r != '-' && r != '_' && r != '.' {
+				otherCount++
+			}
+		}
+	}
+	length := len(seg)
+	// Heuristic: long segments with mostly letters+digits and
+	// enough "entropy" are considered suspicious.
+	alnum := letterCount + digitCount
+	if alnum >= int(float64(length)*0.8) && length >= 16 {
+		return true
+	}
+	// Or segments where digits dominate strongly, like numeric IDs.
+	return digitCount >= int(float64(length)*0.9) && length >= 10
+}
+
 // MethodPath returns the MethodPathAnalyzer registered in this registry, if any.
 func (r *Registry) MethodPath() *MethodPathAnalyzer {
 	if r == nil {
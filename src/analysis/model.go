@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -69,6 +70,80 @@ type ObservedRequest struct {
 	TLS        TLSSignature
 	ServerAddr string
 	IsGRPC     bool
+	ReusedConn bool // the upstream connection was reused (keep-alive / h2)
+	HTTP2      bool // the upstream connection negotiated HTTP/2
+
+	// Per-phase upstream timings; zero means the phase did not happen
+	// (e.g. no DNS/connect/TLS on a reused connection).
+	Phases PhaseTimings
+
+	// Captured bodies (possibly truncated to the proxy's -max-body limit).
+	ReqBody           []byte
+	RespBody          []byte
+	ReqBodyTruncated  bool
+	RespBodyTruncated bool
+
+	// Contract conformance, when the host has a contract loaded.
+	ContractChecked    bool
+	ContractViolations []ContractViolation
+
+	// Secrets and PII found in the capture, when it was scanned.
+	SensitiveScanned  bool
+	SensitiveFindings []SensitiveFinding
+}
+
+// ConcretePath returns the request path the event was observed on. Route.Path
+// may be a template (/users/{id}); a "#method" RPC suffix on the route is kept
+// so distinct RPC calls on one endpoint stay distinct.
+func (ev *ObservedRequest) ConcretePath() string {
+	if ev.Path == "" {
+		return ev.Route.Path
+	}
+	if i := strings.IndexByte(ev.Route.Path, '#'); i >= 0 {
+		return ev.Path + ev.Route.Path[i:]
+	}
+	return ev.Path
+}
+
+// PhaseTimings breaks the upstream round trip into its phases.
+type PhaseTimings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration
+	Read    time.Duration
+	// ConnWait is GetConn -> GotConn: dialing (DNS, connect, TLS) for a new
+	// connection plus any time spent waiting for a pooled one.
+	ConnWait time.Duration
+}
+
+// Phase names used as keys in per-phase snapshots.
+const (
+	PhaseDNS      = "dns"
+	PhaseConnect  = "connect"
+	PhaseTLS      = "tls"
+	PhaseTTFB     = "ttfb"
+	PhaseRead     = "read"
+	PhaseConnWait = "conn_wait"
+)
+
+// each calls fn for every phase that was observed (non-zero).
+func (p PhaseTimings) each(fn func(name string, d time.Duration)) {
+	for _, ph := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{PhaseDNS, p.DNS},
+		{PhaseConnect, p.Connect},
+		{PhaseTLS, p.TLS},
+		{PhaseTTFB, p.TTFB},
+		{PhaseRead, p.Read},
+		{PhaseConnWait, p.ConnWait},
+	} {
+		if ph.d > 0 {
+			fn(ph.name, ph.d)
+		}
+	}
 }
 
 //
@@ -83,6 +158,8 @@ type Analyzer interface {
 // Registry fans out events to multiple analyzers.
 type Registry struct {
 	analyzers []Analyzer
+	info      []AnalyzerInfo // set by NewRegistryFromConfig
+	templater *PathTemplater // see UseTemplater
 }
 
 func NewRegistry(analyzers ...Analyzer) *Registry {
@@ -90,36 +167,36 @@ func NewRegistry(analyzers ...Analyzer) *Registry {
 }
 
 func (r *Registry) OnRequest(ev *ObservedRequest) {
+	if r.templater != nil && ev != nil {
+		ev.Route.Path = r.templater.Retemplate(ev.Route.Host, ev.Route.Path)
+	}
 	for _, a := range r.analyzers {
 		a.OnRequest(ev)
 	}
 }
 
-// QuantileEstimate is a minimal struct for latency quantiles.
-// If you use HDR histograms or t-digests, you can wrap them here.
+// QuantileEstimate is a minimal struct for latency quantiles, filled from a
+// LatencySketch.
 type QuantileEstimate struct {
-	P50 time.Duration
-	P90 time.Duration
-	P99 time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	P999 time.Duration
 }
 
 //
 // 10. Composed analyzer
 //
 
-// NewDefaultRegistry shows how you can wire up a combined analyzer set.
+// NewDefaultRegistry wires every registered analyzer that is on by default,
+// with default parameters (see config.go).
 func NewDefaultRegistry() *Registry {
-	return NewRegistry(
-		NewTemporalAnalyzer(time.Second, 300),
-		NewRetryAnalyzer(30*time.Second),
-		NewLatencyAnalyzer(),
-		NewErrorTransitionAnalyzer(),
-		NewSizeAnalyzer(),
-		NewClientFingerprintAnalyzer(),
-		NewMethodPathAnalyzer(),
-		NewAuthCookieAnalyzer(),
-		NewResponseProfileAnalyzer(),
-	)
+	reg, err := NewRegistryFromConfig(RegistryConfig{})
+	if err != nil {
+		panic(err) // the built-in defaults always parse
+	}
+	return reg
 }
 
 func ClassifyOutcome(status int) Outcome {
@@ -0,0 +1,388 @@
+package analysis
+
+import (
+	"strings"
+	"sync"
+)
+
+//
+// Path templating for RouteKey normalization
+//
+
+// Placeholders substituted for variable path segments.
+const (
+	SegmentID    = "{id}"    // all digits
+	SegmentUUID  = "{uuid}"  // 8-4-4-4-12 hex
+	SegmentHex   = "{hex}"   // long hex string (hashes, object IDs)
+	SegmentToken = "{token}" // high-entropy alnum (see isHighEntropyPath)
+	SegmentParam = "{param}" // learned: too many distinct literals at this position
+)
+
+// DefaultMaxLiterals is how many distinct literal values a path position may
+// take before the templater treats it as a variable.
+const DefaultMaxLiterals = 50
+
+// maxTemplatePositions bounds the learned state; once reached, unseen
+// positions are left literal instead of being tracked.
+const maxTemplatePositions = 10000
+
+// PathTemplater turns concrete request paths into route templates, e.g.
+// /users/123/orders/9f1c... -> /users/{id}/orders/{hex}. Segments are
+// classified by shape, and positions that keep producing new literals (slugs,
+// usernames) are learned as variable once they exceed MaxLiterals. User
+// overrides are consulted first and always win.
+type PathTemplater struct {
+	mu          sync.Mutex
+	MaxLiterals int
+	overrides   []string
+	positions   map[templatePosition]*positionStats
+	onPromote   func(host string)
+}
+
+// templatePosition identifies a segment slot by host and the templated
+// prefix before it, so /users/{id} and /teams/{id} learn independently.
+type templatePosition struct {
+	host   string
+	prefix string
+}
+
+type positionStats struct {
+	literals map[string]struct{}
+	variable bool
+}
+
+// NewPathTemplater constructs a templater with the given override patterns
+// (see MatchPathTemplate for the pattern syntax).
+func NewPathTemplater(overrides ...string) *PathTemplater {
+	t := &PathTemplater{
+		MaxLiterals: DefaultMaxLiterals,
+		positions:   make(map[templatePosition]*positionStats),
+	}
+	t.SetOverrides(overrides)
+	return t
+}
+
+// SetOverrides replaces the user-supplied patterns. Patterns are matched in
+// order; the first match is used as the template verbatim.
+func (t *PathTemplater) SetOverrides(patterns []string) {
+	var clean []string
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p != "" {
+			clean = append(clean, p)
+		}
+	}
+	t.mu.Lock()
+	t.overrides = clean
+	t.mu.Unlock()
+}
+
+// Overrides returns the current override patterns.
+func (t *PathTemplater) Overrides() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.overrides...)
+}
+
+// Clone returns an independent copy of the templater, so callers can template
+// paths (and learn from them) without changing what live traffic sees.
+func (t *PathTemplater) Clone() *PathTemplater {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := &PathTemplater{
+		MaxLiterals: t.MaxLiterals,
+		overrides:   append([]string(nil), t.overrides...),
+		positions:   make(map[templatePosition]*positionStats, len(t.positions)),
+	}
+	for pos, st := range t.positions {
+		cp := &positionStats{variable: st.variable}
+		if st.literals != nil {
+			cp.literals = make(map[string]struct{}, len(st.literals))
+			for lit := range st.literals {
+				cp.literals[lit] = struct{}{}
+			}
+		}
+		c.positions[pos] = cp
+	}
+	return c
+}
+
+// SetPromoteHandler installs a callback invoked (outside the templater's
+// lock) whenever a position on host is learned as a parameter. Routes
+// templated before that still carry the literal; see Retemplate.
+func (t *PathTemplater) SetPromoteHandler(fn func(host string)) {
+	t.mu.Lock()
+	t.onPromote = fn
+	t.mu.Unlock()
+}
+
+// Template returns the route template for a concrete path and learns from it.
+func (t *PathTemplater) Template(host, path string) string {
+	if t == nil || path == "" || path == "/" {
+		return path
+	}
+	t.mu.Lock()
+	out, promoted := t.template(host, path, true)
+	fn := t.onPromote
+	t.mu.Unlock()
+	if promoted && fn != nil {
+		fn(host)
+	}
+	return out
+}
+
+// Retemplate applies what has been learned so far to a path or to a template
+// produced earlier, without learning from it. Literal segments at positions
+// promoted since become {param}; placeholders are kept. A "#method" RPC
+// suffix is preserved.
+func (t *PathTemplater) Retemplate(host, tmpl string) string {
+	if t == nil || tmpl == "" || tmpl == "/" {
+		return tmpl
+	}
+	path, suffix := tmpl, ""
+	if i := strings.IndexByte(tmpl, '#'); i >= 0 {
+		path, suffix = tmpl[:i], tmpl[i:]
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.overrides {
+		if p == path {
+			return tmpl
+		}
+	}
+	out, _ := t.template(host, path, false)
+	return out + suffix
+}
+
+// template does the work of Template and Retemplate; t.mu must be held. It
+// reports whether learning promoted a position.
+func (t *PathTemplater) template(host, path string, learn bool) (string, bool) {
+	for _, p := range t.overrides {
+		if _, ok := MatchPathTemplate(p, path); ok {
+			return p, false
+		}
+	}
+
+	maxLit := t.MaxLiterals
+	if maxLit <= 0 {
+		maxLit = DefaultMaxLiterals
+	}
+
+	promoted := false
+	segs := strings.Split(path, "/")
+	var b strings.Builder
+	for i, seg := range segs {
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		if seg == "" {
+			continue
+		}
+		if !learn && isPlaceholder(seg) {
+			b.WriteString(seg)
+			continue
+		}
+		if ph := classifySegment(seg); ph != "" {
+			b.WriteString(ph)
+			continue
+		}
+		pos := templatePosition{host: host, prefix: b.String()}
+		st := t.positions[pos]
+		if !learn {
+			if st != nil && st.variable {
+				b.WriteString(SegmentParam)
+			} else {
+				b.WriteString(seg)
+			}
+			continue
+		}
+		if st == nil {
+			if len(t.positions) >= maxTemplatePositions {
+				b.WriteString(seg)
+				continue
+			}
+			st = &positionStats{literals: make(map[string]struct{})}
+			t.positions[pos] = st
+		}
+		if !st.variable {
+			st.literals[seg] = struct{}{}
+			if len(st.literals) > maxLit {
+				st.variable = true
+				st.literals = nil
+				promoted = true
+			}
+		}
+		if st.variable {
+			b.WriteString(SegmentParam)
+		} else {
+			b.WriteString(seg)
+		}
+	}
+	return b.String(), promoted
+}
+
+// isPlaceholder reports whether a template segment is a parameter rather
+// than a literal.
+func isPlaceholder(seg string) bool {
+	return seg == "*" || seg == "**" || (len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}')
+}
+
+// classifySegment returns the placeholder for a segment whose shape marks it
+// as an identifier, or "" for a literal.
+func classifySegment(seg string) string {
+	switch {
+	case isNumericSegment(seg):
+		return SegmentID
+	case isUUIDSegment(seg):
+		return SegmentUUID
+	case isHexSegment(seg):
+		return SegmentHex
+	case isHighEntropySegment(seg) && strings.ContainsAny(seg, "0123456789"):
+		// Requiring a digit keeps long word slugs literal.
+		return SegmentToken
+	}
+	return ""
+}
+
+func isNumericSegment(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	for _, r := range seg {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexRune(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func isUUIDSegment(seg string) bool {
+	if len(seg) != 36 {
+		return false
+	}
+	for i, r := range seg {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if !isHexRune(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isHexSegment matches hex strings of at least 8 characters that contain a
+// digit, so hex-looking words ("deadbeef", "facade") stay literal.
+func isHexSegment(seg string) bool {
+	if len(seg) < 8 {
+		return false
+	}
+	digit := false
+	for _, r := range seg {
+		if !isHexRune(r) {
+			return false
+		}
+		if r >= '0' && r <= '9' {
+			digit = true
+		}
+	}
+	return digit
+}
+
+// MatchPathTemplate reports whether a concrete path matches a template and
+// returns the captured parameters. A "{name}" segment matches exactly one
+// non-empty segment, "*" matches one segment without capturing, and a
+// trailing "{name...}" or "**" matches the rest of the path.
+func MatchPathTemplate(template, path string) (map[string]string, bool) {
+	tsegs := strings.Split(strings.Trim(template, "/"), "/")
+	psegs := strings.Split(strings.Trim(path, "/"), "/")
+	var params map[string]string
+	for i, ts := range tsegs {
+		if ts == "**" || (strings.HasPrefix(ts, "{") && strings.HasSuffix(ts, "...}")) {
+			if i != len(tsegs)-1 {
+				return nil, false
+			}
+			if ts != "**" {
+				if params == nil {
+					params = make(map[string]string)
+				}
+				params[ts[1:len(ts)-4]] = strings.Join(psegs[min(i, len(psegs)):], "/")
+			}
+			return params, true
+		}
+		if i >= len(psegs) {
+			return nil, false
+		}
+		ps := psegs[i]
+		switch {
+		case ts == "*":
+			if ps == "" {
+				return nil, false
+			}
+		case len(ts) > 2 && ts[0] == '{' && ts[len(ts)-1] == '}':
+			if ps == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[ts[1:len(ts)-1]] = ps
+		default:
+			if ts != ps {
+				return nil, false
+			}
+		}
+	}
+	if len(tsegs) != len(psegs) {
+		return nil, false
+	}
+	return params, true
+}
+
+//
+// Folding routes after a promotion
+//
+
+// routeMerger is implemented by analyzers that keep state per route. rename
+// maps a route to its current template; routes that end up equal are merged.
+type routeMerger interface {
+	mergeRoutes(rename func(RouteKey) RouteKey)
+}
+
+// UseTemplater makes the registry re-template incoming routes with t, so
+// events templated before a promotion (queued, or replayed from storage)
+// land on the promoted route. It does not install a promote handler; the
+// owner of t wires that to RetemplateRoutes.
+func (r *Registry) UseTemplater(t *PathTemplater) {
+	r.templater = t
+}
+
+// RetemplateRoutes re-templates the routes tracked for host with the
+// registry's templater and merges those that now share a template, e.g. the
+// first MaxLiterals /people/<name> routes into /people/{param}.
+func (r *Registry) RetemplateRoutes(host string) {
+	if r == nil || r.templater == nil {
+		return
+	}
+	rename := func(k RouteKey) RouteKey {
+		if k.Host == host {
+			k.Path = r.templater.Retemplate(k.Host, k.Path)
+		}
+		return k
+	}
+	for _, a := range r.analyzers {
+		if m, ok := a.(routeMerger); ok {
+			m.mergeRoutes(rename)
+		}
+	}
+}
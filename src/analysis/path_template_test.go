@@ -0,0 +1,149 @@
+package analysis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPathTemplaterShapes(t *testing.T) {
+	tp := NewPathTemplater()
+	tests := []struct{ in, want string }{
+		{"/users/123", "/users/{id}"},
+		{"/users/123/orders/550e8400-e29b-41d4-a716-446655440000", "/users/{id}/orders/{uuid}"},
+		{"/blobs/9f1c2ab3d4e5", "/blobs/{hex}"},
+		{"/s/aZ3kq9XbT1mNw7pQ", "/s/{token}"},
+		{"/api/v1/health", "/api/v1/health"},
+		{"/articles/deadbeef", "/articles/deadbeef"},
+		{"/", "/"},
+	}
+	for _, tt := range tests {
+		if got := tp.Template("h", tt.in); got != tt.want {
+			t.Errorf("Template(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPathTemplaterLearnsHighCardinalityPositions(t *testing.T) {
+	tp := NewPathTemplater()
+	tp.MaxLiterals = 3
+	for i := 0; i < 3; i++ {
+		if got := tp.Template("h", fmt.Sprintf("/people/name-%c/profile", 'a'+i)); got != fmt.Sprintf("/people/name-%c/profile", 'a'+i) {
+			t.Fatalf("below threshold should stay literal, got %q", got)
+		}
+	}
+	if got := tp.Template("h", "/people/name-z/profile"); got != "/people/{param}/profile" {
+		t.Fatalf("expected learned variable position, got %q", got)
+	}
+	// Other hosts learn independently.
+	if got := tp.Template("other", "/people/name-z/profile"); got != "/people/name-z/profile" {
+		t.Fatalf("host isolation broken, got %q", got)
+	}
+	// A clone keeps what was learned but learns on its own from then on.
+	c := tp.Clone()
+	if got := c.Template("h", "/people/name-q/profile"); got != "/people/{param}/profile" {
+		t.Fatalf("clone lost learned state, got %q", got)
+	}
+	for i := 0; i < 4; i++ {
+		c.Template("other", fmt.Sprintf("/people/x-%c/profile", 'a'+i))
+	}
+	if got := tp.Template("other", "/people/name-y/profile"); got != "/people/name-y/profile" {
+		t.Fatalf("clone learning leaked into the original, got %q", got)
+	}
+}
+
+func TestPathTemplaterOverridesWin(t *testing.T) {
+	tp := NewPathTemplater("/repos/{owner}/{repo}", "/static/**")
+	if got := tp.Template("h", "/repos/golang/go"); got != "/repos/{owner}/{repo}" {
+		t.Fatalf("override not applied: %q", got)
+	}
+	if got := tp.Template("h", "/static/js/app.123.js"); got != "/static/**" {
+		t.Fatalf("wildcard override not applied: %q", got)
+	}
+}
+
+func TestMatchPathTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl, path string
+		ok         bool
+		params     map[string]string
+	}{
+		{"/users/{id}", "/users/42", true, map[string]string{"id": "42"}},
+		{"/users/{id}", "/users/42/orders", false, nil},
+		{"/users/{id}", "/users/", false, nil},
+		{"/files/{path...}", "/files/a/b/c.txt", true, map[string]string{"path": "a/b/c.txt"}},
+		{"/a/*/c", "/a/b/c", true, nil},
+		{"/a/b", "/a/c", false, nil},
+	}
+	for _, tt := range tests {
+		params, ok := MatchPathTemplate(tt.tmpl, tt.path)
+		if ok != tt.ok || len(params) != len(tt.params) {
+			t.Errorf("MatchPathTemplate(%q, %q) = %v, %v", tt.tmpl, tt.path, params, ok)
+			continue
+		}
+		for k, v := range tt.params {
+			if params[k] != v {
+				t.Errorf("MatchPathTemplate(%q, %q)[%q] = %q, want %q", tt.tmpl, tt.path, k, params[k], v)
+			}
+		}
+	}
+}
+
+func TestRegistryFoldsRoutesAfterPromotion(t *testing.T) {
+	tp := NewPathTemplater()
+	tp.MaxLiterals = 3
+	lat, mp := NewLatencyAnalyzer(), NewMethodPathAnalyzer()
+	reg := NewRegistry(lat, mp)
+	reg.UseTemplater(tp)
+	promoted := 0
+	tp.SetPromoteHandler(func(host string) {
+		promoted++
+		reg.RetemplateRoutes(host)
+	})
+
+	send := func(host, name string, ms int) {
+		path := "/people/" + name + "/profile"
+		reg.OnRequest(&ObservedRequest{
+			Timestamp: time.Now(), Method: "GET", Path: path, StatusCode: 200,
+			Latency: time.Duration(ms) * time.Millisecond,
+			Route:   RouteKey{Host: host, Method: "GET", Path: tp.Template(host, path)},
+		})
+	}
+	for i, name := range []string{"ann", "bob", "cy", "dee", "eve"} {
+		send("h", name, 10*(i+1))
+	}
+	send("other", "ann", 1)
+
+	if promoted != 1 {
+		t.Fatalf("promoted %d times, want 1", promoted)
+	}
+	snap := lat.Snapshot(0)
+	if len(snap) != 2 {
+		t.Fatalf("want the folded route and the other host's route, got %+v", snap)
+	}
+	for _, s := range snap {
+		switch s.Route.Host {
+		case "h":
+			if s.Route.Path != "/people/{param}/profile" || s.Count != 5 || s.Min != 10*time.Millisecond || s.Max != 50*time.Millisecond {
+				t.Fatalf("folded latency = %+v", s)
+			}
+		case "other":
+			if s.Route.Path != "/people/ann/profile" {
+				t.Fatalf("other host was re-templated: %+v", s)
+			}
+		}
+	}
+	if got := mp.Snapshot(0); len(got) != 2 {
+		t.Fatalf("method/path routes = %+v", got)
+	}
+
+	// Events templated before the promotion (queued, or replayed from
+	// storage) land on the template too.
+	reg.OnRequest(&ObservedRequest{Timestamp: time.Now(), Route: RouteKey{Host: "h", Method: "GET", Path: "/people/ann/profile"}})
+	if snap := lat.Snapshot(0); len(snap) != 2 {
+		t.Fatalf("stale template split the route again: %+v", snap)
+	}
+	if got := tp.Retemplate("h", "/people/ann/profile#Get"); got != "/people/{param}/profile#Get" {
+		t.Fatalf("Retemplate = %q", got)
+	}
+}
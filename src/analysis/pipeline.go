@@ -0,0 +1,287 @@
+package analysis
+
+import (
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// 14. Asynchronous ingestion pipeline
+//
+
+// QueuePolicy decides what Submit does when a worker's queue is full.
+type QueuePolicy int
+
+const (
+	// QueueDrop discards the event and counts it; the caller never waits.
+	QueueDrop QueuePolicy = iota
+	// QueueBlock waits for room, applying back-pressure to the caller.
+	QueueBlock
+)
+
+func (p QueuePolicy) String() string {
+	if p == QueueBlock {
+		return "block"
+	}
+	return "drop"
+}
+
+// ParseQueuePolicy accepts "drop" or "block".
+func ParseQueuePolicy(s string) (QueuePolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "drop":
+		return QueueDrop, nil
+	case "block":
+		return QueueBlock, nil
+	}
+	return QueueDrop, fmt.Errorf("unknown queue policy %q (want drop or block)", s)
+}
+
+// PipelineConfig sizes a Pipeline.
+type PipelineConfig struct {
+	Workers int // worker goroutines (shards); <= 0 means 1
+	// QueueSize is the total of queued events, split evenly across workers.
+	// With a reorder window each worker also holds at most its share of
+	// QueueSize for reordering, so at most 2*QueueSize events are in memory.
+	QueueSize int
+	Policy    QueuePolicy
+	// ReorderWindow holds each event this long so that events of the same
+	// client arriving out of timestamp order (a slow request finishing after
+	// a later fast one) are applied in timestamp order. 0 = arrival order.
+	ReorderWindow time.Duration
+}
+
+// PipelineStats reports queue depth and what happened to submitted events.
+type PipelineStats struct {
+	Workers       int           `json:"workers"`
+	QueueSize     int           `json:"queue_size"`
+	Policy        string        `json:"policy"`
+	ReorderWindow time.Duration `json:"reorder_window_ns"`
+	Depth         int64         `json:"depth"` // queued + held for reordering
+	Submitted     int64         `json:"submitted"`
+	Processed     int64         `json:"processed"`
+	Dropped       int64         `json:"dropped"`
+	Late          int64         `json:"late"` // applied after a later-stamped event of the same worker
+}
+
+// Pipeline feeds a Registry from worker goroutines so that producers (the
+// proxy) never wait on analyzer locks. Events are sharded by client, so all
+// events of one client are handled by one worker, in timestamp order as long
+// as they arrive within ReorderWindow of each other.
+type Pipeline struct {
+	reg    *Registry
+	cfg    PipelineConfig
+	shards []chan *ObservedRequest
+	wg     sync.WaitGroup
+
+	closeMu sync.RWMutex
+	closed  bool
+
+	depth     atomic.Int64
+	submitted atomic.Int64
+	processed atomic.Int64
+	dropped   atomic.Int64
+	late      atomic.Int64
+}
+
+// NewPipeline starts cfg.Workers goroutines feeding reg. Call Close to stop
+// them after draining.
+func NewPipeline(reg *Registry, cfg PipelineConfig) *Pipeline {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	per := cfg.QueueSize / cfg.Workers
+	if per < 1 {
+		per = 1
+	}
+	cfg.QueueSize = per * cfg.Workers
+	p := &Pipeline{reg: reg, cfg: cfg, shards: make([]chan *ObservedRequest, cfg.Workers)}
+	for i := range p.shards {
+		p.shards[i] = make(chan *ObservedRequest, per)
+		p.wg.Add(1)
+		go p.run(p.shards[i], per)
+	}
+	return p
+}
+
+func (p *Pipeline) shardFor(c ClientID) chan *ObservedRequest {
+	if len(p.shards) == 1 {
+		return p.shards[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(c.IP))
+	h.Write([]byte{0})
+	h.Write([]byte(c.ClientHint))
+	h.Write([]byte{0})
+	h.Write([]byte(c.UserAgent))
+	return p.shards[h.Sum32()%uint32(len(p.shards))]
+}
+
+// Submit queues ev for analysis. It reports false if the event was dropped
+// (queue full under QueueDrop, or the pipeline is closed).
+func (p *Pipeline) Submit(ev *ObservedRequest) bool {
+	if p == nil || ev == nil {
+		return false
+	}
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+	p.submitted.Add(1)
+	ch := p.shardFor(ev.Client)
+	if p.cfg.Policy == QueueBlock {
+		p.depth.Add(1)
+		ch <- ev
+		return true
+	}
+	select {
+	case ch <- ev:
+		p.depth.Add(1)
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Close stops accepting events, applies everything already queued and waits
+// for the workers to exit.
+func (p *Pipeline) Close() {
+	if p == nil {
+		return
+	}
+	p.closeMu.Lock()
+	if p.closed {
+		p.closeMu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, ch := range p.shards {
+		close(ch)
+	}
+	p.closeMu.Unlock()
+	p.wg.Wait()
+}
+
+// Stats returns a point-in-time view of the counters.
+func (p *Pipeline) Stats() PipelineStats {
+	if p == nil {
+		return PipelineStats{}
+	}
+	return PipelineStats{
+		Workers:       p.cfg.Workers,
+		QueueSize:     p.cfg.QueueSize,
+		Policy:        p.cfg.Policy.String(),
+		ReorderWindow: p.cfg.ReorderWindow,
+		Depth:         p.depth.Load(),
+		Submitted:     p.submitted.Load(),
+		Processed:     p.processed.Load(),
+		Dropped:       p.dropped.Load(),
+		Late:          p.late.Load(),
+	}
+}
+
+func (p *Pipeline) apply(ev *ObservedRequest) {
+	p.reg.OnRequest(ev)
+	p.depth.Add(-1)
+	p.processed.Add(1)
+}
+
+// run is one worker. With a reorder window, events wait in a heap ordered
+// by timestamp and are released once the oldest has been held long enough.
+// The heap holds at most maxPending events: when it is full the oldest is
+// released early, so a slow analyzer stalls the worker and the queue in
+// front of it fills up and applies the queue policy.
+func (p *Pipeline) run(ch chan *ObservedRequest, maxPending int) {
+	defer p.wg.Done()
+	if p.cfg.ReorderWindow <= 0 {
+		for ev := range ch {
+			p.apply(ev)
+		}
+		return
+	}
+
+	var (
+		pending  reorderHeap
+		released time.Time // newest timestamp applied so far
+		seq      uint64
+		timer    = time.NewTimer(time.Hour)
+	)
+	timer.Stop()
+	defer timer.Stop()
+
+	release1 := func() {
+		it := heap.Pop(&pending).(reorderItem)
+		if it.ev.Timestamp.Before(released) {
+			p.late.Add(1)
+		} else {
+			released = it.ev.Timestamp
+		}
+		p.apply(it.ev)
+	}
+	release := func(now time.Time, all bool) {
+		for len(pending) > 0 && (all || !pending[0].due.After(now)) {
+			release1()
+		}
+	}
+
+	for {
+		var wake <-chan time.Time
+		if len(pending) > 0 {
+			timer.Reset(time.Until(pending[0].due))
+			wake = timer.C
+		}
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				release(time.Time{}, true)
+				return
+			}
+			if len(pending) >= maxPending {
+				release1()
+			}
+			seq++
+			heap.Push(&pending, reorderItem{ev: ev, due: time.Now().Add(p.cfg.ReorderWindow), seq: seq})
+		case <-wake:
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		release(time.Now(), false)
+	}
+}
+
+type reorderItem struct {
+	ev  *ObservedRequest
+	due time.Time // arrival + reorder window
+	seq uint64    // arrival order, to keep equal timestamps stable
+}
+
+// reorderHeap orders by event timestamp, then arrival.
+type reorderHeap []reorderItem
+
+func (h reorderHeap) Len() int { return len(h) }
+func (h reorderHeap) Less(i, j int) bool {
+	if !h[i].ev.Timestamp.Equal(h[j].ev.Timestamp) {
+		return h[i].ev.Timestamp.Before(h[j].ev.Timestamp)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h reorderHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *reorderHeap) Push(x any)   { *h = append(*h, x.(reorderItem)) }
+func (h *reorderHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,98 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPipelineAppliesEventsInTimestampOrderPerClient(t *testing.T) {
+	reg := NewRegistry(NewErrorTransitionAnalyzer())
+	p := NewPipeline(reg, PipelineConfig{Workers: 4, QueueSize: 64, ReorderWindow: 50 * time.Millisecond})
+
+	client := ClientID{IP: "1.2.3.4"}
+	base := time.Now()
+	// A slow request that started first finishes last: 500, 500, then the
+	// earlier 200 arrives. In timestamp order the streak ends at two errors.
+	for _, ev := range []*ObservedRequest{
+		{Timestamp: base.Add(2 * time.Second), Client: client, StatusCode: 500, Outcome: Outcome5xx},
+		{Timestamp: base.Add(3 * time.Second), Client: client, StatusCode: 500, Outcome: Outcome5xx},
+		{Timestamp: base.Add(1 * time.Second), Client: client, StatusCode: 200, Outcome: Outcome2xx},
+	} {
+		if !p.Submit(ev) {
+			t.Fatalf("unexpected drop")
+		}
+	}
+	p.Close()
+
+	snaps := reg.ErrorTransitions().Snapshot(0)
+	if len(snaps) != 1 {
+		t.Fatalf("expected one client, got %d", len(snaps))
+	}
+	if snaps[0].ConsecutiveErrors != 2 {
+		t.Fatalf("expected streak of 2 in timestamp order, got %d", snaps[0].ConsecutiveErrors)
+	}
+	st := p.Stats()
+	if st.Processed != 3 || st.Depth != 0 || st.Late != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestPipelineDropPolicyCountsOverflow(t *testing.T) {
+	block := make(chan struct{})
+	reg := NewRegistry(analyzerFunc(func(*ObservedRequest) { <-block }))
+	p := NewPipeline(reg, PipelineConfig{Workers: 1, QueueSize: 1, Policy: QueueDrop})
+
+	ev := &ObservedRequest{Timestamp: time.Now()}
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		if p.Submit(ev) {
+			accepted++
+		}
+	}
+	close(block)
+	p.Close()
+
+	st := p.Stats()
+	if st.Dropped == 0 || st.Dropped+int64(accepted) != 10 {
+		t.Fatalf("unexpected stats %+v (accepted %d)", st, accepted)
+	}
+	if st.Processed != int64(accepted) {
+		t.Fatalf("processed %d, accepted %d", st.Processed, accepted)
+	}
+	if p.Submit(ev) {
+		t.Fatalf("submit after close should fail")
+	}
+}
+
+func TestPipelineReorderHeapIsBoundedByQueueSize(t *testing.T) {
+	block := make(chan struct{})
+	reg := NewRegistry(analyzerFunc(func(*ObservedRequest) { <-block }))
+	const queue = 8
+	p := NewPipeline(reg, PipelineConfig{Workers: 1, QueueSize: queue, Policy: QueueDrop, ReorderWindow: time.Hour})
+
+	base := time.Now()
+	accepted := 0
+	for i := 0; i < 1000; i++ {
+		if p.Submit(&ObservedRequest{Timestamp: base.Add(time.Duration(i) * time.Millisecond)}) {
+			accepted++
+		}
+		if i%50 == 0 {
+			time.Sleep(time.Millisecond) // let the worker drain into the heap
+		}
+	}
+	// Queue, heap and the one event stuck in the analyzer.
+	if st := p.Stats(); st.Depth > 2*queue+1 || int64(accepted) != st.Depth {
+		t.Fatalf("depth %d not bounded by 2*QueueSize (accepted %d)", st.Depth, accepted)
+	}
+	close(block)
+	p.Close()
+
+	st := p.Stats()
+	if st.Dropped != int64(1000-accepted) || st.Processed != int64(accepted) || st.Depth != 0 {
+		t.Fatalf("unexpected stats %+v (accepted %d)", st, accepted)
+	}
+}
+
+type analyzerFunc func(*ObservedRequest)
+
+func (f analyzerFunc) OnRequest(ev *ObservedRequest) { f(ev) }
@@ -0,0 +1,501 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// 20. Rate-limit headers and 429 correlation
+//
+
+// Defaults for NewRateLimitAnalyzer.
+const (
+	DefaultNearLimit      = 0.1 // remaining/limit at or below this is near the limit
+	maxRateLimitSamples   = 120 // remaining-quota samples kept per key
+	maxRateLimitClients   = 16  // client IPs remembered per key
+	rateLimitEpochSeconds = 1e9 // reset values above this are Unix times, not deltas
+	rateLimitEpochMillis  = 1e12
+)
+
+// Rate-limit flags.
+const (
+	FlagNearLimit         = "near_limit"
+	FlagWillExhaust       = "will_exhaust_before_reset"
+	FlagThrottled         = "throttled"
+	FlagIgnoresThrottling = "ignores_throttling"
+)
+
+// RateLimitKey identifies one quota: an upstream host and the credential the
+// requests were made with (see CredentialFingerprint).
+type RateLimitKey struct {
+	Host       string
+	Credential string
+}
+
+// RateLimitSample is the quota a response advertised.
+type RateLimitSample struct {
+	Time      time.Time
+	Limit     int64
+	Remaining int64
+}
+
+// rateLimitHeaders is what one response said about the quota; -1 = absent.
+type rateLimitHeaders struct {
+	limit, remaining int64
+	reset            time.Time
+	window           time.Duration
+	policy           string
+	retryAfter       time.Duration
+}
+
+type rateLimitState struct {
+	first, last time.Time
+	requests    int64
+	withHeaders int64
+	clients     map[string]time.Time // IP -> last seen
+
+	limit, remaining int64
+	resetAt          time.Time
+	window           time.Duration
+	policy           string
+	lastUpdate       time.Time
+	samples          []RateLimitSample // oldest first
+
+	// 429s and what the client did next.
+	throttled      int64
+	retryAfterSeen int64
+	lastThrottled  time.Time
+	throttledFrom  time.Time // when the client was told to wait...
+	throttledUntil time.Time // ...and until when (Retry-After or quota reset)
+	early          int64     // requests started in between
+	awaitingNext   bool      // the next request's gap goes into backoff
+	backoff        *LatencySketch
+	backoffN       int64
+}
+
+// RateLimitSnapshot is a read-only view of one quota.
+type RateLimitSnapshot struct {
+	Key         RateLimitKey
+	ClientIPs   []string
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	Requests    int64
+	WithHeaders int64 // responses that carried rate-limit headers
+
+	Limit      int64 // -1 = never advertised
+	Remaining  int64 // -1 = never advertised
+	ResetAt    time.Time
+	Window     time.Duration
+	Policy     string
+	LastUpdate time.Time
+	Samples    []RateLimitSample
+
+	// UsedPerSec is how fast Remaining fell over the current window;
+	// ExhaustAt extrapolates it to zero (zero time = not heading there).
+	UsedPerSec float64
+	ExhaustAt  time.Time
+
+	Throttled      int64
+	RetryAfterSeen int64
+	LastThrottled  time.Time
+	// EarlyRequests were sent while Retry-After (or an exhausted quota's
+	// reset) had not elapsed; BackoffAfter429 is the gap from a 429 to the
+	// client's next request.
+	EarlyRequests   int64
+	BackoffAfter429 QuantileEstimate
+	BackoffN        int64
+
+	Flags []string
+}
+
+// RateLimitAnalyzer follows RateLimit-*, X-RateLimit-* and Retry-After
+// response headers per host and credential: remaining quota over time, when
+// the current pace runs it out, and how clients behave after a 429.
+type RateLimitAnalyzer struct {
+	*boundedBase
+	byKey *boundedMap[RateLimitKey, *rateLimitState]
+
+	NearLimit float64
+}
+
+// NewRateLimitAnalyzer constructs a RateLimitAnalyzer with defaults.
+func NewRateLimitAnalyzer() *RateLimitAnalyzer {
+	byKey := newBoundedMap[RateLimitKey, *rateLimitState](DefaultLimits)
+	return &RateLimitAnalyzer{
+		boundedBase: newBoundedBase("ratelimit", byKey),
+		byKey:       byKey,
+		NearLimit:   DefaultNearLimit,
+	}
+}
+
+// CredentialFingerprint names the credential a request carries without
+// revealing it: the Authorization scheme (or API key header) and a short
+// SHA-256 prefix of the value, e.g. "bearer:3fa29c01d2e4". Requests without
+// one are keyed by client IP ("ip:10.0.0.1").
+func CredentialFingerprint(h http.Header, client ClientID) string {
+	for _, name := range []string{"Authorization", "X-Api-Key", "Api-Key", "X-Auth-Token"} {
+		v := strings.TrimSpace(h.Get(name))
+		if v == "" {
+			continue
+		}
+		label := strings.ToLower(name)
+		if name == "Authorization" {
+			label = "auth"
+			if i := strings.IndexByte(v, ' '); i > 0 {
+				label = strings.ToLower(v[:i])
+			}
+		}
+		sum := sha256.Sum256([]byte(v))
+		return label + ":" + hex.EncodeToString(sum[:6])
+	}
+	return "ip:" + client.IP
+}
+
+// OnRequest ingests an ObservedRequest.
+func (a *RateLimitAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || ev.Route.Host == "" {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	received := now.Add(max(ev.Latency, 0))
+	hdr := parseRateLimitHeaders(ev.RespHeaders, received)
+	if ev.StatusCode == http.StatusTooManyRequests || ev.StatusCode == http.StatusServiceUnavailable {
+		hdr.retryAfter = parseRetryAfter(ev.RespHeaders, received)
+	}
+	key := RateLimitKey{Host: ev.Route.Host, Credential: CredentialFingerprint(ev.ReqHeaders, ev.Client)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, ok := a.byKey.get(key, now)
+	if !ok {
+		// Hosts that never advertise limits or throttle are not worth a key.
+		if hdr.limit < 0 && hdr.remaining < 0 && ev.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+		st = &rateLimitState{
+			first:     now,
+			clients:   make(map[string]time.Time),
+			limit:     -1,
+			remaining: -1,
+			backoff:   NewLatencySketch(),
+		}
+		a.byKey.put(key, st, now)
+	}
+	st.requests++
+	if now.After(st.last) {
+		st.last = now
+	}
+	if ev.Client.IP != "" {
+		st.clients[ev.Client.IP] = now
+		for len(st.clients) > maxRateLimitClients {
+			var oldest string
+			for ip, t := range st.clients {
+				if oldest == "" || t.Before(st.clients[oldest]) {
+					oldest = ip
+				}
+			}
+			delete(st.clients, oldest)
+		}
+	}
+
+	// What the client did after being throttled.
+	if now.After(st.throttledFrom) && now.Before(st.throttledUntil) {
+		st.early++
+	}
+	if st.awaitingNext && now.After(st.lastThrottled) {
+		st.backoff.Add(now.Sub(st.lastThrottled))
+		st.backoffN++
+		st.awaitingNext = false
+	}
+
+	if hdr.limit >= 0 || hdr.remaining >= 0 {
+		st.withHeaders++
+		if !received.Before(st.lastUpdate) {
+			if hdr.limit >= 0 {
+				st.limit = hdr.limit
+			}
+			if hdr.remaining >= 0 {
+				st.remaining = hdr.remaining
+			}
+			if !hdr.reset.IsZero() {
+				st.resetAt = hdr.reset
+			}
+			if hdr.window > 0 {
+				st.window = hdr.window
+			}
+			if hdr.policy != "" {
+				st.policy = hdr.policy
+			}
+			st.lastUpdate = received
+			st.samples = append(st.samples, RateLimitSample{Time: received, Limit: st.limit, Remaining: st.remaining})
+			if len(st.samples) > maxRateLimitSamples {
+				st.samples = append(st.samples[:0], st.samples[len(st.samples)-maxRateLimitSamples:]...)
+			}
+			if st.remaining == 0 {
+				st.throttle(received, st.resetAt)
+			}
+		}
+	}
+
+	if ev.StatusCode == http.StatusTooManyRequests {
+		st.throttled++
+		st.lastThrottled = received
+		st.awaitingNext = true
+		if hdr.retryAfter > 0 {
+			st.retryAfterSeen++
+		}
+	}
+	if hdr.retryAfter > 0 {
+		st.throttle(received, received.Add(hdr.retryAfter))
+	}
+}
+
+// pruneBefore drops quota samples and clients from before cutoff (see
+// agingEntry).
+func (st *rateLimitState) pruneBefore(cutoff time.Time) {
+	i := 0
+	for i < len(st.samples) && st.samples[i].Time.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		st.samples = append(st.samples[:0], st.samples[i:]...)
+	}
+	for ip, t := range st.clients {
+		if t.Before(cutoff) {
+			delete(st.clients, ip)
+		}
+	}
+}
+
+// throttle records that from on, the client should wait until until.
+func (st *rateLimitState) throttle(from, until time.Time) {
+	if until.After(st.throttledUntil) {
+		st.throttledFrom, st.throttledUntil = from, until
+	}
+}
+
+// parseRateLimitHeaders reads the IETF RateLimit fields (both the
+// RateLimit-Limit/-Remaining/-Reset and the structured "RateLimit:
+// limit=..., remaining=..., reset=..." forms), RateLimit-Policy, and the
+// X-RateLimit-* / X-Rate-Limit-* conventions. Reset is taken as seconds
+// from received unless it looks like a Unix time.
+func parseRateLimitHeaders(h http.Header, received time.Time) rateLimitHeaders {
+	out := rateLimitHeaders{limit: -1, remaining: -1}
+	if h == nil {
+		return out
+	}
+	var reset string
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-", "X-Rate-Limit-"} {
+		if out.limit < 0 {
+			out.limit = leadingInt(h.Get(prefix + "Limit"))
+		}
+		if out.remaining < 0 {
+			out.remaining = leadingInt(h.Get(prefix + "Remaining"))
+		}
+		if reset == "" {
+			reset = strings.TrimSpace(h.Get(prefix + "Reset"))
+		}
+	}
+	if v := h.Get("RateLimit"); v != "" {
+		for _, part := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			name, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(name) {
+			case "limit":
+				out.limit = leadingInt(val)
+			case "remaining", "r":
+				out.remaining = leadingInt(val)
+			case "reset", "t":
+				reset = val
+			}
+		}
+	}
+	if p := strings.TrimSpace(h.Get("RateLimit-Policy")); p != "" {
+		out.policy = p
+		for _, part := range strings.Split(p, ";") {
+			if name, val, ok := strings.Cut(strings.TrimSpace(part), "="); ok && strings.EqualFold(name, "w") {
+				if n := leadingInt(val); n > 0 {
+					out.window = time.Duration(n) * time.Second
+				}
+			}
+		}
+	}
+	if reset != "" {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(reset), 64); err == nil && f >= 0 {
+			switch {
+			case f >= rateLimitEpochMillis:
+				out.reset = time.UnixMilli(int64(f))
+			case f >= rateLimitEpochSeconds:
+				out.reset = time.Unix(int64(f), 0)
+			default:
+				out.reset = received.Add(time.Duration(f * float64(time.Second)))
+			}
+		} else if t, err := http.ParseTime(reset); err == nil {
+			out.reset = t
+		}
+	}
+	return out
+}
+
+// leadingInt parses the first integer of a field such as "100" or
+// "100, 100;w=60"; -1 when there is none.
+func leadingInt(s string) int64 {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(s[:end], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Snapshot returns every quota seen, most constrained first (throttled,
+// then lowest remaining share).
+func (a *RateLimitAnalyzer) Snapshot() []RateLimitSnapshot {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]RateLimitSnapshot, 0, a.byKey.len())
+	a.byKey.each(func(key RateLimitKey, st *rateLimitState) bool {
+		s := RateLimitSnapshot{
+			Key:             key,
+			FirstSeen:       st.first,
+			LastSeen:        st.last,
+			Requests:        st.requests,
+			WithHeaders:     st.withHeaders,
+			Limit:           st.limit,
+			Remaining:       st.remaining,
+			ResetAt:         st.resetAt,
+			Window:          st.window,
+			Policy:          st.policy,
+			LastUpdate:      st.lastUpdate,
+			Samples:         append([]RateLimitSample(nil), st.samples...),
+			Throttled:       st.throttled,
+			RetryAfterSeen:  st.retryAfterSeen,
+			LastThrottled:   st.lastThrottled,
+			EarlyRequests:   st.early,
+			BackoffAfter429: st.backoff.Estimate(),
+			BackoffN:        st.backoffN,
+		}
+		for ip := range st.clients {
+			s.ClientIPs = append(s.ClientIPs, ip)
+		}
+		sort.Strings(s.ClientIPs)
+		s.UsedPerSec, s.ExhaustAt = predictExhaustion(st.samples)
+		s.Flags = a.flags(&s)
+		out = append(out, s)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].Throttled > 0) != (out[j].Throttled > 0) {
+			return out[i].Throttled > 0
+		}
+		si, sj := out[i].remainingShare(), out[j].remainingShare()
+		if si != sj {
+			return si < sj
+		}
+		return out[i].Requests > out[j].Requests
+	})
+	return out
+}
+
+// remainingShare is Remaining/Limit, or 1 when either is unknown.
+func (s *RateLimitSnapshot) remainingShare() float64 {
+	if s.Limit <= 0 || s.Remaining < 0 {
+		return 1
+	}
+	return float64(s.Remaining) / float64(s.Limit)
+}
+
+// predictExhaustion fits a line to the samples since Remaining last went
+// up (the current window) and extends it to zero.
+func predictExhaustion(samples []RateLimitSample) (float64, time.Time) {
+	start := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Remaining > samples[i-1].Remaining {
+			start = i
+		}
+	}
+	win := samples[start:]
+	if len(win) < 2 {
+		return 0, time.Time{}
+	}
+	t0 := win[0].Time
+	var n, sx, sy, sxx, sxy float64
+	for _, s := range win {
+		x, y := s.Time.Sub(t0).Seconds(), float64(s.Remaining)
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	den := n*sxx - sx*sx
+	if den <= 0 {
+		return 0, time.Time{}
+	}
+	slope := (n*sxy - sx*sy) / den
+	if slope >= 0 {
+		return 0, time.Time{}
+	}
+	last := win[len(win)-1]
+	used := -slope
+	secs := float64(last.Remaining) / used
+	if math.IsInf(secs, 0) || secs > float64(math.MaxInt64/int64(time.Second)) {
+		return used, time.Time{}
+	}
+	return used, last.Time.Add(time.Duration(secs * float64(time.Second)))
+}
+
+// flags names what is wrong with the quota of s; the caller holds the lock.
+func (a *RateLimitAnalyzer) flags(s *RateLimitSnapshot) []string {
+	var out []string
+	if s.Limit > 0 && s.Remaining >= 0 && s.remainingShare() <= a.NearLimit {
+		out = append(out, FlagNearLimit)
+	}
+	if !s.ExhaustAt.IsZero() && s.ResetAt.After(s.LastUpdate) && s.ExhaustAt.Before(s.ResetAt) {
+		out = append(out, FlagWillExhaust)
+	}
+	if s.Throttled > 0 {
+		out = append(out, FlagThrottled)
+	}
+	if s.EarlyRequests > 0 {
+		out = append(out, FlagIgnoresThrottling)
+	}
+	return out
+}
+
+// RateLimit returns the RateLimitAnalyzer registered in this registry, if any.
+func (r *Registry) RateLimit() *RateLimitAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if ra, ok := a.(*RateLimitAnalyzer); ok {
+			return ra
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitQuotaPredictionAndThrottling(t *testing.T) {
+	a := NewRateLimitAnalyzer()
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	send := func(at time.Duration, token string, status int, resp http.Header) {
+		req := http.Header{}
+		if token != "" {
+			req.Set("Authorization", "Bearer "+token)
+		}
+		a.OnRequest(&ObservedRequest{
+			Timestamp:   base.Add(at),
+			Client:      ClientID{IP: "10.0.0.1"},
+			Route:       RouteKey{Host: "api.vendor", Method: "GET", Path: "/items"},
+			StatusCode:  status,
+			ReqHeaders:  req,
+			RespHeaders: resp,
+		})
+	}
+
+	// Two per second against 100 per minute: empty after 45s, reset at 60s.
+	for i := 0; i < 10; i++ {
+		send(time.Duration(i)*500*time.Millisecond, "alpha", 200, http.Header{
+			"X-Ratelimit-Limit":     {"100"},
+			"X-Ratelimit-Remaining": {strconv.Itoa(90 - i)},
+			"X-Ratelimit-Reset":     {strconv.FormatInt(base.Add(time.Minute).Unix(), 10)},
+		})
+	}
+	// Another token, structured header, throttled: asked for 10s, came back
+	// after 2s.
+	send(0, "beta", 429, http.Header{"Ratelimit": {"limit=10, remaining=0, reset=10"}, "Retry-After": {"10"}})
+	send(2*time.Second, "beta", 429, http.Header{"Ratelimit": {"limit=10, remaining=0, reset=8"}})
+	send(12*time.Second, "beta", 200, http.Header{"Ratelimit": {"limit=10, remaining=9, reset=60"}})
+	// No headers and no 429: not tracked.
+	send(0, "", 200, http.Header{})
+
+	snap := a.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("want 2 quotas, got %d", len(snap))
+	}
+	beta, alpha := snap[0], snap[1]
+
+	if alpha.Key.Credential != CredentialFingerprint(http.Header{"Authorization": {"Bearer alpha"}}, ClientID{}) || alpha.Key.Credential[:7] != "bearer:" {
+		t.Fatalf("alpha credential = %q", alpha.Key.Credential)
+	}
+	if alpha.Limit != 100 || alpha.Remaining != 81 || !alpha.ResetAt.Equal(base.Add(time.Minute)) || len(alpha.Samples) != 10 {
+		t.Fatalf("alpha = %+v", alpha)
+	}
+	if alpha.UsedPerSec < 1.99 || alpha.UsedPerSec > 2.01 {
+		t.Fatalf("alpha used/s = %v", alpha.UsedPerSec)
+	}
+	if want := base.Add(4500 * time.Millisecond).Add(40500 * time.Millisecond); alpha.ExhaustAt.Sub(want).Abs() > 100*time.Millisecond {
+		t.Fatalf("alpha exhaust at %v, want %v", alpha.ExhaustAt, want)
+	}
+	if len(alpha.Flags) != 1 || alpha.Flags[0] != FlagWillExhaust {
+		t.Fatalf("alpha flags = %v", alpha.Flags)
+	}
+
+	if beta.Throttled != 2 || beta.RetryAfterSeen != 1 || beta.EarlyRequests != 1 || beta.BackoffN != 2 {
+		t.Fatalf("beta = %+v", beta)
+	}
+	if beta.Remaining != 9 || beta.BackoffAfter429.P50 < 1900*time.Millisecond {
+		t.Fatalf("beta remaining=%d backoff=%v", beta.Remaining, beta.BackoffAfter429)
+	}
+	want := map[string]bool{FlagThrottled: true, FlagIgnoresThrottling: true}
+	if len(beta.Flags) != len(want) {
+		t.Fatalf("beta flags = %v", beta.Flags)
+	}
+	for _, f := range beta.Flags {
+		if !want[f] {
+			t.Fatalf("unexpected flag %q in %v", f, beta.Flags)
+		}
+	}
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	h := http.Header{}
+	h.Set("RateLimit-Limit", "100, 100;w=60")
+	h.Set("RateLimit-Remaining", "42")
+	h.Set("RateLimit-Reset", "30")
+	h.Set("RateLimit-Policy", "100;w=60")
+	got := parseRateLimitHeaders(h, now)
+	if got.limit != 100 || got.remaining != 42 || !got.reset.Equal(now.Add(30*time.Second)) || got.window != time.Minute {
+		t.Fatalf("got %+v", got)
+	}
+	if got := parseRateLimitHeaders(http.Header{"X-Rate-Limit-Reset": {"1714572000000"}}, now); !got.reset.Equal(time.UnixMilli(1714572000000)) || got.limit != -1 {
+		t.Fatalf("millisecond reset: %+v", got)
+	}
+}
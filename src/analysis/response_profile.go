@@ -2,7 +2,6 @@ package analysis
 
 import (
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -46,14 +45,16 @@ type ResponseProfileSnapshot struct {
 
 // ResponseProfileAnalyzer aggregates response entropy / type drift per route.
 type ResponseProfileAnalyzer struct {
-	mu      sync.RWMutex
-	byRoute map[RouteKey]*ResponseProfileState
+	*boundedBase
+	byRoute *boundedMap[RouteKey, *ResponseProfileState]
 }
 
 // NewResponseProfileAnalyzer constructs an empty analyzer.
 func NewResponseProfileAnalyzer() *ResponseProfileAnalyzer {
+	byRoute := newBoundedMap[RouteKey, *ResponseProfileState](DefaultLimits)
 	return &ResponseProfileAnalyzer{
-		byRoute: make(map[RouteKey]*ResponseProfileState),
+		boundedBase: newBoundedBase("responseprofile", byRoute),
+		byRoute:     byRoute,
 	}
 }
 
@@ -83,14 +84,14 @@ func (a *ResponseProfileAnalyzer) OnRequest(ev *ObservedRequest) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	st, ok := a.byRoute[ev.Route]
+	st, ok := a.byRoute.get(ev.Route, now)
 	if !ok {
 		st = &ResponseProfileState{
 			ContentTypes:     make(map[string]int64),
 			ContentEncodings: make(map[string]int64),
 		}
 		st.FirstSeen = now
-		a.byRoute[ev.Route] = st
+		a.byRoute.put(ev.Route, st, now)
 	}
 
 	st.LastSeen = now
@@ -124,6 +125,26 @@ func (a *ResponseProfileAnalyzer) OnRequest(ev *ObservedRequest) {
 	}
 }
 
+func (a *ResponseProfileAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byRoute.rekey(rename, func(dst, src *ResponseProfileState) {
+		if src.FirstSeen.Before(dst.FirstSeen) {
+			dst.FirstSeen = src.FirstSeen
+		}
+		if src.LastSeen.After(dst.LastSeen) {
+			dst.LastSeen = src.LastSeen
+			dst.PrimaryContentType = src.PrimaryContentType
+		}
+		dst.Count += src.Count
+		mergeCounts(dst.ContentTypes, src.ContentTypes, 0)
+		mergeCounts(dst.ContentEncodings, src.ContentEncodings, 0)
+		dst.ContentTypeChangeCount += src.ContentTypeChangeCount
+		dst.HighEntropyCount += src.HighEntropyCount
+		dst.LowEntropyCount += src.LowEntropyCount
+	})
+	a.mu.Unlock()
+}
+
 // Snapshot returns per-route response profile snapshots.
 //
 // minCount: if > 0, only routes with Count >= minCount are included.
@@ -138,17 +159,17 @@ func (a *ResponseProfileAnalyzer) Snapshot(minCount, minChanges int64) []Respons
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	out := make([]ResponseProfileSnapshot, 0, len(a.byRoute))
-	for route, st := range a.byRoute {
+	out := make([]ResponseProfileSnapshot, 0, a.byRoute.len())
+	a.byRoute.each(func(route RouteKey, st *ResponseProfileState) bool {
 		if minCount > 0 && st.Count < minCount {
-			continue
+			return true
 		}
 
 		hasCTDrift := st.ContentTypeChangeCount > 0
 		hasEntropyMix := st.HighEntropyCount > 0 && st.LowEntropyCount > 0
 
 		if minChanges > 0 && !hasCTDrift && !hasEntropyMix {
-			continue
+			return true
 		}
 
 		ctCopy := make(map[string]int64, len(st.ContentTypes))
@@ -180,7 +201,8 @@ func (a *ResponseProfileAnalyzer) Snapshot(minCount, minChanges int64) []Respons
 			HasEntropyMix:       hasEntropyMix,
 		}
 		out = append(out, snap)
-	}
+		return true
+	})
 
 	return out
 }
@@ -1,7 +1,6 @@
 package analysis
 
 import (
-	"sync"
 	"time"
 )
 
@@ -21,14 +20,15 @@ type RetryState struct {
 	Count         int64
 	LastStatus    int
 	LastOutcome   Outcome
+	Route         RouteKey // templated route the key belongs to
 }
 
 // RetryAnalyzer detects bursts of repeated requests for the same RetryKey
 // within a configurable time window.
 type RetryAnalyzer struct {
-	mu     sync.RWMutex
+	*boundedBase
 	Window time.Duration
-	byKey  map[RetryKey]*RetryState
+	byKey  *boundedMap[RetryKey, *RetryState]
 }
 
 // NewRetryAnalyzer constructs a RetryAnalyzer with the given time window.
@@ -38,9 +38,11 @@ func NewRetryAnalyzer(window time.Duration) *RetryAnalyzer {
 	if window <= 0 {
 		window = 30 * time.Second
 	}
+	byKey := newBoundedMap[RetryKey, *RetryState](DefaultLimits)
 	return &RetryAnalyzer{
-		Window: window,
-		byKey:  make(map[RetryKey]*RetryState),
+		boundedBase: newBoundedBase("retry", byKey),
+		Window:      window,
+		byKey:       byKey,
 	}
 }
 
@@ -59,21 +61,22 @@ func (a *RetryAnalyzer) OnRequest(ev *ObservedRequest) {
 		Client: ev.Client,
 		Method: ev.Method,
 		Host:   ev.Route.Host,
-		Path:   ev.Route.Path,
+		Path:   ev.ConcretePath(), // retries repeat the exact resource, not just the route
 		Query:  ev.Query,
 	}
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	st, ok := a.byKey[key]
+	st, ok := a.byKey.get(key, ts)
 	if !ok {
-		a.byKey[key] = &RetryState{
+		a.byKey.put(key, &RetryState{
 			LastTimestamp: ts,
 			Count:         1,
 			LastStatus:    ev.StatusCode,
 			LastOutcome:   ev.Outcome,
-		}
+			Route:         ev.Route,
+		}, ts)
 		return
 	}
 
@@ -87,6 +90,7 @@ func (a *RetryAnalyzer) OnRequest(ev *ObservedRequest) {
 	st.LastTimestamp = ts
 	st.LastStatus = ev.StatusCode
 	st.LastOutcome = ev.Outcome
+	st.Route = ev.Route
 }
 
 // RetrySnapshot is a read-only view of a hot retry key.
@@ -100,6 +104,7 @@ type RetrySnapshot struct {
 	LastTimestamp time.Time
 	LastStatus    int
 	LastOutcome   Outcome
+	Route         RouteKey
 }
 
 // Snapshot returns all keys that currently look like retries, i.e. keys whose
@@ -113,15 +118,15 @@ func (a *RetryAnalyzer) Snapshot(minCount int64) []RetrySnapshot {
 	defer a.mu.RUnlock()
 
 	now := time.Now()
-	out := make([]RetrySnapshot, 0, len(a.byKey))
+	out := make([]RetrySnapshot, 0, a.byKey.len())
 
-	for key, st := range a.byKey {
+	a.byKey.each(func(key RetryKey, st *RetryState) bool {
 		if st.Count < minCount {
-			continue
+			return true
 		}
 		if now.Sub(st.LastTimestamp) > a.Window {
 			// stale burst, effectively expired
-			continue
+			return true
 		}
 		out = append(out, RetrySnapshot{
 			Client:        key.Client,
@@ -133,8 +138,10 @@ func (a *RetryAnalyzer) Snapshot(minCount int64) []RetrySnapshot {
 			LastTimestamp: st.LastTimestamp,
 			LastStatus:    st.LastStatus,
 			LastOutcome:   st.LastOutcome,
+			Route:         st.Route,
 		})
-	}
+		return true
+	})
 
 	return out
 }
@@ -0,0 +1,442 @@
+package analysis
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// 19. Idempotency-aware retry semantics
+//
+
+// Defaults for NewRetrySemanticsAnalyzer.
+const (
+	DefaultRetrySemanticsWindow = 30 * time.Second
+	DefaultNoBackoff            = 100 * time.Millisecond // gaps below this are immediate retries
+	maxBurstAttempts            = 32                     // per key; oldest dropped first
+)
+
+// Backoff classes of one retry burst.
+const (
+	BackoffNone        = "none"        // every gap below NoBackoff
+	BackoffConstant    = "constant"    // gaps within 25% of their mean
+	BackoffLinear      = "linear"      // gaps grow by a roughly fixed step
+	BackoffExponential = "exponential" // gaps grow by a roughly fixed factor
+	BackoffIrregular   = "irregular"
+	BackoffUnknown     = "unknown" // too few gaps to tell
+)
+
+// Retry semantics flags.
+const (
+	FlagUnsafeRetry           = "unsafe_retry_without_idempotency_key"
+	FlagIdempotencyKeyChanged = "idempotency_key_changed"
+	FlagRetryAfterIgnored     = "retry_after_ignored"
+	FlagNoBackoff             = "no_backoff"
+	FlagRetryBodyChanged      = "body_changed"
+)
+
+// IdempotentMethod reports whether RFC 9110 defines method as idempotent.
+func IdempotentMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryAttempt is one request of a burst.
+type retryAttempt struct {
+	start, end time.Time
+	status     int
+	idemKey    string
+	bodyHash   uint64
+	bodyKnown  bool          // false when the captured body was truncated
+	retryAfter time.Duration // from this attempt's 429/503 response; 0 = none
+}
+
+// RetryBurstStats counts what went wrong across one or more retry bursts.
+type RetryBurstStats struct {
+	Retries           int64 // attempts after the first
+	UnkeyedRetries    int64 // retries of POST/PATCH without an Idempotency-Key
+	KeyChanges        int64 // retries whose Idempotency-Key differed from the previous attempt's
+	RetryAfterChecked int64 // retries following a 429/503 that carried Retry-After
+	RetryAfterIgnored int64 // of which came before the advertised delay
+	BodyChanges       int64 // retries whose body differed from the previous attempt's
+}
+
+func (s *RetryBurstStats) add(o RetryBurstStats) {
+	s.Retries += o.Retries
+	s.UnkeyedRetries += o.UnkeyedRetries
+	s.KeyChanges += o.KeyChanges
+	s.RetryAfterChecked += o.RetryAfterChecked
+	s.RetryAfterIgnored += o.RetryAfterIgnored
+	s.BodyChanges += o.BodyChanges
+}
+
+type retrySemanticsState struct {
+	route     RouteKey
+	first     time.Time
+	last      time.Time
+	attempts  []retryAttempt // current burst, oldest first
+	totals    RetryBurstStats
+	bursts    int64 // finished bursts with at least one retry
+	byBackoff map[string]int64
+}
+
+// RetrySemanticsSnapshot is a read-only view of one retried request key.
+// Totals cover every burst seen, the current one included; the Burst*
+// fields describe the current (most recent) burst only.
+type RetrySemanticsSnapshot struct {
+	Key        RetryKey
+	Route      RouteKey
+	Idempotent bool
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Bursts     int64
+	RetryBurstStats
+	Backoff map[string]int64 // bursts per backoff class
+
+	BurstAttempts int
+	BurstGaps     []time.Duration // between attempt starts
+	BurstBackoff  string
+	LastStatus    int
+
+	Flags []string
+}
+
+// RetrySemanticsAnalyzer looks inside the bursts RetryAnalyzer counts: was
+// the method safe to retry, did the client send a stable Idempotency-Key,
+// did it wait out Retry-After, how did it back off, and did the body change
+// between attempts. Bursts are keyed like RetryAnalyzer's.
+type RetrySemanticsAnalyzer struct {
+	*boundedBase
+	byKey *boundedMap[RetryKey, *retrySemanticsState]
+
+	Window    time.Duration
+	NoBackoff time.Duration
+}
+
+// NewRetrySemanticsAnalyzer constructs a RetrySemanticsAnalyzer with defaults.
+func NewRetrySemanticsAnalyzer() *RetrySemanticsAnalyzer {
+	byKey := newBoundedMap[RetryKey, *retrySemanticsState](DefaultLimits)
+	return &RetrySemanticsAnalyzer{
+		boundedBase: newBoundedBase("retrysemantics", byKey),
+		byKey:       byKey,
+		Window:      DefaultRetrySemanticsWindow,
+		NoBackoff:   DefaultNoBackoff,
+	}
+}
+
+// OnRequest ingests an ObservedRequest.
+func (a *RetrySemanticsAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key := RetryKey{
+		Client: ev.Client,
+		Method: ev.Method,
+		Host:   ev.Route.Host,
+		Path:   ev.ConcretePath(),
+		Query:  ev.Query,
+	}
+	at := retryAttempt{
+		start:     now,
+		end:       now.Add(max(ev.Latency, 0)),
+		status:    ev.StatusCode,
+		idemKey:   idempotencyKey(ev.ReqHeaders),
+		bodyHash:  hashBody(ev.ReqBody),
+		bodyKnown: !ev.ReqBodyTruncated,
+	}
+	if ev.StatusCode == http.StatusTooManyRequests || ev.StatusCode == http.StatusServiceUnavailable {
+		at.retryAfter = parseRetryAfter(ev.RespHeaders, at.end)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, ok := a.byKey.get(key, now)
+	if !ok {
+		st = &retrySemanticsState{first: now, byBackoff: make(map[string]int64)}
+		a.byKey.put(key, st, now)
+	}
+	st.route = ev.Route
+	if now.Before(st.first) {
+		st.first = now
+	}
+	if now.After(st.last) {
+		st.last = now
+	}
+
+	// A request more than Window after the newest attempt starts a new
+	// burst; earlier ones still belong to the current burst.
+	if n := len(st.attempts); n > 0 && now.Sub(st.attempts[n-1].start) > a.Window {
+		a.finish(st)
+	}
+	st.attempts = append(st.attempts, at)
+	// Events arrive at completion, so overlapping attempts can be out of order.
+	sort.SliceStable(st.attempts, func(i, j int) bool { return st.attempts[i].start.Before(st.attempts[j].start) })
+	if len(st.attempts) > maxBurstAttempts {
+		st.attempts = append(st.attempts[:0], st.attempts[len(st.attempts)-maxBurstAttempts:]...)
+	}
+}
+
+// finish folds the current burst into the totals; the caller holds the lock.
+func (a *RetrySemanticsAnalyzer) finish(st *retrySemanticsState) {
+	if len(st.attempts) > 1 {
+		stats, backoff, _ := a.burst(st.route.Method, st.attempts)
+		st.totals.add(stats)
+		st.bursts++
+		st.byBackoff[backoff]++
+	}
+	st.attempts = st.attempts[:0]
+}
+
+// burst evaluates one burst of attempts, oldest first.
+func (a *RetrySemanticsAnalyzer) burst(method string, attempts []retryAttempt) (RetryBurstStats, string, []time.Duration) {
+	var s RetryBurstStats
+	unsafe := strings.EqualFold(method, http.MethodPost) || strings.EqualFold(method, http.MethodPatch)
+	gaps := make([]time.Duration, 0, len(attempts))
+	for i := 1; i < len(attempts); i++ {
+		prev, cur := attempts[i-1], attempts[i]
+		s.Retries++
+		gaps = append(gaps, cur.start.Sub(prev.start))
+		if unsafe && cur.idemKey == "" {
+			s.UnkeyedRetries++
+		}
+		if cur.idemKey != "" && prev.idemKey != "" && cur.idemKey != prev.idemKey {
+			s.KeyChanges++
+		}
+		// A truncated body says nothing about the rest of it.
+		if cur.bodyKnown && prev.bodyKnown && cur.bodyHash != prev.bodyHash {
+			s.BodyChanges++
+		}
+		if prev.retryAfter > 0 {
+			s.RetryAfterChecked++
+			// 10% slack for clock granularity and proxy overhead.
+			if cur.start.Sub(prev.end) < prev.retryAfter*9/10 {
+				s.RetryAfterIgnored++
+			}
+		}
+	}
+	return s, classifyBackoff(gaps, a.NoBackoff), gaps
+}
+
+// classifyBackoff names the shape of the gaps between attempts.
+func classifyBackoff(gaps []time.Duration, none time.Duration) string {
+	if len(gaps) == 0 {
+		return BackoffUnknown
+	}
+	immediate := true
+	for _, g := range gaps {
+		if g >= none {
+			immediate = false
+			break
+		}
+	}
+	if immediate {
+		return BackoffNone
+	}
+	if len(gaps) < 2 {
+		return BackoffUnknown
+	}
+
+	var mean float64
+	for _, g := range gaps {
+		mean += float64(g)
+	}
+	mean /= float64(len(gaps))
+	if relSpread(durationsToFloats(gaps), mean) <= 0.25 {
+		return BackoffConstant
+	}
+
+	// Growth factors and steps between consecutive gaps; when both fit,
+	// the tighter one wins and exponential takes ties (two gaps of 1s, 2s).
+	ratios := make([]float64, 0, len(gaps)-1)
+	steps := make([]float64, 0, len(gaps)-1)
+	var meanRatio, meanStep float64
+	for i := 1; i < len(gaps); i++ {
+		if gaps[i-1] <= 0 {
+			return BackoffIrregular
+		}
+		r := float64(gaps[i]) / float64(gaps[i-1])
+		d := float64(gaps[i] - gaps[i-1])
+		ratios = append(ratios, r)
+		steps = append(steps, d)
+		meanRatio += r
+		meanStep += d
+	}
+	meanRatio /= float64(len(ratios))
+	meanStep /= float64(len(steps))
+
+	expSpread, linSpread := relSpread(ratios, meanRatio), relSpread(steps, meanStep)
+	exponential := meanRatio >= 1.5 && expSpread <= 0.3
+	linear := meanStep > 0 && linSpread <= 0.35
+	switch {
+	case exponential && (!linear || expSpread <= linSpread):
+		return BackoffExponential
+	case linear:
+		return BackoffLinear
+	}
+	return BackoffIrregular
+}
+
+// relSpread is the largest relative deviation of vs from mean.
+func relSpread(vs []float64, mean float64) float64 {
+	if mean == 0 {
+		return math.Inf(1)
+	}
+	var worst float64
+	for _, v := range vs {
+		worst = max(worst, math.Abs(v-mean)/math.Abs(mean))
+	}
+	return worst
+}
+
+func durationsToFloats(ds []time.Duration) []float64 {
+	out := make([]float64, len(ds))
+	for i, d := range ds {
+		out[i] = float64(d)
+	}
+	return out
+}
+
+// idempotencyKey returns the request's Idempotency-Key (or the common
+// X-Idempotency-Key spelling).
+func idempotencyKey(h http.Header) string {
+	if h == nil {
+		return ""
+	}
+	if v := h.Get("Idempotency-Key"); v != "" {
+		return v
+	}
+	return h.Get("X-Idempotency-Key")
+}
+
+// parseRetryAfter reads Retry-After as delay-seconds or an HTTP-date, the
+// latter relative to the response's Date header when present, else to
+// received.
+func parseRetryAfter(h http.Header, received time.Time) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
+		return 0
+	}
+	ref := received
+	if d, err := http.ParseTime(h.Get("Date")); err == nil {
+		ref = d
+	}
+	return max(at.Sub(ref), 0)
+}
+
+// hashBody fingerprints a captured body for equality checks; 0 when empty.
+func hashBody(b []byte) uint64 {
+	if len(b) == 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// Snapshot returns keys with at least minRetries retries, most retries first.
+func (a *RetrySemanticsAnalyzer) Snapshot(minRetries int64) []RetrySemanticsSnapshot {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if minRetries < 1 {
+		minRetries = 1
+	}
+	out := make([]RetrySemanticsSnapshot, 0)
+	a.byKey.each(func(key RetryKey, st *retrySemanticsState) bool {
+		s := RetrySemanticsSnapshot{
+			Key:             key,
+			Route:           st.route,
+			Idempotent:      IdempotentMethod(key.Method),
+			FirstSeen:       st.first,
+			LastSeen:        st.last,
+			Bursts:          st.bursts,
+			RetryBurstStats: st.totals,
+			Backoff:         make(map[string]int64, len(st.byBackoff)+1),
+			BurstAttempts:   len(st.attempts),
+		}
+		for k, v := range st.byBackoff {
+			s.Backoff[k] = v
+		}
+		if n := len(st.attempts); n > 0 {
+			s.LastStatus = st.attempts[n-1].status
+		}
+		if len(st.attempts) > 1 {
+			stats, backoff, gaps := a.burst(key.Method, st.attempts)
+			s.RetryBurstStats.add(stats)
+			s.Bursts++
+			s.Backoff[backoff]++
+			s.BurstBackoff, s.BurstGaps = backoff, gaps
+		}
+		if s.Retries < minRetries {
+			return true
+		}
+		s.Flags = retrySemanticsFlags(&s)
+		out = append(out, s)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Retries != out[j].Retries {
+			return out[i].Retries > out[j].Retries
+		}
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out
+}
+
+func retrySemanticsFlags(s *RetrySemanticsSnapshot) []string {
+	var out []string
+	if s.UnkeyedRetries > 0 {
+		out = append(out, FlagUnsafeRetry)
+	}
+	if s.KeyChanges > 0 {
+		out = append(out, FlagIdempotencyKeyChanged)
+	}
+	if s.RetryAfterIgnored > 0 {
+		out = append(out, FlagRetryAfterIgnored)
+	}
+	if s.Backoff[BackoffNone] > 0 {
+		out = append(out, FlagNoBackoff)
+	}
+	if s.BodyChanges > 0 {
+		out = append(out, FlagRetryBodyChanged)
+	}
+	return out
+}
+
+// RetrySemantics returns the RetrySemanticsAnalyzer registered in this
+// registry, if any.
+func (r *Registry) RetrySemantics() *RetrySemanticsAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if ra, ok := a.(*RetrySemanticsAnalyzer); ok {
+			return ra
+		}
+	}
+	return nil
+}
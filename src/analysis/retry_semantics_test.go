@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetrySemanticsPostWithoutKeyAndRetryAfter(t *testing.T) {
+	a := NewRetrySemanticsAnalyzer()
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	send := func(at time.Duration, method, key, body string, status int, retryAfter string) {
+		ev := &ObservedRequest{
+			Timestamp:   base.Add(at),
+			Latency:     50 * time.Millisecond,
+			Client:      ClientID{IP: "10.0.0.1"},
+			Route:       RouteKey{Host: "shop", Method: method, Path: "/orders"},
+			Method:      method,
+			Path:        "/orders",
+			StatusCode:  status,
+			ReqHeaders:  http.Header{},
+			RespHeaders: http.Header{},
+			ReqBody:     []byte(body),
+		}
+		if key != "" {
+			ev.ReqHeaders.Set("Idempotency-Key", key)
+		}
+		if retryAfter != "" {
+			ev.RespHeaders.Set("Retry-After", retryAfter)
+		}
+		a.OnRequest(ev)
+	}
+
+	// Unkeyed POST hammered with no delay; the 429 asked for 2s and the
+	// second attempt came after 10ms; the third changed the body.
+	send(0, "POST", "", `{"sku":1}`, 429, "2")
+	send(60*time.Millisecond, "POST", "", `{"sku":1}`, 503, "")
+	send(120*time.Millisecond, "POST", "", `{"sku":1,"ts":2}`, 201, "")
+
+	// Keyed PUT with exponential backoff that honors Retry-After.
+	send(0, "PUT", "k1", "x", 503, "1")
+	send(1100*time.Millisecond, "PUT", "k1", "x", 503, "")
+	send(3100*time.Millisecond, "PUT", "k1", "x", 503, "")
+	send(7100*time.Millisecond, "PUT", "k1", "x", 200, "")
+
+	snap := a.Snapshot(1)
+	if len(snap) != 2 {
+		t.Fatalf("want 2 keys, got %d", len(snap))
+	}
+	put, post := snap[0], snap[1]
+	if post.Key.Method != "POST" || post.Idempotent || post.Retries != 2 || post.UnkeyedRetries != 2 {
+		t.Fatalf("post = %+v", post)
+	}
+	if post.RetryAfterChecked != 1 || post.RetryAfterIgnored != 1 || post.BodyChanges != 1 || post.BurstBackoff != BackoffNone {
+		t.Fatalf("post = %+v", post)
+	}
+	want := map[string]bool{FlagUnsafeRetry: true, FlagRetryAfterIgnored: true, FlagNoBackoff: true, FlagRetryBodyChanged: true}
+	if len(post.Flags) != len(want) {
+		t.Fatalf("post flags = %v", post.Flags)
+	}
+	for _, f := range post.Flags {
+		if !want[f] {
+			t.Fatalf("unexpected flag %q in %v", f, post.Flags)
+		}
+	}
+
+	if !put.Idempotent || put.Retries != 3 || put.RetryAfterIgnored != 0 || put.RetryAfterChecked != 1 {
+		t.Fatalf("put = %+v", put)
+	}
+	if put.BurstBackoff != BackoffExponential || len(put.Flags) != 0 {
+		t.Fatalf("put backoff=%s flags=%v gaps=%v", put.BurstBackoff, put.Flags, put.BurstGaps)
+	}
+
+	// A request after the window closes the burst into the totals.
+	send(time.Minute, "PUT", "k2", "x", 200, "")
+	for _, s := range a.Snapshot(1) {
+		if s.Key.Method == "PUT" && (s.Bursts != 1 || s.Backoff[BackoffExponential] != 1 || s.BurstAttempts != 1) {
+			t.Fatalf("put after window = %+v", s)
+		}
+	}
+}
+
+func TestRetrySemanticsTruncatedBodiesAreNotCompared(t *testing.T) {
+	a := NewRetrySemanticsAnalyzer()
+	t0 := time.Now()
+	attempts := []retryAttempt{
+		{start: t0, bodyHash: 1, bodyKnown: true},
+		{start: t0.Add(time.Second), bodyHash: 2}, // truncated
+		{start: t0.Add(2 * time.Second), bodyHash: 3, bodyKnown: true},
+	}
+	if s, _, _ := a.burst("POST", attempts); s.BodyChanges != 0 {
+		t.Fatalf("truncated body counted as a change: %+v", s)
+	}
+}
+
+func TestClassifyBackoff(t *testing.T) {
+	s := time.Second
+	for _, tc := range []struct {
+		gaps []time.Duration
+		want string
+	}{
+		{[]time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, BackoffNone},
+		{[]time.Duration{s}, BackoffUnknown},
+		{[]time.Duration{s, s, 1100 * time.Millisecond}, BackoffConstant},
+		{[]time.Duration{s, 2 * s, 3 * s, 4 * s}, BackoffLinear},
+		{[]time.Duration{s, 2 * s, 4 * s, 8 * s}, BackoffExponential},
+		{[]time.Duration{5 * s, s, 9 * s}, BackoffIrregular},
+	} {
+		if got := classifyBackoff(tc.gaps, DefaultNoBackoff); got != tc.want {
+			t.Errorf("classifyBackoff(%v) = %s, want %s", tc.gaps, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+//
+// 13. JSON body schema inference & field-level drift per route
+//
+
+// Body directions.
+const (
+	DirectionRequest  = "request"
+	DirectionResponse = "response"
+)
+
+// Schema drift kinds.
+const (
+	DriftFieldAdded   = "field_added"   // field seen for the first time on a learned route
+	DriftFieldRemoved = "field_removed" // a field that was always present is missing
+	DriftTypeChanged  = "type_changed"  // a field carried a type it never had before
+)
+
+// Defaults for SchemaDriftAnalyzer.
+const (
+	DefaultSchemaMinSamples = 5   // samples before a route's schema is considered learned
+	maxSchemaFields         = 500 // field paths tracked per route and direction
+	maxSchemaDepth          = 16  // nesting depth walked into a body
+	maxRecentDrift          = 200 // drift events kept for Recent()
+)
+
+// SchemaDrift is one field-level change in a route's payload structure.
+type SchemaDrift struct {
+	Route     RouteKey  `json:"route"`
+	Direction string    `json:"direction"`
+	Kind      string    `json:"kind"`
+	Field     string    `json:"field"`               // e.g. $.user.roles[]
+	OldTypes  []string  `json:"old_types,omitempty"` // types seen before this sample
+	NewType   string    `json:"new_type,omitempty"`
+	CaptureID string    `json:"capture_id,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// FieldStats is the running schema of one field path.
+type FieldStats struct {
+	Types     map[string]int64 // JSON type -> samples
+	Present   int64            // samples in which the field occurred
+	MinItems  int              // arrays only
+	MaxItems  int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+type bodySchema struct {
+	samples   int64
+	fields    map[string]*FieldStats
+	drifts    int64
+	lastDrift time.Time
+}
+
+type schemaKey struct {
+	route     RouteKey
+	direction string
+}
+
+// SchemaDriftAnalyzer infers a running JSON schema per route and direction
+// (field paths, types, nullability, presence ratio, array lengths) and
+// reports drift once a route has MinSamples samples: fields appearing for the
+// first time, disappearing after having always been present, or changing type.
+type SchemaDriftAnalyzer struct {
+	*boundedBase
+	MinSamples int64
+	byKey      *boundedMap[schemaKey, *bodySchema]
+	recent     []SchemaDrift
+	onDrift    func(SchemaDrift)
+}
+
+// NewSchemaDriftAnalyzer constructs an analyzer with default thresholds.
+func NewSchemaDriftAnalyzer() *SchemaDriftAnalyzer {
+	byKey := newBoundedMap[schemaKey, *bodySchema](DefaultLimits)
+	return &SchemaDriftAnalyzer{
+		boundedBase: newBoundedBase("schema", byKey),
+		MinSamples:  DefaultSchemaMinSamples,
+		byKey:       byKey,
+	}
+}
+
+// SetDriftHandler installs a callback invoked (outside the analyzer's lock)
+// for every drift event.
+func (a *SchemaDriftAnalyzer) SetDriftHandler(fn func(SchemaDrift)) {
+	a.mu.Lock()
+	a.onDrift = fn
+	a.mu.Unlock()
+}
+
+// OnRequest ingests the request and response bodies of an ObservedRequest.
+func (a *SchemaDriftAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var drifts []SchemaDrift
+	a.mu.Lock()
+	if v, ok := jsonBodyValue(ev.ReqHeaders, ev.ReqBody, ev.ReqBodyTruncated); ok {
+		drifts = append(drifts, a.observe(schemaKey{ev.Route, DirectionRequest}, v, ev.ID, now)...)
+	}
+	if v, ok := jsonBodyValue(ev.RespHeaders, ev.RespBody, ev.RespBodyTruncated); ok {
+		drifts = append(drifts, a.observe(schemaKey{ev.Route, DirectionResponse}, v, ev.ID, now)...)
+	}
+	fn := a.onDrift
+	a.mu.Unlock()
+
+	if fn != nil {
+		for _, d := range drifts {
+			fn(d)
+		}
+	}
+}
+
+// jsonBodyValue decodes a complete JSON body; anything else is skipped.
+func jsonBodyValue(h map[string][]string, body []byte, truncated bool) (any, bool) {
+	if truncated || len(body) == 0 {
+		return nil, false
+	}
+	var ct string
+	for k, vs := range h {
+		if strings.EqualFold(k, "Content-Type") && len(vs) > 0 {
+			ct = vs[0]
+		}
+	}
+	if !IsJSONMediaType(ct) {
+		return nil, false
+	}
+	return DecodeJSON(body)
+}
+
+// schemaType is JSONType with integers folded into number, so a field that
+// carries both 1 and 1.5 is not reported as drifting.
+func schemaType(v any) string {
+	if t := JSONType(v); t != "integer" {
+		return t
+	}
+	return "number"
+}
+
+// flattenJSON collects field path -> values for one body. Array elements
+// share the path "<array>[]", so an array of objects yields one set of fields.
+func flattenJSON(path string, v any, depth int, out map[string][]any) {
+	out[path] = append(out[path], v)
+	if depth >= maxSchemaDepth {
+		return
+	}
+	switch x := v.(type) {
+	case map[string]any:
+		for k, child := range x {
+			flattenJSON(path+"."+k, child, depth+1, out)
+		}
+	case []any:
+		for _, child := range x {
+			flattenJSON(path+"[]", child, depth+1, out)
+		}
+	}
+}
+
+// parentPath returns the path of the value containing field.
+func parentPath(field string) string {
+	if strings.HasSuffix(field, "[]") {
+		return field[:len(field)-2]
+	}
+	if i := strings.LastIndexByte(field, '.'); i > 0 {
+		return field[:i]
+	}
+	return ""
+}
+
+func (a *SchemaDriftAnalyzer) observe(key schemaKey, v any, id string, now time.Time) []SchemaDrift {
+	bs, _ := a.byKey.get(key, now)
+	if bs == nil {
+		bs = &bodySchema{fields: make(map[string]*FieldStats)}
+		a.byKey.put(key, bs, now)
+	}
+	minSamples := a.MinSamples
+	if minSamples <= 0 {
+		minSamples = DefaultSchemaMinSamples
+	}
+	learned := bs.samples >= minSamples
+
+	values := make(map[string][]any)
+	flattenJSON("$", v, 0, values)
+
+	var drifts []SchemaDrift
+	drift := func(kind, field string, old []string, newType string) {
+		drifts = append(drifts, SchemaDrift{
+			Route: key.route, Direction: key.direction, Kind: kind, Field: field,
+			OldTypes: old, NewType: newType, CaptureID: id, At: now,
+		})
+	}
+
+	// Always-present fields missing from this sample (whose parent is here).
+	if learned {
+		known := make([]string, 0, len(bs.fields))
+		for field := range bs.fields {
+			known = append(known, field)
+		}
+		sort.Strings(known)
+		for _, field := range known {
+			fs := bs.fields[field]
+			if _, ok := values[field]; ok || fs.Present != bs.samples {
+				continue
+			}
+			if p := parentPath(field); p != "" {
+				pv, ok := values[p]
+				if !ok || !containerPresent(pv, strings.HasSuffix(field, "[]")) {
+					continue
+				}
+			}
+			drift(DriftFieldRemoved, field, fs.typeList(), "")
+		}
+	}
+
+	fields := make([]string, 0, len(values))
+	for f := range values {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		fs := bs.fields[field]
+		if fs == nil {
+			if len(bs.fields) >= maxSchemaFields {
+				continue
+			}
+			fs = &FieldStats{Types: make(map[string]int64), FirstSeen: now, MinItems: -1}
+			bs.fields[field] = fs
+			if learned {
+				drift(DriftFieldAdded, field, nil, schemaType(values[field][0]))
+			}
+		} else if learned {
+			reported := make(map[string]bool)
+			for _, val := range values[field] {
+				t := schemaType(val)
+				if fs.Types[t] == 0 && !reported[t] {
+					reported[t] = true
+					drift(DriftTypeChanged, field, fs.typeList(), t)
+				}
+			}
+		}
+		fs.Present++
+		fs.LastSeen = now
+		for _, val := range values[field] {
+			fs.Types[schemaType(val)]++
+			if arr, ok := val.([]any); ok {
+				if fs.MinItems < 0 || len(arr) < fs.MinItems {
+					fs.MinItems = len(arr)
+				}
+				if len(arr) > fs.MaxItems {
+					fs.MaxItems = len(arr)
+				}
+			}
+		}
+	}
+	bs.samples++
+
+	if len(drifts) > 0 {
+		bs.drifts += int64(len(drifts))
+		bs.lastDrift = now
+		a.recent = append(a.recent, drifts...)
+		if n := len(a.recent) - maxRecentDrift; n > 0 {
+			a.recent = append([]SchemaDrift(nil), a.recent[n:]...)
+		}
+	}
+	return drifts
+}
+
+// merge folds the samples of o into bs. A field is still "always present"
+// afterwards only if it was in every sample of both.
+func (bs *bodySchema) merge(o *bodySchema) {
+	for field, ofs := range o.fields {
+		fs := bs.fields[field]
+		if fs == nil {
+			if len(bs.fields) >= maxSchemaFields {
+				continue
+			}
+			fs = &FieldStats{Types: make(map[string]int64), FirstSeen: ofs.FirstSeen, MinItems: -1}
+			bs.fields[field] = fs
+		}
+		mergeCounts(fs.Types, ofs.Types, 0)
+		fs.Present += ofs.Present
+		if ofs.MinItems >= 0 && (fs.MinItems < 0 || ofs.MinItems < fs.MinItems) {
+			fs.MinItems = ofs.MinItems
+		}
+		if ofs.MaxItems > fs.MaxItems {
+			fs.MaxItems = ofs.MaxItems
+		}
+		if ofs.FirstSeen.Before(fs.FirstSeen) {
+			fs.FirstSeen = ofs.FirstSeen
+		}
+		if ofs.LastSeen.After(fs.LastSeen) {
+			fs.LastSeen = ofs.LastSeen
+		}
+	}
+	bs.samples += o.samples
+	bs.drifts += o.drifts
+	if o.lastDrift.After(bs.lastDrift) {
+		bs.lastDrift = o.lastDrift
+	}
+}
+
+func (a *SchemaDriftAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byKey.rekey(func(k schemaKey) schemaKey {
+		k.route = rename(k.route)
+		return k
+	}, (*bodySchema).merge)
+	a.mu.Unlock()
+}
+
+// containerPresent reports whether any of the parent's values can hold the
+// child: an object for a property, a non-empty array for an element.
+func containerPresent(vals []any, element bool) bool {
+	for _, v := range vals {
+		switch x := v.(type) {
+		case map[string]any:
+			if !element {
+				return true
+			}
+		case []any:
+			if element && len(x) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (fs *FieldStats) typeList() []string {
+	out := make([]string, 0, len(fs.Types))
+	for t := range fs.Types {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// FieldSchemaSnapshot is the read-only view of one field.
+type FieldSchemaSnapshot struct {
+	Path          string           `json:"path"`
+	Types         map[string]int64 `json:"types"`
+	Nullable      bool             `json:"nullable"`
+	PresenceRatio float64          `json:"presence_ratio"`
+	MinItems      *int             `json:"min_items,omitempty"`
+	MaxItems      *int             `json:"max_items,omitempty"`
+	FirstSeen     time.Time        `json:"first_seen"`
+	LastSeen      time.Time        `json:"last_seen"`
+}
+
+// RouteSchemaSnapshot is the inferred schema of one route and direction.
+type RouteSchemaSnapshot struct {
+	Route     RouteKey              `json:"route"`
+	Direction string                `json:"direction"`
+	Samples   int64                 `json:"samples"`
+	Drifts    int64                 `json:"drifts"`
+	LastDrift time.Time             `json:"last_drift,omitempty"`
+	Fields    []FieldSchemaSnapshot `json:"fields"`
+}
+
+// Snapshot returns the schemas of routes with at least minSamples bodies.
+func (a *SchemaDriftAnalyzer) Snapshot(minSamples int64) []RouteSchemaSnapshot {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make([]RouteSchemaSnapshot, 0, a.byKey.len())
+	a.byKey.each(func(key schemaKey, bs *bodySchema) bool {
+		if bs.samples < minSamples {
+			return true
+		}
+		snap := RouteSchemaSnapshot{
+			Route:     key.route,
+			Direction: key.direction,
+			Samples:   bs.samples,
+			Drifts:    bs.drifts,
+			LastDrift: bs.lastDrift,
+			Fields:    make([]FieldSchemaSnapshot, 0, len(bs.fields)),
+		}
+		for path, fs := range bs.fields {
+			types := make(map[string]int64, len(fs.Types))
+			for t, n := range fs.Types {
+				types[t] = n
+			}
+			f := FieldSchemaSnapshot{
+				Path:      path,
+				Types:     types,
+				Nullable:  fs.Types["null"] > 0,
+				FirstSeen: fs.FirstSeen,
+				LastSeen:  fs.LastSeen,
+			}
+			if bs.samples > 0 {
+				f.PresenceRatio = float64(fs.Present) / float64(bs.samples)
+			}
+			if fs.MinItems >= 0 {
+				lo, hi := fs.MinItems, fs.MaxItems
+				f.MinItems, f.MaxItems = &lo, &hi
+			}
+			snap.Fields = append(snap.Fields, f)
+		}
+		sort.Slice(snap.Fields, func(i, j int) bool { return snap.Fields[i].Path < snap.Fields[j].Path })
+		out = append(out, snap)
+		return true
+	})
+	return out
+}
+
+// Recent returns up to limit of the latest drift events, newest first.
+func (a *SchemaDriftAnalyzer) Recent(limit int) []SchemaDrift {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := len(a.recent)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]SchemaDrift, 0, limit)
+	for i := n - 1; i >= n-limit; i-- {
+		out = append(out, a.recent[i])
+	}
+	return out
+}
+
+// SchemaDrift returns the SchemaDriftAnalyzer registered in this registry, if any.
+func (r *Registry) SchemaDrift() *SchemaDriftAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if sa, ok := a.(*SchemaDriftAnalyzer); ok {
+			return sa
+		}
+	}
+	return nil
+}
+
+// Reset forgets all accumulated state, including the recent drift events.
+func (a *SchemaDriftAnalyzer) Reset() {
+	a.mu.Lock()
+	a.byKey.reset()
+	a.recent = nil
+	a.mu.Unlock()
+}
@@ -0,0 +1,86 @@
+package analysis
+
+import (
+	"net/http"
+	"testing"
+)
+
+func jsonEvent(route RouteKey, body string) *ObservedRequest {
+	return &ObservedRequest{
+		Route:       route,
+		RespHeaders: http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+		RespBody:    []byte(body),
+	}
+}
+
+func TestSchemaDriftDetection(t *testing.T) {
+	a := NewSchemaDriftAnalyzer()
+	a.MinSamples = 3
+	var fired []SchemaDrift
+	a.SetDriftHandler(func(d SchemaDrift) { fired = append(fired, d) })
+
+	route := RouteKey{Host: "api", Path: "/users/{id}", Method: "GET"}
+	for i := 0; i < 3; i++ {
+		a.OnRequest(jsonEvent(route, `{"id":1,"name":"a","tags":["x","y"],"email":null}`))
+	}
+	if len(fired) != 0 {
+		t.Fatalf("no drift expected while learning, got %+v", fired)
+	}
+
+	// name disappears, id becomes a string, nickname appears
+	a.OnRequest(jsonEvent(route, `{"id":"1","nickname":"b","tags":[],"email":null}`))
+
+	got := make(map[string]SchemaDrift)
+	for _, d := range fired {
+		got[d.Kind+" "+d.Field] = d
+	}
+	if len(fired) != 3 {
+		t.Fatalf("expected 3 drift events, got %+v", fired)
+	}
+	if d, ok := got[DriftTypeChanged+" $.id"]; !ok || d.NewType != "string" || d.OldTypes[0] != "number" {
+		t.Errorf("missing id type change: %+v", fired)
+	}
+	if _, ok := got[DriftFieldRemoved+" $.name"]; !ok {
+		t.Errorf("missing name removal: %+v", fired)
+	}
+	if _, ok := got[DriftFieldAdded+" $.nickname"]; !ok {
+		t.Errorf("missing nickname addition: %+v", fired)
+	}
+	// An empty array must not count as its elements being removed.
+	if _, ok := got[DriftFieldRemoved+" $.tags[]"]; ok {
+		t.Errorf("empty array reported as removed element")
+	}
+
+	snaps := a.Snapshot(1)
+	if len(snaps) != 1 || snaps[0].Direction != DirectionResponse || snaps[0].Samples != 4 || snaps[0].Drifts != 3 {
+		t.Fatalf("unexpected snapshot: %+v", snaps)
+	}
+	fields := make(map[string]FieldSchemaSnapshot)
+	for _, f := range snaps[0].Fields {
+		fields[f.Path] = f
+	}
+	if !fields["$.email"].Nullable {
+		t.Errorf("email should be nullable")
+	}
+	if r := fields["$.name"].PresenceRatio; r != 0.75 {
+		t.Errorf("name presence = %v, want 0.75", r)
+	}
+	if f := fields["$.tags"]; f.MinItems == nil || *f.MinItems != 0 || *f.MaxItems != 2 {
+		t.Errorf("tags array lengths = %+v", f)
+	}
+	if recent := a.Recent(1); len(recent) != 1 {
+		t.Errorf("Recent(1) = %d events", len(recent))
+	}
+}
+
+func TestSchemaDriftSkipsNonJSONAndTruncated(t *testing.T) {
+	a := NewSchemaDriftAnalyzer()
+	route := RouteKey{Host: "api", Path: "/", Method: "GET"}
+	a.OnRequest(&ObservedRequest{Route: route, RespHeaders: http.Header{"Content-Type": {"text/html"}}, RespBody: []byte("{}")})
+	ev := jsonEvent(route, `{"a":`)
+	ev.RespBodyTruncated = true
+	a.OnRequest(ev)
+	if snaps := a.Snapshot(0); len(snaps) != 0 {
+		t.Fatalf("expected nothing learned, got %+v", snaps)
+	}
+}
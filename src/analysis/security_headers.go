@@ -0,0 +1,466 @@
+package analysis
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// 22. Security header and cookie audit
+//
+
+// Finding severities, most severe first.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+// SeverityRank orders severities (high = 3); unknown names rank 0.
+func SeverityRank(s string) int {
+	switch s {
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+// Security checks.
+const (
+	CheckHSTSMissing         = "hsts_missing"
+	CheckHSTSShort           = "hsts_short"
+	CheckCSPMissing          = "csp_missing"
+	CheckCSPUnsafe           = "csp_unsafe"
+	CheckNoSniffMissing      = "nosniff_missing"
+	CheckFrameOptionsMissing = "frame_options_missing"
+	CheckFrameOptionsInvalid = "frame_options_invalid"
+	CheckReferrerPolicy      = "referrer_policy_missing"
+	CheckReferrerUnsafe      = "referrer_policy_unsafe"
+	CheckCORSCredentials     = "cors_wildcard_credentials"
+	CheckCookieNotSecure     = "cookie_not_secure"
+	CheckCookieNotHTTPOnly   = "cookie_not_httponly"
+	CheckCookieNoSameSite    = "cookie_samesite_missing"
+	CheckCookieSameSiteNone  = "cookie_samesite_none_insecure"
+	CheckCookieBroadDomain   = "cookie_broad_domain"
+	CheckCookieBroadPath     = "cookie_broad_path"
+	CheckCookiePrefix        = "cookie_prefix_violation"
+	CheckMixedContent        = "mixed_content"
+)
+
+const (
+	minHSTSMaxAge       = 180 * 24 * 3600 // seconds; the usual audit floor
+	maxSecuritySamples  = 5               // example capture IDs per finding
+	maxSecurityRoutes   = 8
+	maxMixedContentScan = 1 << 20 // bytes of HTML searched for http:// references
+	maxExampleURLLen    = 100
+)
+
+// sessionCookieName matches cookie names that look like they carry a session
+// or credential; their missing attributes are rated more severe.
+var sessionCookieName = regexp.MustCompile(`(?i)(sess|sid|auth|token|jwt|login|remember|csrf|xsrf)`)
+
+// mixedContentRef finds http:// URLs in attributes that load or submit to
+// them. Scripts, frames, styles, objects and forms are active mixed content;
+// media is passive.
+var mixedContentRef = regexp.MustCompile(`(?i)<(script|iframe|frame|link|object|embed|form|img|audio|video|source|track)\b[^>]*?\s(?:src|href|action|data|poster)\s*=\s*["']?(http://[^"'\s>]+)`)
+
+// SecurityFindingKey identifies one finding: a check failing on a host, with
+// a detail such as the cookie name.
+type SecurityFindingKey struct {
+	Host   string
+	Check  string
+	Detail string
+}
+
+// securityIssue is one check failing on one response.
+type securityIssue struct {
+	check, detail, severity, message string
+}
+
+type securityFindingState struct {
+	severity    string
+	message     string
+	first, last time.Time
+	count       int64
+	routes      map[string]int64 // "METHOD /path" -> count
+	samples     []string         // capture IDs, newest last
+}
+
+// SecurityFinding is a read-only view of one finding.
+type SecurityFinding struct {
+	Key       SecurityFindingKey
+	Severity  string
+	Message   string // from the first response that failed the check
+	Count     int64  // responses that failed it
+	Routes    map[string]int64
+	Samples   []string // example capture IDs, newest last
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// SecurityHeadersAnalyzer passively audits responses per host: HSTS, CSP,
+// X-Content-Type-Options, frame options, Referrer-Policy, CORS wildcards
+// with credentials, Set-Cookie attributes and mixed content in HTML.
+type SecurityHeadersAnalyzer struct {
+	*boundedBase
+	findings *boundedMap[SecurityFindingKey, *securityFindingState]
+}
+
+// NewSecurityHeadersAnalyzer constructs an empty analyzer.
+func NewSecurityHeadersAnalyzer() *SecurityHeadersAnalyzer {
+	findings := newBoundedMap[SecurityFindingKey, *securityFindingState](DefaultLimits)
+	return &SecurityHeadersAnalyzer{
+		boundedBase: newBoundedBase("security", findings),
+		findings:    findings,
+	}
+}
+
+// OnRequest ingests an ObservedRequest.
+func (a *SecurityHeadersAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || ev.Route.Host == "" || ev.StatusCode < 200 || ev.StatusCode == http.StatusNotModified {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	issues := auditResponse(ev, now)
+	if len(issues) == 0 {
+		return
+	}
+	route := ev.Route.Method + " " + ev.Route.Path
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, is := range issues {
+		key := SecurityFindingKey{Host: ev.Route.Host, Check: is.check, Detail: is.detail}
+		st, ok := a.findings.get(key, now)
+		if !ok {
+			st = &securityFindingState{
+				severity: is.severity,
+				message:  is.message,
+				first:    now,
+				routes:   make(map[string]int64),
+			}
+			a.findings.put(key, st, now)
+		}
+		st.count++
+		if now.After(st.last) {
+			st.last = now
+		}
+		addCount(st.routes, route, maxSecurityRoutes)
+		if ev.ID != "" {
+			st.samples = append(st.samples, ev.ID)
+			if len(st.samples) > maxSecuritySamples {
+				st.samples = st.samples[len(st.samples)-maxSecuritySamples:]
+			}
+		}
+	}
+}
+
+// auditResponse runs every check against one response.
+func auditResponse(ev *ObservedRequest, now time.Time) []securityIssue {
+	h := ev.RespHeaders
+	if h == nil {
+		h = http.Header{}
+	}
+	secure := strings.EqualFold(ev.Scheme, "https") || ev.TLSState != nil || ev.TLS.Version != 0
+	ct := strings.ToLower(h.Get("Content-Type"))
+	html := strings.Contains(ct, "text/html") || strings.Contains(ct, "application/xhtml")
+	var out []securityIssue
+	add := func(check, detail, severity, format string, args ...any) {
+		out = append(out, securityIssue{check: check, detail: detail, severity: severity, message: fmt.Sprintf(format, args...)})
+	}
+
+	if secure {
+		hsts := h.Get("Strict-Transport-Security")
+		maxAge := hstsMaxAge(hsts)
+		switch {
+		case hsts == "":
+			add(CheckHSTSMissing, "", SeverityMedium, "HTTPS response without Strict-Transport-Security")
+		case maxAge <= 0:
+			add(CheckHSTSMissing, "", SeverityMedium, "Strict-Transport-Security %q is disabled or has no valid max-age", hsts)
+		case maxAge < minHSTSMaxAge:
+			add(CheckHSTSShort, "", SeverityLow, "HSTS max-age=%d is under 180 days", maxAge)
+		}
+	}
+
+	if ct != "" && !strings.EqualFold(strings.TrimSpace(h.Get("X-Content-Type-Options")), "nosniff") {
+		add(CheckNoSniffMissing, "", SeverityLow, "X-Content-Type-Options: nosniff missing on %s", mediaType(ct))
+	}
+
+	csp := parseCSP(h.Get("Content-Security-Policy"))
+	if html {
+		if csp == nil {
+			add(CheckCSPMissing, "", SeverityMedium, "HTML response without Content-Security-Policy")
+		} else if why := cspScriptWeakness(csp); why != "" {
+			add(CheckCSPUnsafe, "", SeverityLow, "CSP script policy %s", why)
+		}
+
+		xfo := strings.ToUpper(strings.TrimSpace(h.Get("X-Frame-Options")))
+		_, ancestors := csp["frame-ancestors"]
+		switch {
+		case ancestors:
+		case xfo == "":
+			add(CheckFrameOptionsMissing, "", SeverityMedium, "HTML response without X-Frame-Options or CSP frame-ancestors (clickjacking)")
+		case xfo != "DENY" && xfo != "SAMEORIGIN":
+			add(CheckFrameOptionsInvalid, "", SeverityLow, "X-Frame-Options %q is not DENY or SAMEORIGIN and is ignored by current browsers", xfo)
+		}
+
+		rp := strings.ToLower(strings.TrimSpace(h.Get("Referrer-Policy")))
+		switch {
+		case rp == "":
+			add(CheckReferrerPolicy, "", SeverityLow, "HTML response without Referrer-Policy")
+		case strings.Contains(rp, "unsafe-url"):
+			add(CheckReferrerUnsafe, "", SeverityMedium, "Referrer-Policy unsafe-url sends full URLs, also over HTTP")
+		}
+	}
+
+	if strings.EqualFold(strings.TrimSpace(h.Get("Access-Control-Allow-Credentials")), "true") {
+		switch origin := strings.TrimSpace(h.Get("Access-Control-Allow-Origin")); origin {
+		case "*", "null":
+			add(CheckCORSCredentials, origin, SeverityHigh, "Access-Control-Allow-Origin %q with Access-Control-Allow-Credentials: true", origin)
+		}
+	}
+
+	for _, line := range h.Values("Set-Cookie") {
+		out = append(out, auditCookie(line, ev, secure, now)...)
+	}
+
+	if html && secure && !ev.RespBodyTruncated && len(ev.RespBody) > 0 {
+		body := ev.RespBody
+		if len(body) > maxMixedContentScan {
+			body = body[:maxMixedContentScan]
+		}
+		seen := make(map[string]bool)
+		for _, m := range mixedContentRef.FindAllSubmatch(body, -1) {
+			tag, ref := strings.ToLower(string(m[1])), string(m[2])
+			kind, sev := "active", SeverityHigh
+			switch tag {
+			case "img", "audio", "video", "source", "track":
+				kind, sev = "passive", SeverityLow
+			}
+			if seen[kind] {
+				continue
+			}
+			seen[kind] = true
+			if len(ref) > maxExampleURLLen {
+				ref = ref[:maxExampleURLLen] + "…"
+			}
+			add(CheckMixedContent, kind, sev, "HTTPS page loads %s content over HTTP: <%s> %s", kind, tag, ref)
+		}
+	}
+	return out
+}
+
+// auditCookie checks one Set-Cookie line.
+func auditCookie(line string, ev *ObservedRequest, secure bool, now time.Time) []securityIssue {
+	c, err := http.ParseSetCookie(line)
+	if err != nil {
+		return nil
+	}
+	// Deleting a cookie exposes nothing.
+	if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+		return nil
+	}
+	session := sessionCookieName.MatchString(c.Name)
+	sev := func(sessionSev, otherSev string) string {
+		if session {
+			return sessionSev
+		}
+		return otherSev
+	}
+	var out []securityIssue
+	add := func(check, severity, format string, args ...any) {
+		out = append(out, securityIssue{check: check, detail: c.Name, severity: severity, message: fmt.Sprintf(format, args...)})
+	}
+
+	if secure && !c.Secure {
+		add(CheckCookieNotSecure, sev(SeverityHigh, SeverityMedium), "cookie %s set over HTTPS without Secure", c.Name)
+	}
+	if !c.HttpOnly {
+		add(CheckCookieNotHTTPOnly, sev(SeverityMedium, SeverityLow), "cookie %s readable by scripts (no HttpOnly)", c.Name)
+	}
+	switch {
+	case c.SameSite == 0:
+		add(CheckCookieNoSameSite, SeverityLow, "cookie %s without SameSite", c.Name)
+	case c.SameSite == http.SameSiteNoneMode && !c.Secure:
+		add(CheckCookieSameSiteNone, SeverityMedium, "cookie %s has SameSite=None without Secure and is rejected by browsers", c.Name)
+	}
+
+	host := ev.Route.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+	if domain != "" && domain != host && net.ParseIP(host) == nil {
+		switch labels := strings.Count(domain, ".") + 1; {
+		case labels <= 1:
+			add(CheckCookieBroadDomain, SeverityHigh, "cookie %s scoped to top-level domain %q", c.Name, domain)
+		case labels < strings.Count(host, ".")+1:
+			add(CheckCookieBroadDomain, sev(SeverityMedium, SeverityLow), "cookie %s set by %s is sent to every subdomain of %s", c.Name, host, domain)
+		}
+	}
+	// An explicit Path=/ widens the default path (the request's directory).
+	if c.Path == "/" {
+		if dir := defaultCookiePath(ev.ConcretePath()); dir != "/" {
+			add(CheckCookieBroadPath, SeverityLow, "cookie %s set by %s with Path=/ instead of %s", c.Name, ev.Route.Path, dir)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Path != "/" || c.Domain != ""):
+		add(CheckCookiePrefix, SeverityMedium, "cookie %s needs Secure, Path=/ and no Domain", c.Name)
+	case strings.HasPrefix(c.Name, "__Secure-") && !c.Secure:
+		add(CheckCookiePrefix, SeverityMedium, "cookie %s needs Secure", c.Name)
+	}
+	return out
+}
+
+// defaultCookiePath is the RFC 6265 default-path of a request path: its
+// directory.
+func defaultCookiePath(p string) string {
+	if i := strings.IndexByte(p, '#'); i >= 0 {
+		p = p[:i]
+	}
+	i := strings.LastIndexByte(p, '/')
+	if i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+// hstsMaxAge returns the max-age directive, or -1 when absent or invalid.
+func hstsMaxAge(v string) int64 {
+	for _, part := range strings.Split(v, ";") {
+		name, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "max-age") {
+			if n, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(val), `"`), 10, 64); err == nil {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// parseCSP splits a policy into directive -> source list; nil when empty.
+func parseCSP(v string) map[string][]string {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	out := make(map[string][]string)
+	for _, d := range strings.Split(v, ";") {
+		f := strings.Fields(d)
+		if len(f) > 0 {
+			out[strings.ToLower(f[0])] = f[1:]
+		}
+	}
+	return out
+}
+
+// cspScriptWeakness says what lets arbitrary script run under csp, or "".
+func cspScriptWeakness(csp map[string][]string) string {
+	src, ok := csp["script-src"]
+	if !ok {
+		if src, ok = csp["default-src"]; !ok {
+			return "is missing (no script-src or default-src)"
+		}
+	}
+	nonced := false
+	for _, s := range src {
+		l := strings.ToLower(s)
+		if strings.HasPrefix(l, "'nonce-") || strings.HasPrefix(l, "'sha256-") || strings.HasPrefix(l, "'sha384-") || strings.HasPrefix(l, "'sha512-") {
+			nonced = true
+		}
+	}
+	for _, s := range src {
+		switch l := strings.ToLower(s); l {
+		case "'unsafe-inline'":
+			if !nonced { // ignored by browsers when a nonce or hash is present
+				return "allows 'unsafe-inline'"
+			}
+		case "'unsafe-eval'":
+			return "allows 'unsafe-eval'"
+		case "*", "http:", "https:", "data:":
+			return fmt.Sprintf("allows any source (%s)", l)
+		}
+	}
+	return ""
+}
+
+// mediaType strips parameters from a Content-Type.
+func mediaType(ct string) string {
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.TrimSpace(ct)
+}
+
+// Snapshot returns every finding, most severe first, then most frequent.
+func (a *SecurityHeadersAnalyzer) Snapshot() []SecurityFinding {
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]SecurityFinding, 0, a.findings.len())
+	a.findings.each(func(key SecurityFindingKey, st *securityFindingState) bool {
+		f := SecurityFinding{
+			Key:       key,
+			Severity:  st.severity,
+			Message:   st.message,
+			Count:     st.count,
+			Routes:    make(map[string]int64, len(st.routes)),
+			Samples:   append([]string(nil), st.samples...),
+			FirstSeen: st.first,
+			LastSeen:  st.last,
+		}
+		for r, n := range st.routes {
+			f.Routes[r] = n
+		}
+		out = append(out, f)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if ri, rj := SeverityRank(out[i].Severity), SeverityRank(out[j].Severity); ri != rj {
+			return ri > rj
+		}
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		if out[i].Key.Host != out[j].Key.Host {
+			return out[i].Key.Host < out[j].Key.Host
+		}
+		if out[i].Key.Check != out[j].Key.Check {
+			return out[i].Key.Check < out[j].Key.Check
+		}
+		return out[i].Key.Detail < out[j].Key.Detail
+	})
+	return out
+}
+
+// SecurityHeaders returns the SecurityHeadersAnalyzer registered in this
+// registry, if any.
+func (r *Registry) SecurityHeaders() *SecurityHeadersAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if sa, ok := a.(*SecurityHeadersAnalyzer); ok {
+			return sa
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package analysis
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersAuditsHeadersCookiesAndMixedContent(t *testing.T) {
+	a := NewSecurityHeadersAnalyzer()
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	send := func(id, scheme, path string, resp http.Header, body string) {
+		a.OnRequest(&ObservedRequest{
+			ID:          id,
+			Timestamp:   base,
+			Route:       RouteKey{Host: "app.example.com", Method: "GET", Path: path},
+			Method:      "GET",
+			Scheme:      scheme,
+			Path:        path,
+			StatusCode:  200,
+			RespHeaders: resp,
+			RespBody:    []byte(body),
+		})
+	}
+
+	page := http.Header{
+		"Content-Type":                     {"text/html; charset=utf-8"},
+		"Strict-Transport-Security":        {"max-age=3600"},
+		"Content-Security-Policy":          {"default-src 'self'; script-src 'self' 'unsafe-inline'"},
+		"X-Content-Type-Options":           {"nosniff"},
+		"Access-Control-Allow-Origin":      {"*"},
+		"Access-Control-Allow-Credentials": {"true"},
+		"Set-Cookie": {
+			"sessionid=abc; Path=/; Domain=example.com",
+			"theme=dark; Path=/; Secure; HttpOnly; SameSite=Lax",
+			"old=; Max-Age=0",
+		},
+	}
+	body := `<html><script src="http://cdn.example.net/app.js"></script><img src="http://img.example.net/a.png"></html>`
+	send("1", "https", "/account/home", page, body)
+	send("2", "https", "/account/home", page, body)
+
+	api := http.Header{"Content-Type": {"application/json"}}
+	send("3", "http", "/api/items", api, `{}`)
+
+	got := make(map[SecurityFindingKey]SecurityFinding)
+	for _, f := range a.Snapshot() {
+		got[f.Key] = f
+	}
+	host := "app.example.com"
+	want := map[SecurityFindingKey]string{
+		{host, CheckHSTSShort, ""}:                  SeverityLow,
+		{host, CheckCSPUnsafe, ""}:                  SeverityLow,
+		{host, CheckFrameOptionsMissing, ""}:        SeverityMedium,
+		{host, CheckReferrerPolicy, ""}:             SeverityLow,
+		{host, CheckCORSCredentials, "*"}:           SeverityHigh,
+		{host, CheckCookieNotSecure, "sessionid"}:   SeverityHigh,
+		{host, CheckCookieNotHTTPOnly, "sessionid"}: SeverityMedium,
+		{host, CheckCookieNoSameSite, "sessionid"}:  SeverityLow,
+		{host, CheckCookieBroadDomain, "sessionid"}: SeverityMedium,
+		{host, CheckCookieBroadPath, "sessionid"}:   SeverityLow,
+		{host, CheckCookieBroadPath, "theme"}:       SeverityLow,
+		{host, CheckMixedContent, "active"}:         SeverityHigh,
+		{host, CheckMixedContent, "passive"}:        SeverityLow,
+		{host, CheckNoSniffMissing, ""}:             SeverityLow,
+	}
+	for k, sev := range want {
+		f, ok := got[k]
+		if !ok {
+			t.Errorf("missing finding %+v", k)
+			continue
+		}
+		if f.Severity != sev {
+			t.Errorf("%+v severity = %s, want %s", k, f.Severity, sev)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d findings, want %d: %+v", len(got), len(want), got)
+	}
+
+	cors := got[SecurityFindingKey{host, CheckCORSCredentials, "*"}]
+	if cors.Count != 2 || cors.Routes["GET /account/home"] != 2 || len(cors.Samples) != 2 || cors.Samples[1] != "2" {
+		t.Fatalf("cors = %+v", cors)
+	}
+	if nosniff := got[SecurityFindingKey{host, CheckNoSniffMissing, ""}]; nosniff.Count != 1 || nosniff.Samples[0] != "3" {
+		t.Fatalf("nosniff = %+v", nosniff)
+	}
+	if snap := a.Snapshot(); snap[0].Severity != SeverityHigh || snap[len(snap)-1].Severity != SeverityLow {
+		t.Fatalf("snapshot not ordered by severity: %+v", snap)
+	}
+}
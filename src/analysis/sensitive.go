@@ -0,0 +1,458 @@
+package analysis
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+//
+// 23. Sensitive data (secrets and PII) in traffic
+//
+
+// Sensitive data categories.
+const (
+	SensitiveSecret = "secret"
+	SensitivePII    = "pii"
+)
+
+// Sensitive data kinds.
+const (
+	SensitiveAWSKey          = "aws_access_key"
+	SensitiveGitHubToken     = "github_token"
+	SensitiveSlackToken      = "slack_token"
+	SensitiveStripeKey       = "stripe_key"
+	SensitiveGoogleAPIKey    = "google_api_key"
+	SensitiveJWT             = "jwt"
+	SensitivePrivateKey      = "private_key"
+	SensitiveCredentialParam = "credential_parameter"
+	SensitiveEmail           = "email"
+	SensitiveCardNumber      = "card_number"
+	SensitiveUSSSN           = "us_ssn"
+	SensitiveUKNINO          = "uk_nino"
+)
+
+// Where a finding was seen in a capture.
+const (
+	LocationURL    = "url" // the path
+	LocationQuery  = "query"
+	LocationHeader = "header"
+	LocationBody   = "body"
+)
+
+// Route flags.
+const (
+	FlagSecretInURL      = "secret_in_url"
+	FlagSecretInResponse = "secret_in_response"
+	FlagPrivateKey       = "private_key"
+	FlagPIIToLogs        = "pii_sent_to_logs"
+)
+
+// SensitiveFinding is one secret or piece of PII found in a capture. The
+// matched value is never kept, only a masked form of it.
+type SensitiveFinding struct {
+	Kind     string `json:"kind"`
+	Category string `json:"category"`        // "secret" | "pii"
+	Where    string `json:"where"`           // "request" | "response"
+	Location string `json:"location"`        // "url" | "query" | "header" | "body"
+	Field    string `json:"field,omitempty"` // header or query parameter name
+	Masked   string `json:"masked"`
+}
+
+type sensitivePattern struct {
+	kind, category string
+	re             *regexp.Regexp
+	valid          func(string) bool // optional check on the match
+}
+
+var sensitivePatterns = []sensitivePattern{
+	{kind: SensitivePrivateKey, category: SensitiveSecret, re: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{kind: SensitiveAWSKey, category: SensitiveSecret, re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: SensitiveGitHubToken, category: SensitiveSecret, re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{60,255})\b`)},
+	{kind: SensitiveSlackToken, category: SensitiveSecret, re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{kind: SensitiveStripeKey, category: SensitiveSecret, re: regexp.MustCompile(`\b(?:sk|rk)_live_[A-Za-z0-9]{16,}\b`)},
+	{kind: SensitiveGoogleAPIKey, category: SensitiveSecret, re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{kind: SensitiveJWT, category: SensitiveSecret, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{16,}`)},
+	{kind: SensitiveEmail, category: SensitivePII, re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]{1,64}@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,24}\b`), valid: validEmail},
+	{kind: SensitiveCardNumber, category: SensitivePII, re: regexp.MustCompile(`\b[2-6]\d{3}(?:[ -]?\d){9,15}\b`), valid: validCardNumber},
+	{kind: SensitiveUSSSN, category: SensitivePII, re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), valid: validSSN},
+	{kind: SensitiveUKNINO, category: SensitivePII, re: regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`), valid: validNINO},
+}
+
+// credentialParam matches query parameter names that carry credentials.
+// Opaque values match no token pattern, so the name is what gives them away.
+var credentialParam = regexp.MustCompile(`(?i)^(?:access_?token|refresh_?token|id_?token|auth(?:_?token)?|token|api_?key|apikey|secret|client_?secret|password|passwd|pwd|session(?:_?id)?|sid|signature|sig)$`)
+
+// ScanSensitive reports the secrets and PII in data, seen at where/location
+// (and field, for a header or parameter). Matches are masked.
+func ScanSensitive(data []byte, where, location, field string) []SensitiveFinding {
+	if len(data) == 0 {
+		return nil
+	}
+	var out []SensitiveFinding
+	for _, p := range sensitivePatterns {
+		for _, m := range p.re.FindAll(data, -1) {
+			s := string(m)
+			if p.valid != nil && !p.valid(s) {
+				continue
+			}
+			out = append(out, SensitiveFinding{
+				Kind:     p.kind,
+				Category: p.category,
+				Where:    where,
+				Location: location,
+				Field:    field,
+				Masked:   MaskSensitive(p.kind, s),
+			})
+		}
+	}
+	return out
+}
+
+// CredentialParam reports whether a parameter named name holds a credential.
+func CredentialParam(name string) bool {
+	return credentialParam.MatchString(name)
+}
+
+// MaskSensitive hides all but enough of a match to recognise it again.
+func MaskSensitive(kind, s string) string {
+	switch kind {
+	case SensitivePrivateKey:
+		return s // the PEM header carries no secret
+	case SensitiveEmail:
+		local, domain, _ := strings.Cut(s, "@")
+		return local[:1] + "***@" + domain
+	case SensitiveCardNumber, SensitiveUSSSN, SensitiveUKNINO:
+		digits := 0
+		b := []byte(s)
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i] == ' ' || b[i] == '-' {
+				continue
+			}
+			if digits++; digits > 4 {
+				b[i] = '*'
+			}
+		}
+		return string(b)
+	case SensitiveJWT:
+		return s[:3] + "…" + s[len(s)-4:]
+	case SensitiveAWSKey, SensitiveGitHubToken, SensitiveSlackToken, SensitiveStripeKey, SensitiveGoogleAPIKey:
+		// Prefixes such as ghp_ or sk_live_ identify the issuer; the rest of
+		// a long token stays unguessable with ten characters shown.
+		if len(s) >= 20 {
+			return s[:6] + "…" + s[len(s)-4:]
+		}
+	}
+	// Passwords and other short or opaque secrets: show nothing, not even
+	// the length.
+	return maskedSecret
+}
+
+// maskedSecret replaces a secret that no part of may be shown.
+const maskedSecret = "********"
+
+func validEmail(s string) bool {
+	_, domain, _ := strings.Cut(s, "@")
+	domain = strings.ToLower(domain)
+	// Retina image names (logo@2x.png) and package specs look like emails.
+	for _, ext := range []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".js", ".css"} {
+		if strings.HasSuffix(domain, ext) {
+			return false
+		}
+	}
+	return true
+}
+
+// validCardNumber accepts 13-19 digits that pass the Luhn check and are not
+// a single repeated digit.
+func validCardNumber(s string) bool {
+	var digits []byte
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= '0' && c <= '9' {
+			digits = append(digits, c-'0')
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	same := true
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i])
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		same = same && digits[i] == digits[0]
+	}
+	return sum%10 == 0 && !same
+}
+
+// validSSN rejects area numbers 000, 666 and 9xx, group 00 and serial 0000,
+// which are never issued.
+func validSSN(s string) bool {
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+func validNINO(s string) bool {
+	switch strings.ToUpper(s[:2]) {
+	case "BG", "GB", "KN", "NK", "NT", "TN", "ZZ":
+		return false
+	}
+	return true
+}
+
+// maxSensitiveSamples is the number of example capture IDs kept per route.
+const maxSensitiveSamples = 5
+
+// logsPath matches endpoints that ship logs, telemetry or analytics.
+var logsPath = regexp.MustCompile(`(?i)(^|/)(logs?|logging|telemetry|analytics|events|collect|track|ingest|rum)(/|$)`)
+
+// SensitiveStats aggregates sensitive data findings for a route.
+type SensitiveStats struct {
+	Scanned     int64
+	WithFinding int64
+	ByKind      map[string]int64 // requests with at least one finding of the kind
+	ByLocation  map[string]int64 // "request/query", "response/body", ...
+	Flags       map[string]bool
+	FirstSeen   time.Time
+	LastFinding time.Time
+	LastSample  []SensitiveFinding
+	Samples     []string // capture IDs with findings, newest last
+}
+
+// SensitiveSnapshot is a read-only view for one route, or for a whole host
+// when Route.Method and Route.Path are empty.
+type SensitiveSnapshot struct {
+	Route       RouteKey
+	Scanned     int64
+	WithFinding int64
+	ByKind      map[string]int64
+	ByLocation  map[string]int64
+	Flags       []string
+	LastFinding time.Time
+	LastSample  []SensitiveFinding
+	Samples     []string
+}
+
+// SensitiveAnalyzer summarises the sensitive data found in captures per
+// route. Only scanned requests (ObservedRequest.SensitiveScanned) count.
+type SensitiveAnalyzer struct {
+	*boundedBase
+	byRoute *boundedMap[RouteKey, *SensitiveStats]
+}
+
+// NewSensitiveAnalyzer constructs an empty analyzer.
+func NewSensitiveAnalyzer() *SensitiveAnalyzer {
+	byRoute := newBoundedMap[RouteKey, *SensitiveStats](DefaultLimits)
+	return &SensitiveAnalyzer{
+		boundedBase: newBoundedBase("sensitive", byRoute),
+		byRoute:     byRoute,
+	}
+}
+
+// OnRequest ingests an ObservedRequest and updates the route's findings.
+func (a *SensitiveAnalyzer) OnRequest(ev *ObservedRequest) {
+	if ev == nil || !ev.SensitiveScanned {
+		return
+	}
+	now := ev.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, ok := a.byRoute.get(ev.Route, now)
+	if !ok {
+		st = &SensitiveStats{
+			ByKind:     make(map[string]int64),
+			ByLocation: make(map[string]int64),
+			Flags:      make(map[string]bool),
+			FirstSeen:  now,
+		}
+		a.byRoute.put(ev.Route, st, now)
+	}
+	st.Scanned++
+	if len(ev.SensitiveFindings) == 0 {
+		return
+	}
+	st.WithFinding++
+	seen := make(map[string]bool, len(ev.SensitiveFindings))
+	for _, f := range ev.SensitiveFindings {
+		// count each kind and location once per request
+		if !seen[f.Kind] {
+			seen[f.Kind] = true
+			st.ByKind[f.Kind]++
+		}
+		if loc := f.Where + "/" + f.Location; !seen[loc] {
+			seen[loc] = true
+			st.ByLocation[loc]++
+		}
+		switch {
+		case f.Kind == SensitivePrivateKey:
+			st.Flags[FlagPrivateKey] = true
+		case f.Category == SensitiveSecret && f.Where == "request" && (f.Location == LocationURL || f.Location == LocationQuery):
+			st.Flags[FlagSecretInURL] = true
+		case f.Category == SensitiveSecret && f.Where == "response":
+			st.Flags[FlagSecretInResponse] = true
+		case f.Category == SensitivePII && f.Where == "request" && logsPath.MatchString(ev.ConcretePath()):
+			st.Flags[FlagPIIToLogs] = true
+		}
+	}
+	st.LastFinding = now
+	st.LastSample = append([]SensitiveFinding(nil), ev.SensitiveFindings...)
+	if ev.ID != "" {
+		st.Samples = append(st.Samples, ev.ID)
+		if len(st.Samples) > maxSensitiveSamples {
+			st.Samples = st.Samples[len(st.Samples)-maxSensitiveSamples:]
+		}
+	}
+}
+
+func (a *SensitiveAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byRoute.rekey(rename, func(dst, src *SensitiveStats) {
+		dst.Scanned += src.Scanned
+		dst.WithFinding += src.WithFinding
+		mergeCounts(dst.ByKind, src.ByKind, 0)
+		mergeCounts(dst.ByLocation, src.ByLocation, 0)
+		for f := range src.Flags {
+			dst.Flags[f] = true
+		}
+		if src.FirstSeen.Before(dst.FirstSeen) {
+			dst.FirstSeen = src.FirstSeen
+		}
+		older, newer := src.Samples, dst.Samples
+		if src.LastFinding.After(dst.LastFinding) {
+			dst.LastFinding = src.LastFinding
+			dst.LastSample = src.LastSample
+			older, newer = dst.Samples, src.Samples
+		}
+		dst.Samples = append(append([]string(nil), older...), newer...)
+		if len(dst.Samples) > maxSensitiveSamples {
+			dst.Samples = dst.Samples[len(dst.Samples)-maxSensitiveSamples:]
+		}
+	})
+	a.mu.Unlock()
+}
+
+// Snapshot returns routes with at least minFindings requests carrying
+// sensitive data, most such requests first. Pass 0 to include every scanned
+// route.
+func (a *SensitiveAnalyzer) Snapshot(minFindings int64) []SensitiveSnapshot {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]SensitiveSnapshot, 0, a.byRoute.len())
+	a.byRoute.each(func(route RouteKey, st *SensitiveStats) bool {
+		if st.WithFinding < minFindings {
+			return true
+		}
+		snap := SensitiveSnapshot{
+			Route:       route,
+			Scanned:     st.Scanned,
+			WithFinding: st.WithFinding,
+			ByKind:      make(map[string]int64, len(st.ByKind)),
+			ByLocation:  make(map[string]int64, len(st.ByLocation)),
+			LastFinding: st.LastFinding,
+			LastSample:  append([]SensitiveFinding(nil), st.LastSample...),
+			Samples:     append([]string(nil), st.Samples...),
+		}
+		for k, n := range st.ByKind {
+			snap.ByKind[k] = n
+		}
+		for k, n := range st.ByLocation {
+			snap.ByLocation[k] = n
+		}
+		for f := range st.Flags {
+			snap.Flags = append(snap.Flags, f)
+		}
+		sort.Strings(snap.Flags)
+		out = append(out, snap)
+		return true
+	})
+	sortSensitive(out)
+	return out
+}
+
+// HostSnapshot folds Snapshot by host. LastSample and Samples come from the
+// host's most recent finding.
+func (a *SensitiveAnalyzer) HostSnapshot(minFindings int64) []SensitiveSnapshot {
+	byHost := make(map[string]*SensitiveSnapshot)
+	for _, s := range a.Snapshot(0) {
+		h, ok := byHost[s.Route.Host]
+		if !ok {
+			h = &SensitiveSnapshot{
+				Route:      RouteKey{Host: s.Route.Host},
+				ByKind:     make(map[string]int64),
+				ByLocation: make(map[string]int64),
+			}
+			byHost[s.Route.Host] = h
+		}
+		h.Scanned += s.Scanned
+		h.WithFinding += s.WithFinding
+		for k, n := range s.ByKind {
+			h.ByKind[k] += n
+		}
+		for k, n := range s.ByLocation {
+			h.ByLocation[k] += n
+		}
+		for _, f := range s.Flags {
+			if !slices.Contains(h.Flags, f) {
+				h.Flags = append(h.Flags, f)
+			}
+		}
+		if s.LastFinding.After(h.LastFinding) {
+			h.LastFinding, h.LastSample, h.Samples = s.LastFinding, s.LastSample, s.Samples
+		}
+	}
+	out := make([]SensitiveSnapshot, 0, len(byHost))
+	for _, h := range byHost {
+		if h.WithFinding < minFindings {
+			continue
+		}
+		sort.Strings(h.Flags)
+		out = append(out, *h)
+	}
+	sortSensitive(out)
+	return out
+}
+
+func sortSensitive(out []SensitiveSnapshot) {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].WithFinding != out[j].WithFinding {
+			return out[i].WithFinding > out[j].WithFinding
+		}
+		if out[i].Route.Host != out[j].Route.Host {
+			return out[i].Route.Host < out[j].Route.Host
+		}
+		if out[i].Route.Path != out[j].Route.Path {
+			return out[i].Route.Path < out[j].Route.Path
+		}
+		return out[i].Route.Method < out[j].Route.Method
+	})
+}
+
+// Sensitive returns the SensitiveAnalyzer registered in this registry, if any.
+func (r *Registry) Sensitive() *SensitiveAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, a := range r.analyzers {
+		if sa, ok := a.(*SensitiveAnalyzer); ok {
+			return sa
+		}
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package analysis
 
 import (
 	"math"
-	"sync"
 	"time"
 )
 
@@ -58,26 +57,30 @@ type RouteSizeSnapshot struct {
 	ReqStd   float64 `json:"req_std_bytes"`
 	ReqMin   int64   `json:"req_min_bytes"`
 	ReqMax   int64   `json:"req_max_bytes"`
+	ReqTotal int64   `json:"req_total_bytes"`
 
 	ResCount int64   `json:"res_count"`
 	ResMean  float64 `json:"res_mean_bytes"`
 	ResStd   float64 `json:"res_std_bytes"`
 	ResMin   int64   `json:"res_min_bytes"`
 	ResMax   int64   `json:"res_max_bytes"`
+	ResTotal int64   `json:"res_total_bytes"`
 
 	LastUpdated time.Time `json:"last_updated"`
 }
 
 // SizeAnalyzer maintains payload size statistics keyed by RouteKey.
 type SizeAnalyzer struct {
-	mu      sync.RWMutex
-	byRoute map[RouteKey]*PayloadProfile
+	*boundedBase
+	byRoute *boundedMap[RouteKey, *PayloadProfile]
 }
 
 // NewSizeAnalyzer constructs an empty SizeAnalyzer.
 func NewSizeAnalyzer() *SizeAnalyzer {
+	byRoute := newBoundedMap[RouteKey, *PayloadProfile](DefaultLimits)
 	return &SizeAnalyzer{
-		byRoute: make(map[RouteKey]*PayloadProfile),
+		boundedBase: newBoundedBase("size", byRoute),
+		byRoute:     byRoute,
 	}
 }
 
@@ -104,10 +107,10 @@ func (a *SizeAnalyzer) OnRequest(ev *ObservedRequest) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	profile, ok := a.byRoute[ev.Route]
+	profile, ok := a.byRoute.get(ev.Route, now)
 	if !ok {
 		profile = &PayloadProfile{}
-		a.byRoute[ev.Route] = profile
+		a.byRoute.put(ev.Route, profile, now)
 	}
 
 	if reqBytes > 0 || ev.Method != "" {
@@ -118,6 +121,34 @@ func (a *SizeAnalyzer) OnRequest(ev *ObservedRequest) {
 	}
 }
 
+// merge folds the samples of o into s.
+func (s *SizeStats) merge(o SizeStats) {
+	if o.Count == 0 {
+		return
+	}
+	if s.Count == 0 || o.MinBytes < s.MinBytes {
+		s.MinBytes = o.MinBytes
+	}
+	if o.MaxBytes > s.MaxBytes {
+		s.MaxBytes = o.MaxBytes
+	}
+	s.Count += o.Count
+	s.TotalBytes += o.TotalBytes
+	s.SquaredBytes += o.SquaredBytes
+	if o.LastUpdated.After(s.LastUpdated) {
+		s.LastUpdated = o.LastUpdated
+	}
+}
+
+func (a *SizeAnalyzer) mergeRoutes(rename func(RouteKey) RouteKey) {
+	a.mu.Lock()
+	a.byRoute.rekey(rename, func(dst, src *PayloadProfile) {
+		dst.Request.merge(src.Request)
+		dst.Response.merge(src.Response)
+	})
+	a.mu.Unlock()
+}
+
 // updateSizeStats mutates a SizeStats instance with a new sample.
 func updateSizeStats(s *SizeStats, size int64, now time.Time) {
 	if size < 0 {
@@ -155,15 +186,15 @@ func (a *SizeAnalyzer) Snapshot(minCount int64) []RouteSizeSnapshot {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	out := make([]RouteSizeSnapshot, 0, len(a.byRoute))
-	for route, profile := range a.byRoute {
+	out := make([]RouteSizeSnapshot, 0, a.byRoute.len())
+	a.byRoute.each(func(route RouteKey, profile *PayloadProfile) bool {
 		req := profile.Request
 		res := profile.Response
 
 		if minCount > 0 &&
 			req.Count < minCount &&
 			res.Count < minCount {
-			continue
+			return true
 		}
 
 		last := req.LastUpdated
@@ -179,16 +210,19 @@ func (a *SizeAnalyzer) Snapshot(minCount int64) []RouteSizeSnapshot {
 			ReqStd:   req.StdDev(),
 			ReqMin:   req.MinBytes,
 			ReqMax:   req.MaxBytes,
+			ReqTotal: req.TotalBytes,
 
 			ResCount: res.Count,
 			ResMean:  res.Mean(),
 			ResStd:   res.StdDev(),
 			ResMin:   res.MinBytes,
 			ResMax:   res.MaxBytes,
+			ResTotal: res.TotalBytes,
 
 			LastUpdated: last,
 		})
-	}
+		return true
+	})
 	return out
 }
 
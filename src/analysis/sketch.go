@@ -0,0 +1,164 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+//
+// Mergeable quantile sketch
+//
+
+// sketchGamma is the ratio between consecutive bucket boundaries. Reporting
+// the geometric midpoint of a bucket bounds the relative error of any
+// quantile by (gamma-1)/(gamma+1), i.e. about 1% here.
+const sketchGamma = 1.02
+
+var sketchLogGamma = math.Log(sketchGamma)
+
+// LatencySketch is a log-bucketed histogram (in the spirit of HDR histograms
+// and DDSketch). Memory grows with the dynamic range of the data, not the
+// number of samples, and two sketches merge exactly by adding bucket counts,
+// so per-route sketches can be combined per host or per time window.
+type LatencySketch struct {
+	buckets map[int]int64 // bucket index -> count, for values >= 1µs
+	zero    int64         // values below 1µs (including 0)
+	count   int64
+	min     time.Duration
+	max     time.Duration
+}
+
+// NewLatencySketch constructs an empty sketch.
+func NewLatencySketch() *LatencySketch {
+	return &LatencySketch{buckets: make(map[int]int64)}
+}
+
+// sketchUnit is the smallest resolved value; everything below is "zero".
+const sketchUnit = time.Microsecond
+
+func sketchIndex(d time.Duration) int {
+	return int(math.Floor(math.Log(float64(d)/float64(sketchUnit)) / sketchLogGamma))
+}
+
+// sketchValue returns the representative value of bucket i (geometric
+// midpoint of its bounds).
+func sketchValue(i int) time.Duration {
+	lo := math.Pow(sketchGamma, float64(i))
+	return time.Duration(lo * math.Sqrt(sketchGamma) * float64(sketchUnit))
+}
+
+// Add records one observation.
+func (s *LatencySketch) Add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	if s.count == 0 || d < s.min {
+		s.min = d
+	}
+	if d > s.max {
+		s.max = d
+	}
+	s.count++
+	if d < sketchUnit {
+		s.zero++
+		return
+	}
+	if s.buckets == nil {
+		s.buckets = make(map[int]int64)
+	}
+	s.buckets[sketchIndex(d)]++
+}
+
+// Merge folds o into s.
+func (s *LatencySketch) Merge(o *LatencySketch) {
+	if o == nil || o.count == 0 {
+		return
+	}
+	if s.count == 0 || o.min < s.min {
+		s.min = o.min
+	}
+	if o.max > s.max {
+		s.max = o.max
+	}
+	s.count += o.count
+	s.zero += o.zero
+	if s.buckets == nil {
+		s.buckets = make(map[int]int64, len(o.buckets))
+	}
+	for i, n := range o.buckets {
+		s.buckets[i] += n
+	}
+}
+
+// Count returns the number of observations.
+func (s *LatencySketch) Count() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.count
+}
+
+// Quantile returns the estimated q-quantile (0 <= q <= 1). Results are
+// clamped to the exact observed min and max.
+func (s *LatencySketch) Quantile(q float64) time.Duration {
+	return s.quantiles(q)[0]
+}
+
+// quantiles answers several (ascending) quantiles in one pass.
+func (s *LatencySketch) quantiles(qs ...float64) []time.Duration {
+	out := make([]time.Duration, len(qs))
+	if s == nil || s.count == 0 {
+		return out
+	}
+	idx := make([]int, 0, len(s.buckets))
+	for i := range s.buckets {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+
+	for k, q := range qs {
+		q = math.Max(0, math.Min(1, q))
+		// rank of the target observation (0-based)
+		rank := int64(math.Ceil(q*float64(s.count))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		var v time.Duration
+		switch {
+		case rank >= s.count-1:
+			out[k] = s.max
+			continue
+		case rank == 0:
+			out[k] = s.min
+			continue
+		}
+		if rank < s.zero {
+			v = 0
+		} else {
+			seen := s.zero
+			v = s.max
+			for _, i := range idx {
+				seen += s.buckets[i]
+				if seen > rank {
+					v = sketchValue(i)
+					break
+				}
+			}
+		}
+		if v < s.min {
+			v = s.min
+		}
+		if v > s.max {
+			v = s.max
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Estimate returns the standard set of quantiles.
+func (s *LatencySketch) Estimate() QuantileEstimate {
+	v := s.quantiles(0.50, 0.90, 0.95, 0.99, 0.999)
+	return QuantileEstimate{P50: v[0], P90: v[1], P95: v[2], P99: v[3], P999: v[4]}
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func within(got, want time.Duration, rel float64) bool {
+	return math.Abs(float64(got-want)) <= rel*float64(want)
+}
+
+func TestLatencySketchQuantiles(t *testing.T) {
+	s := NewLatencySketch()
+	for i := 1; i <= 10000; i++ {
+		s.Add(time.Duration(i) * time.Millisecond)
+	}
+	est := s.Estimate()
+	for _, c := range []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"p50", est.P50, 5000 * time.Millisecond},
+		{"p90", est.P90, 9000 * time.Millisecond},
+		{"p95", est.P95, 9500 * time.Millisecond},
+		{"p99", est.P99, 9900 * time.Millisecond},
+		{"p99.9", est.P999, 9990 * time.Millisecond},
+	} {
+		if !within(c.got, c.want, 0.02) {
+			t.Errorf("%s = %s, want ~%s", c.name, c.got, c.want)
+		}
+	}
+	if q := s.Quantile(1); q != 10*time.Second {
+		t.Errorf("max quantile = %s, want exact max", q)
+	}
+	if q := s.Quantile(0); q != time.Millisecond {
+		t.Errorf("min quantile = %s, want exact min", q)
+	}
+}
+
+func TestLatencySketchMergeMatchesCombined(t *testing.T) {
+	a, b, all := NewLatencySketch(), NewLatencySketch(), NewLatencySketch()
+	for i := 0; i < 1000; i++ {
+		fast := time.Duration(i%50) * time.Millisecond
+		slow := time.Second + time.Duration(i)*time.Millisecond
+		a.Add(fast)
+		b.Add(slow)
+		all.Add(fast)
+		all.Add(slow)
+	}
+	a.Merge(b)
+	if a.Count() != all.Count() || a.Estimate() != all.Estimate() {
+		t.Fatalf("merged %+v (n=%d) != combined %+v (n=%d)", a.Estimate(), a.Count(), all.Estimate(), all.Count())
+	}
+}
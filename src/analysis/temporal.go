@@ -29,6 +29,18 @@ type TemporalAnalyzer struct {
 	mu         sync.RWMutex
 	resolution time.Duration
 	buckets    []TimeBucket
+
+	// Per-series rollups at several resolutions (temporal_rollup.go).
+	tiers     []*rollupTier
+	maxSeries int
+	newest    time.Time
+
+	// Limits on the rollups: MaxEntries caps series per window alongside
+	// maxSeries, MaxAge drops windows older than it.
+	limits  Limits
+	pruned  time.Time // last MaxAge sweep
+	folded  int64     // series folded into "other"
+	expired int64     // rollup windows dropped by MaxAge
 }
 
 // NewTemporalAnalyzer constructs a TemporalAnalyzer with the specified
@@ -40,10 +52,12 @@ func NewTemporalAnalyzer(resolution time.Duration, bucketCount int) *TemporalAna
 	if resolution <= 0 {
 		resolution = time.Second
 	}
-	return &TemporalAnalyzer{
+	t := &TemporalAnalyzer{
 		resolution: resolution,
 		buckets:    make([]TimeBucket, bucketCount),
 	}
+	t.SetRollups(DefaultResolutions, DefaultMaxSeries)
+	return t
 }
 
 // Temporal returns the TemporalAnalyzer registered in this registry, if any.
@@ -109,6 +123,8 @@ func (t *TemporalAnalyzer) OnRequest(ev *ObservedRequest) {
 	// Use float64 representation of nanoseconds for variance.
 	ns := float64(lat)
 	b.SquaredLatency += ns * ns
+
+	t.addRollups(ev)
 }
 
 // indexFor computes the ring index for a quantized timestamp.
@@ -137,3 +153,64 @@ func (t *TemporalAnalyzer) Snapshot() []TimeBucket {
 	copy(out, t.buckets)
 	return out
 }
+
+// Name identifies the analyzer for /metrics/reset and /metrics/capacity.
+func (t *TemporalAnalyzer) Name() string { return "temporal" }
+
+// SetLimits applies limits to the rollups: MaxEntries caps the series per
+// window (the smaller of it and max_series wins), MaxAge drops older windows.
+// The ring of 1s buckets already has a fixed size and window.
+func (t *TemporalAnalyzer) SetLimits(lim Limits) {
+	t.mu.Lock()
+	t.limits = lim
+	t.pruneRollups()
+	t.mu.Unlock()
+}
+
+// Capacity counts the ring buckets in use plus the series buckets held by
+// the rollups.
+func (t *TemporalAnalyzer) Capacity() CapacityStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	used := 0
+	for i := range t.buckets {
+		if !t.buckets[i].WindowStart.IsZero() {
+			used++
+		}
+	}
+	max := len(t.buckets)
+	perWindow := t.seriesCap()
+	for _, tier := range t.tiers {
+		for i := range tier.slots {
+			used += len(tier.slots[i].series)
+		}
+		max += tier.res.Buckets * perWindow
+	}
+	if perWindow == 0 && len(t.tiers) > 0 {
+		max = 0 // unlimited
+	}
+	age := t.resolution * time.Duration(len(t.buckets))
+	if t.limits.MaxAge > 0 {
+		age = t.limits.MaxAge
+	}
+	return CapacityStats{
+		Analyzer:   t.Name(),
+		Entries:    used,
+		MaxEntries: max,
+		MaxAge:     age,
+		Evicted:    t.folded,
+		Expired:    t.expired,
+	}
+}
+
+// Reset clears every bucket, including the rollups.
+func (t *TemporalAnalyzer) Reset() {
+	t.mu.Lock()
+	clear(t.buckets)
+	for _, tier := range t.tiers {
+		clear(tier.slots)
+	}
+	t.newest, t.pruned = time.Time{}, time.Time{}
+	t.folded, t.expired = 0, 0
+	t.mu.Unlock()
+}
@@ -0,0 +1,421 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolution is one rollup tier: Buckets windows of Step each.
+type Resolution struct {
+	Step    time.Duration `json:"step_ns"`
+	Buckets int           `json:"buckets"`
+}
+
+// Span is how far back the tier reaches.
+func (r Resolution) Span() time.Duration { return r.Step * time.Duration(r.Buckets) }
+
+// DefaultResolutions keep 5 minutes at 1s, an hour at 10s, 6 hours at 1m,
+// 2 days at 10m and a week at 1h.
+var DefaultResolutions = []Resolution{
+	{Step: time.Second, Buckets: 300},
+	{Step: 10 * time.Second, Buckets: 360},
+	{Step: time.Minute, Buckets: 360},
+	{Step: 10 * time.Minute, Buckets: 288},
+	{Step: time.Hour, Buckets: 168},
+}
+
+// DefaultMaxSeries caps the distinct (host, route, class) series per
+// rollup window; the rest are folded into host "other".
+const DefaultMaxSeries = 500
+
+// ParseResolutions reads "1s:300,10s:360"; "" or "off" means no rollups.
+func ParseResolutions(s string) ([]Resolution, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" {
+		return nil, nil
+	}
+	var out []Resolution
+	for _, item := range strings.Split(s, ",") {
+		step, n, ok := strings.Cut(strings.TrimSpace(item), ":")
+		d, err := time.ParseDuration(step)
+		if !ok || err != nil || d <= 0 {
+			return nil, fmt.Errorf("rollup %q: want step:buckets, e.g. 10s:360", item)
+		}
+		count, err := strconv.Atoi(n)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("rollup %q: bucket count must be a positive integer", item)
+		}
+		out = append(out, Resolution{Step: d, Buckets: count})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Step < out[j].Step })
+	return out, nil
+}
+
+// FormatResolutions is the inverse of ParseResolutions.
+func FormatResolutions(rs []Resolution) string {
+	if len(rs) == 0 {
+		return "off"
+	}
+	parts := make([]string, len(rs))
+	for i, r := range rs {
+		parts[i] = r.Step.String() + ":" + strconv.Itoa(r.Buckets)
+	}
+	return strings.Join(parts, ",")
+}
+
+// OutcomeAny is the Class of a series that merges every outcome class.
+const OutcomeAny Outcome = 255
+
+// SeriesKey identifies one rollup series. Fields not in a query's group-by
+// are left empty (Class = OutcomeAny when classes are merged).
+type SeriesKey struct {
+	Host   string
+	Method string
+	Path   string
+	Class  Outcome
+}
+
+// SeriesBucket aggregates one series over one window.
+type SeriesBucket struct {
+	WindowStart    time.Time
+	Count          int64
+	Errors         int64 // 5xx and network errors
+	ReqBytes       int64
+	RespBytes      int64
+	TotalLatency   time.Duration
+	MinLatency     time.Duration
+	MaxLatency     time.Duration
+	SquaredLatency float64
+	Sketch         *LatencySketch
+}
+
+// MeanLatency returns the average latency in the bucket.
+func (b *SeriesBucket) MeanLatency() time.Duration {
+	if b.Count == 0 {
+		return 0
+	}
+	return time.Duration(int64(b.TotalLatency) / b.Count)
+}
+
+func (b *SeriesBucket) add(ev *ObservedRequest) {
+	lat := ev.Latency
+	if b.Count == 0 || lat < b.MinLatency {
+		b.MinLatency = lat
+	}
+	if lat > b.MaxLatency {
+		b.MaxLatency = lat
+	}
+	b.Count++
+	if ev.Outcome == Outcome5xx || ev.Outcome == OutcomeNetworkError {
+		b.Errors++
+	}
+	b.ReqBytes += ev.ReqBytes
+	b.RespBytes += ev.RespBytes
+	b.TotalLatency += lat
+	b.SquaredLatency += float64(lat) * float64(lat)
+	if b.Sketch == nil {
+		b.Sketch = NewLatencySketch()
+	}
+	b.Sketch.Add(lat)
+}
+
+func (b *SeriesBucket) merge(o *SeriesBucket) {
+	if o.Count == 0 {
+		return
+	}
+	if b.Count == 0 || o.MinLatency < b.MinLatency {
+		b.MinLatency = o.MinLatency
+	}
+	if o.MaxLatency > b.MaxLatency {
+		b.MaxLatency = o.MaxLatency
+	}
+	b.Count += o.Count
+	b.Errors += o.Errors
+	b.ReqBytes += o.ReqBytes
+	b.RespBytes += o.RespBytes
+	b.TotalLatency += o.TotalLatency
+	b.SquaredLatency += o.SquaredLatency
+	if b.Sketch == nil {
+		b.Sketch = NewLatencySketch()
+	}
+	b.Sketch.Merge(o.Sketch)
+}
+
+// rollupTier is a ring of windows, each holding per-series buckets.
+type rollupTier struct {
+	res   Resolution
+	slots []rollupSlot
+}
+
+type rollupSlot struct {
+	start  time.Time
+	series map[SeriesKey]*SeriesBucket
+}
+
+func newRollupTier(res Resolution) *rollupTier {
+	return &rollupTier{res: res, slots: make([]rollupSlot, res.Buckets)}
+}
+
+// add records ev under key and reports whether it was folded into the
+// overflow series.
+func (t *rollupTier) add(ev *ObservedRequest, key SeriesKey, maxSeries int) (folded bool) {
+	start := ev.Timestamp.UTC().Truncate(t.res.Step)
+	idx := start.UnixNano() / int64(t.res.Step) % int64(len(t.slots))
+	if idx < 0 {
+		idx += int64(len(t.slots))
+	}
+	s := &t.slots[idx]
+	switch {
+	case s.start.Equal(start) && s.series != nil:
+	case s.start.After(start):
+		return false // older than the ring reaches
+	default:
+		*s = rollupSlot{start: start, series: make(map[SeriesKey]*SeriesBucket)}
+	}
+	b := s.series[key]
+	if b == nil {
+		if maxSeries > 0 && len(s.series) >= maxSeries {
+			key = SeriesKey{Host: otherSeries, Class: key.Class}
+			b = s.series[key]
+			folded = true
+		}
+		if b == nil {
+			b = &SeriesBucket{WindowStart: start}
+			s.series[key] = b
+		}
+	}
+	b.add(ev)
+	return folded
+}
+
+// otherSeries is the host of the overflow series.
+const otherSeries = "other"
+
+// Group-by dimensions accepted by TemporalQuery.
+const (
+	GroupHost  = "host"
+	GroupRoute = "route" // host + method + path template
+	GroupClass = "class"
+)
+
+// TemporalQuery selects rollup series.
+type TemporalQuery struct {
+	Step     time.Duration // tier to read; 0 = finest tier reaching From
+	GroupBy  []string      // any of GroupHost, GroupRoute, GroupClass
+	From, To time.Time     // window starts outside [From, To] are skipped; zero = open
+	Keep     func(SeriesKey) bool
+}
+
+// Series is one grouped time series, oldest window first.
+type Series struct {
+	Key     SeriesKey
+	Buckets []SeriesBucket
+}
+
+// Resolutions returns the configured rollup tiers, finest first.
+func (t *TemporalAnalyzer) Resolutions() []Resolution {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]Resolution, len(t.tiers))
+	for i, tier := range t.tiers {
+		out[i] = tier.res
+	}
+	return out
+}
+
+// pickTier chooses the tier for q; the caller holds the lock.
+func (t *TemporalAnalyzer) pickTier(q TemporalQuery, now time.Time) (*rollupTier, error) {
+	if len(t.tiers) == 0 {
+		return nil, fmt.Errorf("temporal rollups are disabled")
+	}
+	if q.Step > 0 {
+		for _, tier := range t.tiers {
+			if tier.res.Step == q.Step {
+				return tier, nil
+			}
+		}
+		steps := make([]string, len(t.tiers))
+		for i, tier := range t.tiers {
+			steps[i] = tier.res.Step.String()
+		}
+		return nil, fmt.Errorf("no %s rollup (have %s)", q.Step, strings.Join(steps, ", "))
+	}
+	if q.From.IsZero() {
+		return t.tiers[0], nil
+	}
+	for _, tier := range t.tiers {
+		if !now.Add(-tier.res.Span()).After(q.From) {
+			return tier, nil
+		}
+	}
+	return t.tiers[len(t.tiers)-1], nil
+}
+
+// Rollup returns the series selected by q, grouped as requested, and the
+// step of the tier that was read.
+func (t *TemporalAnalyzer) Rollup(q TemporalQuery) ([]Series, time.Duration, error) {
+	if t == nil {
+		return nil, 0, fmt.Errorf("temporal analyzer not available")
+	}
+	var byHost, byRoute, byClass bool
+	for _, g := range q.GroupBy {
+		switch strings.TrimSpace(g) {
+		case GroupHost:
+			byHost = true
+		case GroupRoute:
+			byHost, byRoute = true, true
+		case GroupClass:
+			byClass = true
+		case "":
+		default:
+			return nil, 0, fmt.Errorf("unknown group_by %q (want host, route or class)", g)
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	now := t.newest
+	if now.IsZero() {
+		now = time.Now()
+	}
+	tier, err := t.pickTier(q, now)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	type point struct {
+		key   SeriesKey
+		start int64
+	}
+	merged := make(map[point]*SeriesBucket)
+	for i := range tier.slots {
+		s := &tier.slots[i]
+		if s.series == nil || s.start.IsZero() {
+			continue
+		}
+		if !q.From.IsZero() && s.start.Add(tier.res.Step).Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && s.start.After(q.To) {
+			continue
+		}
+		for key, b := range s.series {
+			if q.Keep != nil && !q.Keep(key) {
+				continue
+			}
+			g := SeriesKey{Class: OutcomeAny}
+			if byHost {
+				g.Host = key.Host
+			}
+			if byRoute {
+				g.Method, g.Path = key.Method, key.Path
+			}
+			if byClass {
+				g.Class = key.Class
+			}
+			p := point{g, s.start.UnixNano()}
+			m := merged[p]
+			if m == nil {
+				m = &SeriesBucket{WindowStart: s.start}
+				merged[p] = m
+			}
+			m.merge(b)
+		}
+	}
+
+	idx := make(map[SeriesKey]int)
+	var out []Series
+	for p, b := range merged {
+		i, ok := idx[p.key]
+		if !ok {
+			i = len(out)
+			idx[p.key] = i
+			out = append(out, Series{Key: p.key})
+		}
+		out[i].Buckets = append(out[i].Buckets, *b)
+	}
+	for i := range out {
+		sort.Slice(out[i].Buckets, func(a, b int) bool {
+			return out[i].Buckets[a].WindowStart.Before(out[i].Buckets[b].WindowStart)
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Key, out[j].Key
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		return a.Class < b.Class
+	})
+	return out, tier.res.Step, nil
+}
+
+// SetRollups replaces the rollup tiers (dropping their data). maxSeries caps
+// series per window; 0 = unlimited.
+func (t *TemporalAnalyzer) SetRollups(rs []Resolution, maxSeries int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tiers = t.tiers[:0]
+	for _, r := range rs {
+		if r.Step > 0 && r.Buckets > 0 {
+			t.tiers = append(t.tiers, newRollupTier(r))
+		}
+	}
+	sort.Slice(t.tiers, func(i, j int) bool { return t.tiers[i].res.Step < t.tiers[j].res.Step })
+	t.maxSeries = maxSeries
+}
+
+// addRollups records ev in every tier; the caller holds the write lock.
+func (t *TemporalAnalyzer) addRollups(ev *ObservedRequest) {
+	if ev.Timestamp.After(t.newest) {
+		t.newest = ev.Timestamp
+	}
+	key := SeriesKey{Host: ev.Route.Host, Method: ev.Route.Method, Path: ev.Route.Path, Class: ev.Outcome}
+	perWindow := t.seriesCap()
+	for _, tier := range t.tiers {
+		if tier.add(ev, key, perWindow) {
+			t.folded++
+		}
+	}
+	// Sweeping every slot is cheap but not free; once a second is enough.
+	if t.limits.MaxAge > 0 && t.newest.Sub(t.pruned) >= time.Second {
+		t.pruneRollups()
+	}
+}
+
+// seriesCap is the series limit per rollup window; 0 = unlimited. The
+// caller holds the lock.
+func (t *TemporalAnalyzer) seriesCap() int {
+	n := t.maxSeries
+	if m := t.limits.MaxEntries; m > 0 && (n == 0 || m < n) {
+		n = m
+	}
+	return n
+}
+
+// pruneRollups drops rollup windows that ended before the MaxAge window;
+// the caller holds the write lock.
+func (t *TemporalAnalyzer) pruneRollups() {
+	t.pruned = t.newest
+	if t.limits.MaxAge <= 0 {
+		return
+	}
+	cutoff := t.newest.Add(-t.limits.MaxAge)
+	for _, tier := range t.tiers {
+		for i := range tier.slots {
+			s := &tier.slots[i]
+			if s.series != nil && !s.start.Add(tier.res.Step).After(cutoff) {
+				*s = rollupSlot{}
+				t.expired++
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemporalRollupsSplitByHostAndClass(t *testing.T) {
+	a := NewTemporalAnalyzer(time.Second, 60)
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	add := func(offset time.Duration, host string, status int, lat time.Duration) {
+		a.OnRequest(&ObservedRequest{
+			Timestamp:  base.Add(offset),
+			Route:      RouteKey{Host: host, Method: "GET", Path: "/pay"},
+			StatusCode: status,
+			Outcome:    ClassifyOutcome(status),
+			Latency:    lat,
+			RespBytes:  100,
+		})
+	}
+	add(5*time.Second, "payments", 200, 10*time.Millisecond)
+	add(15*time.Second, "payments", 500, 30*time.Millisecond)
+	add(25*time.Second, "payments", 500, 50*time.Millisecond)
+	add(30*time.Second, "search", 200, time.Millisecond)
+
+	series, step, err := a.Rollup(TemporalQuery{Step: time.Minute, GroupBy: []string{GroupHost}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step != time.Minute || len(series) != 2 {
+		t.Fatalf("step=%s series=%d", step, len(series))
+	}
+	pay := series[0]
+	if pay.Key.Host != "payments" || pay.Key.Class != OutcomeAny || len(pay.Buckets) != 1 {
+		t.Fatalf("unexpected series %+v", pay)
+	}
+	b := pay.Buckets[0]
+	if b.Count != 3 || b.Errors != 2 || b.RespBytes != 300 || b.MaxLatency != 50*time.Millisecond {
+		t.Fatalf("unexpected bucket %+v", b)
+	}
+
+	// 10s windows, errors only, for one host.
+	series, _, err = a.Rollup(TemporalQuery{
+		Step:    10 * time.Second,
+		GroupBy: []string{GroupClass},
+		Keep:    func(k SeriesKey) bool { return k.Host == "payments" && k.Class == Outcome5xx },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Buckets) != 2 || series[0].Key.Class != Outcome5xx {
+		t.Fatalf("unexpected error series %+v", series)
+	}
+
+	// Auto resolution picks the finest tier that still reaches From.
+	_, step, _ = a.Rollup(TemporalQuery{From: base.Add(-12 * time.Hour)})
+	if step != 10*time.Minute {
+		t.Fatalf("auto resolution = %s, want 10m", step)
+	}
+
+	if _, _, err := a.Rollup(TemporalQuery{Step: 7 * time.Second}); err == nil {
+		t.Fatalf("expected unknown resolution error")
+	}
+}
+
+func TestTemporalRollupFoldsExcessSeries(t *testing.T) {
+	a := NewTemporalAnalyzer(time.Second, 10)
+	a.SetRollups([]Resolution{{Step: time.Minute, Buckets: 5}}, 2)
+	ts := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	for _, host := range []string{"a", "b", "c", "d"} {
+		a.OnRequest(&ObservedRequest{Timestamp: ts, Route: RouteKey{Host: host}, Outcome: Outcome2xx})
+	}
+	series, _, err := a.Rollup(TemporalQuery{GroupBy: []string{GroupHost}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := map[string]int64{}
+	for _, s := range series {
+		hosts[s.Key.Host] = s.Buckets[0].Count
+	}
+	if len(hosts) != 3 || hosts["other"] != 2 {
+		t.Fatalf("unexpected folding %v", hosts)
+	}
+}
+
+func TestTemporalRollupLimitsAndCapacity(t *testing.T) {
+	a := NewTemporalAnalyzer(time.Second, 10)
+	a.SetRollups([]Resolution{{Step: time.Minute, Buckets: 60}}, 0)
+	a.SetLimits(Limits{MaxEntries: 2, MaxAge: 5 * time.Minute})
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, host := range []string{"a", "b", "c"} {
+		a.OnRequest(&ObservedRequest{Timestamp: t0, Route: RouteKey{Host: host}, Outcome: Outcome2xx})
+	}
+	c := a.Capacity()
+	// One ring bucket, series a and b, and "c" folded into "other".
+	if c.Entries != 4 || c.Evicted != 1 || c.MaxEntries != 10+60*2 {
+		t.Fatalf("capacity = %+v", c)
+	}
+
+	a.OnRequest(&ObservedRequest{Timestamp: t0.Add(10 * time.Minute), Route: RouteKey{Host: "a"}, Outcome: Outcome2xx})
+	series, _, err := a.Rollup(TemporalQuery{GroupBy: []string{GroupHost}})
+	if err != nil || len(series) != 1 || len(series[0].Buckets) != 1 || a.Capacity().Expired != 1 {
+		t.Fatalf("window older than max_age kept: %+v %v", series, err)
+	}
+
+	a.Reset()
+	if c := a.Capacity(); c.Entries != 0 || c.Evicted != 0 || c.Expired != 0 {
+		t.Fatalf("after reset: %+v", c)
+	}
+}
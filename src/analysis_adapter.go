@@ -2,11 +2,14 @@ package main // analysis_adapter.go
 import (
 	"HTTPBreakoutBox/src/analysis"
 	"encoding/json"
+	"fmt"
 	"math"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,7 +22,25 @@ type routeLatencyDTO struct {
 	StdDevMs    float64   `json:"stddev_ms"`
 	MinMs       float64   `json:"min_ms"`
 	MaxMs       float64   `json:"max_ms"`
+	P50Ms       float64   `json:"p50_ms"`
+	P90Ms       float64   `json:"p90_ms"`
+	P95Ms       float64   `json:"p95_ms"`
+	P99Ms       float64   `json:"p99_ms"`
+	P999Ms      float64   `json:"p999_ms"`
 	LastUpdated time.Time `json:"last_updated"`
+
+	// Per-phase (dns, connect, tls, ttfb, read, conn_wait) percentiles; only phases
+	// that were observed for the route are present.
+	Phases map[string]phaseQuantilesDTO `json:"phases,omitempty"`
+}
+
+type phaseQuantilesDTO struct {
+	Count  int64   `json:"count"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
 }
 
 // handleRouteLatencyMetrics exposes per-route latency stats.
@@ -28,15 +49,16 @@ type routeLatencyDTO struct {
 //
 //	?min=<N>    -> minimum count per route (default 10)
 //	?limit=<K>  -> max number of routes to return (default 100)
+//	?sort=<f>   -> "mean" (default) or a percentile: p50, p90, p95, p99, p999
 //
-// Routes are sorted by descending MeanMs.
+// Routes are sorted by descending MeanMs (or the chosen percentile).
 func handleRouteLatencyMetrics(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	la := analysisRegistry.Latency()
+	la := reg.Latency()
 	if la == nil {
 		http.Error(w, "latency analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -79,22 +101,53 @@ func handleRouteLatencyMetrics(w http.ResponseWriter, r *http.Request) {
 			StdDevMs:    float64(s.StdDev) / 1e6,
 			MinMs:       float64(s.Min) / 1e6,
 			MaxMs:       float64(s.Max) / 1e6,
+			P50Ms:       float64(s.Quantiles.P50) / 1e6,
+			P90Ms:       float64(s.Quantiles.P90) / 1e6,
+			P95Ms:       float64(s.Quantiles.P95) / 1e6,
+			P99Ms:       float64(s.Quantiles.P99) / 1e6,
+			P999Ms:      float64(s.Quantiles.P999) / 1e6,
 			LastUpdated: s.LastUpdated,
 		}
+		if len(s.Phases) > 0 {
+			dto.Phases = make(map[string]phaseQuantilesDTO, len(s.Phases))
+			for name, qe := range s.Phases {
+				dto.Phases[name] = phaseQuantilesDTO{
+					Count:  s.PhaseN[name],
+					P50Ms:  float64(qe.P50) / 1e6,
+					P90Ms:  float64(qe.P90) / 1e6,
+					P95Ms:  float64(qe.P95) / 1e6,
+					P99Ms:  float64(qe.P99) / 1e6,
+					P999Ms: float64(qe.P999) / 1e6,
+				}
+			}
+		}
 		dtos = append(dtos, dto)
 	}
 
-	// Sort by descending mean latency
-	// (you can sort by MaxMs if you prefer tail behavior)
+	// Sort by descending mean latency, or by a tail percentile if asked.
+	key := func(d *routeLatencyDTO) float64 { return d.MeanMs }
+	switch q.Get("sort") {
+	case "p50":
+		key = func(d *routeLatencyDTO) float64 { return d.P50Ms }
+	case "p90":
+		key = func(d *routeLatencyDTO) float64 { return d.P90Ms }
+	case "p95":
+		key = func(d *routeLatencyDTO) float64 { return d.P95Ms }
+	case "p99":
+		key = func(d *routeLatencyDTO) float64 { return d.P99Ms }
+	case "p999":
+		key = func(d *routeLatencyDTO) float64 { return d.P999Ms }
+	}
 	sort.Slice(dtos, func(i, j int) bool {
+		ki, kj := key(&dtos[i]), key(&dtos[j])
 		// NaN guard
-		if math.IsNaN(dtos[i].MeanMs) {
+		if math.IsNaN(ki) {
 			return false
 		}
-		if math.IsNaN(dtos[j].MeanMs) {
+		if math.IsNaN(kj) {
 			return true
 		}
-		return dtos[i].MeanMs > dtos[j].MeanMs
+		return ki > kj
 	})
 
 	if len(dtos) > limit {
@@ -147,12 +200,12 @@ type RetryDTO struct {
 // Optional query param: ?min=<N> to require at least N requests in the burst.
 // Default is 2 (at least one retry).
 func handleRetryMetrics(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	ra := analysisRegistry.Retry()
+	ra := reg.Retry()
 	if ra == nil {
 		http.Error(w, "retry analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -201,14 +254,26 @@ type temporalBucketDTO struct {
 	MaxLatencyMs  float64   `json:"max_latency_ms"`
 }
 
-// handleTemporalMetrics exposes the temporal distribution as JSON.
+// GET /metrics/temporal -> the global ring of 1s buckets ([]temporalBucketDTO).
+// GET /metrics/temporal?resolution=<step|auto>&group_by=<host,route,class>&from=<t>&to=<t>&host=<h>&route=<path>&class=<2xx|...>
+// -> temporalRollupDTO: per-series rollups split by host, route and outcome class.
 func handleTemporalMetrics(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	// The rollup parameters select the rollups; from/to alone keep their
+	// meaning on every /metrics endpoint (replay the captures in range).
+	q := r.URL.Query()
+	for _, p := range []string{"resolution", "group_by", "host", "route", "class"} {
+		if q.Has(p) {
+			handleTemporalRollup(w, r)
+			return
+		}
+	}
+
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	ta := analysisRegistry.Temporal()
+	ta := reg.Temporal()
 	if ta == nil {
 		http.Error(w, "temporal analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -254,6 +319,158 @@ func handleTemporalMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type temporalPointDTO struct {
+	WindowStart   time.Time `json:"window_start"`
+	Count         int64     `json:"count"`
+	Errors        int64     `json:"errors"`
+	ErrorRate     float64   `json:"error_rate"`
+	ReqBytes      int64     `json:"req_bytes"`
+	RespBytes     int64     `json:"resp_bytes"`
+	MeanLatencyMs float64   `json:"mean_latency_ms"`
+	StdDevMs      float64   `json:"stddev_latency_ms"`
+	MinLatencyMs  float64   `json:"min_latency_ms"`
+	MaxLatencyMs  float64   `json:"max_latency_ms"`
+	P50Ms         float64   `json:"p50_ms"`
+	P95Ms         float64   `json:"p95_ms"`
+	P99Ms         float64   `json:"p99_ms"`
+}
+
+type temporalSeriesDTO struct {
+	Host   string             `json:"host,omitempty"`
+	Method string             `json:"method,omitempty"`
+	Path   string             `json:"path,omitempty"`
+	Class  string             `json:"class,omitempty"`
+	Points []temporalPointDTO `json:"points"`
+}
+
+type temporalRollupDTO struct {
+	Resolution  string              `json:"resolution"`
+	GroupBy     []string            `json:"group_by"`
+	From        *time.Time          `json:"from,omitempty"`
+	To          *time.Time          `json:"to,omitempty"`
+	Resolutions []string            `json:"resolutions"`
+	Series      []temporalSeriesDTO `json:"series"`
+}
+
+func temporalPoint(b analysis.SeriesBucket) temporalPointDTO {
+	mean := float64(b.TotalLatency) / float64(b.Count)
+	variance := b.SquaredLatency/float64(b.Count) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	est := b.Sketch.Estimate()
+	return temporalPointDTO{
+		WindowStart:   b.WindowStart,
+		Count:         b.Count,
+		Errors:        b.Errors,
+		ErrorRate:     float64(b.Errors) / float64(b.Count),
+		ReqBytes:      b.ReqBytes,
+		RespBytes:     b.RespBytes,
+		MeanLatencyMs: mean / 1e6,
+		StdDevMs:      math.Sqrt(variance) / 1e6,
+		MinLatencyMs:  float64(b.MinLatency) / 1e6,
+		MaxLatencyMs:  float64(b.MaxLatency) / 1e6,
+		P50Ms:         float64(est.P50) / 1e6,
+		P95Ms:         float64(est.P95) / 1e6,
+		P99Ms:         float64(est.P99) / 1e6,
+	}
+}
+
+func handleTemporalRollup(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistrySelect(w, r, false)
+	if reg == nil {
+		return
+	}
+	ta := reg.Temporal()
+	if ta == nil {
+		http.Error(w, "temporal analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	params := r.URL.Query()
+	var tq analysis.TemporalQuery
+	if res := params.Get("resolution"); res != "" && res != "auto" {
+		d, err := time.ParseDuration(res)
+		if err != nil {
+			http.Error(w, "resolution: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		tq.Step = d
+	}
+	now := time.Now()
+	var err error
+	if s := params.Get("from"); s != "" {
+		if tq.From, err = parseTimeBound(s, now); err != nil {
+			http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if s := params.Get("to"); s != "" {
+		if tq.To, err = parseTimeBound(s, now); err != nil {
+			http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, g := range strings.Split(params.Get("group_by"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			tq.GroupBy = append(tq.GroupBy, g)
+		}
+	}
+	host, route, class := params.Get("host"), params.Get("route"), params.Get("class")
+	if host != "" || route != "" || class != "" {
+		tq.Keep = func(k analysis.SeriesKey) bool {
+			return (host == "" || strings.EqualFold(k.Host, host)) &&
+				(route == "" || k.Path == route) &&
+				(class == "" || string(mapOutcome(k.Class)) == class)
+		}
+	}
+
+	series, step, err := ta.Rollup(tq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := temporalRollupDTO{
+		Resolution: step.String(),
+		GroupBy:    tq.GroupBy,
+		Series:     make([]temporalSeriesDTO, 0, len(series)),
+	}
+	if out.GroupBy == nil {
+		out.GroupBy = []string{}
+	}
+	if !tq.From.IsZero() {
+		out.From = &tq.From
+	}
+	if !tq.To.IsZero() {
+		out.To = &tq.To
+	}
+	for _, res := range ta.Resolutions() {
+		out.Resolutions = append(out.Resolutions, res.Step.String())
+	}
+	for _, s := range series {
+		dto := temporalSeriesDTO{
+			Host:   s.Key.Host,
+			Method: s.Key.Method,
+			Path:   s.Key.Path,
+			Points: make([]temporalPointDTO, 0, len(s.Buckets)),
+		}
+		if s.Key.Class != analysis.OutcomeAny {
+			dto.Class = string(mapOutcome(s.Key.Class))
+		}
+		for _, b := range s.Buckets {
+			dto.Points = append(dto.Points, temporalPoint(b))
+		}
+		out.Series = append(out.Series, dto)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // toHTTPHeader converts a map[string][]string to http.Header.
 func toHTTPHeader(m map[string][]string) http.Header {
 	if m == nil {
@@ -311,9 +528,21 @@ func observedFromCapture(c Capture) *analysis.ObservedRequest {
 		ClientHint: c.XForwardedFor,
 	}
 
+	// Captures persisted before dissection existed are dissected on replay.
+	rpc := c.RPC
+	if rpc == nil {
+		rpc = dissectCapture(&c)
+	}
+
+	// Captures persisted before templating existed are templated on replay.
+	tmpl := c.RouteTemplate
+	if tmpl == "" {
+		tmpl = routeTemplate(u.Host, u.Path)
+	}
+
 	route := analysis.RouteKey{
 		Host:   u.Host,
-		Path:   u.Path,
+		Path:   rpcRoutePath(tmpl, rpc),
 		Method: c.Method,
 	}
 
@@ -335,7 +564,7 @@ func observedFromCapture(c Capture) *analysis.ObservedRequest {
 
 		Latency:    latency,
 		StatusCode: c.ResponseStatus,
-		Outcome:    analysis.ClassifyOutcome(c.ResponseStatus),
+		Outcome:    rpcOutcome(analysis.ClassifyOutcome(c.ResponseStatus), rpc),
 
 		Method: c.Method,
 		Proto:  c.Proto,
@@ -352,13 +581,53 @@ func observedFromCapture(c Capture) *analysis.ObservedRequest {
 
 		TLS:        tlsSig,
 		ServerAddr: c.ServerAddr,
+		ReusedConn: c.ReusedConn,
+		HTTP2:      c.HTTP2,
 
 		IsGRPC: c.IsGRPC,
+
+		Phases: capturePhases(c),
+
+		ReqBody:           []byte(c.RequestBodyBase64),
+		RespBody:          []byte(c.ResponseBodyBase64),
+		ReqBodyTruncated:  c.ReqBodyTruncated,
+		RespBodyTruncated: c.RespBodyTruncated,
+
+		ContractChecked:    c.ContractChecked,
+		ContractViolations: c.ContractViolations,
+
+		SensitiveScanned:  c.SensitiveScanned,
+		SensitiveFindings: c.SensitiveFindings,
 	}
 
 	return ev
 }
 
+// capturePhases converts a capture's phase timings for the analyzers.
+func capturePhases(c Capture) analysis.PhaseTimings {
+	ms := func(v int64) time.Duration { return time.Duration(v) * time.Millisecond }
+	return analysis.PhaseTimings{
+		DNS:     ms(c.DNSMs),
+		Connect: ms(c.ConnectMs),
+		TLS:     ms(c.TLSMs),
+		TTFB:    ms(c.TTFBMs),
+		Read:    ms(c.RespReadMs),
+
+		ConnWait: ms(c.ConnWaitMs),
+	}
+}
+
+// relearnRouteTemplates feeds the concrete paths of loaded captures to the
+// route templater, so positions promoted in an earlier run are promoted
+// again before the captures' stored templates are replayed.
+func relearnRouteTemplates(captures []Capture) {
+	for _, c := range captures {
+		if u, err := url.Parse(c.URL); err == nil && u.Host != "" {
+			routeTemplate(u.Host, u.Path)
+		}
+	}
+}
+
 // RebuildAnalysisFromCaptures replays historical captures through the analyzers.
 func RebuildAnalysisFromCaptures(reg *analysis.Registry, captures []Capture) {
 	if reg == nil {
@@ -373,6 +642,85 @@ func RebuildAnalysisFromCaptures(reg *analysis.Registry, captures []Capture) {
 	}
 }
 
+// Stored captures and color rules that ad-hoc analysis replays from.
+var (
+	analysisStore *captureStore
+	analysisRules *ruleStore
+
+	// analysisConfig is the analyzer selection the live registry was built
+	// from; ad-hoc registries use it too.
+	analysisConfig analysis.RegistryConfig
+)
+
+// SetAnalysisSource wires the capture store (and color rules, for color:
+// terms) used by ad-hoc /metrics queries.
+func SetAnalysisSource(store *captureStore, rules *ruleStore) {
+	analysisStore, analysisRules = store, rules
+}
+
+// analysisRegistryFor returns the registry a /metrics/* request reads. With
+// no q/from/to parameters that is the live registry; otherwise a throwaway
+// registry is built by replaying only the stored captures that match the
+// filter query (same syntax as the UI search bar) within [from, to]. On
+// failure the error has been written and nil is returned.
+func analysisRegistryFor(w http.ResponseWriter, r *http.Request) *analysis.Registry {
+	return analysisRegistrySelect(w, r, true)
+}
+
+// analysisRegistrySelect is analysisRegistryFor for handlers that apply
+// from/to themselves (temporal rollups reach further back than the capture
+// store); with timeRange false only q triggers a replay.
+func analysisRegistrySelect(w http.ResponseWriter, r *http.Request, timeRange bool) *analysis.Registry {
+	q := r.URL.Query()
+	query, from, to := strings.TrimSpace(q.Get("q")), q.Get("from"), q.Get("to")
+	if !timeRange {
+		from, to = "", ""
+	}
+	if query == "" && from == "" && to == "" {
+		if analysisRegistry == nil {
+			http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+			return nil
+		}
+		return analysisRegistry
+	}
+	if analysisStore == nil {
+		http.Error(w, "capture store not available for ad-hoc analysis", http.StatusServiceUnavailable)
+		return nil
+	}
+
+	var sel captureSelection
+	now := time.Now()
+	var err error
+	if from != "" {
+		if sel.from, err = parseTimeBound(from, now); err != nil {
+			http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+			return nil
+		}
+	}
+	if to != "" {
+		if sel.to, err = parseTimeBound(to, now); err != nil {
+			http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+			return nil
+		}
+	}
+	if query != "" {
+		var rules []ColorRule
+		if analysisRules != nil {
+			rules = analysisRules.getAll()
+		}
+		sel.filter = compileCaptureFilter(query, rules)
+	}
+
+	reg, err := analysis.NewRegistryFromConfig(analysisConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	reg.UseTemplater(routeTemplater)
+	RebuildAnalysisFromCaptures(reg, sel.apply(analysisStore.list()))
+	return reg
+}
+
 type clientErrorDTO struct {
 	ClientIP          string       `json:"client_ip"`
 	UserAgent         string       `json:"user_agent"`
@@ -391,12 +739,12 @@ type clientErrorDTO struct {
 //	?min=<N>    -> minimum streak length (applied to 5xx, 4xx, or errors). Default: 3
 //	?limit=<K>  -> maximum number of clients to return. Default: 100
 func handleClientErrorMetrics(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	eta := analysisRegistry.ErrorTransitions()
+	eta := reg.ErrorTransitions()
 	if eta == nil {
 		http.Error(w, "error transition analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -492,12 +840,12 @@ type routeSizeDTO struct {
 //
 // Sorted by descending max(request mean, response mean).
 func handleRouteSizeMetrics(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	sa := analysisRegistry.Size()
+	sa := reg.Size()
 	if sa == nil {
 		http.Error(w, "size analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -593,12 +941,12 @@ type methodPathDTO struct {
 //	             (anomalous ones are always included). Default: 0
 //	?limit=<K> -> max number of endpoints to return. Default: 100
 func handleMethodPathAnomalies(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	mp := analysisRegistry.MethodPath()
+	mp := reg.MethodPath()
 	if mp == nil {
 		http.Error(w, "method-path analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -716,12 +1064,12 @@ type clientFingerprintDTO struct {
 //	?min_changes=<N> -> minimum UA+TLS change count (default 1)
 //	?limit=<K>       -> max number of clients (default 100)
 func handleClientFingerprintMetrics(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	cfa := analysisRegistry.ClientFingerprint()
+	cfa := reg.ClientFingerprint()
 	if cfa == nil {
 		http.Error(w, "client fingerprint analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -822,12 +1170,12 @@ type authCookieDTO struct {
 //	?min_changes=<N>   -> minimum (auth+cookie) change count (default: 1)
 //	?limit=<K>         -> max number of rows (default: 100)
 func handleAuthCookieStability(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	ac := analysisRegistry.AuthCookie()
+	ac := reg.AuthCookie()
 	if ac == nil {
 		http.Error(w, "auth/cookie analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -936,12 +1284,12 @@ type responseProfileDTO struct {
 //	?min_changes=<N> -> minimum "interesting" changes (CT drift or entropy mix) (default: 1)
 //	?limit=<K>       -> max number of routes (default: 100)
 func handleResponseProfileMetrics(w http.ResponseWriter, r *http.Request) {
-	if analysisRegistry == nil {
-		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
 		return
 	}
 
-	rp := analysisRegistry.ResponseProfile()
+	rp := reg.ResponseProfile()
 	if rp == nil {
 		http.Error(w, "response profile analyzer not available", http.StatusServiceUnavailable)
 		return
@@ -1027,3 +1375,1328 @@ func handleResponseProfileMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+type contractRouteDTO struct {
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+
+	Checked       int64            `json:"checked"`
+	Violating     int64            `json:"violating"`
+	ViolationRate float64          `json:"violation_rate"`
+	ByKind        map[string]int64 `json:"by_kind"`
+
+	LastViolation time.Time                    `json:"last_violation,omitempty"`
+	LastSample    []analysis.ContractViolation `json:"last_sample,omitempty"`
+}
+
+// GET /metrics/contract/routes
+//
+// Query params (optional):
+//
+//	?min=<N>   -> minimum violating requests per route (default: 1; 0 = all checked routes)
+//	?limit=<K> -> max number of routes (default: 100)
+func handleContractMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	ca := reg.Contract()
+	if ca == nil {
+		http.Error(w, "contract analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+
+	minViolations := int64(1)
+	if s := q.Get("min"); s != "" {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v >= 0 {
+			minViolations = v
+		}
+	}
+
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+
+	snap := ca.Snapshot(minViolations)
+
+	dtos := make([]contractRouteDTO, 0, len(snap))
+	for _, s := range snap {
+		dtos = append(dtos, contractRouteDTO{
+			Method: s.Route.Method,
+			Host:   s.Route.Host,
+			Path:   s.Route.Path,
+
+			Checked:       s.Checked,
+			Violating:     s.Violating,
+			ViolationRate: s.ViolationRate,
+			ByKind:        s.ByKind,
+
+			LastViolation: s.LastViolation,
+			LastSample:    s.LastSample,
+		})
+	}
+
+	// Worst offenders first.
+	sort.Slice(dtos, func(i, j int) bool {
+		if dtos[i].Violating != dtos[j].Violating {
+			return dtos[i].Violating > dtos[j].Violating
+		}
+		return dtos[i].ViolationRate > dtos[j].ViolationRate
+	})
+
+	if len(dtos) > limit {
+		dtos = dtos[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dtos); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type schemaFieldDTO struct {
+	Path          string           `json:"path"`
+	Types         map[string]int64 `json:"types"`
+	Nullable      bool             `json:"nullable"`
+	PresenceRatio float64          `json:"presence_ratio"`
+	MinItems      *int             `json:"min_items,omitempty"`
+	MaxItems      *int             `json:"max_items,omitempty"`
+}
+
+type routeSchemaDTO struct {
+	Method    string `json:"method"`
+	Host      string `json:"host"`
+	Path      string `json:"path"`
+	Direction string `json:"direction"`
+
+	Samples   int64     `json:"samples"`
+	Drifts    int64     `json:"drifts"`
+	LastDrift time.Time `json:"last_drift,omitempty"`
+
+	Fields []schemaFieldDTO `json:"fields"`
+}
+
+// GET /metrics/schema/routes
+//
+// Query params (optional):
+//
+//	?min=<N>              -> minimum JSON bodies per route and direction (default: 1)
+//	?direction=<req|resp> -> only request or response bodies
+//	?drifting=1           -> only routes that have drifted
+//	?limit=<K>            -> max number of routes (default: 100)
+func handleSchemaMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	sd := reg.SchemaDrift()
+	if sd == nil {
+		http.Error(w, "schema analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+
+	minSamples := int64(1)
+	if s := q.Get("min"); s != "" {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v >= 0 {
+			minSamples = v
+		}
+	}
+
+	var direction string
+	switch strings.ToLower(q.Get("direction")) {
+	case "req", "request":
+		direction = analysis.DirectionRequest
+	case "resp", "response":
+		direction = analysis.DirectionResponse
+	}
+	drifting := q.Get("drifting") == "1" || q.Get("drifting") == "true"
+
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+
+	snap := sd.Snapshot(minSamples)
+
+	dtos := make([]routeSchemaDTO, 0, len(snap))
+	for _, s := range snap {
+		if direction != "" && s.Direction != direction {
+			continue
+		}
+		if drifting && s.Drifts == 0 {
+			continue
+		}
+		dto := routeSchemaDTO{
+			Method:    s.Route.Method,
+			Host:      s.Route.Host,
+			Path:      s.Route.Path,
+			Direction: s.Direction,
+
+			Samples:   s.Samples,
+			Drifts:    s.Drifts,
+			LastDrift: s.LastDrift,
+
+			Fields: make([]schemaFieldDTO, 0, len(s.Fields)),
+		}
+		for _, f := range s.Fields {
+			dto.Fields = append(dto.Fields, schemaFieldDTO{
+				Path:          f.Path,
+				Types:         f.Types,
+				Nullable:      f.Nullable,
+				PresenceRatio: f.PresenceRatio,
+				MinItems:      f.MinItems,
+				MaxItems:      f.MaxItems,
+			})
+		}
+		dtos = append(dtos, dto)
+	}
+
+	// Most recently drifting first, then busiest.
+	sort.Slice(dtos, func(i, j int) bool {
+		if !dtos[i].LastDrift.Equal(dtos[j].LastDrift) {
+			return dtos[i].LastDrift.After(dtos[j].LastDrift)
+		}
+		return dtos[i].Samples > dtos[j].Samples
+	})
+
+	if len(dtos) > limit {
+		dtos = dtos[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dtos); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /metrics/schema/drift?limit=<K> -> latest field-level drift events, newest first (default: 50)
+func handleSchemaDriftEvents(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	sd := reg.SchemaDrift()
+	if sd == nil {
+		http.Error(w, "schema analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 50
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sd.Recent(limit)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /metrics/capacity -> per-analyzer entries, caps and eviction counts
+func handleAnalysisCapacity(w http.ResponseWriter, r *http.Request) {
+	if analysisRegistry == nil {
+		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	out := analysisRegistry.Capacity()
+	if out == nil {
+		out = []analysis.CapacityStats{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /metrics/reset[?analyzer=<name>] -> clears one analyzer, or all of them
+func handleAnalysisReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method", http.StatusMethodNotAllowed)
+		return
+	}
+	if analysisRegistry == nil {
+		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	name := strings.TrimSpace(r.URL.Query().Get("analyzer"))
+	if !analysisRegistry.Reset(name) {
+		http.Error(w, fmt.Sprintf("unknown analyzer %q (have: %s)", name, strings.Join(analysisRegistry.Analyzers(), ", ")), http.StatusNotFound)
+		return
+	}
+	if name == "" {
+		// Every counter restarts, so routes can compete for slots again.
+		exportedRoutes.reset()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /metrics/pipeline -> analysis queue depth, drop and late counters
+func handlePipelineMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(analysisPipeline.Stats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// analyzerEndpoints maps analyzer names to the JSON endpoints that read them.
+var analyzerEndpoints = map[string][]string{
+	"temporal":          {"/metrics/temporal"},
+	"retry":             {"/metrics/retries"},
+	"latency":           {"/metrics/latency/routes"},
+	"errortransitions":  {"/metrics/errors/clients"},
+	"size":              {"/metrics/size/routes"},
+	"methodpath":        {"/metrics/methods/anomalies"},
+	"clientfingerprint": {"/metrics/clients/fingerprints"},
+	"authcookie":        {"/metrics/authcookie/stability"},
+	"responseprofile":   {"/metrics/response/profile"},
+	"contract":          {"/metrics/contract/routes"},
+	"coverage":          {"/api/coverage", "/api/coverage.html"},
+	"schema":            {"/metrics/schema/routes", "/metrics/schema/drift"},
+	"anomaly":           {"/metrics/anomalies"},
+	"hosts":             {"/metrics/hosts"},
+	"concurrency":       {"/metrics/concurrency", "/metrics/concurrency/timeline"},
+	"retrysemantics":    {"/metrics/retries/semantics"},
+	"ratelimit":         {"/metrics/ratelimits"},
+	"caching":           {"/metrics/caching/routes"},
+	"security":          {"/metrics/security/headers"},
+	"sensitive":         {"/metrics/sensitive"},
+}
+
+type analyzerIndexDTO struct {
+	analysis.AnalyzerInfo
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+type metricsIndexDTO struct {
+	Analyzers []analyzerIndexDTO      `json:"analyzers"`
+	Limits    analysis.Limits         `json:"limits"`
+	Pipeline  *analysis.PipelineStats `json:"pipeline,omitempty"`
+	OTLP      *otlpStats              `json:"otlp,omitempty"`
+	Endpoints map[string]string       `json:"endpoints"`
+}
+
+// wantsMetricsIndex reports whether a GET /metrics asks for the JSON index
+// rather than the Prometheus exposition.
+func wantsMetricsIndex(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/plain") &&
+		!strings.Contains(accept, "openmetrics")
+}
+
+// GET /metrics?format=json (or Accept: application/json) -> analyzers, their
+// settings and endpoints
+func handleMetricsIndex(w http.ResponseWriter, r *http.Request) {
+	if analysisRegistry == nil {
+		http.Error(w, "analysis registry not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	out := metricsIndexDTO{
+		Limits: analysis.DefaultLimits,
+		Endpoints: map[string]string{
+			"/metrics":          "Prometheus exposition (this index with ?format=json)",
+			"/metrics/capacity": "per-analyzer entries, caps and evictions",
+			"/metrics/reset":    "POST ?analyzer=<name> to clear one analyzer, or all",
+			"/metrics/pipeline": "analysis queue depth and drops",
+		},
+	}
+	if analysisConfig.Limits != nil {
+		out.Limits = *analysisConfig.Limits
+	}
+	if analysisPipeline != nil {
+		st := analysisPipeline.Stats()
+		out.Pipeline = &st
+	}
+	if spanExporter != nil {
+		st := spanExporter.Stats()
+		out.OTLP = &st
+	}
+	for _, info := range analysisRegistry.Info() {
+		d := analyzerIndexDTO{AnalyzerInfo: info}
+		if info.Enabled {
+			d.Endpoints = analyzerEndpoints[info.Name]
+		}
+		out.Analyzers = append(out.Analyzers, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /metrics/anomalies?active=1&metric=<rate|error_rate|p95_ms>&scope=<host|route>&host=<h>&limit=<K>
+// -> detected anomalies, newest first (default limit: 50)
+func handleAnomalyMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	an := reg.Anomalies()
+	if an == nil {
+		http.Error(w, "anomaly analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := 50
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	f := analysis.AnomalyFilter{
+		ActiveOnly: q.Get("active") == "1" || q.Get("active") == "true",
+		Metric:     q.Get("metric"),
+		Scope:      q.Get("scope"),
+		Host:       q.Get("host"),
+	}
+	out := an.Recent(f, limit)
+	if out == nil {
+		out = []analysis.Anomaly{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type hostHealthDTO struct {
+	Host            string                       `json:"host"`
+	Requests        int64                        `json:"requests"`
+	Connections     int64                        `json:"connections"`
+	NewConnections  int64                        `json:"new_connections"`
+	Reused          int64                        `json:"reused"`
+	ReuseRatio      float64                      `json:"reuse_ratio"`
+	NewConnsPerMin  float64                      `json:"new_conns_per_min"`
+	NewConnsLastMin int64                        `json:"new_conns_last_min"`
+	HTTP2Share      float64                      `json:"http2_share"`
+	Phases          map[string]phaseQuantilesDTO `json:"phases,omitempty"`
+	IPs             []analysis.HostIP            `json:"ips"`
+	IPChanges       int64                        `json:"ip_changes"`
+	NewIPs          int64                        `json:"new_ips"`
+	LastIPChange    *time.Time                   `json:"last_ip_change,omitempty"`
+	Flags           []string                     `json:"flags"`
+	FirstSeen       time.Time                    `json:"first_seen"`
+	LastSeen        time.Time                    `json:"last_seen"`
+}
+
+// GET /metrics/hosts?min=<N>&flagged=1&sort=<host|requests|reuse|tls|connect|dns>&limit=<K>
+// -> per-host connection reuse, handshake/TTFB/read percentiles, upstream
+// addresses and health flags (defaults: min 1, sort by host, limit 100)
+func handleHostHealthMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	ha := reg.HostHealth()
+	if ha == nil {
+		http.Error(w, "hosts analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	minCount := int64(1)
+	if s := q.Get("min"); s != "" {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v > 0 {
+			minCount = v
+		}
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	flagged := q.Get("flagged") == "1" || q.Get("flagged") == "true"
+
+	out := make([]hostHealthDTO, 0)
+	for _, s := range ha.Snapshot(minCount) {
+		if flagged && len(s.Flags) == 0 {
+			continue
+		}
+		dto := hostHealthDTO{
+			Host:            s.Host,
+			Requests:        s.Requests,
+			Connections:     s.Conns,
+			NewConnections:  s.NewConns,
+			Reused:          s.Reused,
+			ReuseRatio:      s.ReuseRatio,
+			NewConnsPerMin:  s.NewConnsPerMin,
+			NewConnsLastMin: s.NewConnsLastMin,
+			HTTP2Share:      s.HTTP2Share,
+			IPs:             s.IPs,
+			IPChanges:       s.IPChanges,
+			NewIPs:          s.NewIPs,
+			Flags:           s.Flags,
+			FirstSeen:       s.FirstSeen,
+			LastSeen:        s.LastSeen,
+		}
+		if dto.IPs == nil {
+			dto.IPs = []analysis.HostIP{}
+		}
+		if dto.Flags == nil {
+			dto.Flags = []string{}
+		}
+		if !s.LastIPChange.IsZero() {
+			t := s.LastIPChange
+			dto.LastIPChange = &t
+		}
+		if len(s.Phases) > 0 {
+			dto.Phases = make(map[string]phaseQuantilesDTO, len(s.Phases))
+			for name, qe := range s.Phases {
+				dto.Phases[name] = phaseQuantilesDTO{
+					Count:  s.PhaseN[name],
+					P50Ms:  float64(qe.P50) / 1e6,
+					P90Ms:  float64(qe.P90) / 1e6,
+					P95Ms:  float64(qe.P95) / 1e6,
+					P99Ms:  float64(qe.P99) / 1e6,
+					P999Ms: float64(qe.P999) / 1e6,
+				}
+			}
+		}
+		out = append(out, dto)
+	}
+
+	// Worst first for everything but the default alphabetical order.
+	phase := func(name string) func(d *hostHealthDTO) float64 {
+		return func(d *hostHealthDTO) float64 { return d.Phases[name].P95Ms }
+	}
+	var key func(d *hostHealthDTO) float64
+	switch q.Get("sort") {
+	case "requests":
+		key = func(d *hostHealthDTO) float64 { return float64(d.Requests) }
+	case "reuse":
+		key = func(d *hostHealthDTO) float64 { return -d.ReuseRatio }
+	case "dns":
+		key = phase(analysis.PhaseDNS)
+	case "connect":
+		key = phase(analysis.PhaseConnect)
+	case "tls":
+		key = phase(analysis.PhaseTLS)
+	}
+	if key != nil {
+		sort.SliceStable(out, func(i, j int) bool { return key(&out[i]) > key(&out[j]) })
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type concurrencyLevelDTO struct {
+	Min        int     `json:"min"`
+	Max        int     `json:"max,omitempty"` // 0 = no upper bound
+	Count      int64   `json:"count"`
+	MeanTTFBMs float64 `json:"mean_ttfb_ms"`
+}
+
+type concurrencyDTO struct {
+	Scope           string                `json:"scope"`
+	Host            string                `json:"host,omitempty"`
+	ClientIP        string                `json:"client_ip,omitempty"`
+	UserAgent       string                `json:"user_agent,omitempty"`
+	Requests        int64                 `json:"requests"`
+	InFlightNow     int64                 `json:"in_flight_now"`
+	Mean            float64               `json:"mean"`
+	Peak            int                   `json:"peak"`
+	PeakAt          time.Time             `json:"peak_at"`
+	TTFBCorrelation float64               `json:"ttfb_correlation"`
+	TTFBSlopeMs     float64               `json:"ttfb_slope_ms"`
+	TTFBByLevel     []concurrencyLevelDTO `json:"ttfb_by_concurrency"`
+	ConnWaitP50Ms   float64               `json:"conn_wait_p50_ms,omitempty"`
+	ConnWaitP95Ms   float64               `json:"conn_wait_p95_ms,omitempty"`
+	DialP95Ms       float64               `json:"dial_p95_ms,omitempty"`
+	PoolWaits       int64                 `json:"pool_waits,omitempty"`
+	Flags           []string              `json:"flags"`
+	FirstSeen       time.Time             `json:"first_seen"`
+	LastSeen        time.Time             `json:"last_seen"`
+}
+
+// GET /metrics/concurrency?scope=<host|client|all>&min=<N>&flagged=1&limit=<K>
+// -> requests in flight per host (default), client or overall: time-averaged
+// and peak concurrency, live in-flight count, TTFB against concurrency and
+// connection pool waits, highest peak first (defaults: min 1, limit 100)
+func handleConcurrencyMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	ca := reg.Concurrency()
+	if ca == nil {
+		http.Error(w, "concurrency analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	scope := q.Get("scope")
+	switch scope {
+	case "":
+		scope = analysis.ScopeHost
+	case analysis.ScopeHost, analysis.ScopeClient, analysis.ScopeAll:
+	default:
+		http.Error(w, "scope: want host, client or all", http.StatusBadRequest)
+		return
+	}
+	minCount := int64(1)
+	if s := q.Get("min"); s != "" {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v > 0 {
+			minCount = v
+		}
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	flagged := q.Get("flagged") == "1" || q.Get("flagged") == "true"
+	hosts, clients := proxyInFlightBy.snapshot()
+
+	out := make([]concurrencyDTO, 0)
+	for _, s := range ca.Snapshot(scope, minCount) {
+		if flagged && len(s.Flags) == 0 {
+			continue
+		}
+		dto := concurrencyDTO{
+			Scope:           s.Key.Scope,
+			Host:            s.Key.Host,
+			ClientIP:        s.Key.Client.IP,
+			UserAgent:       s.Key.Client.UserAgent,
+			Requests:        s.Requests,
+			Mean:            math.Round(s.Mean*1000) / 1000,
+			Peak:            s.Peak,
+			PeakAt:          s.PeakAt,
+			TTFBCorrelation: math.Round(s.TTFBCorrelation*1000) / 1000,
+			TTFBSlopeMs:     math.Round(s.TTFBSlopeMs*1000) / 1000,
+			TTFBByLevel:     []concurrencyLevelDTO{},
+			PoolWaits:       s.PoolWaits,
+			Flags:           s.Flags,
+			FirstSeen:       s.FirstSeen,
+			LastSeen:        s.LastSeen,
+		}
+		switch s.Key.Scope {
+		case analysis.ScopeHost:
+			dto.InFlightNow = hosts[s.Key.Host]
+		case analysis.ScopeClient:
+			dto.InFlightNow = clients[s.Key.Client.IP]
+		default:
+			dto.InFlightNow = proxyInFlight.Load()
+		}
+		if s.Waited > 0 {
+			dto.ConnWaitP50Ms = float64(s.ConnWait.P50) / 1e6
+			dto.ConnWaitP95Ms = float64(s.ConnWait.P95) / 1e6
+			dto.DialP95Ms = float64(s.Dial.P95) / 1e6
+		}
+		for _, l := range s.TTFBByLevel {
+			dto.TTFBByLevel = append(dto.TTFBByLevel, concurrencyLevelDTO{
+				Min:        l.Min,
+				Max:        l.Max,
+				Count:      l.Count,
+				MeanTTFBMs: float64(l.MeanTTFB) / 1e6,
+			})
+		}
+		if dto.Flags == nil {
+			dto.Flags = []string{}
+		}
+		out = append(out, dto)
+		if len(out) == limit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type concurrencyPointDTO struct {
+	T       time.Time `json:"t"`
+	Mean    float64   `json:"mean"`
+	Peak    int       `json:"peak"`
+	Started int64     `json:"started"`
+}
+
+type concurrencyTimelineDTO struct {
+	Scope     string                `json:"scope"`
+	Host      string                `json:"host,omitempty"`
+	ClientIP  string                `json:"client_ip,omitempty"`
+	UserAgent string                `json:"user_agent,omitempty"`
+	StepMs    float64               `json:"step_ms"`
+	Points    []concurrencyPointDTO `json:"points"`
+}
+
+// GET /metrics/concurrency/timeline?host=<h> | client=<ip>[&ua=<agent>] [&from=<t>&to=<t>]
+// -> mean and peak requests in flight per window for one host, one client
+// (the busiest with that IP unless ua is given) or, with neither, overall
+func handleConcurrencyTimeline(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	ca := reg.Concurrency()
+	if ca == nil {
+		http.Error(w, "concurrency analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	key := analysis.ConcurrencyKey{Scope: analysis.ScopeAll}
+	switch {
+	case q.Get("host") != "":
+		key = analysis.ConcurrencyKey{Scope: analysis.ScopeHost, Host: q.Get("host")}
+	case q.Get("client") != "":
+		ip, ua := q.Get("client"), q.Get("ua")
+		var busiest int64
+		for _, s := range ca.Snapshot(analysis.ScopeClient, 0) {
+			c := s.Key.Client
+			if c.IP == ip && (ua == "" || c.UserAgent == ua) && s.Requests > busiest {
+				key, busiest = s.Key, s.Requests
+			}
+		}
+		if busiest == 0 {
+			http.Error(w, "client not seen", http.StatusNotFound)
+			return
+		}
+	}
+
+	var from, to time.Time
+	now := time.Now()
+	var err error
+	if s := q.Get("from"); s != "" {
+		if from, err = parseTimeBound(s, now); err != nil {
+			http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if to, err = parseTimeBound(s, now); err != nil {
+			http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	out := concurrencyTimelineDTO{
+		Scope:     key.Scope,
+		Host:      key.Host,
+		ClientIP:  key.Client.IP,
+		UserAgent: key.Client.UserAgent,
+		StepMs:    float64(ca.Step) / 1e6,
+		Points:    []concurrencyPointDTO{},
+	}
+	for _, p := range ca.Timeline(key, from, to) {
+		out.Points = append(out.Points, concurrencyPointDTO{
+			T:       p.Start,
+			Mean:    math.Round(p.Mean*1000) / 1000,
+			Peak:    p.Peak,
+			Started: p.Started,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type retrySemanticsDTO struct {
+	ClientIP          string           `json:"client_ip"`
+	UserAgent         string           `json:"user_agent,omitempty"`
+	Method            string           `json:"method"`
+	Host              string           `json:"host"`
+	Path              string           `json:"path"`
+	Query             string           `json:"query,omitempty"`
+	Route             string           `json:"route"`
+	Idempotent        bool             `json:"idempotent"`
+	Bursts            int64            `json:"bursts"`
+	Retries           int64            `json:"retries"`
+	UnkeyedRetries    int64            `json:"unkeyed_retries"`
+	KeyChanges        int64            `json:"idempotency_key_changes"`
+	RetryAfterChecked int64            `json:"retry_after_checked"`
+	RetryAfterIgnored int64            `json:"retry_after_ignored"`
+	BodyChanges       int64            `json:"body_changes"`
+	Backoff           map[string]int64 `json:"backoff"`
+	BurstAttempts     int              `json:"burst_attempts"`
+	BurstGapsMs       []float64        `json:"burst_gaps_ms"`
+	BurstBackoff      string           `json:"burst_backoff,omitempty"`
+	LastStatus        int              `json:"last_status"`
+	Flags             []string         `json:"flags"`
+	FirstSeen         time.Time        `json:"first_seen"`
+	LastSeen          time.Time        `json:"last_seen"`
+}
+
+// GET /metrics/retries/semantics?min=<N>&flagged=1&method=<M>&host=<h>&limit=<K>
+// -> retried requests with their idempotency, Idempotency-Key use, Retry-After
+// compliance, backoff shape and body changes, most retries first
+// (defaults: min 1, limit 100)
+func handleRetrySemanticsMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	ra := reg.RetrySemantics()
+	if ra == nil {
+		http.Error(w, "retry semantics analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	minRetries := int64(1)
+	if s := q.Get("min"); s != "" {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v > 0 {
+			minRetries = v
+		}
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	flagged := q.Get("flagged") == "1" || q.Get("flagged") == "true"
+	method, host := q.Get("method"), q.Get("host")
+
+	out := make([]retrySemanticsDTO, 0)
+	for _, s := range ra.Snapshot(minRetries) {
+		if (flagged && len(s.Flags) == 0) || (method != "" && !strings.EqualFold(s.Key.Method, method)) || (host != "" && s.Key.Host != host) {
+			continue
+		}
+		dto := retrySemanticsDTO{
+			ClientIP:          s.Key.Client.IP,
+			UserAgent:         s.Key.Client.UserAgent,
+			Method:            s.Key.Method,
+			Host:              s.Key.Host,
+			Path:              s.Key.Path,
+			Query:             s.Key.Query,
+			Route:             s.Route.Path,
+			Idempotent:        s.Idempotent,
+			Bursts:            s.Bursts,
+			Retries:           s.Retries,
+			UnkeyedRetries:    s.UnkeyedRetries,
+			KeyChanges:        s.KeyChanges,
+			RetryAfterChecked: s.RetryAfterChecked,
+			RetryAfterIgnored: s.RetryAfterIgnored,
+			BodyChanges:       s.BodyChanges,
+			Backoff:           s.Backoff,
+			BurstAttempts:     s.BurstAttempts,
+			BurstGapsMs:       make([]float64, 0, len(s.BurstGaps)),
+			BurstBackoff:      s.BurstBackoff,
+			LastStatus:        s.LastStatus,
+			Flags:             s.Flags,
+			FirstSeen:         s.FirstSeen,
+			LastSeen:          s.LastSeen,
+		}
+		for _, g := range s.BurstGaps {
+			dto.BurstGapsMs = append(dto.BurstGapsMs, float64(g)/1e6)
+		}
+		if dto.Flags == nil {
+			dto.Flags = []string{}
+		}
+		out = append(out, dto)
+		if len(out) == limit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type rateLimitSampleDTO struct {
+	T         time.Time `json:"t"`
+	Limit     int64     `json:"limit"`
+	Remaining int64     `json:"remaining"`
+}
+
+// rateLimitRetryDTO is a RetryAnalyzer burst on the quota's host, by one of
+// its clients, whose latest attempt was throttled.
+type rateLimitRetryDTO struct {
+	ClientIP   string    `json:"client_ip"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Count      int64     `json:"count"`
+	LastStatus int       `json:"last_status"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+type rateLimitDTO struct {
+	Host            string               `json:"host"`
+	Credential      string               `json:"credential"`
+	ClientIPs       []string             `json:"client_ips"`
+	Requests        int64                `json:"requests"`
+	WithHeaders     int64                `json:"with_headers"`
+	Limit           *int64               `json:"limit"`
+	Remaining       *int64               `json:"remaining"`
+	ResetAt         *time.Time           `json:"reset_at,omitempty"`
+	WindowSec       float64              `json:"window_s,omitempty"`
+	Policy          string               `json:"policy,omitempty"`
+	UsedPerSec      float64              `json:"used_per_s"`
+	ExhaustAt       *time.Time           `json:"exhaust_at,omitempty"`
+	Throttled       int64                `json:"throttled"`
+	RetryAfterSeen  int64                `json:"retry_after_seen"`
+	LastThrottled   *time.Time           `json:"last_throttled,omitempty"`
+	EarlyRequests   int64                `json:"early_requests"`
+	BackoffAfter429 *phaseQuantilesDTO   `json:"backoff_after_429,omitempty"`
+	RetryBursts     []rateLimitRetryDTO  `json:"retry_bursts"`
+	Samples         []rateLimitSampleDTO `json:"samples,omitempty"`
+	Flags           []string             `json:"flags"`
+	FirstSeen       time.Time            `json:"first_seen"`
+	LastSeen        time.Time            `json:"last_seen"`
+}
+
+// GET /metrics/ratelimits?host=<h>&credential=<fp>&flagged=1&samples=1&limit=<K>
+// -> advertised quota per host and credential fingerprint, the pace it is
+// used at and when that runs it out, 429s and what clients did next
+// (including their current retry bursts), most constrained first
+// (default limit 100)
+func handleRateLimitMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	ra := reg.RateLimit()
+	if ra == nil {
+		http.Error(w, "rate limit analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	flagged := q.Get("flagged") == "1" || q.Get("flagged") == "true"
+	withSamples := q.Get("samples") == "1" || q.Get("samples") == "true"
+	host, cred := q.Get("host"), q.Get("credential")
+
+	// Throttled retry bursts by host, to join with the quotas below.
+	bursts := make(map[string][]analysis.RetrySnapshot)
+	for _, b := range reg.Retry().Snapshot(2) {
+		if b.LastStatus == http.StatusTooManyRequests {
+			bursts[b.Host] = append(bursts[b.Host], b)
+		}
+	}
+
+	out := make([]rateLimitDTO, 0)
+	for _, s := range ra.Snapshot() {
+		if (flagged && len(s.Flags) == 0) || (host != "" && s.Key.Host != host) || (cred != "" && s.Key.Credential != cred) {
+			continue
+		}
+		dto := rateLimitDTO{
+			Host:           s.Key.Host,
+			Credential:     s.Key.Credential,
+			ClientIPs:      s.ClientIPs,
+			Requests:       s.Requests,
+			WithHeaders:    s.WithHeaders,
+			Policy:         s.Policy,
+			WindowSec:      s.Window.Seconds(),
+			UsedPerSec:     math.Round(s.UsedPerSec*1000) / 1000,
+			Throttled:      s.Throttled,
+			RetryAfterSeen: s.RetryAfterSeen,
+			EarlyRequests:  s.EarlyRequests,
+			RetryBursts:    []rateLimitRetryDTO{},
+			Flags:          s.Flags,
+			FirstSeen:      s.FirstSeen,
+			LastSeen:       s.LastSeen,
+		}
+		if dto.ClientIPs == nil {
+			dto.ClientIPs = []string{}
+		}
+		if s.Limit >= 0 {
+			dto.Limit = &s.Limit
+		}
+		if s.Remaining >= 0 {
+			dto.Remaining = &s.Remaining
+		}
+		if !s.ResetAt.IsZero() {
+			dto.ResetAt = &s.ResetAt
+		}
+		if !s.ExhaustAt.IsZero() {
+			dto.ExhaustAt = &s.ExhaustAt
+		}
+		if !s.LastThrottled.IsZero() {
+			dto.LastThrottled = &s.LastThrottled
+		}
+		if s.BackoffN > 0 {
+			b := s.BackoffAfter429
+			dto.BackoffAfter429 = &phaseQuantilesDTO{
+				Count:  s.BackoffN,
+				P50Ms:  float64(b.P50) / 1e6,
+				P90Ms:  float64(b.P90) / 1e6,
+				P95Ms:  float64(b.P95) / 1e6,
+				P99Ms:  float64(b.P99) / 1e6,
+				P999Ms: float64(b.P999) / 1e6,
+			}
+		}
+		for _, b := range bursts[s.Key.Host] {
+			if slices.Contains(s.ClientIPs, b.Client.IP) {
+				dto.RetryBursts = append(dto.RetryBursts, rateLimitRetryDTO{
+					ClientIP:   b.Client.IP,
+					Method:     b.Method,
+					Path:       b.Path,
+					Count:      b.Count,
+					LastStatus: b.LastStatus,
+					LastSeen:   b.LastTimestamp,
+				})
+			}
+		}
+		if withSamples {
+			for _, p := range s.Samples {
+				dto.Samples = append(dto.Samples, rateLimitSampleDTO{T: p.Time, Limit: p.Limit, Remaining: p.Remaining})
+			}
+		}
+		if dto.Flags == nil {
+			dto.Flags = []string{}
+		}
+		out = append(out, dto)
+		if len(out) == limit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type cachingDTO struct {
+	Method             string             `json:"method"`
+	Host               string             `json:"host"`
+	Path               string             `json:"path"`
+	Requests           int64              `json:"requests"`
+	Classes            map[string]int64   `json:"classes"`
+	Cacheable          float64            `json:"cacheable"`
+	Lifetime           *phaseQuantilesDTO `json:"lifetime,omitempty"`
+	OK                 int64              `json:"ok"`
+	ETags              int64              `json:"etags"`
+	WeakETags          int64              `json:"weak_etags"`
+	LastModified       int64              `json:"last_modified"`
+	MissingValidators  int64              `json:"missing_validators"`
+	FromCache          int64              `json:"from_cache"`
+	Vary               map[string]int64   `json:"vary,omitempty"`
+	Conditional        int64              `json:"conditional"`
+	NotModified        int64              `json:"not_modified"`
+	HitRatio           float64            `json:"hit_ratio"`
+	Refetches          int64              `json:"refetches"`
+	Identical          int64              `json:"identical_refetches"`
+	IdenticalFresh     int64              `json:"identical_while_fresh"`
+	IdenticalRevalid   int64              `json:"identical_revalidatable"`
+	ConditionalIgnored int64              `json:"conditional_ignored"`
+	WastedBytes        int64              `json:"wasted_bytes"`
+	Flags              []string           `json:"flags"`
+	FirstSeen          time.Time          `json:"first_seen"`
+	LastSeen           time.Time          `json:"last_seen"`
+}
+
+// GET /metrics/caching/routes?min=<N>&flagged=1&host=<h>&limit=<K>
+// -> per-route cacheability, validators, 304 hit ratio and byte-identical
+// refetches, most wasted bytes first (defaults: min 1, limit 100)
+func handleCachingMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	ca := reg.Caching()
+	if ca == nil {
+		http.Error(w, "caching analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	minCount := int64(1)
+	if s := q.Get("min"); s != "" {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v > 0 {
+			minCount = v
+		}
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	flagged := q.Get("flagged") == "1" || q.Get("flagged") == "true"
+	host := q.Get("host")
+
+	out := make([]cachingDTO, 0)
+	for _, s := range ca.Snapshot(minCount) {
+		if (flagged && len(s.Flags) == 0) || (host != "" && s.Route.Host != host) {
+			continue
+		}
+		dto := cachingDTO{
+			Method:             s.Route.Method,
+			Host:               s.Route.Host,
+			Path:               s.Route.Path,
+			Requests:           s.Requests,
+			Classes:            s.Classes,
+			Cacheable:          math.Round(s.Cacheable*1000) / 1000,
+			OK:                 s.OK,
+			ETags:              s.ETags,
+			WeakETags:          s.WeakETags,
+			LastModified:       s.LastModified,
+			MissingValidators:  s.MissingValidators,
+			FromCache:          s.FromCache,
+			Vary:               s.Vary,
+			Conditional:        s.Conditional,
+			NotModified:        s.NotModified,
+			HitRatio:           math.Round(s.HitRatio*1000) / 1000,
+			Refetches:          s.Refetches,
+			Identical:          s.Identical,
+			IdenticalFresh:     s.IdenticalFresh,
+			IdenticalRevalid:   s.IdenticalRevalid,
+			ConditionalIgnored: s.ConditionalIgnored,
+			WastedBytes:        s.WastedBytes,
+			Flags:              s.Flags,
+			FirstSeen:          s.FirstSeen,
+			LastSeen:           s.LastSeen,
+		}
+		if s.Lifetimes > 0 {
+			dto.Lifetime = &phaseQuantilesDTO{
+				Count:  s.Lifetimes,
+				P50Ms:  float64(s.Lifetime.P50) / 1e6,
+				P90Ms:  float64(s.Lifetime.P90) / 1e6,
+				P95Ms:  float64(s.Lifetime.P95) / 1e6,
+				P99Ms:  float64(s.Lifetime.P99) / 1e6,
+				P999Ms: float64(s.Lifetime.P999) / 1e6,
+			}
+		}
+		if dto.Flags == nil {
+			dto.Flags = []string{}
+		}
+		out = append(out, dto)
+		if len(out) == limit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type securityFindingDTO struct {
+	Severity  string           `json:"severity"`
+	Host      string           `json:"host"`
+	Check     string           `json:"check"`
+	Detail    string           `json:"detail,omitempty"`
+	Message   string           `json:"message"`
+	Count     int64            `json:"count"`
+	Routes    map[string]int64 `json:"routes"`
+	Samples   []string         `json:"samples"`
+	FirstSeen time.Time        `json:"first_seen"`
+	LastSeen  time.Time        `json:"last_seen"`
+}
+
+// GET /metrics/security/headers?severity=<high|medium|low>&host=<h>&check=<c>&limit=<K>
+// -> security header, cookie and mixed-content findings at or above a
+// severity, most severe first (defaults: all severities, limit 200)
+func handleSecurityHeaderMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	sa := reg.SecurityHeaders()
+	if sa == nil {
+		http.Error(w, "security analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	minRank := 0
+	if s := q.Get("severity"); s != "" {
+		if minRank = analysis.SeverityRank(strings.ToLower(s)); minRank == 0 {
+			http.Error(w, "severity must be high, medium or low", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 200
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	host := q.Get("host")
+	check := q.Get("check")
+
+	out := make([]securityFindingDTO, 0)
+	for _, f := range sa.Snapshot() {
+		if analysis.SeverityRank(f.Severity) < minRank ||
+			(host != "" && f.Key.Host != host) ||
+			(check != "" && f.Key.Check != check) {
+			continue
+		}
+		dto := securityFindingDTO{
+			Severity:  f.Severity,
+			Host:      f.Key.Host,
+			Check:     f.Key.Check,
+			Detail:    f.Key.Detail,
+			Message:   f.Message,
+			Count:     f.Count,
+			Routes:    f.Routes,
+			Samples:   f.Samples,
+			FirstSeen: f.FirstSeen,
+			LastSeen:  f.LastSeen,
+		}
+		if dto.Samples == nil {
+			dto.Samples = []string{}
+		}
+		out = append(out, dto)
+		if len(out) == limit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type sensitiveDTO struct {
+	Method       string                      `json:"method,omitempty"`
+	Host         string                      `json:"host"`
+	Path         string                      `json:"path,omitempty"`
+	Scanned      int64                       `json:"scanned"`
+	WithFindings int64                       `json:"with_findings"`
+	Rate         float64                     `json:"rate"`
+	ByKind       map[string]int64            `json:"by_kind"`
+	ByLocation   map[string]int64            `json:"by_location"`
+	Flags        []string                    `json:"flags"`
+	LastFinding  time.Time                   `json:"last_finding,omitempty"`
+	LastSample   []analysis.SensitiveFinding `json:"last_sample,omitempty"`
+	Samples      []string                    `json:"samples"`
+}
+
+// GET /metrics/sensitive?by=route|host&min=<N>&flagged=1&host=<h>&kind=<k>&limit=<K>
+// -> masked secrets and PII found in captures per route (or per host),
+// most affected requests first (defaults: by route, min 1, limit 100)
+func handleSensitiveMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := analysisRegistryFor(w, r)
+	if reg == nil {
+		return
+	}
+
+	sa := reg.Sensitive()
+	if sa == nil {
+		http.Error(w, "sensitive analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	minCount := int64(1)
+	if s := q.Get("min"); s != "" {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v >= 0 {
+			minCount = v
+		}
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	flagged := q.Get("flagged") == "1" || q.Get("flagged") == "true"
+	host := q.Get("host")
+	kind := q.Get("kind")
+
+	var snap []analysis.SensitiveSnapshot
+	switch q.Get("by") {
+	case "", "route":
+		snap = sa.Snapshot(minCount)
+	case "host":
+		snap = sa.HostSnapshot(minCount)
+	default:
+		http.Error(w, "by must be route or host", http.StatusBadRequest)
+		return
+	}
+
+	out := make([]sensitiveDTO, 0)
+	for _, s := range snap {
+		if (flagged && len(s.Flags) == 0) || (host != "" && s.Route.Host != host) || (kind != "" && s.ByKind[kind] == 0) {
+			continue
+		}
+		dto := sensitiveDTO{
+			Method:       s.Route.Method,
+			Host:         s.Route.Host,
+			Path:         s.Route.Path,
+			Scanned:      s.Scanned,
+			WithFindings: s.WithFinding,
+			ByKind:       s.ByKind,
+			ByLocation:   s.ByLocation,
+			Flags:        s.Flags,
+			LastFinding:  s.LastFinding,
+			LastSample:   s.LastSample,
+			Samples:      s.Samples,
+		}
+		if s.Scanned > 0 {
+			dto.Rate = math.Round(float64(s.WithFinding)/float64(s.Scanned)*1000) / 1000
+		}
+		if dto.Flags == nil {
+			dto.Flags = []string{}
+		}
+		if dto.Samples == nil {
+			dto.Samples = []string{}
+		}
+		out = append(out, dto)
+		if len(out) == limit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+func TestObservedFromCaptureUsesRouteTemplate(t *testing.T) {
+	old := routeTemplater
+	defer SetRouteTemplater(old)
+	SetRouteTemplater(analysis.NewPathTemplater("/repos/{owner}/{repo}"))
+
+	ev := observedFromCapture(Capture{Method: "GET", URL: "http://api.example.com/users/42?x=1"})
+	if ev.Route.Path != "/users/{id}" || ev.Path != "/users/42" {
+		t.Fatalf("route=%q path=%q, want templated route and concrete path", ev.Route.Path, ev.Path)
+	}
+
+	ev = observedFromCapture(Capture{Method: "GET", URL: "http://api.example.com/repos/golang/go"})
+	if ev.Route.Path != "/repos/{owner}/{repo}" {
+		t.Fatalf("override not applied: %q", ev.Route.Path)
+	}
+
+	// A template recorded on the capture wins over re-templating.
+	ev = observedFromCapture(Capture{Method: "GET", URL: "http://h/a/b", RouteTemplate: "/a/{x}"})
+	if ev.Route.Path != "/a/{x}" {
+		t.Fatalf("stored template ignored: %q", ev.Route.Path)
+	}
+
+	SetRouteTemplater(nil)
+	ev = observedFromCapture(Capture{Method: "GET", URL: "http://h/users/42"})
+	if ev.Route.Path != "/users/42" {
+		t.Fatalf("templating disabled but route = %q", ev.Route.Path)
+	}
+}
+
+func TestAdHocAnalysisReplaysFilteredCaptures(t *testing.T) {
+	oldReg, oldStore, oldRules := analysisRegistry, analysisStore, analysisRules
+	defer func() { analysisRegistry, analysisStore, analysisRules = oldReg, oldStore, oldRules }()
+
+	deploy := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := newCaptureStore(10)
+	for i, c := range []Capture{
+		{Method: "GET", URL: "http://api/users/1", ResponseStatus: 200, DurationMs: 10, Time: deploy.Add(-time.Hour)},
+		{Method: "GET", URL: "http://api/users/2", ResponseStatus: 200, DurationMs: 300, Time: deploy.Add(time.Hour)},
+		{Method: "GET", URL: "http://web/index", ResponseStatus: 200, DurationMs: 5, Time: deploy.Add(time.Hour)},
+	} {
+		c.Name = strconv.Itoa(i)
+		store.add(c)
+	}
+	analysisRegistry = analysis.NewDefaultRegistry() // live registry stays empty
+	SetAnalysisSource(store, &ruleStore{})
+
+	get := func(query string) []routeLatencyDTO {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleRouteLatencyMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics/latency/routes?min=1&"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var out []routeLatencyDTO
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if live := get(""); len(live) != 0 {
+		t.Fatalf("live registry should be untouched, got %d routes", len(live))
+	}
+	before := get("q=host:api&to=" + url.QueryEscape(deploy.Format(time.RFC3339)))
+	after := get("q=host:api&from=" + url.QueryEscape(deploy.Format(time.RFC3339)))
+	if len(before) != 1 || len(after) != 1 {
+		t.Fatalf("before=%d after=%d routes, want 1 each", len(before), len(after))
+	}
+	if before[0].Count != 1 || after[0].Count != 1 || after[0].MeanMs <= before[0].MeanMs {
+		t.Fatalf("before=%+v after=%+v", before[0], after[0])
+	}
+
+	rec := httptest.NewRecorder()
+	handleRouteLatencyMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics/latency/routes?from=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad from: status %d", rec.Code)
+	}
+}
+
+func TestAnalysisResetEndpoint(t *testing.T) {
+	old := analysisRegistry
+	defer func() { analysisRegistry = old }()
+
+	analysisRegistry = analysis.NewDefaultRegistry()
+	RebuildAnalysisFromCaptures(analysisRegistry, []Capture{
+		{Method: "GET", URL: "http://api/users/1", ResponseStatus: 200, DurationMs: 10, Time: time.Now()},
+	})
+	if n := len(analysisRegistry.Latency().Snapshot(0)); n != 1 {
+		t.Fatalf("expected one route before reset, got %d", n)
+	}
+
+	rec := httptest.NewRecorder()
+	handleAnalysisReset(rec, httptest.NewRequest(http.MethodPost, "/metrics/reset?analyzer=bogus", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown analyzer: status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAnalysisReset(rec, httptest.NewRequest(http.MethodPost, "/metrics/reset?analyzer=latency", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("reset: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := len(analysisRegistry.Latency().Snapshot(0)); n != 0 {
+		t.Fatalf("latency not cleared: %d routes", n)
+	}
+	if n := len(analysisRegistry.MethodPath().Snapshot(0)); n != 1 {
+		t.Fatalf("method/path should be untouched, got %d", n)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAnalysisCapacity(rec, httptest.NewRequest(http.MethodGet, "/metrics/capacity", nil))
+	var caps []analysis.CapacityStats
+	if err := json.NewDecoder(rec.Body).Decode(&caps); err != nil {
+		t.Fatal(err)
+	}
+	if len(caps) != len(analysisRegistry.Analyzers()) {
+		t.Fatalf("capacity lists %d analyzers, want %d", len(caps), len(analysisRegistry.Analyzers()))
+	}
+}
+
+func TestMetricsIndexListsAnalyzers(t *testing.T) {
+	oldReg, oldCfg := analysisRegistry, analysisConfig
+	defer func() { analysisRegistry, analysisConfig = oldReg, oldCfg }()
+
+	analysisConfig = analysis.RegistryConfig{}
+	if err := analysisConfig.Apply("-schema"); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := analysis.NewRegistryFromConfig(analysisConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysisRegistry = reg
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if wantsMetricsIndex(req) {
+		t.Fatalf("plain scrape should get Prometheus text")
+	}
+	req.Header.Set("Accept", "application/json")
+	if !wantsMetricsIndex(req) {
+		t.Fatalf("Accept: application/json should get the index")
+	}
+
+	rec := httptest.NewRecorder()
+	handleMetricsIndex(rec, req)
+	var idx metricsIndexDTO
+	if err := json.NewDecoder(rec.Body).Decode(&idx); err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]analyzerIndexDTO)
+	for _, a := range idx.Analyzers {
+		byName[a.Name] = a
+	}
+	if a := byName["schema"]; a.Enabled || len(a.Endpoints) != 0 {
+		t.Fatalf("schema should be listed as disabled: %+v", a)
+	}
+	if a := byName["retry"]; !a.Enabled || a.Params["window"] != "30s" || len(a.Endpoints) == 0 {
+		t.Fatalf("retry entry: %+v", a)
+	}
+}
+
+func TestTemporalRollupEndpoint(t *testing.T) {
+	old := analysisRegistry
+	defer func() { analysisRegistry = old }()
+
+	analysisRegistry = analysis.NewDefaultRegistry()
+	now := time.Now()
+	RebuildAnalysisFromCaptures(analysisRegistry, []Capture{
+		{Method: "GET", URL: "http://payments/charge", ResponseStatus: 500, DurationMs: 40, Time: now.Add(-90 * time.Minute)},
+		{Method: "GET", URL: "http://payments/charge", ResponseStatus: 200, DurationMs: 20, Time: now.Add(-90 * time.Minute)},
+		{Method: "GET", URL: "http://search/q", ResponseStatus: 200, DurationMs: 5, Time: now.Add(-90 * time.Minute)},
+	})
+
+	rec := httptest.NewRecorder()
+	handleTemporalMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics/temporal?group_by=host&host=payments&from=3h", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var out temporalRollupDTO
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Resolution != "1m0s" || len(out.Series) != 1 || out.Series[0].Host != "payments" {
+		t.Fatalf("unexpected rollup %+v", out)
+	}
+	if p := out.Series[0].Points; len(p) != 1 || p[0].Count != 2 || p[0].ErrorRate != 0.5 {
+		t.Fatalf("unexpected points %+v", p)
+	}
+
+	rec = httptest.NewRecorder()
+	handleTemporalMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics/temporal?resolution=7s", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown resolution: status %d", rec.Code)
+	}
+
+	// from/to alone still replay the stored captures into the 1s buckets.
+	oldStore, oldRules := analysisStore, analysisRules
+	defer func() { analysisStore, analysisRules = oldStore, oldRules }()
+	store := newCaptureStore(10)
+	store.add(Capture{Method: "GET", URL: "http://search/q", ResponseStatus: 200, DurationMs: 5, Time: now.Add(-30 * time.Second)})
+	SetAnalysisSource(store, &ruleStore{})
+	rec = httptest.NewRecorder()
+	handleTemporalMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics/temporal?from=1m", nil))
+	var buckets []temporalBucketDTO
+	if err := json.NewDecoder(rec.Body).Decode(&buckets); err != nil || len(buckets) != 1 || buckets[0].Count != 1 {
+		t.Fatalf("from alone should replay captures into buckets: %d %v %+v", rec.Code, err, buckets)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"sync"
 	"time"
+
+	"HTTPBreakoutBox/src/analysis"
 )
 
 // Capture represents a single proxied transaction (request + response)
@@ -29,6 +31,7 @@ type Capture struct {
 	TTFBMs     int64 `json:"ttfb_ms,omitempty"`      // first byte from origin after write
 	RespReadMs int64 `json:"resp_read_ms,omitempty"` // body read duration (first->last byte)
 	TotalMs    int64 `json:"total_ms,omitempty"`     // wall clock: RoundTrip start -> last byte
+	ConnWaitMs int64 `json:"conn_wait_ms,omitempty"` // GetConn -> GotConn: dial or wait for a pooled connection
 
 	// Connection / protocol (origin side)
 	ServerAddr string `json:"server_addr,omitempty"` // ip:port of origin
@@ -48,6 +51,18 @@ type Capture struct {
 	Scheme string `json:"scheme,omitempty"` // "http" or "https"`
 	IsGRPC bool   `json:"is_grpc,omitempty"`
 
+	// RouteTemplate is the normalized path used as the analysis route
+	// (e.g. /users/{id}); URL keeps the concrete path for drill-down.
+	RouteTemplate string `json:"route_template,omitempty"`
+
+	// --- correlation (links captures to each other and to backend logs) ---
+
+	CorrelationID string `json:"correlation_id,omitempty"` // adopted or injected request ID
+	TraceID       string `json:"trace_id,omitempty"`       // W3C trace-id from traceparent
+	ParentSpanID  string `json:"parent_span_id,omitempty"` // traceparent parent-id: the caller's span for this hop
+	TraceFlags    string `json:"trace_flags,omitempty"`    // traceparent flags ("01" = sampled)
+	TraceState    string `json:"tracestate,omitempty"`     // raw tracestate header
+
 	// --- TLS fingerprint summary (client<->proxy or proxy<->origin, whichever you choose) ---
 
 	TLSVersion     uint16 `json:"tls_version,omitempty"`      // tls.ConnectionState.Version
@@ -80,6 +95,19 @@ type Capture struct {
 
 	// GRPC specific
 	GRPC *GRPCSample `json:"grpc,omitempty"`
+
+	// RPC-over-HTTP (JSON-RPC / SOAP) summary extracted by a body dissector
+	RPC *RPCSample `json:"rpc,omitempty"`
+
+	// --- API contract conformance (set when the host has a contract loaded) ---
+
+	ContractChecked    bool                         `json:"contract_checked,omitempty"`
+	ContractViolations []analysis.ContractViolation `json:"contract_violations,omitempty"`
+
+	// --- secrets and PII found in the capture (values masked) ---
+
+	SensitiveScanned  bool                        `json:"sensitive_scanned,omitempty"`
+	SensitiveFindings []analysis.SensitiveFinding `json:"sensitive_findings,omitempty"`
 }
 
 type captureStore struct {
@@ -107,6 +135,17 @@ type GRPCFrameSample struct {
 	Base64     string `json:"base64"` // base64 of decoded payload (after decompression)
 }
 
+type RPCSample struct {
+	Protocol  string `json:"protocol"`                // "jsonrpc" | "soap"
+	Method    string `json:"method,omitempty"`        // JSON-RPC method or SOAP operation
+	ID        string `json:"id,omitempty"`            // JSON-RPC id (stringified)
+	Batch     int    `json:"batch,omitempty"`         // calls in a JSON-RPC batch (0 = single call)
+	Fault     bool   `json:"fault,omitempty"`         // JSON-RPC error object or SOAP Fault in response
+	ErrorCode int    `json:"error_code,omitempty"`    // JSON-RPC error.code
+	FaultCode string `json:"fault_code,omitempty"`    // SOAP faultcode / Code/Value
+	FaultMsg  string `json:"fault_message,omitempty"` // JSON-RPC error.message / SOAP faultstring
+}
+
 func newCaptureStore(cap int) *captureStore {
 	return &captureStore{
 		buf:  make([]Capture, cap),
@@ -130,6 +169,13 @@ func (s *captureStore) add(c Capture) Capture {
 	return s.buf[idx]
 }
 
+// occupancy returns the number of stored captures and the buffer capacity.
+func (s *captureStore) occupancy() (count, capacity int) {
+	s.Lock()
+	defer s.Unlock()
+	return s.count, len(s.buf)
+}
+
 func (s *captureStore) list() []Capture {
 	s.Lock()
 	defer s.Unlock()
@@ -225,6 +271,25 @@ func (s *captureStore) clear() {
 	s.next = 0
 }
 
+// byCorrelation returns captures (oldest first) whose correlation ID or
+// trace ID equals id.
+func (s *captureStore) byCorrelation(id string) []Capture {
+	if id == "" {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	var out []Capture
+	start := (s.next - s.count + len(s.buf)) % len(s.buf)
+	for i := 0; i < s.count; i++ {
+		c := s.buf[(start+i)%len(s.buf)]
+		if c.CorrelationID == id || c.TraceID == id {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
 func (s *captureStore) updateName(id int64, name string) (Capture, bool) {
 	s.Lock()
 	defer s.Unlock()
@@ -0,0 +1,923 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// Contract validation: each finished capture whose host has an OpenAPI 3.x
+// document loaded is checked against it, and the violations are attached to
+// the Capture (ContractViolations) and fed to the contract analyzer.
+//
+// JSON and YAML documents are accepted; the JSON Schema subset understood is
+// type (incl. type arrays and 3.0 nullable), enum, const, properties,
+// required, additionalProperties, items, min/maxItems, allOf/anyOf/oneOf,
+// minimum/maximum, min/maxLength and pattern. Local "$ref"s are resolved.
+
+// contractEvent is the payload of the "contract" SSE event.
+type contractEvent struct {
+	CaptureID  int64                        `json:"capture_id"`
+	Method     string                       `json:"method"`
+	URL        string                       `json:"url"`
+	Status     int                          `json:"status"`
+	Violations []analysis.ContractViolation `json:"violations"`
+}
+
+// maxContractViolations bounds the violations recorded per capture.
+const maxContractViolations = 20
+
+// maxSchemaDepth stops runaway recursion through self-referencing schemas.
+const maxSchemaDepth = 64
+
+// maxContractBody bounds the bodies decoded and checked against a schema.
+// Validation runs on the proxy's response path; larger bodies are only
+// checked for their media type.
+const maxContractBody = 1 << 20
+
+type contractSpec struct {
+	Host     string
+	Source   string
+	Title    string
+	Version  string
+	basePath string
+	doc      map[string]any
+	paths    []contractPath // most literal segments first
+
+	patterns sync.Map // pattern string -> *regexp.Regexp (nil if invalid)
+}
+
+type contractPath struct {
+	template string
+	literals int
+	item     map[string]any
+}
+
+// contractInfo is the /api/contracts view of a loaded spec.
+type contractInfo struct {
+	Host       string `json:"host"`
+	Source     string `json:"source,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Version    string `json:"version,omitempty"`
+	BasePath   string `json:"base_path,omitempty"`
+	Paths      int    `json:"paths"`
+	Operations int    `json:"operations"`
+}
+
+var contractMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// parseContract decodes an OpenAPI 3.x JSON or YAML document for host.
+func parseContract(host, source string, data []byte) (*contractSpec, error) {
+	if t := bytes.TrimSpace(data); len(t) > 0 && t[0] != '{' {
+		j, err := yamlToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode contract: %w", err)
+		}
+		data = j
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode contract: %w", err)
+	}
+	ver, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(ver, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q (want 3.x)", ver)
+	}
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" {
+		return nil, errors.New("contract host is required")
+	}
+
+	spec := &contractSpec{Host: host, Source: source, doc: doc}
+	if info, ok := doc["info"].(map[string]any); ok {
+		spec.Title, _ = info["title"].(string)
+		spec.Version, _ = info["version"].(string)
+	}
+	if servers, ok := doc["servers"].([]any); ok && len(servers) > 0 {
+		if s, ok := servers[0].(map[string]any); ok {
+			raw, _ := s["url"].(string)
+			if u, err := url.Parse(raw); err == nil && !strings.Contains(u.Path, "{") {
+				spec.basePath = strings.TrimRight(u.Path, "/")
+			}
+		}
+	}
+	paths, _ := doc["paths"].(map[string]any)
+	for tmpl, v := range paths {
+		item := spec.resolve(v)
+		if item == nil {
+			continue
+		}
+		lit := 0
+		for _, seg := range strings.Split(strings.Trim(tmpl, "/"), "/") {
+			if !strings.Contains(seg, "{") {
+				lit++
+			}
+		}
+		spec.paths = append(spec.paths, contractPath{template: tmpl, literals: lit, item: item})
+	}
+	// Concrete paths win over templated ones (/users/me before /users/{id}).
+	sort.Slice(spec.paths, func(i, j int) bool {
+		if spec.paths[i].literals != spec.paths[j].literals {
+			return spec.paths[i].literals > spec.paths[j].literals
+		}
+		return spec.paths[i].template < spec.paths[j].template
+	})
+	return spec, nil
+}
+
+// yamlToJSON re-encodes a YAML document as JSON, so that both formats are
+// decoded (and their numbers kept exact) the same way.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonCompatible(v))
+}
+
+// jsonCompatible turns the map[any]any that YAML produces for non-string
+// keys (e.g. response codes written as 200) into map[string]any.
+func jsonCompatible(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, e := range x {
+			x[k] = jsonCompatible(e)
+		}
+	case map[any]any:
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			m[fmt.Sprint(k)] = jsonCompatible(e)
+		}
+		return m
+	case []any:
+		for i, e := range x {
+			x[i] = jsonCompatible(e)
+		}
+	}
+	return v
+}
+
+func (s *contractSpec) info() contractInfo {
+	ops := 0
+	for _, p := range s.paths {
+		for _, m := range contractMethods {
+			if _, ok := p.item[m]; ok {
+				ops++
+			}
+		}
+	}
+	return contractInfo{
+		Host: s.Host, Source: s.Source, Title: s.Title, Version: s.Version,
+		BasePath: s.basePath, Paths: len(s.paths), Operations: ops,
+	}
+}
+
+// resolve follows local $refs ("#/components/...") and returns the object.
+func (s *contractSpec) resolve(v any) map[string]any {
+	for i := 0; i < maxSchemaDepth; i++ {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		v = s.lookupRef(ref)
+	}
+	return nil
+}
+
+func (s *contractSpec) lookupRef(ref string) any {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil // remote refs are not followed
+	}
+	var cur any = s.doc
+	for _, tok := range strings.Split(ref[2:], "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[tok]
+	}
+	return cur
+}
+
+//
+// Contract store
+//
+
+type contractStore struct {
+	mu     sync.RWMutex
+	byHost map[string]*contractSpec
+}
+
+func newContractStore() *contractStore {
+	return &contractStore{byHost: make(map[string]*contractSpec)}
+}
+
+// contracts holds the per-host specs consulted by validateContract.
+var contracts = newContractStore()
+
+func (s *contractStore) set(spec *contractSpec) {
+	s.mu.Lock()
+	s.byHost[spec.Host] = spec
+	s.mu.Unlock()
+}
+
+func (s *contractStore) remove(host string) bool {
+	host = strings.ToLower(host)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byHost[host]; !ok {
+		return false
+	}
+	delete(s.byHost, host)
+	return true
+}
+
+// lookup finds the spec for a request host, trying host:port then hostname.
+func (s *contractStore) lookup(host string) *contractSpec {
+	host = strings.ToLower(host)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.byHost) == 0 {
+		return nil
+	}
+	if spec := s.byHost[host]; spec != nil {
+		return spec
+	}
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		return s.byHost[h]
+	}
+	return nil
+}
+
+func (s *contractStore) list() []contractInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]contractInfo, 0, len(s.byHost))
+	for _, spec := range s.byHost {
+		out = append(out, spec.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// loadContractFiles loads "host=path.json" pairs (the -contract flag).
+func loadContractFiles(pairs []string) error {
+	for _, kv := range pairs {
+		host, path, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("contract %q: want host=path", kv)
+		}
+		path = strings.TrimSpace(path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		spec, err := parseContract(host, path, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		contracts.set(spec)
+	}
+	return nil
+}
+
+// coverageOperations lists the spec's operations for the coverage analyzer.
+func (s *contractSpec) coverageOperations() []analysis.CoverageOperation {
+	var ops []analysis.CoverageOperation
+	for _, p := range s.paths {
+		for _, m := range contractMethods {
+			op := s.resolve(p.item[m])
+			if op == nil {
+				continue
+			}
+			co := analysis.CoverageOperation{Method: strings.ToUpper(m), Path: p.template}
+			co.OperationID, _ = op["operationId"].(string)
+			if responses, ok := op["responses"].(map[string]any); ok {
+				for k := range responses {
+					co.Statuses = append(co.Statuses, k)
+				}
+				sort.Strings(co.Statuses)
+			}
+			for _, param := range s.operationParameters(p.item, op) {
+				cp := analysis.CoverageParam{}
+				cp.Name, _ = param["name"].(string)
+				cp.In, _ = param["in"].(string)
+				cp.Required, _ = param["required"].(bool)
+				if schema := s.resolve(param["schema"]); schema != nil {
+					if items := s.resolve(schema["items"]); items != nil && schemaHasType(schema, "array") {
+						schema = items
+					}
+					enum, _ := schema["enum"].([]any)
+					for _, e := range enum {
+						cp.Enum = append(cp.Enum, fmt.Sprint(e))
+					}
+				}
+				co.Params = append(co.Params, cp)
+			}
+			ops = append(ops, co)
+		}
+	}
+	return ops
+}
+
+// installContract loads a spec for validation and registers its operations
+// with the coverage analyzer. When store is non-nil the captures already
+// stored are replayed so coverage reflects traffic seen before the upload.
+func installContract(spec *contractSpec, store *captureStore) {
+	contracts.set(spec)
+	cov := analysisRegistry.Coverage()
+	if cov == nil {
+		return
+	}
+	cov.SetOperations(spec.Host, spec.basePath, spec.coverageOperations())
+	if store == nil {
+		return
+	}
+	for _, c := range store.list() {
+		if ev := observedFromCapture(c); ev != nil {
+			cov.OnRequest(ev)
+		}
+	}
+}
+
+// uninstallContract unloads a host's spec and its coverage.
+func uninstallContract(host string) bool {
+	if !contracts.remove(host) {
+		return false
+	}
+	if cov := analysisRegistry.Coverage(); cov != nil {
+		cov.RemoveHost(host)
+	}
+	return true
+}
+
+// registerContractCoverage registers every loaded spec with the coverage
+// analyzer (used at startup, after the registry is created).
+func registerContractCoverage() {
+	contracts.mu.RLock()
+	specs := make([]*contractSpec, 0, len(contracts.byHost))
+	for _, spec := range contracts.byHost {
+		specs = append(specs, spec)
+	}
+	contracts.mu.RUnlock()
+	for _, spec := range specs {
+		installContract(spec, nil)
+	}
+}
+
+//
+// Validation
+//
+
+// validateContract checks a finished capture against its host's contract
+// and records the outcome on the capture.
+func validateContract(c *Capture) {
+	c.ContractChecked, c.ContractViolations = false, nil
+	if c.IsGRPC || c.GRPC != nil || c.Method == http.MethodConnect {
+		return
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	spec := contracts.lookup(u.Host)
+	if spec == nil {
+		return
+	}
+	c.ContractChecked = true
+	c.ContractViolations = spec.validate(c, u)
+}
+
+type contractCheck struct {
+	spec     *contractSpec
+	specPath string
+	out      []analysis.ContractViolation
+}
+
+func (cc *contractCheck) add(kind, where, pointer, format string, args ...any) {
+	if len(cc.out) >= maxContractViolations {
+		return
+	}
+	cc.out = append(cc.out, analysis.ContractViolation{
+		Kind: kind, Where: where, Pointer: pointer,
+		Message: fmt.Sprintf(format, args...), SpecPath: cc.specPath,
+	})
+}
+
+func (s *contractSpec) validate(c *Capture, u *url.URL) []analysis.ContractViolation {
+	cc := &contractCheck{spec: s}
+
+	path := u.Path
+	if s.basePath != "" {
+		if path != s.basePath && !strings.HasPrefix(path, s.basePath+"/") {
+			cc.add(analysis.ContractUnknownPath, "request", "", "path %s is outside server base %s", path, s.basePath)
+			return cc.out
+		}
+		path = strings.TrimPrefix(path, s.basePath)
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	var cp *contractPath
+	var pathParams map[string]string
+	for i := range s.paths {
+		if params, ok := analysis.MatchPathTemplate(s.paths[i].template, path); ok {
+			cp, pathParams = &s.paths[i], params
+			break
+		}
+	}
+	if cp == nil {
+		cc.add(analysis.ContractUnknownPath, "request", "", "no path in contract matches %s", path)
+		return cc.out
+	}
+	cc.specPath = cp.template
+
+	op := s.resolve(cp.item[strings.ToLower(c.Method)])
+	if op == nil {
+		cc.add(analysis.ContractUnknownMethod, "request", "", "%s is not documented for %s", c.Method, cp.template)
+		return cc.out
+	}
+
+	cc.checkParameters(cp.item, op, pathParams, c, u)
+	cc.checkRequestBody(op, c)
+	cc.checkResponse(op, c)
+	return cc.out
+}
+
+// operationParameters merges path-item and operation parameters; the
+// operation's definition wins for the same name and location.
+func (s *contractSpec) operationParameters(item, op map[string]any) []map[string]any {
+	var out []map[string]any
+	index := make(map[string]int)
+	for _, src := range []map[string]any{item, op} {
+		list, _ := src["parameters"].([]any)
+		for _, raw := range list {
+			p := s.resolve(raw)
+			if p == nil {
+				continue
+			}
+			name, _ := p["name"].(string)
+			in, _ := p["in"].(string)
+			key := in + "\x00" + strings.ToLower(name)
+			if i, ok := index[key]; ok {
+				out[i] = p
+				continue
+			}
+			index[key] = len(out)
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (cc *contractCheck) checkParameters(item, op map[string]any, pathParams map[string]string, c *Capture, u *url.URL) {
+	query := u.Query()
+	var cookies []*http.Cookie
+	if ck := headerValue(c.RequestHeaders, "Cookie"); ck != "" {
+		cookies = (&http.Request{Header: http.Header{"Cookie": {ck}}}).Cookies()
+	}
+
+	for _, p := range cc.spec.operationParameters(item, op) {
+		name, _ := p["name"].(string)
+		in, _ := p["in"].(string)
+		required, _ := p["required"].(bool)
+		if name == "" {
+			continue
+		}
+
+		var values []string
+		switch in {
+		case "path":
+			required = true
+			if v, ok := pathParams[name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[name]
+		case "header":
+			// OpenAPI ignores these when declared as parameters.
+			switch strings.ToLower(name) {
+			case "accept", "content-type", "authorization":
+				continue
+			}
+			for k, vs := range c.RequestHeaders {
+				if strings.EqualFold(k, name) {
+					values = append(values, vs...)
+				}
+			}
+		case "cookie":
+			for _, ck := range cookies {
+				if ck.Name == name {
+					values = append(values, ck.Value)
+				}
+			}
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if required {
+				cc.add(analysis.ContractMissingParameter, "request", name, "required %s parameter %q is missing", in, name)
+			}
+			continue
+		}
+		schema := cc.spec.resolve(p["schema"])
+		if schema == nil {
+			continue
+		}
+		var v any
+		if schemaHasType(schema, "array") {
+			if in != "query" && len(values) == 1 {
+				values = strings.Split(values[0], ",")
+			}
+			arr := make([]any, len(values))
+			for i, s := range values {
+				arr[i] = coerceParam(s, cc.spec.resolve(schema["items"]))
+			}
+			v = arr
+		} else {
+			v = coerceParam(values[0], schema)
+		}
+		sc := &schemaCheck{spec: cc.spec}
+		sc.check(schema, v, "", 0)
+		if len(sc.errs) > 0 {
+			cc.add(analysis.ContractInvalidParameter, "request", name, "%s parameter %q: %s", in, name, sc.errs[0].msg)
+		}
+	}
+}
+
+// coerceParam types a raw parameter string according to its schema so it
+// can be validated like a JSON value.
+func coerceParam(raw string, schema map[string]any) any {
+	if schema == nil {
+		return raw
+	}
+	types := schemaTypes(schema)
+	for _, t := range types {
+		switch t {
+		case "integer", "number":
+			if _, err := strconv.ParseFloat(raw, 64); err == nil {
+				return json.Number(raw)
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(raw); err == nil {
+				return b
+			}
+		}
+	}
+	return raw
+}
+
+func schemaHasType(schema map[string]any, want string) bool {
+	for _, t := range schemaTypes(schema) {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (cc *contractCheck) checkRequestBody(op map[string]any, c *Capture) {
+	rb := cc.spec.resolve(op["requestBody"])
+	hasBody := strings.TrimSpace(c.RequestBodyBase64) != "" || c.RequestBodyBytes > 0
+	if rb == nil {
+		return
+	}
+	if !hasBody {
+		if req, _ := rb["required"].(bool); req {
+			cc.add(analysis.ContractRequestBody, "request", "", "required request body is missing")
+		}
+		return
+	}
+	content, _ := rb["content"].(map[string]any)
+	cc.checkContent(content, "request", analysis.ContractRequestBody, mediaType(c.RequestHeaders), c.RequestBodyBase64, c.ReqBodyTruncated)
+}
+
+func (cc *contractCheck) checkResponse(op map[string]any, c *Capture) {
+	responses, _ := op["responses"].(map[string]any)
+	if len(responses) == 0 {
+		return
+	}
+	status := strconv.Itoa(c.ResponseStatus)
+	var resp map[string]any
+	for _, key := range []string{status, status[:1] + "XX", status[:1] + "xx", "default"} {
+		if v, ok := responses[key]; ok {
+			resp = cc.spec.resolve(v)
+			break
+		}
+	}
+	if resp == nil {
+		cc.add(analysis.ContractUndocumentedStatus, "response", "", "status %s is not documented", status)
+		return
+	}
+	if strings.TrimSpace(c.ResponseBodyBase64) == "" && c.ResponseBodyBytes == 0 {
+		return
+	}
+	content, _ := resp["content"].(map[string]any)
+	cc.checkContent(content, "response", analysis.ContractResponseBody, mediaType(c.ResponseHeaders), c.ResponseBodyBase64, c.RespBodyTruncated)
+}
+
+// checkContent matches the body's media type against a content map and
+// validates JSON bodies against the media type's schema.
+func (cc *contractCheck) checkContent(content map[string]any, where, kind, mt, body string, truncated bool) {
+	if len(content) == 0 {
+		if mt != "" {
+			cc.add(analysis.ContractUndocumentedType, where, "", "%s body (%s) is not documented", where, mt)
+		}
+		return
+	}
+	media := contentFor(content, mt)
+	if media == nil {
+		if mt == "" {
+			mt = "no content type"
+		}
+		cc.add(analysis.ContractUndocumentedType, where, "", "%s content type %s is not documented", where, mt)
+		return
+	}
+	m := cc.spec.resolve(media)
+	schema := m["schema"]
+	if schema == nil || !analysis.IsJSONMediaType(mt) || truncated || len(body) > maxContractBody {
+		return
+	}
+	v, ok := analysis.DecodeJSON([]byte(body))
+	if !ok {
+		cc.add(kind, where, "", "%s body is not valid JSON", where)
+		return
+	}
+	sc := &schemaCheck{spec: cc.spec}
+	sc.check(schema, v, "", 0)
+	for _, e := range sc.errs {
+		cc.add(kind, where, e.pointer, "%s", e.msg)
+	}
+}
+
+// contentFor picks the content entry for a media type: exact, type/*, */*.
+func contentFor(content map[string]any, mt string) any {
+	if mt != "" {
+		for k, v := range content {
+			if strings.EqualFold(strings.TrimSpace(strings.SplitN(k, ";", 2)[0]), mt) {
+				return v
+			}
+		}
+		if major, _, ok := strings.Cut(mt, "/"); ok {
+			if v, ok := content[major+"/*"]; ok {
+				return v
+			}
+		}
+	}
+	return content["*/*"]
+}
+
+//
+// JSON Schema subset
+//
+
+type schemaError struct {
+	pointer string
+	msg     string
+}
+
+type schemaCheck struct {
+	spec *contractSpec
+	errs []schemaError
+}
+
+func (sc *schemaCheck) fail(ptr, format string, args ...any) {
+	if len(sc.errs) < maxContractViolations {
+		sc.errs = append(sc.errs, schemaError{pointer: ptr, msg: fmt.Sprintf(format, args...)})
+	}
+}
+
+// valid reports whether v satisfies schema without recording errors.
+func (sc *schemaCheck) valid(schema any, v any, ptr string, depth int) bool {
+	sub := &schemaCheck{spec: sc.spec}
+	sub.check(schema, v, ptr, depth)
+	return len(sub.errs) == 0
+}
+
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, x := range t {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch x := v.(type) {
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+func jsonEqual(a, b any) bool {
+	an, aok := schemaNumber(a)
+	bn, bok := schemaNumber(b)
+	if aok && bok {
+		return an == bn
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func escapePointer(tok string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(tok, "~", "~0"), "/", "~1")
+}
+
+func (sc *schemaCheck) check(raw any, v any, ptr string, depth int) {
+	if depth > maxSchemaDepth {
+		return
+	}
+	if b, ok := raw.(bool); ok {
+		if !b {
+			sc.fail(ptr, "value not allowed")
+		}
+		return
+	}
+	schema := sc.spec.resolve(raw)
+	if schema == nil {
+		return
+	}
+	where := ptr
+	if where == "" {
+		where = "body"
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, s := range all {
+			sc.check(s, v, ptr, depth+1)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, s := range anyOf {
+			if sc.valid(s, v, ptr, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			sc.fail(ptr, "%s matches none of anyOf", where)
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		n := 0
+		for _, s := range oneOf {
+			if sc.valid(s, v, ptr, depth+1) {
+				n++
+			}
+		}
+		if n != 1 {
+			sc.fail(ptr, "%s matches %d of oneOf (want exactly 1)", where, n)
+		}
+	}
+
+	got := analysis.JSONType(v)
+	if nullable, _ := schema["nullable"].(bool); nullable && got == "null" {
+		return
+	}
+	if types := schemaTypes(schema); len(types) > 0 {
+		ok := false
+		for _, t := range types {
+			if t == got || (t == "number" && got == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			sc.fail(ptr, "%s: expected %s, got %s", where, strings.Join(types, " or "), got)
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sc.fail(ptr, "%s: value is not in enum", where)
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, v) {
+		sc.fail(ptr, "%s: value does not equal const", where)
+	}
+
+	switch x := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(x)
+		if min, ok := schemaNumber(schema["minLength"]); ok && float64(n) < min {
+			sc.fail(ptr, "%s: shorter than minLength %v", where, min)
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && float64(n) > max {
+			sc.fail(ptr, "%s: longer than maxLength %v", where, max)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re := sc.spec.pattern(p); re != nil && !re.MatchString(x) {
+				sc.fail(ptr, "%s: does not match pattern %s", where, p)
+			}
+		}
+	case json.Number:
+		f, _ := x.Float64()
+		if min, ok := schemaNumber(schema["minimum"]); ok && f < min {
+			sc.fail(ptr, "%s: %s is below minimum %v", where, x, min)
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && f > max {
+			sc.fail(ptr, "%s: %s is above maximum %v", where, x, max)
+		}
+	case []any:
+		if min, ok := schemaNumber(schema["minItems"]); ok && float64(len(x)) < min {
+			sc.fail(ptr, "%s: fewer than minItems %v", where, min)
+		}
+		if max, ok := schemaNumber(schema["maxItems"]); ok && float64(len(x)) > max {
+			sc.fail(ptr, "%s: more than maxItems %v", where, max)
+		}
+		if items, ok := schema["items"]; ok {
+			for i, el := range x {
+				sc.check(items, el, ptr+"/"+strconv.Itoa(i), depth+1)
+			}
+		}
+	case map[string]any:
+		if req, ok := schema["required"].([]any); ok {
+			for _, r := range req {
+				if name, ok := r.(string); ok {
+					if _, present := x[name]; !present {
+						sc.fail(ptr+"/"+escapePointer(name), "missing required property %q", name)
+					}
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := ptr + "/" + escapePointer(k)
+			if ps, ok := props[k]; ok {
+				sc.check(ps, x[k], child, depth+1)
+				continue
+			}
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					sc.fail(child, "unexpected property %q", k)
+				}
+			case map[string]any:
+				sc.check(ap, x[k], child, depth+1)
+			}
+		}
+	}
+}
+
+// pattern compiles (and caches) a schema pattern; invalid patterns are
+// ignored rather than reported against the traffic.
+func (s *contractSpec) pattern(p string) *regexp.Regexp {
+	if v, ok := s.patterns.Load(p); ok {
+		return v.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		re = nil
+	}
+	s.patterns.Store(p, re)
+	return re
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+const testContract = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Users", "version": "1"},
+  "servers": [{"url": "https://api.example.com/v1"}],
+  "paths": {
+    "/users/me": {"get": {"responses": {"200": {"description": "ok"}}}},
+    "/users/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "get": {
+        "parameters": [{"name": "X-Tenant", "in": "header", "required": true, "schema": {"type": "string"}}],
+        "responses": {
+          "200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "4XX": {"description": "error"}
+        }
+      },
+      "put": {
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+        "responses": {"204": {"description": "updated"}}
+      }
+    }
+  },
+  "components": {"schemas": {"User": {
+    "type": "object",
+    "required": ["id", "name"],
+    "additionalProperties": false,
+    "properties": {
+      "id": {"type": "integer", "minimum": 1},
+      "name": {"type": "string", "minLength": 1},
+      "role": {"type": "string", "enum": ["admin", "member"]},
+      "email": {"type": "string", "nullable": true}
+    }
+  }}}
+}`
+
+func loadTestContract(t *testing.T) {
+	t.Helper()
+	spec, err := parseContract("api.example.com", "test", []byte(testContract))
+	if err != nil {
+		t.Fatalf("parseContract: %v", err)
+	}
+	old := contracts
+	contracts = newContractStore()
+	contracts.set(spec)
+	t.Cleanup(func() { contracts = old })
+}
+
+func contractKinds(c Capture) []string {
+	var out []string
+	for _, v := range c.ContractViolations {
+		out = append(out, v.Kind)
+	}
+	return out
+}
+
+func TestValidateContract(t *testing.T) {
+	loadTestContract(t)
+	jsonHdr := map[string][]string{"Content-Type": {"application/json"}}
+	tenant := map[string][]string{"X-Tenant": {"acme"}}
+
+	cases := []struct {
+		name string
+		c    Capture
+		want []string
+	}{
+		{
+			name: "conformant",
+			c: Capture{Method: "GET", URL: "https://api.example.com/v1/users/7", RequestHeaders: tenant,
+				ResponseStatus: 200, ResponseHeaders: jsonHdr, ResponseBodyBase64: `{"id":7,"name":"ann","email":null}`},
+		},
+		{
+			name: "literal path preferred over template",
+			c:    Capture{Method: "GET", URL: "https://api.example.com/v1/users/me", ResponseStatus: 200},
+		},
+		{
+			name: "unknown path",
+			c:    Capture{Method: "GET", URL: "https://api.example.com/v1/teams/1", ResponseStatus: 200},
+			want: []string{analysis.ContractUnknownPath},
+		},
+		{
+			name: "outside base path",
+			c:    Capture{Method: "GET", URL: "https://api.example.com/users/7", ResponseStatus: 200},
+			want: []string{analysis.ContractUnknownPath},
+		},
+		{
+			name: "unknown method",
+			c:    Capture{Method: "DELETE", URL: "https://api.example.com/v1/users/7", ResponseStatus: 204},
+			want: []string{analysis.ContractUnknownMethod},
+		},
+		{
+			name: "missing header and invalid path param",
+			c:    Capture{Method: "GET", URL: "https://api.example.com/v1/users/abc", ResponseStatus: 404},
+			want: []string{analysis.ContractInvalidParameter, analysis.ContractMissingParameter},
+		},
+		{
+			name: "response body breaks schema",
+			c: Capture{Method: "GET", URL: "https://api.example.com/v1/users/7", RequestHeaders: tenant,
+				ResponseStatus: 200, ResponseHeaders: jsonHdr, ResponseBodyBase64: `{"id":0,"role":"root","extra":1}`},
+			want: []string{analysis.ContractResponseBody, analysis.ContractResponseBody, analysis.ContractResponseBody, analysis.ContractResponseBody},
+		},
+		{
+			name: "undocumented status",
+			c: Capture{Method: "GET", URL: "https://api.example.com/v1/users/7", RequestHeaders: tenant,
+				ResponseStatus: 500},
+			want: []string{analysis.ContractUndocumentedStatus},
+		},
+		{
+			name: "undocumented content type",
+			c: Capture{Method: "GET", URL: "https://api.example.com/v1/users/7", RequestHeaders: tenant,
+				ResponseStatus: 200, ResponseHeaders: map[string][]string{"Content-Type": {"text/html"}}, ResponseBodyBase64: "<p>hi</p>"},
+			want: []string{analysis.ContractUndocumentedType},
+		},
+		{
+			name: "missing required request body",
+			c:    Capture{Method: "PUT", URL: "https://api.example.com/v1/users/7", ResponseStatus: 204},
+			want: []string{analysis.ContractRequestBody},
+		},
+		{
+			name: "truncated body is not schema checked",
+			c: Capture{Method: "PUT", URL: "https://api.example.com/v1/users/7", RequestHeaders: jsonHdr,
+				RequestBodyBase64: `{"id":`, ReqBodyTruncated: true, ResponseStatus: 204},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.c
+			validateContract(&c)
+			if !c.ContractChecked {
+				t.Fatalf("capture was not checked")
+			}
+			got := contractKinds(c)
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("kinds = %v, want %v (%+v)", got, tc.want, c.ContractViolations)
+			}
+		})
+	}
+
+	other := Capture{Method: "GET", URL: "https://elsewhere.test/x", ResponseStatus: 200}
+	validateContract(&other)
+	if other.ContractChecked || len(other.ContractViolations) != 0 {
+		t.Errorf("hosts without a contract should not be checked: %+v", other)
+	}
+}
+
+func TestValidateContractSkipsTruncatedResponses(t *testing.T) {
+	loadTestContract(t)
+	old := maxStoredBody
+	defer func() { maxStoredBody = old }()
+	maxStoredBody = 16
+
+	body := `{"id":7,"name":"` + strings.Repeat("a", 64) + `"}`
+	c := captureExchange(t, "https://api.example.com/v1/users/7", http.Header{"Content-Type": {"application/json"}}, body)
+	c.RequestHeaders = map[string][]string{"X-Tenant": {"acme"}}
+	validateContract(&c)
+	if !c.ContractChecked || len(c.ContractViolations) != 0 {
+		t.Fatalf("truncated JSON response reported as violating: %+v", c.ContractViolations)
+	}
+}
+
+func TestParseContractRejectsNonOpenAPI3(t *testing.T) {
+	if _, err := parseContract("h", "", []byte(`{"swagger":"2.0"}`)); err == nil {
+		t.Error("expected swagger 2.0 to be rejected")
+	}
+	if _, err := parseContract("h", "", []byte("swagger: \"2.0\"\n")); err == nil {
+		t.Error("expected swagger 2.0 YAML to be rejected")
+	}
+}
+
+func TestParseContractAcceptsYAML(t *testing.T) {
+	spec, err := parseContract("h", "", []byte(`openapi: 3.0.3
+info: {title: Users, version: "1"}
+paths:
+  /users/{id}:
+    get:
+      responses:
+        200:
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id: {type: integer, maximum: 9007199254740993}
+`))
+	if err != nil {
+		t.Fatalf("parseContract: %v", err)
+	}
+	if info := spec.info(); info.Title != "Users" || info.Operations != 1 {
+		t.Fatalf("info = %+v", info)
+	}
+	c := Capture{Method: "GET", URL: "https://h/users/7", ResponseStatus: 200,
+		ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}}, ResponseBodyBase64: `{"name":"x"}`}
+	old := contracts
+	contracts = newContractStore()
+	contracts.set(spec)
+	defer func() { contracts = old }()
+	if validateContract(&c); len(c.ContractViolations) != 1 || c.ContractViolations[0].Kind != analysis.ContractResponseBody {
+		t.Fatalf("violations = %+v", c.ContractViolations)
+	}
+
+	// Bodies over maxContractBody are not decoded.
+	c.ResponseBodyBase64 = `{"name":"` + strings.Repeat("x", maxContractBody) + `"}`
+	if validateContract(&c); !c.ContractChecked || len(c.ContractViolations) != 0 {
+		t.Fatalf("oversized body validated: %+v", c.ContractViolations)
+	}
+}
+
+func TestContractsAPI(t *testing.T) {
+	old := contracts
+	contracts = newContractStore()
+	defer func() { contracts = old }()
+
+	h := buildUIHandler(newCaptureStore(10), &ruleStore{}, newSseBroker(), newSearchStore(10))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/contracts/api.example.com", strings.NewReader(testContract)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"operations":3`) {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/contracts", nil))
+	if !strings.Contains(rec.Body.String(), `"host":"api.example.com"`) {
+		t.Fatalf("GET: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/contracts/api.example.com", nil))
+	if rec.Code != http.StatusNoContent || contracts.lookup("api.example.com") != nil {
+		t.Fatalf("DELETE: %d", rec.Code)
+	}
+}
+
+func TestBrokerPublishEvent(t *testing.T) {
+	b := newSseBroker()
+	ch := b.addClient()
+	defer b.removeClient(ch)
+
+	b.publishEvent("contract", contractEvent{CaptureID: 3})
+	m := <-ch
+	if m.name != "contract" {
+		t.Fatalf("event name = %q", m.name)
+	}
+	if ev, ok := m.data.(contractEvent); !ok || ev.CaptureID != 3 {
+		t.Fatalf("payload = %#v", m.data)
+	}
+}
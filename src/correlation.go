@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Correlation settings (configured from flags in main).
+var (
+	correlationHeader       = "X-Breakout-Capture-Id"
+	injectCorrelation       = false
+	adoptCorrelationHeaders = []string{"X-Request-Id", "X-Correlation-Id", "traceparent"}
+)
+
+// traceContext is a parsed W3C traceparent header.
+type traceContext struct {
+	TraceID  string // 32 lowercase hex
+	ParentID string // 16 lowercase hex: span ID of the caller that sent the request
+	Flags    string // 2 hex, e.g. "01" = sampled
+}
+
+// parseTraceparent parses a W3C traceparent value
+// ("00-<32 hex trace-id>-<16 hex parent-id>-<2 hex flags>"). Invalid or
+// all-zero IDs are rejected.
+func parseTraceparent(v string) (traceContext, bool) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(v)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceContext{}, false
+	}
+	if parts[0] == "ff" {
+		return traceContext{}, false
+	}
+	for _, p := range parts[:4] {
+		if _, err := hex.DecodeString(p); err != nil {
+			return traceContext{}, false
+		}
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return traceContext{}, false
+	}
+	return traceContext{TraceID: parts[1], ParentID: parts[2], Flags: parts[3]}, true
+}
+
+// newCorrelationID returns a random 128-bit hex identifier.
+func newCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// assignCorrelation picks the correlation ID for an outgoing request. An ID
+// already carried by the request (our own header, then the adopt list) wins;
+// otherwise, when injection is enabled, a fresh ID is stamped onto the request
+// so it reaches the origin and shows up in backend logs.
+func assignCorrelation(r *http.Request) (correlationID, traceID string) {
+	if tc, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		traceID = tc.TraceID
+	}
+
+	candidates := append([]string{correlationHeader}, adoptCorrelationHeaders...)
+	for _, h := range candidates {
+		if h == "" {
+			continue
+		}
+		v := strings.TrimSpace(r.Header.Get(h))
+		if v == "" {
+			continue
+		}
+		if strings.EqualFold(h, "traceparent") {
+			if traceID == "" {
+				continue
+			}
+			v = traceID
+		}
+		return v, traceID
+	}
+
+	if injectCorrelation && correlationHeader != "" {
+		if id := newCorrelationID(); id != "" {
+			r.Header.Set(correlationHeader, id)
+			return id, traceID
+		}
+	}
+	return "", traceID
+}
+
+// correlationGroup links captures that share a trace ID or correlation ID.
+type correlationGroup struct {
+	Key            string    `json:"key"`
+	TraceID        string    `json:"trace_id,omitempty"`
+	CorrelationIDs []string  `json:"correlation_ids,omitempty"`
+	CaptureIDs     []int64   `json:"capture_ids"`
+	Hosts          []string  `json:"hosts,omitempty"`
+	Count          int       `json:"count"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// groupByCorrelation groups captures by trace ID (falling back to the
+// correlation ID) and returns groups with at least minCount captures, most
+// recent first.
+func groupByCorrelation(caps []Capture, minCount int) []correlationGroup {
+	byKey := make(map[string]*correlationGroup)
+	seenCorr := make(map[string]map[string]struct{})
+	seenHost := make(map[string]map[string]struct{})
+
+	for _, c := range caps {
+		key := c.TraceID
+		if key == "" {
+			key = c.CorrelationID
+		}
+		if key == "" {
+			continue
+		}
+		g, ok := byKey[key]
+		if !ok {
+			g = &correlationGroup{Key: key, TraceID: c.TraceID, FirstSeen: c.Time, LastSeen: c.Time}
+			byKey[key] = g
+			seenCorr[key] = make(map[string]struct{})
+			seenHost[key] = make(map[string]struct{})
+		}
+		g.CaptureIDs = append(g.CaptureIDs, c.ID)
+		g.Count++
+		if c.Time.Before(g.FirstSeen) {
+			g.FirstSeen = c.Time
+		}
+		if c.Time.After(g.LastSeen) {
+			g.LastSeen = c.Time
+		}
+		if c.CorrelationID != "" && c.CorrelationID != key {
+			if _, dup := seenCorr[key][c.CorrelationID]; !dup {
+				seenCorr[key][c.CorrelationID] = struct{}{}
+				g.CorrelationIDs = append(g.CorrelationIDs, c.CorrelationID)
+			}
+		}
+		if h := captureHost(c); h != "" {
+			if _, dup := seenHost[key][h]; !dup {
+				seenHost[key][h] = struct{}{}
+				g.Hosts = append(g.Hosts, h)
+			}
+		}
+	}
+
+	out := make([]correlationGroup, 0, len(byKey))
+	for _, g := range byKey {
+		if g.Count < minCount {
+			continue
+		}
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// captureHost returns the host[:port] of a capture's URL.
+func captureHost(c Capture) string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
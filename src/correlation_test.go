@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		in     string
+		trace  string
+		parent string
+		ok     bool
+	}{
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", "", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", false},
+		{"00-xyz-00f067aa0ba902b7-01", "", "", false},
+		{"garbage", "", "", false},
+	}
+	for _, tt := range tests {
+		tc, ok := parseTraceparent(tt.in)
+		if ok != tt.ok || tc.TraceID != tt.trace || tc.ParentID != tt.parent {
+			t.Errorf("parseTraceparent(%q) = %#v, %v; want trace=%q parent=%q ok=%v", tt.in, tc, ok, tt.trace, tt.parent, tt.ok)
+		}
+	}
+}
+
+func TestAssignCorrelationAdoptAndInject(t *testing.T) {
+	oldInject := injectCorrelation
+	defer func() { injectCorrelation = oldInject }()
+
+	// Existing X-Request-Id is adopted as-is.
+	r, _ := http.NewRequest("GET", "http://example.com/", nil)
+	r.Header.Set("X-Request-Id", "req-123")
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	corr, trace := assignCorrelation(r)
+	if corr != "req-123" || trace != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("adopt: got corr=%q trace=%q", corr, trace)
+	}
+
+	// traceparent alone is adopted as its trace-id.
+	r, _ = http.NewRequest("GET", "http://example.com/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if corr, _ := assignCorrelation(r); corr != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("traceparent adopt: got %q", corr)
+	}
+
+	// Nothing to adopt and injection disabled.
+	injectCorrelation = false
+	r, _ = http.NewRequest("GET", "http://example.com/", nil)
+	if corr, _ := assignCorrelation(r); corr != "" {
+		t.Fatalf("expected no correlation ID, got %q", corr)
+	}
+
+	// Injection stamps the configured header.
+	injectCorrelation = true
+	r, _ = http.NewRequest("GET", "http://example.com/", nil)
+	corr, _ = assignCorrelation(r)
+	if len(corr) != 32 || r.Header.Get(correlationHeader) != corr {
+		t.Fatalf("expected injected 32-hex ID in %s, got %q / %q", correlationHeader, corr, r.Header.Get(correlationHeader))
+	}
+}
+
+func TestGroupByCorrelationAndStoreLookup(t *testing.T) {
+	store := newCaptureStore(8)
+	t0 := time.Unix(100, 0)
+	store.add(Capture{Time: t0, URL: "http://a.example/x", TraceID: "t1", CorrelationID: "c1"})
+	store.add(Capture{Time: t0.Add(time.Second), URL: "http://b.example/y", TraceID: "t1", CorrelationID: "c2"})
+	store.add(Capture{Time: t0.Add(2 * time.Second), URL: "http://a.example/z", CorrelationID: "solo"})
+
+	groups := groupByCorrelation(store.list(), 2)
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group with min=2, got %d", len(groups))
+	}
+	g := groups[0]
+	if g.Key != "t1" || g.Count != 2 || len(g.Hosts) != 2 || len(g.CorrelationIDs) != 2 {
+		t.Fatalf("unexpected group: %#v", g)
+	}
+
+	if got := store.byCorrelation("c2"); len(got) != 1 || got[0].URL != "http://b.example/y" {
+		t.Fatalf("byCorrelation(c2) = %#v", got)
+	}
+	if got := store.byCorrelation("t1"); len(got) != 2 {
+		t.Fatalf("byCorrelation(t1) returned %d captures, want 2", len(got))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// coverageReportTmpl renders the coverage snapshot as a self-contained page
+// (no scripts or external assets) so it can be saved next to test results.
+var coverageReportTmpl = template.Must(template.New("coverage").Funcs(template.FuncMap{
+	"pct":  func(r float64) string { return fmt.Sprintf("%.1f%%", r*100) },
+	"join": func(v []string) string { return strings.Join(v, ", ") },
+}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>API coverage</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 28px; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+tr.miss td { background: #fff3f3; }
+.small { color: #666; font-size: 12px; }
+code { font-family: ui-monospace, Menlo, monospace; }
+</style>
+</head>
+<body>
+<h1>API coverage</h1>
+{{if not .}}<p>No contracts loaded. Load one with <code>-contract host=openapi.json</code> or <code>PUT /api/contracts/{host}</code>.</p>{{end}}
+{{range .}}
+<h2>{{.Host}}{{.BasePath}}</h2>
+<p>{{.Covered}} of {{.Operations}} operations exercised ({{pct .Ratio}})</p>
+<table>
+<thead><tr><th>Method</th><th>Path</th><th>Hits</th><th>Statuses seen</th><th>Declared, not seen</th><th>Undeclared</th><th>Parameters</th></tr></thead>
+<tbody>
+{{range .Ops}}
+<tr{{if eq .Hits 0}} class="miss"{{end}}>
+<td>{{.Method}}</td>
+<td><code>{{.Path}}</code>{{if .OperationID}}<div class="small">{{.OperationID}}</div>{{end}}</td>
+<td>{{.Hits}}</td>
+<td>{{range $code, $n := .SeenStatuses}}{{$code}}×{{$n}} {{end}}</td>
+<td>{{join .UncoveredStatuses}}</td>
+<td>{{join .UndeclaredStatuses}}</td>
+<td>{{range .Params}}<div><code>{{.Name}}</code> <span class="small">{{.In}}{{if .Required}}, required{{end}}</span> ×{{.Hits}}{{if .Enum}} <span class="small">enum missing: {{if .EnumMissing}}{{join .EnumMissing}}{{else}}none{{end}}</span>{{end}}</div>{{end}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// GET /api/coverage[?host=<host>]      -> []CoverageSnapshot (JSON)
+// GET /api/coverage.html[?host=<host>] -> the same report as a static page
+func handleCoverageReport(w http.ResponseWriter, r *http.Request) {
+	if isVerbose() {
+		log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method", http.StatusMethodNotAllowed)
+		return
+	}
+	cov := analysisRegistry.Coverage()
+	if cov == nil {
+		http.Error(w, "coverage analyzer not available", http.StatusServiceUnavailable)
+		return
+	}
+	snap := cov.Snapshot(r.URL.Query().Get("host"))
+	if snap == nil {
+		snap = []analysis.CoverageSnapshot{}
+	}
+	if strings.HasSuffix(r.URL.Path, ".html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := coverageReportTmpl.Execute(w, snap); err != nil {
+			log.Printf("coverage report: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(snap)
+}
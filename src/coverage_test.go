@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+func TestCoverageReportReplaysStoredCaptures(t *testing.T) {
+	oldReg, oldContracts := analysisRegistry, contracts
+	defer func() { analysisRegistry, contracts = oldReg, oldContracts }()
+	analysisRegistry = analysis.NewDefaultRegistry()
+	contracts = newContractStore()
+
+	store := newCaptureStore(10)
+	store.add(Capture{Method: "GET", URL: "https://api.example.com/v1/users/7", ResponseStatus: 200,
+		RequestHeaders: map[string][]string{"X-Tenant": {"acme"}}})
+
+	spec, err := parseContract("api.example.com", "test", []byte(testContract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installContract(spec, store)
+
+	rec := httptest.NewRecorder()
+	handleCoverageReport(rec, httptest.NewRequest(http.MethodGet, "/api/coverage", nil))
+	var snaps []analysis.CoverageSnapshot
+	if err := json.NewDecoder(rec.Body).Decode(&snaps); err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || snaps[0].Operations != 3 || snaps[0].Covered != 1 {
+		t.Fatalf("unexpected coverage: %+v", snaps)
+	}
+
+	rec = httptest.NewRecorder()
+	handleCoverageReport(rec, httptest.NewRequest(http.MethodGet, "/api/coverage.html", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(body, "1 of 3 operations exercised (33.3%)") ||
+		!strings.Contains(body, "<code>/users/{id}</code>") {
+		t.Fatalf("unexpected html report:\n%s", body)
+	}
+
+	if !uninstallContract("api.example.com") || len(analysisRegistry.Coverage().Snapshot("")) != 0 {
+		t.Errorf("uninstall should drop coverage")
+	}
+}
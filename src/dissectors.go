@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"strings"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// bodyDissector extracts an RPC-level summary from a finished capture.
+// RPC-over-HTTP protocols (JSON-RPC, SOAP) tunnel every call through one URL,
+// so the dissected method is what gives per-route analysis its meaning.
+type bodyDissector interface {
+	Name() string
+	// Dissect returns nil when the capture is not this dissector's protocol.
+	Dissect(c *Capture) *RPCSample
+}
+
+// bodyDissectors are tried in order; the first non-nil result wins.
+var bodyDissectors = []bodyDissector{
+	jsonRPCDissector{},
+	soapDissector{},
+}
+
+// dissectCapture runs the dissector chain against a capture.
+func dissectCapture(c *Capture) *RPCSample {
+	if c == nil || c.GRPC != nil {
+		return nil
+	}
+	for _, d := range bodyDissectors {
+		if s := d.Dissect(c); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// rpcRoutePath derives the logical route path for an RPC call, e.g.
+// "/rpc#eth_getBalance". Non-RPC captures keep the plain path.
+func rpcRoutePath(path string, rpc *RPCSample) string {
+	if rpc == nil || rpc.Method == "" {
+		return path
+	}
+	return path + "#" + rpc.Method
+}
+
+// rpcOutcome refines an HTTP outcome with the RPC result. JSON-RPC errors and
+// SOAP Faults are frequently sent with 200 (or a generic 500), so the fault
+// code decides whether the caller or the server is to blame.
+func rpcOutcome(base analysis.Outcome, rpc *RPCSample) analysis.Outcome {
+	if rpc == nil || !rpc.Fault {
+		return base
+	}
+	if base == analysis.Outcome4xx || base == analysis.OutcomeNetworkError {
+		return base
+	}
+	if rpc.isClientFault() {
+		return analysis.Outcome4xx
+	}
+	return analysis.Outcome5xx
+}
+
+// isClientFault reports whether the fault blames the caller.
+func (s *RPCSample) isClientFault() bool {
+	switch s.Protocol {
+	case "jsonrpc":
+		switch s.ErrorCode {
+		case -32700, -32600, -32601, -32602: // parse error, invalid request, method not found, invalid params
+			return true
+		}
+		return false
+	case "soap":
+		code := s.FaultCode
+		if i := strings.LastIndex(code, ":"); i >= 0 {
+			code = code[i+1:]
+		}
+		// SOAP 1.1 "Client", SOAP 1.2 "Sender" (may be dotted, e.g. Client.Auth)
+		code = strings.ToLower(code)
+		return strings.HasPrefix(code, "client") || strings.HasPrefix(code, "sender")
+	}
+	return false
+}
+
+// headerValue returns the first value of a header from a capture header map.
+func headerValue(h map[string][]string, name string) string {
+	if h == nil {
+		return ""
+	}
+	for k, v := range h {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+//
+// JSON-RPC 2.0
+//
+
+type jsonRPCDissector struct{}
+
+type jsonRPCMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (jsonRPCDissector) Name() string { return "jsonrpc" }
+
+func (jsonRPCDissector) Dissect(c *Capture) *RPCSample {
+	reqs, reqBatch := decodeJSONRPC(c.RequestBodyBase64)
+	if len(reqs) == 0 {
+		return nil
+	}
+	s := &RPCSample{Protocol: "jsonrpc"}
+	if reqBatch {
+		s.Batch = len(reqs)
+	}
+	s.Method = reqs[0].Method
+	for _, m := range reqs[1:] {
+		if m.Method != s.Method {
+			// Mixed batches collapse into one logical route.
+			s.Method = "batch"
+			break
+		}
+	}
+	s.ID = jsonRPCID(reqs[0].ID)
+
+	resps, _ := decodeJSONRPC(c.ResponseBodyBase64)
+	for _, m := range resps {
+		if m.Error != nil {
+			s.Fault = true
+			s.ErrorCode = m.Error.Code
+			s.FaultMsg = m.Error.Message
+			break
+		}
+	}
+	return s
+}
+
+// decodeJSONRPC parses a single JSON-RPC message or a batch. Only messages
+// that declare "jsonrpc": "2.0" are returned.
+func decodeJSONRPC(body string) ([]jsonRPCMessage, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, false
+	}
+	var batch bool
+	var msgs []jsonRPCMessage
+	switch body[0] {
+	case '{':
+		var m jsonRPCMessage
+		if err := json.Unmarshal([]byte(body), &m); err != nil {
+			return nil, false
+		}
+		msgs = []jsonRPCMessage{m}
+	case '[':
+		if err := json.Unmarshal([]byte(body), &msgs); err != nil {
+			return nil, false
+		}
+		batch = true
+	default:
+		return nil, false
+	}
+	out := msgs[:0]
+	for _, m := range msgs {
+		if m.JSONRPC == "2.0" {
+			out = append(out, m)
+		}
+	}
+	return out, batch
+}
+
+// jsonRPCID stringifies a JSON-RPC id (string, number, or null).
+func jsonRPCID(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+//
+// SOAP 1.1 / 1.2
+//
+
+type soapDissector struct{}
+
+func (soapDissector) Name() string { return "soap" }
+
+func (soapDissector) Dissect(c *Capture) *RPCSample {
+	action := strings.Trim(headerValue(c.RequestHeaders, "SOAPAction"), `" `)
+	ct := headerValue(c.RequestHeaders, "Content-Type")
+	mt, params, _ := mime.ParseMediaType(ct)
+	if action == "" && mt == "application/soap+xml" {
+		// SOAP 1.2 carries the action as a media type parameter.
+		action = strings.Trim(params["action"], `"`)
+	}
+	if action == "" && mt != "application/soap+xml" && !looksLikeSOAP(c.RequestBodyBase64) {
+		return nil
+	}
+
+	op, _ := soapBodyElement(c.RequestBodyBase64)
+	if op == "" && action == "" {
+		return nil
+	}
+	s := &RPCSample{Protocol: "soap", Method: op}
+	if s.Method == "" && action != "" {
+		s.Method = soapActionName(action)
+	}
+
+	if _, fault := soapBodyElement(c.ResponseBodyBase64); fault != nil {
+		s.Fault = true
+		s.FaultCode = fault.code
+		s.FaultMsg = fault.message
+	}
+	return s
+}
+
+// looksLikeSOAP is a cheap pre-check before running the XML decoder.
+func looksLikeSOAP(body string) bool {
+	head := body
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return strings.Contains(head, "Envelope") && strings.Contains(head, "<")
+}
+
+// soapActionName reduces a SOAPAction URI to its operation name.
+func soapActionName(action string) string {
+	if i := strings.LastIndexAny(action, "/#"); i >= 0 && i < len(action)-1 {
+		return action[i+1:]
+	}
+	return action
+}
+
+type soapFault struct {
+	code    string
+	message string
+}
+
+// soapBodyElement returns the local name of the first element inside
+// Envelope/Body. When that element is a Fault, its code and message are
+// returned as well.
+func soapBodyElement(body string) (string, *soapFault) {
+	if !looksLikeSOAP(body) {
+		return "", nil
+	}
+	dec := xml.NewDecoder(strings.NewReader(body))
+	dec.Strict = false
+
+	var stack []string
+	var name string
+	var fault *soapFault
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err != io.EOF && name == "" {
+				return "", nil
+			}
+			return name, fault
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			text.Reset()
+			if name == "" && len(stack) == 3 && stack[0] == "Envelope" && stack[1] == "Body" {
+				name = t.Name.Local
+				if name == "Fault" {
+					fault = &soapFault{}
+				} else {
+					return name, nil
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if fault != nil {
+				v := strings.TrimSpace(text.String())
+				switch t.Name.Local {
+				case "faultcode", "Value":
+					if fault.code == "" {
+						fault.code = v
+					}
+				case "faultstring", "Text":
+					if fault.message == "" {
+						fault.message = v
+					}
+				case "Fault":
+					return name, fault
+				}
+			}
+			text.Reset()
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
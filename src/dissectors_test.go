@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+func TestJSONRPCDissectorSingleCallWithError(t *testing.T) {
+	c := &Capture{
+		Method:             "POST",
+		RequestBodyBase64:  `{"jsonrpc":"2.0","method":"eth_getBalance","params":["0x1"],"id":7}`,
+		ResponseBodyBase64: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"invalid params"},"id":7}`,
+	}
+
+	s := dissectCapture(c)
+	if s == nil {
+		t.Fatalf("expected JSON-RPC sample, got nil")
+	}
+	if s.Protocol != "jsonrpc" || s.Method != "eth_getBalance" || s.ID != "7" {
+		t.Fatalf("unexpected sample: %#v", s)
+	}
+	if !s.Fault || s.ErrorCode != -32602 || s.FaultMsg != "invalid params" {
+		t.Fatalf("expected error to be recorded, got %#v", s)
+	}
+	if got := rpcOutcome(analysis.Outcome2xx, s); got != analysis.Outcome4xx {
+		t.Fatalf("rpcOutcome = %v, want %v", got, analysis.Outcome4xx)
+	}
+	if got := rpcRoutePath("/rpc", s); got != "/rpc#eth_getBalance" {
+		t.Fatalf("rpcRoutePath = %q", got)
+	}
+}
+
+func TestJSONRPCDissectorBatch(t *testing.T) {
+	c := &Capture{
+		RequestBodyBase64: `[{"jsonrpc":"2.0","method":"a","id":"x"},{"jsonrpc":"2.0","method":"b","id":2}]`,
+		ResponseBodyBase64: `[{"jsonrpc":"2.0","result":1,"id":"x"},` +
+			`{"jsonrpc":"2.0","error":{"code":-32000,"message":"boom"},"id":2}]`,
+	}
+
+	s := dissectCapture(c)
+	if s == nil || s.Batch != 2 || s.Method != "batch" || s.ID != "x" {
+		t.Fatalf("unexpected batch sample: %#v", s)
+	}
+	if got := rpcOutcome(analysis.Outcome2xx, s); got != analysis.Outcome5xx {
+		t.Fatalf("server error should classify as 5xx, got %v", got)
+	}
+}
+
+func TestJSONRPCDissectorIgnoresPlainJSON(t *testing.T) {
+	c := &Capture{RequestBodyBase64: `{"method":"not-rpc"}`}
+	if s := dissectCapture(c); s != nil {
+		t.Fatalf("expected nil for non JSON-RPC body, got %#v", s)
+	}
+}
+
+func TestSOAPDissectorOperationAndFault(t *testing.T) {
+	c := &Capture{
+		RequestHeaders: map[string][]string{
+			"Content-Type": {"text/xml; charset=utf-8"},
+			"Soapaction":   {`"http://example.com/Svc/GetQuote"`},
+		},
+		RequestBodyBase64: `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header/>
+  <soap:Body><m:GetQuoteRequest xmlns:m="urn:q"><m:Symbol>ACME</m:Symbol></m:GetQuoteRequest></soap:Body>
+</soap:Envelope>`,
+		ResponseBodyBase64: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body><soap:Fault><faultcode>soap:Client</faultcode><faultstring>bad symbol</faultstring></soap:Fault></soap:Body>
+</soap:Envelope>`,
+	}
+
+	s := dissectCapture(c)
+	if s == nil || s.Protocol != "soap" {
+		t.Fatalf("expected SOAP sample, got %#v", s)
+	}
+	if s.Method != "GetQuoteRequest" {
+		t.Fatalf("Method = %q, want body element name", s.Method)
+	}
+	if !s.Fault || s.FaultCode != "soap:Client" || s.FaultMsg != "bad symbol" {
+		t.Fatalf("unexpected fault info: %#v", s)
+	}
+	if got := rpcOutcome(analysis.Outcome5xx, s); got != analysis.Outcome4xx {
+		t.Fatalf("client fault should classify as 4xx, got %v", got)
+	}
+}
+
+func TestSOAP12ActionFallback(t *testing.T) {
+	c := &Capture{
+		RequestHeaders: map[string][]string{
+			"Content-Type": {`application/soap+xml; charset=utf-8; action="urn:svc#Ping"`},
+		},
+		RequestBodyBase64: "<not-xml",
+		ResponseBodyBase64: `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body>` +
+			`<env:Fault><env:Code><env:Value>env:Receiver</env:Value></env:Code>` +
+			`<env:Reason><env:Text>down</env:Text></env:Reason></env:Fault></env:Body></env:Envelope>`,
+	}
+
+	s := dissectCapture(c)
+	if s == nil || s.Method != "Ping" {
+		t.Fatalf("expected action fallback to Ping, got %#v", s)
+	}
+	if !s.Fault || s.FaultCode != "env:Receiver" || s.FaultMsg != "down" {
+		t.Fatalf("unexpected SOAP 1.2 fault: %#v", s)
+	}
+	if got := rpcOutcome(analysis.Outcome2xx, s); got != analysis.Outcome5xx {
+		t.Fatalf("receiver fault should classify as 5xx, got %v", got)
+	}
+}
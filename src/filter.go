@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server-side port of the UI filter language (ui/js/filter.js,
+// captureMatchesQuery) so the API can select captures with the same queries
+// the search bar and color rules use. Keep the two in sync.
+
+// filterText is a parsed term value: a /regex/flags or lower-cased text.
+type filterText struct {
+	re   *regexp.Regexp
+	text string
+}
+
+var filterRegexTerm = regexp.MustCompile(`^/(.*)/(\w*)$`)
+
+// parseFilterText mirrors parseMaybeRegex. JS flags i, m and s map onto Go
+// inline flags; g and others are ignored. Invalid regexes fall back to text.
+func parseFilterText(term string) filterText {
+	if m := filterRegexTerm.FindStringSubmatch(term); m != nil {
+		var flags string
+		for _, f := range m[2] {
+			if strings.ContainsRune("ims", f) && !strings.ContainsRune(flags, f) {
+				flags += string(f)
+			}
+		}
+		expr := m[1]
+		if flags != "" {
+			expr = "(?" + flags + ")" + expr
+		}
+		if re, err := regexp.Compile(expr); err == nil {
+			return filterText{re: re}
+		}
+	}
+	return filterText{text: strings.ToLower(term)}
+}
+
+func (q filterText) matches(hay string, equals bool) bool {
+	if q.re != nil {
+		return q.re.MatchString(hay)
+	}
+	if equals {
+		return strings.ToLower(hay) == q.text
+	}
+	return strings.Contains(strings.ToLower(hay), q.text)
+}
+
+type headerPair struct{ name, value string }
+
+func headerPairs(h map[string][]string) []headerPair {
+	out := make([]headerPair, 0, len(h))
+	for k, vs := range h {
+		out = append(out, headerPair{k, strings.Join(vs, ", ")})
+	}
+	return out
+}
+
+// matchHeaderPairs mirrors matchHeaderTerm; a nil query matches anything.
+func matchHeaderPairs(pairs []headerPair, name, value *filterText) bool {
+	for _, p := range pairs {
+		if (name == nil || name.matches(p.name, false)) && (value == nil || value.matches(p.value, false)) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHeaderFilter(spec string) (name, value *filterText) {
+	if spec == "" {
+		return nil, nil
+	}
+	n, v, ok := strings.Cut(spec, "=")
+	nq := parseFilterText(n)
+	if !ok {
+		return &nq, nil
+	}
+	vq := parseFilterText(v)
+	return &nq, &vq
+}
+
+// captureFilter is a compiled query; every term must match (AND).
+type captureFilter struct {
+	terms []string
+	rules []ColorRule // for color: terms; nil disables them
+}
+
+// compileCaptureFilter prepares query for matching. rules are the color
+// rules consulted by color:<name> terms.
+func compileCaptureFilter(query string, rules []ColorRule) *captureFilter {
+	return &captureFilter{terms: strings.Fields(query), rules: rules}
+}
+
+// ruleName returns the name of the first enabled color rule matching c.
+func (f *captureFilter) ruleName(c *Capture) string {
+	for _, r := range f.rules {
+		q := strings.TrimSpace(r.Query)
+		if !r.Enabled || q == "" {
+			continue
+		}
+		if matchFilterTerms(c, strings.Fields(q), nil) {
+			return strings.ToLower(r.Name)
+		}
+	}
+	return ""
+}
+
+func (f *captureFilter) match(c *Capture) bool {
+	return matchFilterTerms(c, f.terms, f)
+}
+
+// matchFilterTerms evaluates query terms against one capture. withRules is
+// nil when evaluating a color rule itself (ignoreRuleName in the UI).
+func matchFilterTerms(c *Capture, terms []string, withRules *captureFilter) bool {
+	if len(terms) == 0 {
+		return false
+	}
+
+	host := ""
+	if u, err := url.Parse(c.URL); err == nil {
+		host = u.Host
+	}
+	status := strconv.Itoa(c.ResponseStatus)
+	reqBody, respBody := c.RequestBodyBase64, c.ResponseBodyBase64
+	reqHdrs, respHdrs := headerPairs(c.RequestHeaders), headerPairs(c.ResponseHeaders)
+
+	var rule *string
+	ruleName := func() string {
+		if rule == nil {
+			name := withRules.ruleName(c)
+			rule = &name
+		}
+		return *rule
+	}
+
+	for _, term := range terms {
+		var ok bool
+		switch {
+		case strings.HasPrefix(term, "color:") && withRules != nil:
+			ok = parseFilterText(term[6:]).matches(ruleName(), true)
+		case strings.HasPrefix(term, "method:"):
+			ok = parseFilterText(term[7:]).matches(c.Method, true)
+		case strings.HasPrefix(term, "status:"):
+			spec := strings.ToLower(term[7:])
+			if len(spec) == 1 && spec[0] >= '1' && spec[0] <= '5' {
+				ok = strings.HasPrefix(status, spec)
+			} else {
+				ok = parseFilterText(spec).matches(status, false)
+			}
+		case strings.HasPrefix(term, "host:"):
+			ok = parseFilterText(term[5:]).matches(host, true)
+		case strings.HasPrefix(term, "url:"):
+			ok = parseFilterText(term[4:]).matches(c.URL, true)
+		case strings.HasPrefix(term, "body:"):
+			q := parseFilterText(term[5:])
+			ok = q.matches(reqBody, false) || q.matches(respBody, false)
+		case strings.HasPrefix(term, "req.body:"):
+			ok = parseFilterText(term[9:]).matches(reqBody, false)
+		case strings.HasPrefix(term, "resp.body:"):
+			ok = parseFilterText(term[10:]).matches(respBody, false)
+		case strings.HasPrefix(term, "contract:"):
+			spec := term[9:]
+			switch strings.ToLower(spec) {
+			case "violation":
+				ok = len(c.ContractViolations) > 0
+			case "checked":
+				ok = c.ContractChecked
+			case "ok":
+				ok = c.ContractChecked && len(c.ContractViolations) == 0
+			default:
+				q := parseFilterText(spec)
+				for _, v := range c.ContractViolations {
+					if q.matches(v.Kind, true) {
+						ok = true
+						break
+					}
+				}
+			}
+		case strings.HasPrefix(term, "sensitive:"):
+			spec := term[10:]
+			switch strings.ToLower(spec) {
+			case "any":
+				ok = len(c.SensitiveFindings) > 0
+			case "secret", "pii":
+				for _, f := range c.SensitiveFindings {
+					if strings.EqualFold(f.Category, spec) {
+						ok = true
+						break
+					}
+				}
+			default:
+				q := parseFilterText(spec)
+				for _, f := range c.SensitiveFindings {
+					if q.matches(f.Kind, true) {
+						ok = true
+						break
+					}
+				}
+			}
+		case strings.HasPrefix(term, "header:"):
+			n, v := parseHeaderFilter(term[7:])
+			ok = matchHeaderPairs(reqHdrs, n, v) || matchHeaderPairs(respHdrs, n, v)
+		case strings.HasPrefix(term, "req.header:"):
+			n, v := parseHeaderFilter(term[11:])
+			ok = matchHeaderPairs(reqHdrs, n, v)
+		case strings.HasPrefix(term, "resp.header:"):
+			n, v := parseHeaderFilter(term[12:])
+			ok = matchHeaderPairs(respHdrs, n, v)
+		default:
+			// default term: search everywhere
+			q := parseFilterText(term)
+			ok = q.matches(c.URL, false) || q.matches(c.Method, false) || q.matches(status, false) ||
+				q.matches(host, false) || q.matches(reqBody, false) || q.matches(respBody, false) ||
+				matchHeaderPairs(reqHdrs, &q, nil) || matchHeaderPairs(reqHdrs, nil, &q) ||
+				matchHeaderPairs(respHdrs, &q, nil) || matchHeaderPairs(respHdrs, nil, &q)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTimeBound accepts RFC 3339, Unix seconds or milliseconds, or a
+// duration relative to now ("2h" or "-2h" both mean two hours ago).
+func parseTimeBound(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("bad time %q (want RFC 3339, unix seconds or a duration like 2h)", s)
+}
+
+// captureSelection is the subset of stored captures an ad-hoc query asks
+// for. Zero bounds are open.
+type captureSelection struct {
+	filter   *captureFilter // nil = every capture
+	from, to time.Time
+}
+
+func (sel captureSelection) apply(caps []Capture) []Capture {
+	out := caps[:0:0]
+	for i := range caps {
+		c := &caps[i]
+		if c.Deleted {
+			continue
+		}
+		if !sel.from.IsZero() && c.Time.Before(sel.from) {
+			continue
+		}
+		if !sel.to.IsZero() && c.Time.After(sel.to) {
+			continue
+		}
+		if sel.filter != nil && !sel.filter.match(c) {
+			continue
+		}
+		out = append(out, *c)
+	}
+	return out
+}
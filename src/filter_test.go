@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCaptureFilterMatchesUISemantics(t *testing.T) {
+	c := &Capture{
+		Method:             "POST",
+		URL:                "https://api.example.com/auth/login",
+		ResponseStatus:     401,
+		RequestHeaders:     map[string][]string{"Authorization": {"Bearer abc"}},
+		ResponseHeaders:    map[string][]string{"Content-Type": {"application/json"}},
+		RequestBodyBase64:  `{"user":"ann","password":"x"}`,
+		ResponseBodyBase64: `{"error":"denied"}`,
+	}
+	rules := []ColorRule{{Name: "Orange", Query: "status:4", Enabled: true}}
+
+	cases := []struct {
+		q    string
+		want bool
+	}{
+		{"login", true},
+		{"method:post", true},
+		{"method:PO", false}, // prefixed terms are exact
+		{"method:/^po/i", true},
+		{"status:4", true},
+		{"status:40", true},
+		{"status:5", false},
+		{"host:api.example.com", true},
+		{"host:api", false},
+		{"req.body:password", true},
+		{"resp.body:password", false},
+		{`resp.body:/"error"\s*:/i`, true},
+		{"req.header:authorization=bearer", true},
+		{"resp.header:authorization", false},
+		{"header:/^content-/i=/json/", true},
+		{"color:orange", true},
+		{"color:red", false},
+		{"login status:401 method:POST", true},
+		{"login status:200", false},
+		{"contract:violation", false},
+		{"sensitive:any", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		if got := compileCaptureFilter(tc.q, rules).match(c); got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for in, want := range map[string]time.Time{
+		"2024-05-01T10:00:00Z": time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		"1714557600":           time.Unix(1714557600, 0),
+		"1714557600000":        time.UnixMilli(1714557600000),
+		"-2h":                  now.Add(-2 * time.Hour),
+		"30m":                  now.Add(-30 * time.Minute),
+	} {
+		got, err := parseTimeBound(in, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("%q: got %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseTimeBound("yesterday", now); err == nil {
+		t.Error("expected error for unparseable bound")
+	}
+}
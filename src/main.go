@@ -21,6 +21,17 @@ var (
 	maxStoredEntries = 1000    // circular buffer size
 )
 
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func setVerbose(b bool) { verbose.Store(b) }
 func isVerbose() bool   { return verbose.Load() }
 func isPaused() bool    { return paused.Load() }
@@ -29,6 +40,7 @@ type PersistedData struct {
 	Captures    []Capture    `json:"captures"`
 	ColorRules  []ColorRule  `json:"color_rules,omitempty"`
 	SearchItems []SearchItem `json:"search_history,omitempty"`
+	AlertRules  []AlertRule  `json:"alert_rules,omitempty"`
 }
 
 func main() {
@@ -41,6 +53,30 @@ func main() {
 		maxBody    = flag.Int("max-body", maxStoredBody, "maximum bytes to store/display per request/response body")
 		bufferSize = flag.Int("buffer-size", maxStoredEntries, "circular buffer capacity for captured entries")
 		verbose    = flag.Bool("v", false, "enable verbose logging")
+		corrHeader = flag.String("correlation-header", correlationHeader, "header used to stamp/recognize per-capture correlation IDs")
+		corrInject = flag.Bool("inject-correlation", false, "stamp requests without an adoptable ID with a unique correlation header")
+		corrAdopt  = flag.String("adopt-correlation", strings.Join(adoptCorrelationHeaders, ","), "comma-separated request headers to adopt as the correlation ID (empty = none)")
+		otlpURL    = flag.String("otlp-endpoint", "", "OTLP collector endpoint for span export, e.g. http://localhost:4318 (empty = disabled)")
+		otlpProto  = flag.String("otlp-protocol", otlpProtocolHTTPProtobuf, "OTLP transport: http/protobuf, http/json or grpc")
+		otlpHdrs   = flag.String("otlp-headers", "", "comma-separated key=value headers sent with every OTLP export")
+		otlpSvc    = flag.String("otlp-service", "http-breakout-proxy", "service.name resource attribute on exported spans")
+		otlpBatch  = flag.Int("otlp-batch", 256, "maximum spans per OTLP export request")
+		otlpFlush  = flag.Duration("otlp-flush", 5*time.Second, "maximum delay before a partial OTLP batch is sent")
+		otlpRetry  = flag.Int("otlp-retries", 5, "retries per OTLP batch on transient collector errors")
+		templating = flag.Bool("route-templating", true, "normalize analysis routes into path templates (/users/123 -> /users/{id})")
+		routeTmpls = flag.String("route-templates", "", "comma-separated route template overrides, e.g. /repos/{owner}/{repo},/static/** (matched first)")
+		contractFl = flag.String("contract", "", "comma-separated host=openapi.json pairs; captures to that host are validated against the contract")
+		analysisFl = flag.String("analysis-config", "", "JSON file enabling, disabling and tuning analyzers, e.g. {\"analyzers\": {\"schema\": {\"enabled\": false}}}")
+		analyzers  = flag.String("analyzers", "", "comma-separated analyzer overrides applied after -analysis-config: name, -name, name.param=value (e.g. -schema,retry.window=10s)")
+		maxEntries = flag.Int("analysis-max-entries", analysis.DefaultLimits.MaxEntries, "maximum keys (routes, clients, ...) each analyzer tracks; the least recently updated is evicted (0 = unlimited)")
+		maxAge     = flag.Duration("analysis-max-age", 0, "drop analyzer keys not updated within this sliding window, e.g. 1h (0 = keep forever)")
+		workers    = flag.Int("analysis-workers", 4, "goroutines applying captures to the analyzers off the proxy path (0 = analyze inline)")
+		queueSize  = flag.Int("analysis-queue", 4096, "captures queued for analysis across all workers")
+		queueFull  = flag.String("analysis-queue-policy", "drop", "when the analysis queue is full: drop (count and skip) or block (slow the proxy down)")
+		reorder    = flag.Duration("analysis-reorder-window", 250*time.Millisecond, "hold captures this long so each client's captures reach the analyzers in timestamp order")
+		alertEvery = flag.Duration("alert-interval", 5*time.Second, "how often threshold alert rules are evaluated (0 = only match rules fire)")
+		alertExec  = flag.Bool("alert-exec", false, "allow alert rules with exec sinks, which run local commands")
+		maxRoutes  = flag.Int("metrics-max-routes", metricsMaxRoutes, "maximum distinct routes/clients exported on /metrics; the rest fold into \"other\" (0 = unlimited)")
 	)
 	flag.Parse()
 
@@ -52,6 +88,45 @@ func main() {
 	}
 
 	maxStoredBody = *maxBody
+	correlationHeader = strings.TrimSpace(*corrHeader)
+	injectCorrelation = *corrInject
+	adoptCorrelationHeaders = splitList(*corrAdopt)
+	metricsMaxRoutes = *maxRoutes
+	if *templating {
+		SetRouteTemplater(analysis.NewPathTemplater(splitList(*routeTmpls)...))
+	} else {
+		SetRouteTemplater(nil)
+	}
+
+	if err := loadContractFiles(splitList(*contractFl)); err != nil {
+		log.Fatalf("contract: %v", err)
+	}
+	for _, ci := range contracts.list() {
+		log.Printf("Loaded contract for %s from %s (%d operations)", ci.Host, ci.Source, ci.Operations)
+	}
+
+	if *otlpURL != "" {
+		headers := make(map[string]string)
+		for _, kv := range splitList(*otlpHdrs) {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+		exp, err := newOTLPExporter(otlpConfig{
+			Endpoint:      *otlpURL,
+			Protocol:      *otlpProto,
+			Headers:       headers,
+			ServiceName:   *otlpSvc,
+			BatchSize:     *otlpBatch,
+			FlushInterval: *otlpFlush,
+			MaxRetries:    *otlpRetry,
+		})
+		if err != nil {
+			log.Fatalf("OTLP exporter: %v", err)
+		}
+		SetSpanExporter(exp)
+		log.Printf("Exporting spans to %s (%s)", *otlpURL, *otlpProto)
+	}
 
 	paused.Store(false)
 
@@ -60,21 +135,64 @@ func main() {
 	rules := &ruleStore{}
 	broker := newSseBroker()
 	searches := newSearchStore(100)
-	analRegistry := analysis.NewDefaultRegistry()
+	if *analysisFl != "" {
+		data, err := os.ReadFile(*analysisFl)
+		if err != nil {
+			log.Fatalf("analysis-config: %v", err)
+		}
+		if analysisConfig, err = analysis.ParseRegistryConfig(data); err != nil {
+			log.Fatalf("analysis-config %s: %v", *analysisFl, err)
+		}
+	}
+	if err := analysisConfig.Apply(*analyzers); err != nil {
+		log.Fatalf("analyzers: %v", err)
+	}
+	analysisConfig.Limits = &analysis.Limits{MaxEntries: *maxEntries, MaxAge: *maxAge}
+	analRegistry, err := analysis.NewRegistryFromConfig(analysisConfig)
+	if err != nil {
+		log.Fatalf("analyzers: %v", err)
+	}
 	SetAnalysisRegistry(analRegistry)
+	SetAnalysisSource(store, rules)
+	if routeTemplater != nil {
+		// Fold routes templated before a segment was learned as a parameter.
+		analRegistry.UseTemplater(routeTemplater)
+		routeTemplater.SetPromoteHandler(func(host string) { analysisRegistry.RetemplateRoutes(host) })
+	}
+	if *workers > 0 {
+		policy, err := analysis.ParseQueuePolicy(*queueFull)
+		if err != nil {
+			log.Fatalf("analysis-queue-policy: %v", err)
+		}
+		SetAnalysisPipeline(analysis.NewPipeline(analRegistry, analysis.PipelineConfig{
+			Workers:       *workers,
+			QueueSize:     *queueSize,
+			Policy:        policy,
+			ReorderWindow: *reorder,
+		}))
+	}
+	registerContractCoverage()
 
 	// Persistence
 	persistPath := *persist
 	if persistPath != "" {
-		if caps, crs, err := loadAll(persistPath); err == nil {
-			log.Printf("Loaded %d captures and %d color rules from %s", len(caps), len(crs), persistPath)
-			// populate capture store
-			for _, c := range caps {
-				_ = store.add(c) // or store.populateFromSlice if you have it
+		if caps, crs, ars, err := loadAll(persistPath); err == nil {
+			log.Printf("Loaded %d captures, %d color rules and %d alert rules from %s", len(caps), len(crs), len(ars), persistPath)
+			// populate capture store; captures saved before the sensitive
+			// data scanner existed are scanned once here and saved that way
+			for i := range caps {
+				if !caps[i].SensitiveScanned {
+					scanSensitive(&caps[i])
+				}
+				_ = store.add(caps[i]) // or store.populateFromSlice if you have it
 			}
 			// populate rules
 			rules.replace(crs)
+			if err := alerting.replace(ars); err != nil {
+				log.Printf("Warning: alert rules in %s not loaded: %v", persistPath, err)
+			}
 			// build analysis registry from persisted captures
+			relearnRouteTemplates(caps)
 			RebuildAnalysisFromCaptures(analRegistry, caps)
 		} else if !os.IsNotExist(err) {
 			log.Printf("Warning: failed to load %s: %v", persistPath, err)
@@ -87,7 +205,7 @@ func main() {
 			ticker := time.NewTicker(5 * time.Second)
 			defer ticker.Stop()
 			for range ticker.C {
-				if err := saveAll(persistPath, store.list(), rules.getAll()); err != nil {
+				if err := saveAll(persistPath, store.list(), rules.getAll(), alerting.getAll()); err != nil {
 					log.Printf("Error saving %s: %v", persistPath, err)
 				}
 			}
@@ -99,7 +217,9 @@ func main() {
 			signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
 			<-sigc
 			log.Printf("Shutting down: saving %s", persistPath)
-			if err := saveAll(persistPath, store.list(), rules.getAll()); err != nil {
+			analysisPipeline.Close()
+			closeSpanExporter()
+			if err := saveAll(persistPath, store.list(), rules.getAll(), alerting.getAll()); err != nil {
 				log.Printf("Error saving on shutdown: %v", err)
 			}
 			os.Exit(0)
@@ -111,14 +231,36 @@ func main() {
 			signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
 			<-sigc
 			log.Printf("Shutting down")
+			analysisPipeline.Close()
+			closeSpanExporter()
 			os.Exit(0)
 		}()
 	}
 
+	// Announce payload schema drift to UI clients (after the replay above, so
+	// history does not re-fire).
+	if sd := analRegistry.SchemaDrift(); sd != nil {
+		sd.SetDriftHandler(func(d analysis.SchemaDrift) { broker.publishEvent("schema_drift", d) })
+	}
+	if an := analRegistry.Anomalies(); an != nil {
+		an.SetAnomalyHandler(func(a analysis.Anomaly) { broker.publishEvent("anomaly", a) })
+		// Close windows without traffic too, one step late so that requests
+		// still in flight land in their window first.
+		go func() {
+			for range time.Tick(an.Step) {
+				an.Tick(time.Now().Add(-an.Step))
+			}
+		}()
+	}
+	alerting.publish = broker.publishEvent
+	alerting.allowExec = *alertExec
+	go alerting.run(*alertEvery)
+
 	// Build handlers. Pass relevant flags through where required:
 	uiHandler := buildUIHandler(store, rules, broker, searches)
 	// Pass caDir and maxBody if enableMITM or proxy code needs them.
 	proxyHandler := buildProxyHandler(*mitm, store, broker, *caDir)
+	promHandler := metricsHandler(store, broker)
 
 	// Combined handler: route proxy-style requests to proxy; everything else to UI
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,8 +269,22 @@ func main() {
 			return
 		}
 		switch {
+		case r.URL.Path == "/metrics" && wantsMetricsIndex(r):
+			handleMetricsIndex(w, r)
+		case r.URL.Path == "/metrics":
+			promHandler(w, r)
 		case r.URL.Path == "/metrics/temporal":
 			handleTemporalMetrics(w, r)
+		case r.URL.Path == "/metrics/sensitive":
+			handleSensitiveMetrics(w, r)
+		case r.URL.Path == "/metrics/security/headers":
+			handleSecurityHeaderMetrics(w, r)
+		case r.URL.Path == "/metrics/caching/routes":
+			handleCachingMetrics(w, r)
+		case r.URL.Path == "/metrics/ratelimits":
+			handleRateLimitMetrics(w, r)
+		case r.URL.Path == "/metrics/retries/semantics":
+			handleRetrySemanticsMetrics(w, r)
 		case r.URL.Path == "/metrics/retries":
 			handleRetryMetrics(w, r)
 		case r.URL.Path == "/metrics/latency/routes":
@@ -145,6 +301,26 @@ func main() {
 			handleAuthCookieStability(w, r)
 		case r.URL.Path == "/metrics/response/profile":
 			handleResponseProfileMetrics(w, r)
+		case r.URL.Path == "/metrics/contract/routes":
+			handleContractMetrics(w, r)
+		case r.URL.Path == "/metrics/schema/routes":
+			handleSchemaMetrics(w, r)
+		case r.URL.Path == "/metrics/schema/drift":
+			handleSchemaDriftEvents(w, r)
+		case r.URL.Path == "/metrics/anomalies":
+			handleAnomalyMetrics(w, r)
+		case r.URL.Path == "/metrics/hosts":
+			handleHostHealthMetrics(w, r)
+		case r.URL.Path == "/metrics/concurrency":
+			handleConcurrencyMetrics(w, r)
+		case r.URL.Path == "/metrics/concurrency/timeline":
+			handleConcurrencyTimeline(w, r)
+		case r.URL.Path == "/metrics/capacity":
+			handleAnalysisCapacity(w, r)
+		case r.URL.Path == "/metrics/reset":
+			handleAnalysisReset(w, r)
+		case r.URL.Path == "/metrics/pipeline":
+			handlePipelineMetrics(w, r)
 		case r.URL.Path == "/events",
 			strings.HasPrefix(r.URL.Path, "/api/"),
 			strings.HasSuffix(r.URL.Path, ".js"),
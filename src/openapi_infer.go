@@ -0,0 +1,873 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// OpenAPI inference: walk stored captures and describe the observed API as an
+// OpenAPI 3.1 document. Everything here is derived from traffic, so schemas
+// describe what was seen, not what the service promises.
+
+// maxExampleBytes bounds bodies used as examples in the document.
+const maxExampleBytes = 16 << 10
+
+// oaObject is an insertion-ordered JSON object so the generated document
+// reads top-down (openapi, info, servers, paths, ...) in JSON and YAML alike.
+type oaObject struct {
+	keys []string
+	vals map[string]any
+}
+
+func newOAObject() *oaObject { return &oaObject{vals: make(map[string]any)} }
+
+func (o *oaObject) set(k string, v any) *oaObject {
+	if _, ok := o.vals[k]; !ok {
+		o.keys = append(o.keys, k)
+	}
+	o.vals[k] = v
+	return o
+}
+
+func (o *oaObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		kb, _ := json.Marshal(k)
+		b.Write(kb)
+		b.WriteByte(':')
+		vb, err := json.Marshal(o.vals[k])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(vb)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+//
+// JSON schema inference
+//
+
+// schemaInfer accumulates observed JSON values into a schema.
+type schemaInfer struct {
+	samples  int
+	types    map[string]int // object, array, string, integer, number, boolean, null
+	props    map[string]*schemaInfer
+	order    []string
+	objects  int
+	propHits map[string]int
+	items    *schemaInfer
+	strs     int
+	formats  map[string]int
+	example  any
+	hasEx    bool
+}
+
+func newSchemaInfer() *schemaInfer {
+	return &schemaInfer{types: make(map[string]int)}
+}
+
+// observe merges one decoded JSON value (decoded with UseNumber).
+func (s *schemaInfer) observe(v any) {
+	s.samples++
+	if !s.hasEx {
+		s.example, s.hasEx = v, true
+	}
+	s.types[analysis.JSONType(v)]++
+	switch t := v.(type) {
+	case string:
+		s.strs++
+		if f := stringFormat(t); f != "" {
+			if s.formats == nil {
+				s.formats = make(map[string]int)
+			}
+			s.formats[f]++
+		}
+	case []any:
+		if s.items == nil {
+			s.items = newSchemaInfer()
+		}
+		for _, e := range t {
+			s.items.observe(e)
+		}
+	case map[string]any:
+		s.objects++
+		if s.props == nil {
+			s.props = make(map[string]*schemaInfer)
+			s.propHits = make(map[string]int)
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := s.props[k]
+			if p == nil {
+				p = newSchemaInfer()
+				s.props[k] = p
+				s.order = append(s.order, k)
+			}
+			p.observe(t[k])
+			s.propHits[k]++
+		}
+	}
+}
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// stringFormat detects common OpenAPI string formats.
+func stringFormat(v string) string {
+	switch {
+	case v == "":
+		return ""
+	case uuidRe.MatchString(v):
+		return "uuid"
+	}
+	if _, err := time.Parse(time.RFC3339, v); err == nil {
+		return "date-time"
+	}
+	if _, err := time.Parse("2006-01-02", v); err == nil {
+		return "date"
+	}
+	if strings.Contains(v, "@") && !strings.ContainsAny(v, " <>") {
+		if _, err := mail.ParseAddress(v); err == nil {
+			return "email"
+		}
+	}
+	if u, err := url.Parse(v); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return "uri"
+	}
+	return ""
+}
+
+// schema renders the accumulated observations.
+func (s *schemaInfer) schema() *oaObject {
+	out := newOAObject()
+	types := make([]string, 0, len(s.types))
+	for t := range s.types {
+		types = append(types, t)
+	}
+	// integer is subsumed by number when both were seen
+	if s.types["integer"] > 0 && s.types["number"] > 0 {
+		types = removeString(types, "integer")
+	}
+	sort.Strings(types)
+	switch len(types) {
+	case 0:
+	case 1:
+		out.set("type", types[0])
+	default:
+		out.set("type", types)
+	}
+	if s.strs > 0 && len(s.formats) == 1 {
+		for f, n := range s.formats {
+			if n == s.strs {
+				out.set("format", f)
+			}
+		}
+	}
+	if s.props != nil {
+		props := newOAObject()
+		var required []string
+		for _, k := range s.order {
+			props.set(k, s.props[k].schema())
+			if s.propHits[k] == s.objects {
+				required = append(required, k)
+			}
+		}
+		out.set("properties", props)
+		if len(required) > 0 {
+			out.set("required", required)
+		}
+	}
+	if s.items != nil {
+		if s.items.samples > 0 {
+			out.set("items", s.items.schema())
+		} else {
+			out.set("items", newOAObject())
+		}
+	}
+	return out
+}
+
+func removeString(list []string, v string) []string {
+	out := list[:0]
+	for _, s := range list {
+		if s != v {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+//
+// Parameters
+//
+
+// paramInfer tracks one query, header or path parameter.
+type paramInfer struct {
+	name   string
+	in     string
+	hits   int
+	schema *schemaInfer
+}
+
+// observeScalar records a parameter value, typing numbers and booleans.
+func (p *paramInfer) observeScalar(v string) {
+	p.hits++
+	switch {
+	case v == "true" || v == "false":
+		p.schema.observe(v == "true")
+	default:
+		if _, err := strconv.ParseFloat(v, 64); err == nil && v != "" && !strings.ContainsAny(v, "eEx+") {
+			p.schema.observe(json.Number(v))
+		} else {
+			p.schema.observe(v)
+		}
+	}
+}
+
+// documentedHeader reports whether a request header is worth documenting as
+// a parameter. Transport, content negotiation and credential headers are
+// covered elsewhere (or are noise).
+func documentedHeader(name string) bool {
+	switch strings.ToLower(name) {
+	case "host", "user-agent", "accept", "accept-encoding", "accept-language", "connection",
+		"content-length", "content-type", "content-encoding", "transfer-encoding", "cookie",
+		"authorization", "proxy-authorization", "proxy-connection", "te", "upgrade", "keep-alive",
+		"cache-control", "pragma", "origin", "referer", "if-none-match", "if-modified-since",
+		"traceparent", "tracestate", "x-forwarded-for", "x-forwarded-proto", "x-forwarded-host",
+		"sec-fetch-site", "sec-fetch-mode", "sec-fetch-dest", "sec-fetch-user",
+		"sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "upgrade-insecure-requests", "dnt":
+		return false
+	}
+	return !strings.EqualFold(name, correlationHeader)
+}
+
+//
+// Operations
+//
+
+type mediaInfer struct {
+	schema  *schemaInfer
+	example any
+	hasEx   bool
+	nonJSON int
+}
+
+type responseInfer struct {
+	count   int
+	content map[string]*mediaInfer
+	headers map[string]int
+}
+
+type operationInfer struct {
+	method    string
+	path      string
+	count     int
+	params    map[string]*paramInfer // key: in + ":" + lower(name)
+	pathNames []string
+	reqBody   map[string]*mediaInfer
+	responses map[int]*responseInfer
+	bearer    bool
+	basic     bool
+	apiKey    map[string]bool
+}
+
+// openAPIPath converts a route template into an OpenAPI path with unique
+// parameter names, e.g. /a/{id}/b/{id} -> /a/{id}/b/{id2}.
+func openAPIPath(tmpl string) (string, []string) {
+	segs := strings.Split(tmpl, "/")
+	seen := make(map[string]int)
+	var names []string
+	for i, seg := range segs {
+		name := ""
+		switch {
+		case seg == "*":
+			name = "param"
+		case seg == "**":
+			name = "rest"
+		case len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}':
+			name = strings.TrimSuffix(seg[1:len(seg)-1], "...")
+		default:
+			continue
+		}
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, seen[name])
+		}
+		names = append(names, name)
+		segs[i] = "{" + name + "}"
+	}
+	return strings.Join(segs, "/"), names
+}
+
+func mediaType(headers map[string][]string) string {
+	ct := headerValue(headers, "Content-Type")
+	if ct == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.SplitN(ct, ";", 2)[0]))
+	}
+	return mt
+}
+
+func observeMedia(m map[string]*mediaInfer, mt, body string, truncated bool) {
+	if mt == "" || strings.TrimSpace(body) == "" {
+		return
+	}
+	mi := m[mt]
+	if mi == nil {
+		mi = &mediaInfer{}
+		m[mt] = mi
+	}
+	if !analysis.IsJSONMediaType(mt) || truncated {
+		mi.nonJSON++
+		return
+	}
+	v, ok := analysis.DecodeJSON([]byte(body))
+	if !ok {
+		mi.nonJSON++
+		return
+	}
+	if mi.schema == nil {
+		mi.schema = newSchemaInfer()
+	}
+	mi.schema.observe(v)
+	if !mi.hasEx && len(body) <= maxExampleBytes {
+		mi.example, mi.hasEx = v, true
+	}
+}
+
+func (m *mediaInfer) render() *oaObject {
+	out := newOAObject()
+	if m.schema != nil {
+		out.set("schema", m.schema.schema())
+	} else {
+		out.set("schema", newOAObject().set("type", "string"))
+	}
+	if m.hasEx {
+		out.set("example", m.example)
+	}
+	return out
+}
+
+func renderContent(m map[string]*mediaInfer) *oaObject {
+	types := make([]string, 0, len(m))
+	for mt := range m {
+		types = append(types, mt)
+	}
+	sort.Strings(types)
+	out := newOAObject()
+	for _, mt := range types {
+		out.set(mt, m[mt].render())
+	}
+	return out
+}
+
+// openAPIOptions control document generation.
+type openAPIOptions struct {
+	Title   string
+	Version string
+	Host    string // only document captures for this host (empty = all)
+}
+
+// inferOpenAPI builds an OpenAPI 3.1 document from captures. Paths are
+// templated on a copy of the live templater, so generating a document never
+// changes how later traffic is grouped; stored templates are brought up to
+// date with the segments it has learned as parameters since.
+func inferOpenAPI(caps []Capture, opts openAPIOptions) *oaObject {
+	templater := routeTemplater.Clone()
+	ops := make(map[string]*operationInfer)
+	var opOrder []string
+	servers := make(map[string]struct{})
+	var serverOrder []string
+
+	for _, c := range caps {
+		if c.Deleted || c.IsGRPC || c.GRPC != nil || c.Method == http.MethodConnect {
+			continue
+		}
+		u, err := url.Parse(c.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if opts.Host != "" && !strings.EqualFold(u.Host, opts.Host) && !strings.EqualFold(u.Hostname(), opts.Host) {
+			continue
+		}
+		if base := u.Scheme + "://" + u.Host; u.Scheme != "" {
+			if _, ok := servers[base]; !ok {
+				servers[base] = struct{}{}
+				serverOrder = append(serverOrder, base)
+			}
+		}
+
+		tmpl := templater.Retemplate(u.Host, c.RouteTemplate)
+		if tmpl == "" {
+			tmpl = templater.Template(u.Host, u.Path)
+		}
+		if tmpl == "" {
+			tmpl = "/"
+		}
+		path, pathNames := openAPIPath(tmpl)
+		method := strings.ToLower(c.Method)
+		key := method + " " + path
+		op := ops[key]
+		if op == nil {
+			op = &operationInfer{
+				method:    method,
+				path:      path,
+				pathNames: pathNames,
+				params:    make(map[string]*paramInfer),
+				reqBody:   make(map[string]*mediaInfer),
+				responses: make(map[int]*responseInfer),
+				apiKey:    make(map[string]bool),
+			}
+			ops[key] = op
+			opOrder = append(opOrder, key)
+		}
+		op.count++
+
+		param := func(in, name string) *paramInfer {
+			k := in + ":" + strings.ToLower(name)
+			p := op.params[k]
+			if p == nil {
+				p = &paramInfer{name: name, in: in, schema: newSchemaInfer()}
+				op.params[k] = p
+			}
+			return p
+		}
+
+		// Path parameters: values captured by matching the template.
+		if _, ok := analysis.MatchPathTemplate(tmpl, u.Path); ok {
+			for i, v := range templateParamValues(tmpl, u.Path) {
+				if i < len(pathNames) {
+					param("path", pathNames[i]).observeScalar(v)
+				}
+			}
+		}
+		for name, vals := range u.Query() {
+			p := param("query", name)
+			if len(vals) > 0 {
+				p.observeScalar(vals[0])
+			} else {
+				p.hits++
+			}
+		}
+		for name, vals := range c.RequestHeaders {
+			if !documentedHeader(name) {
+				continue
+			}
+			if isAPIKeyHeader(name) {
+				op.apiKey[http.CanonicalHeaderKey(name)] = true
+				continue
+			}
+			if len(vals) > 0 {
+				param("header", http.CanonicalHeaderKey(name)).observeScalar(vals[0])
+			}
+		}
+		if auth := headerValue(c.RequestHeaders, "Authorization"); auth != "" {
+			switch {
+			case strings.HasPrefix(strings.ToLower(auth), "bearer "):
+				op.bearer = true
+			case strings.HasPrefix(strings.ToLower(auth), "basic "):
+				op.basic = true
+			}
+		}
+
+		observeMedia(op.reqBody, mediaType(c.RequestHeaders), c.RequestBodyBase64, c.ReqBodyTruncated)
+
+		if c.ResponseStatus > 0 {
+			ri := op.responses[c.ResponseStatus]
+			if ri == nil {
+				ri = &responseInfer{content: make(map[string]*mediaInfer), headers: make(map[string]int)}
+				op.responses[c.ResponseStatus] = ri
+			}
+			ri.count++
+			observeMedia(ri.content, mediaType(c.ResponseHeaders), c.ResponseBodyBase64, c.RespBodyTruncated)
+			for name := range c.ResponseHeaders {
+				if documentedResponseHeader(name) {
+					ri.headers[http.CanonicalHeaderKey(name)]++
+				}
+			}
+		}
+	}
+
+	return renderOpenAPI(ops, opOrder, serverOrder, opts)
+}
+
+// templateParamValues returns the concrete values of a template's
+// placeholders, in the same order openAPIPath names them.
+func templateParamValues(tmpl, path string) []string {
+	tsegs := strings.Split(tmpl, "/")
+	psegs := strings.Split(path, "/")
+	var vals []string
+	for i, seg := range tsegs {
+		if i >= len(psegs) {
+			break
+		}
+		switch {
+		case seg == "**" || strings.HasSuffix(seg, "...}"):
+			return append(vals, strings.Join(psegs[i:], "/"))
+		case seg == "*" || (len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}'):
+			vals = append(vals, psegs[i])
+		}
+	}
+	return vals
+}
+
+func isAPIKeyHeader(name string) bool {
+	switch strings.ToLower(name) {
+	case "x-api-key", "api-key", "apikey", "x-auth-token":
+		return true
+	}
+	return false
+}
+
+func documentedResponseHeader(name string) bool {
+	switch strings.ToLower(name) {
+	case "location", "etag", "retry-after", "link", "x-ratelimit-limit", "x-ratelimit-remaining",
+		"x-ratelimit-reset", "ratelimit-limit", "ratelimit-remaining", "ratelimit-reset", "x-request-id":
+		return true
+	}
+	return false
+}
+
+var operationIDCleaner = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// operationID turns a path into a camel-case identifier suffix:
+// /users/{id}/orders -> UsersIdOrders.
+func operationID(path string) string {
+	var b strings.Builder
+	for _, w := range operationIDCleaner.Split(path, -1) {
+		if w == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+func renderOpenAPI(ops map[string]*operationInfer, opOrder, servers []string, opts openAPIOptions) *oaObject {
+	title := opts.Title
+	if title == "" {
+		title = "Observed API"
+		if opts.Host != "" {
+			title = opts.Host
+		}
+	}
+	version := opts.Version
+	if version == "" {
+		version = "0.0.0-observed"
+	}
+
+	doc := newOAObject()
+	doc.set("openapi", "3.1.0")
+	doc.set("info", newOAObject().
+		set("title", title).
+		set("version", version).
+		set("description", "Inferred by HTTP Breakout Proxy from captured traffic. Schemas describe observed payloads only."))
+	if len(servers) > 0 {
+		list := make([]any, 0, len(servers))
+		for _, s := range servers {
+			list = append(list, newOAObject().set("url", s))
+		}
+		doc.set("servers", list)
+	}
+
+	// Paths sorted lexically, methods in conventional order.
+	byPath := make(map[string][]*operationInfer)
+	for _, k := range opOrder {
+		op := ops[k]
+		byPath[op.path] = append(byPath[op.path], op)
+	}
+	paths := make([]string, 0, len(byPath))
+	for p := range byPath {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	methodRank := map[string]int{"get": 0, "put": 1, "post": 2, "delete": 3, "options": 4, "head": 5, "patch": 6, "trace": 7}
+	security := newOAObject()
+	usedIDs := make(map[string]int)
+
+	pathsObj := newOAObject()
+	for _, p := range paths {
+		list := byPath[p]
+		sort.Slice(list, func(i, j int) bool {
+			ri, okI := methodRank[list[i].method]
+			rj, okJ := methodRank[list[j].method]
+			if okI != okJ {
+				return okI
+			}
+			if ri != rj {
+				return ri < rj
+			}
+			return list[i].method < list[j].method
+		})
+		item := newOAObject()
+		for _, op := range list {
+			if _, std := methodRank[op.method]; !std {
+				// OpenAPI only allows the standard methods as operations.
+				continue
+			}
+			item.set(op.method, renderOperation(op, security, usedIDs))
+		}
+		if len(item.keys) > 0 {
+			pathsObj.set(p, item)
+		}
+	}
+	doc.set("paths", pathsObj)
+	if len(security.keys) > 0 {
+		doc.set("components", newOAObject().set("securitySchemes", security))
+	}
+	return doc
+}
+
+func renderOperation(op *operationInfer, security *oaObject, usedIDs map[string]int) *oaObject {
+	out := newOAObject()
+	id := op.method + operationID(op.path)
+	usedIDs[id]++
+	if n := usedIDs[id]; n > 1 {
+		id = fmt.Sprintf("%s%d", id, n)
+	}
+	out.set("operationId", id)
+	out.set("summary", fmt.Sprintf("%s %s (observed %d time(s))", strings.ToUpper(op.method), op.path, op.count))
+
+	// Parameters: path (template order), then query and header by name.
+	var params []any
+	for _, name := range op.pathNames {
+		p := op.params["path:"+strings.ToLower(name)]
+		schema := newOAObject().set("type", "string")
+		var example any
+		if p != nil {
+			schema = p.schema.schema()
+			example = p.schema.example
+		}
+		po := newOAObject().set("name", name).set("in", "path").set("required", true).set("schema", schema)
+		if example != nil {
+			po.set("example", example)
+		}
+		params = append(params, po)
+	}
+	keys := make([]string, 0, len(op.params))
+	for k, p := range op.params {
+		if p.in != "path" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := op.params[keys[i]], op.params[keys[j]]
+		if pi.in != pj.in {
+			return pi.in == "query"
+		}
+		return pi.name < pj.name
+	})
+	for _, k := range keys {
+		p := op.params[k]
+		po := newOAObject().set("name", p.name).set("in", p.in)
+		if p.hits == op.count {
+			po.set("required", true)
+		}
+		if p.schema.samples > 0 {
+			po.set("schema", p.schema.schema())
+			if p.schema.hasEx {
+				po.set("example", p.schema.example)
+			}
+		} else {
+			po.set("schema", newOAObject().set("type", "string"))
+		}
+		params = append(params, po)
+	}
+	if len(params) > 0 {
+		out.set("parameters", params)
+	}
+
+	if len(op.reqBody) > 0 {
+		out.set("requestBody", newOAObject().set("content", renderContent(op.reqBody)))
+	}
+
+	codes := make([]int, 0, len(op.responses))
+	for code := range op.responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	responses := newOAObject()
+	for _, code := range codes {
+		ri := op.responses[code]
+		desc := http.StatusText(code)
+		if desc == "" {
+			desc = "Status " + strconv.Itoa(code)
+		}
+		ro := newOAObject().set("description", fmt.Sprintf("%s (observed %d time(s))", desc, ri.count))
+		if len(ri.headers) > 0 {
+			names := make([]string, 0, len(ri.headers))
+			for h := range ri.headers {
+				names = append(names, h)
+			}
+			sort.Strings(names)
+			hdrs := newOAObject()
+			for _, h := range names {
+				hdrs.set(h, newOAObject().set("schema", newOAObject().set("type", "string")))
+			}
+			ro.set("headers", hdrs)
+		}
+		if len(ri.content) > 0 {
+			ro.set("content", renderContent(ri.content))
+		}
+		responses.set(strconv.Itoa(code), ro)
+	}
+	if len(codes) == 0 {
+		responses.set("default", newOAObject().set("description", "No response observed"))
+	}
+	out.set("responses", responses)
+
+	var sec []any
+	if op.bearer {
+		security.set("bearerAuth", newOAObject().set("type", "http").set("scheme", "bearer"))
+		sec = append(sec, newOAObject().set("bearerAuth", []string{}))
+	}
+	if op.basic {
+		security.set("basicAuth", newOAObject().set("type", "http").set("scheme", "basic"))
+		sec = append(sec, newOAObject().set("basicAuth", []string{}))
+	}
+	names := make([]string, 0, len(op.apiKey))
+	for h := range op.apiKey {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+	for _, h := range names {
+		scheme := "apiKey" + operationIDCleaner.ReplaceAllString(h, "")
+		security.set(scheme, newOAObject().set("type", "apiKey").set("in", "header").set("name", h))
+		sec = append(sec, newOAObject().set(scheme, []string{}))
+	}
+	if len(sec) > 0 {
+		out.set("security", sec)
+	}
+	return out
+}
+
+//
+// YAML output
+//
+
+// marshalOpenAPIYAML renders the document as block-style YAML. Strings are
+// emitted as JSON-quoted scalars, which YAML accepts verbatim.
+func marshalOpenAPIYAML(doc *oaObject) []byte {
+	var b bytes.Buffer
+	writeYAMLMap(&b, doc, 0)
+	return b.Bytes()
+}
+
+var yamlPlainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func yamlKey(k string) string {
+	if yamlPlainKey.MatchString(k) {
+		switch strings.ToLower(k) {
+		case "true", "false", "null", "yes", "no", "on", "off", "y", "n", "~":
+		default:
+			return k
+		}
+	}
+	q, _ := json.Marshal(k)
+	return string(q)
+}
+
+func yamlScalar(v any) (string, bool) {
+	switch t := v.(type) {
+	case nil:
+		return "null", true
+	case string:
+		q, _ := json.Marshal(t)
+		return string(q), true
+	case bool, int, int64, float64, json.Number:
+		return fmt.Sprint(t), true
+	case []string:
+		if len(t) == 0 {
+			return "[]", true
+		}
+	case []any:
+		if len(t) == 0 {
+			return "[]", true
+		}
+	case map[string]any:
+		if len(t) == 0 {
+			return "{}", true
+		}
+	case *oaObject:
+		if len(t.keys) == 0 {
+			return "{}", true
+		}
+	}
+	return "", false
+}
+
+func writeYAMLValue(b *bytes.Buffer, v any, indent int) {
+	switch t := v.(type) {
+	case *oaObject:
+		writeYAMLMap(b, t, indent)
+	case map[string]any:
+		o := newOAObject()
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			o.set(k, t[k])
+		}
+		writeYAMLMap(b, o, indent)
+	case []string:
+		for _, s := range t {
+			q, _ := json.Marshal(s)
+			fmt.Fprintf(b, "%s- %s\n", strings.Repeat("  ", indent), q)
+		}
+	case []any:
+		for _, e := range t {
+			pad := strings.Repeat("  ", indent)
+			if s, ok := yamlScalar(e); ok {
+				fmt.Fprintf(b, "%s- %s\n", pad, s)
+				continue
+			}
+			// Nested collection: render at indent+1, then splice "- " into
+			// the first line.
+			var sub bytes.Buffer
+			writeYAMLValue(&sub, e, indent+1)
+			lines := sub.Bytes()
+			b.WriteString(pad + "- ")
+			b.Write(bytes.TrimLeft(lines, " "))
+		}
+	}
+}
+
+func writeYAMLMap(b *bytes.Buffer, o *oaObject, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for _, k := range o.keys {
+		v := o.vals[k]
+		if s, ok := yamlScalar(v); ok {
+			fmt.Fprintf(b, "%s%s: %s\n", pad, yamlKey(k), s)
+			continue
+		}
+		fmt.Fprintf(b, "%s%s:\n", pad, yamlKey(k))
+		writeYAMLValue(b, v, indent+1)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+func TestInferOpenAPI(t *testing.T) {
+	old := routeTemplater
+	defer SetRouteTemplater(old)
+	SetRouteTemplater(analysis.NewPathTemplater())
+
+	jsonHdr := map[string][]string{"Content-Type": {"application/json"}}
+	caps := []Capture{
+		{
+			Method: "GET", URL: "https://api.example.com/users/42?verbose=true",
+			RequestHeaders:     map[string][]string{"X-Tenant": {"acme"}, "Authorization": {"Bearer t"}},
+			ResponseStatus:     200,
+			ResponseHeaders:    jsonHdr,
+			ResponseBodyBase64: `{"id":42,"email":"a@example.com","tags":["x"],"score":1.5}`,
+		},
+		{
+			Method: "GET", URL: "https://api.example.com/users/7",
+			RequestHeaders:     map[string][]string{"X-Tenant": {"acme"}},
+			ResponseStatus:     200,
+			ResponseHeaders:    jsonHdr,
+			ResponseBodyBase64: `{"id":7,"email":"b@example.com","tags":[]}`,
+		},
+		{
+			Method: "POST", URL: "https://api.example.com/users",
+			RequestHeaders:    jsonHdr,
+			RequestBodyBase64: `{"email":"c@example.com"}`,
+			ResponseStatus:    201,
+		},
+		{Method: "GET", URL: "https://other.example.com/ignored", ResponseStatus: 200},
+	}
+
+	doc := inferOpenAPI(caps, openAPIOptions{Host: "api.example.com"})
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(raw), `{"openapi":"3.1.0"`) {
+		t.Errorf("document should start with the openapi version: %.40s", raw)
+	}
+
+	paths := got["paths"].(map[string]any)
+	if _, ok := paths["/ignored"]; ok {
+		t.Errorf("host filter not applied")
+	}
+	get := paths["/users/{id}"].(map[string]any)["get"].(map[string]any)
+
+	params := map[string]map[string]any{}
+	for _, p := range get["parameters"].([]any) {
+		pm := p.(map[string]any)
+		params[pm["in"].(string)+":"+pm["name"].(string)] = pm
+	}
+	if s := params["path:id"]["schema"].(map[string]any); s["type"] != "integer" {
+		t.Errorf("path param schema = %v", s)
+	}
+	if params["header:X-Tenant"]["required"] != true {
+		t.Errorf("header seen on every call should be required: %v", params["header:X-Tenant"])
+	}
+	if q := params["query:verbose"]; q == nil || q["required"] != nil || q["schema"].(map[string]any)["type"] != "boolean" {
+		t.Errorf("optional boolean query param = %v", q)
+	}
+
+	schema := get["responses"].(map[string]any)["200"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	props := schema["properties"].(map[string]any)
+	if props["email"].(map[string]any)["format"] != "email" || props["id"].(map[string]any)["type"] != "integer" {
+		t.Errorf("properties = %v", props)
+	}
+	req := schema["required"].([]any)
+	if len(req) != 3 { // email, id, tags; score is optional
+		t.Errorf("required = %v", req)
+	}
+	if _, ok := got["components"].(map[string]any)["securitySchemes"].(map[string]any)["bearerAuth"]; !ok {
+		t.Errorf("bearer auth scheme missing")
+	}
+	if _, ok := paths["/users"].(map[string]any)["post"].(map[string]any)["requestBody"]; !ok {
+		t.Errorf("request body missing on POST /users")
+	}
+
+	y := string(marshalOpenAPIYAML(doc))
+	for _, want := range []string{
+		"openapi: \"3.1.0\"\n",
+		"\"/users/{id}\":\n    get:\n",
+		"\"200\":\n",
+		"        - name: \"id\"\n          in: \"path\"\n",
+	} {
+		if !strings.Contains(y, want) {
+			t.Errorf("yaml missing %q:\n%s", want, y)
+		}
+	}
+}
+
+func TestOpenAPIPathUniqueNames(t *testing.T) {
+	p, names := openAPIPath("/a/{id}/b/{id}/c/**")
+	if p != "/a/{id}/b/{id2}/c/{rest}" || len(names) != 3 || names[1] != "id2" {
+		t.Fatalf("openAPIPath = %q %v", p, names)
+	}
+}
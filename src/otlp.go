@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	otlpProtocolHTTPProtobuf = "http/protobuf"
+	otlpProtocolHTTPJSON     = "http/json"
+	otlpProtocolGRPC         = "grpc"
+
+	otlpGRPCExportPath = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+)
+
+// otlpConfig configures the span exporter.
+type otlpConfig struct {
+	Endpoint      string            // http(s)://host:port[/v1/traces]; gRPC uses scheme to pick TLS vs h2c
+	Protocol      string            // http/protobuf | http/json | grpc
+	Headers       map[string]string // extra request headers (auth tokens, tenant IDs)
+	ServiceName   string
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	MaxRetries    int
+	Timeout       time.Duration
+}
+
+// otlpExporter turns finished captures into OTLP client spans and ships them
+// in batches. Enqueueing never blocks the proxy; a full queue drops spans.
+type otlpExporter struct {
+	cfg    otlpConfig
+	url    string
+	client *http.Client
+	queue  chan Capture
+
+	exported atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+
+	// ctx is cancelled when Close gives up, aborting the export in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var spanExporter *otlpExporter
+
+func SetSpanExporter(e *otlpExporter) {
+	spanExporter = e
+}
+
+// newOTLPExporter validates the config and starts the batching goroutine.
+func newOTLPExporter(cfg otlpConfig) (*otlpExporter, error) {
+	if cfg.Protocol == "" {
+		cfg.Protocol = otlpProtocolHTTPProtobuf
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "http-breakout-proxy"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 256
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 4096
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("otlp: invalid endpoint %q (want http(s)://host:port[/path])", cfg.Endpoint)
+	}
+
+	e := &otlpExporter{
+		cfg:     cfg,
+		queue:   make(chan Capture, cfg.QueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	switch cfg.Protocol {
+	case otlpProtocolHTTPProtobuf, otlpProtocolHTTPJSON:
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/traces"
+		}
+		e.client = &http.Client{Timeout: cfg.Timeout}
+	case otlpProtocolGRPC:
+		u.Path = otlpGRPCExportPath
+		tr := &http2.Transport{}
+		if u.Scheme == "http" {
+			// Plaintext gRPC: HTTP/2 with prior knowledge (h2c).
+			tr.AllowHTTP = true
+			tr.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			}
+		}
+		e.client = &http.Client{Transport: tr, Timeout: cfg.Timeout}
+	default:
+		return nil, fmt.Errorf("otlp: unknown protocol %q (want %s, %s or %s)",
+			cfg.Protocol, otlpProtocolHTTPProtobuf, otlpProtocolHTTPJSON, otlpProtocolGRPC)
+	}
+	e.url = u.String()
+
+	go e.run()
+	return e, nil
+}
+
+// enqueue hands a finished capture to the exporter without blocking.
+func (e *otlpExporter) enqueue(c Capture) {
+	if e == nil {
+		return
+	}
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+	select {
+	case e.queue <- c:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Close flushes queued spans and stops the exporter. If ctx ends first, the
+// export in flight is aborted, spans still queued are counted as failed and
+// ctx's error is returned without waiting further.
+func (e *otlpExporter) Close(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.closeOnce.Do(func() { close(e.done) })
+	select {
+	case <-e.stopped:
+		e.cancel()
+		return nil
+	case <-ctx.Done():
+		e.cancel()
+		return ctx.Err()
+	}
+}
+
+// closeSpanExporter stops the global exporter at shutdown, waiting at most
+// one export timeout for the final flush.
+func closeSpanExporter() {
+	if spanExporter == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), spanExporter.cfg.Timeout)
+	defer cancel()
+	if err := spanExporter.Close(ctx); err != nil {
+		log.Printf("OTLP: final flush did not finish (%v); %d span(s) still queued are dropped", err, len(spanExporter.queue))
+	}
+}
+
+// otlpStats is the exporter's counter snapshot.
+type otlpStats struct {
+	Exported int64 `json:"exported"`
+	Dropped  int64 `json:"dropped"`
+	Failed   int64 `json:"failed"`
+	Queued   int   `json:"queued"`
+}
+
+func (e *otlpExporter) Stats() otlpStats {
+	if e == nil {
+		return otlpStats{}
+	}
+	return otlpStats{
+		Exported: e.exported.Load(),
+		Dropped:  e.dropped.Load(),
+		Failed:   e.failed.Load(),
+		Queued:   len(e.queue),
+	}
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Capture, 0, e.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		e.export(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case c := <-e.queue:
+			batch = append(batch, c)
+			if len(batch) >= e.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			// drain what is already queued, then stop
+			for {
+				select {
+				case c := <-e.queue:
+					batch = append(batch, c)
+					if len(batch) >= e.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export encodes and sends one batch, retrying transient failures with
+// exponential backoff (honoring Retry-After when the collector sends it).
+func (e *otlpExporter) export(caps []Capture) {
+	b := &otlpBatch{
+		Resource:  []otlpAttr{otlpString("service.name", e.cfg.ServiceName)},
+		ScopeName: "http-breakout-proxy",
+		Spans:     make([]otlpSpan, 0, len(caps)),
+	}
+	for _, c := range caps {
+		b.Spans = append(b.Spans, spanFromCaptureOTLP(c))
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		wait, err := e.send(b)
+		if err == nil {
+			e.exported.Add(int64(len(caps)))
+			return
+		}
+		var perm *otlpPermanentError
+		if errors.As(err, &perm) || attempt >= e.cfg.MaxRetries || e.ctx.Err() != nil {
+			e.failed.Add(int64(len(caps)))
+			log.Printf("OTLP: dropping %d span(s) after %d attempt(s): %v", len(caps), attempt+1, err)
+			return
+		}
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		if isVerbose() {
+			log.Printf("OTLP: export failed (%v), retrying in %s", err, wait)
+		}
+		select {
+		case <-time.After(wait):
+		case <-e.done:
+			// shutting down: one last immediate attempt happens on the next loop
+			backoff = 0
+		}
+	}
+}
+
+type otlpPermanentError struct{ msg string }
+
+func (e *otlpPermanentError) Error() string { return e.msg }
+
+// send performs one export attempt. It returns a server-requested retry delay
+// (0 if none) and an error; permanent failures are *otlpPermanentError.
+func (e *otlpExporter) send(b *otlpBatch) (time.Duration, error) {
+	var body []byte
+	var contentType string
+	switch e.cfg.Protocol {
+	case otlpProtocolHTTPJSON:
+		js, err := b.marshalJSON()
+		if err != nil {
+			return 0, &otlpPermanentError{msg: err.Error()}
+		}
+		body, contentType = js, "application/json"
+	case otlpProtocolGRPC:
+		pb := b.marshalProto()
+		body = make([]byte, 5+len(pb))
+		binary.BigEndian.PutUint32(body[1:5], uint32(len(pb)))
+		copy(body[5:], pb)
+		contentType = "application/grpc"
+	default:
+		body, contentType = b.marshalProto(), "application/x-protobuf"
+	}
+
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, &otlpPermanentError{msg: err.Error()}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.cfg.Protocol == otlpProtocolGRPC {
+		req.Header.Set("TE", "trailers")
+	}
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if e.cfg.Protocol == otlpProtocolGRPC {
+		return 0, grpcExportError(resp)
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		return parseRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("collector returned %s", resp.Status)
+	default:
+		return 0, &otlpPermanentError{msg: "collector returned " + resp.Status}
+	}
+}
+
+// grpcExportError maps the grpc-status of an Export call to an error.
+func grpcExportError(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("grpc transport returned %s", resp.Status)
+	}
+	st := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if st == "" {
+		// trailers-only response
+		st = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(st)
+	if err != nil {
+		return fmt.Errorf("grpc response without grpc-status")
+	}
+	switch code {
+	case 0:
+		return nil
+	case 4, 8, 10, 14: // DEADLINE_EXCEEDED, RESOURCE_EXHAUSTED, ABORTED, UNAVAILABLE
+		return fmt.Errorf("grpc-status %d: %s", code, msg)
+	default:
+		return &otlpPermanentError{msg: fmt.Sprintf("grpc-status %d: %s", code, msg)}
+	}
+}
+
+// parseRetryAfter understands delay-seconds and HTTP-date forms.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func randomID(n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// spanFromCaptureOTLP maps a capture onto an OTLP client span following the
+// HTTP semantic conventions. Requests that carried a traceparent join the
+// caller's trace as a child of the calling span.
+func spanFromCaptureOTLP(c Capture) otlpSpan {
+	s := spanFromCapture(c)
+	s.layoutWaterfall(c.Time)
+
+	sp := otlpSpan{
+		SpanID:     randomID(8),
+		TraceState: c.TraceState,
+		Name:       c.Method,
+		Kind:       otlpSpanKindClient,
+		Start:      c.Time,
+		End:        c.Time.Add(time.Duration(s.DurationMs) * time.Millisecond),
+		StatusCode: otlpStatusUnset,
+	}
+	if tid, err := hex.DecodeString(c.TraceID); err == nil && len(tid) == 16 {
+		sp.TraceID = tid
+		if pid, err := hex.DecodeString(c.ParentSpanID); err == nil && len(pid) == 8 {
+			sp.ParentSpanID = pid
+		}
+	} else {
+		sp.TraceID = randomID(16)
+	}
+
+	attrs := []otlpAttr{
+		otlpString("http.request.method", c.Method),
+		otlpString("url.full", c.URL),
+		otlpInt("breakout.capture_id", c.ID),
+	}
+	if u, err := url.Parse(c.URL); err == nil {
+		if u.Scheme != "" {
+			attrs = append(attrs, otlpString("url.scheme", u.Scheme))
+		}
+		if h := u.Hostname(); h != "" {
+			attrs = append(attrs, otlpString("server.address", h))
+		}
+		port := u.Port()
+		if port == "" {
+			switch u.Scheme {
+			case "https":
+				port = "443"
+			case "http":
+				port = "80"
+			}
+		}
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, otlpInt("server.port", int64(p)))
+		}
+	}
+	if c.ResponseStatus != 0 {
+		attrs = append(attrs, otlpInt("http.response.status_code", int64(c.ResponseStatus)))
+	}
+	if host, port, err := net.SplitHostPort(c.ServerAddr); err == nil {
+		attrs = append(attrs, otlpString("network.peer.address", host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, otlpInt("network.peer.port", int64(p)))
+		}
+	}
+	if c.RequestBodyBytes > 0 {
+		attrs = append(attrs, otlpInt("http.request.body.size", c.RequestBodyBytes))
+	}
+	if c.ResponseBodyBytes > 0 {
+		attrs = append(attrs, otlpInt("http.response.body.size", c.ResponseBodyBytes))
+	}
+	if c.HTTP2 {
+		attrs = append(attrs, otlpString("network.protocol.version", "2"))
+	} else if strings.HasPrefix(c.Proto, "HTTP/") {
+		attrs = append(attrs, otlpString("network.protocol.version", strings.TrimPrefix(c.Proto, "HTTP/")))
+	}
+	if c.UserAgent != "" {
+		attrs = append(attrs, otlpString("user_agent.original", c.UserAgent))
+	}
+	if c.ClientIP != "" {
+		attrs = append(attrs, otlpString("client.address", c.ClientIP))
+	}
+	if c.CorrelationID != "" {
+		attrs = append(attrs, otlpString("breakout.correlation_id", c.CorrelationID))
+	}
+	attrs = append(attrs, otlpBool("breakout.reused_conn", c.ReusedConn))
+	sp.Attrs = attrs
+
+	for _, seg := range s.Waterfall {
+		sp.Events = append(sp.Events, otlpEvent{
+			Time:  c.Time.Add(time.Duration(seg.OffsetMs) * time.Millisecond),
+			Name:  "http." + seg.Phase,
+			Attrs: []otlpAttr{otlpInt("duration_ms", seg.DurationMs)},
+		})
+	}
+
+	if c.ResponseStatus == 0 || c.ResponseStatus >= 500 {
+		sp.StatusCode = otlpStatusError
+		if c.ResponseStatus >= 500 {
+			attrs = append(sp.Attrs, otlpString("error.type", strconv.Itoa(c.ResponseStatus)))
+			sp.Attrs = attrs
+		}
+	}
+	return sp
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Minimal OTLP trace model. It mirrors the subset of
+// opentelemetry/proto/trace/v1 we emit and can be serialized both as protobuf
+// (OTLP/HTTP binary and OTLP/gRPC) and as OTLP/JSON, without pulling in the
+// generated protobuf packages.
+
+const (
+	otlpSpanKindClient = 3
+
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+type otlpAttr struct {
+	Key  string
+	kind byte // 's' string, 'i' int, 'b' bool
+	str  string
+	num  int64
+	flag bool
+}
+
+func otlpString(k, v string) otlpAttr    { return otlpAttr{Key: k, kind: 's', str: v} }
+func otlpInt(k string, v int64) otlpAttr { return otlpAttr{Key: k, kind: 'i', num: v} }
+func otlpBool(k string, v bool) otlpAttr { return otlpAttr{Key: k, kind: 'b', flag: v} }
+
+type otlpEvent struct {
+	Time  time.Time
+	Name  string
+	Attrs []otlpAttr
+}
+
+type otlpSpan struct {
+	TraceID      []byte // 16 bytes
+	SpanID       []byte // 8 bytes
+	ParentSpanID []byte // 8 bytes or nil
+	TraceState   string
+	Name         string
+	Kind         int
+	Start        time.Time
+	End          time.Time
+	Attrs        []otlpAttr
+	Events       []otlpEvent
+	StatusCode   int
+	StatusMsg    string
+}
+
+type otlpBatch struct {
+	Resource  []otlpAttr
+	ScopeName string
+	ScopeVer  string
+	Spans     []otlpSpan
+}
+
+//
+// protobuf encoding
+//
+
+type protoWriter struct{ b []byte }
+
+func (w *protoWriter) tag(field, wire int) {
+	w.b = binary.AppendUvarint(w.b, uint64(field)<<3|uint64(wire))
+}
+
+func (w *protoWriter) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	w.tag(field, 0)
+	w.b = binary.AppendUvarint(w.b, v)
+}
+
+func (w *protoWriter) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	w.tag(field, 1)
+	w.b = binary.LittleEndian.AppendUint64(w.b, v)
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	w.tag(field, 2)
+	w.b = binary.AppendUvarint(w.b, uint64(len(b)))
+	w.b = append(w.b, b...)
+}
+
+func (w *protoWriter) string(field int, s string) { w.bytes(field, []byte(s)) }
+
+// message writes a length-delimited sub-message, even when it is empty.
+func (w *protoWriter) message(field int, fn func(*protoWriter)) {
+	var sub protoWriter
+	fn(&sub)
+	w.tag(field, 2)
+	w.b = binary.AppendUvarint(w.b, uint64(len(sub.b)))
+	w.b = append(w.b, sub.b...)
+}
+
+func writeProtoAttrs(w *protoWriter, field int, attrs []otlpAttr) {
+	for _, a := range attrs {
+		a := a
+		w.message(field, func(kv *protoWriter) { // KeyValue
+			kv.string(1, a.Key)
+			kv.message(2, func(v *protoWriter) { // AnyValue
+				switch a.kind {
+				case 's':
+					v.tag(1, 2)
+					v.b = binary.AppendUvarint(v.b, uint64(len(a.str)))
+					v.b = append(v.b, a.str...)
+				case 'b':
+					v.tag(2, 0)
+					if a.flag {
+						v.b = append(v.b, 1)
+					} else {
+						v.b = append(v.b, 0)
+					}
+				case 'i':
+					v.tag(3, 0)
+					v.b = binary.AppendUvarint(v.b, uint64(a.num))
+				}
+			})
+		})
+	}
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// marshalProto encodes an ExportTraceServiceRequest.
+func (b *otlpBatch) marshalProto() []byte {
+	var w protoWriter
+	w.message(1, func(rs *protoWriter) { // ResourceSpans
+		rs.message(1, func(res *protoWriter) { // Resource
+			writeProtoAttrs(res, 1, b.Resource)
+		})
+		rs.message(2, func(ss *protoWriter) { // ScopeSpans
+			ss.message(1, func(sc *protoWriter) { // InstrumentationScope
+				sc.string(1, b.ScopeName)
+				sc.string(2, b.ScopeVer)
+			})
+			for _, s := range b.Spans {
+				s := s
+				ss.message(2, func(sp *protoWriter) { // Span
+					sp.bytes(1, s.TraceID)
+					sp.bytes(2, s.SpanID)
+					sp.string(3, s.TraceState)
+					sp.bytes(4, s.ParentSpanID)
+					sp.string(5, s.Name)
+					sp.varint(6, uint64(s.Kind))
+					sp.fixed64(7, unixNano(s.Start))
+					sp.fixed64(8, unixNano(s.End))
+					writeProtoAttrs(sp, 9, s.Attrs)
+					for _, ev := range s.Events {
+						ev := ev
+						sp.message(11, func(e *protoWriter) { // Span.Event
+							e.fixed64(1, unixNano(ev.Time))
+							e.string(2, ev.Name)
+							writeProtoAttrs(e, 3, ev.Attrs)
+						})
+					}
+					sp.message(15, func(st *protoWriter) { // Status
+						st.string(2, s.StatusMsg)
+						st.varint(3, uint64(s.StatusCode))
+					})
+				})
+			}
+		})
+	})
+	return w.b
+}
+
+//
+// OTLP/JSON encoding (hex IDs, int64 as decimal strings, enums as numbers)
+//
+
+func (a otlpAttr) MarshalJSON() ([]byte, error) {
+	var v map[string]any
+	switch a.kind {
+	case 's':
+		v = map[string]any{"stringValue": a.str}
+	case 'b':
+		v = map[string]any{"boolValue": a.flag}
+	case 'i':
+		v = map[string]any{"intValue": strconv.FormatInt(a.num, 10)}
+	}
+	return json.Marshal(map[string]any{"key": a.Key, "value": v})
+}
+
+func (b *otlpBatch) marshalJSON() ([]byte, error) {
+	spans := make([]map[string]any, 0, len(b.Spans))
+	for _, s := range b.Spans {
+		events := make([]map[string]any, 0, len(s.Events))
+		for _, ev := range s.Events {
+			events = append(events, map[string]any{
+				"timeUnixNano": strconv.FormatUint(unixNano(ev.Time), 10),
+				"name":         ev.Name,
+				"attributes":   ev.Attrs,
+			})
+		}
+		sp := map[string]any{
+			"traceId":           hex.EncodeToString(s.TraceID),
+			"spanId":            hex.EncodeToString(s.SpanID),
+			"name":              s.Name,
+			"kind":              s.Kind,
+			"startTimeUnixNano": strconv.FormatUint(unixNano(s.Start), 10),
+			"endTimeUnixNano":   strconv.FormatUint(unixNano(s.End), 10),
+			"attributes":        s.Attrs,
+			"events":            events,
+			"status":            map[string]any{"code": s.StatusCode, "message": s.StatusMsg},
+		}
+		if len(s.ParentSpanID) > 0 {
+			sp["parentSpanId"] = hex.EncodeToString(s.ParentSpanID)
+		}
+		if s.TraceState != "" {
+			sp["traceState"] = s.TraceState
+		}
+		spans = append(spans, sp)
+	}
+	return json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": b.Resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": b.ScopeName, "version": b.ScopeVer},
+				"spans": spans,
+			}},
+		}},
+	})
+}
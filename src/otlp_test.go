@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func testOTLPCapture() Capture {
+	return Capture{
+		ID:             7,
+		Time:           time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Method:         "GET",
+		URL:            "https://api.example.com/users/1",
+		ResponseStatus: 503,
+		TotalMs:        40,
+		DNSMs:          5,
+		TTFBMs:         30,
+		ServerAddr:     "10.0.0.1:443",
+		TraceID:        "4bf92f3577b34da6a3ce929d0e0e4736",
+		ParentSpanID:   "00f067aa0ba902b7",
+	}
+}
+
+func TestOTLPJSONExportRetriesOn503(t *testing.T) {
+	var calls atomic.Int32
+	got := make(chan map[string]any, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		got <- body
+	}))
+	defer collector.Close()
+
+	exp, err := newOTLPExporter(otlpConfig{
+		Endpoint:      collector.URL,
+		Protocol:      otlpProtocolHTTPJSON,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		MaxRetries:    2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.enqueue(testOTLPCapture())
+
+	var body map[string]any
+	select {
+	case body = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collector never received a successful export")
+	}
+	if err := exp.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := body["resourceSpans"].([]any)[0].(map[string]any)
+	span := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	if span["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || span["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Errorf("trace linkage = %v/%v", span["traceId"], span["parentSpanId"])
+	}
+	if span["status"].(map[string]any)["code"].(float64) != otlpStatusError {
+		t.Errorf("status = %v, want error", span["status"])
+	}
+	attrs := map[string]any{}
+	for _, a := range span["attributes"].([]any) {
+		kv := a.(map[string]any)
+		for _, v := range kv["value"].(map[string]any) {
+			attrs[kv["key"].(string)] = v
+		}
+	}
+	if attrs["http.response.status_code"] != "503" || attrs["server.address"] != "api.example.com" || attrs["network.peer.address"] != "10.0.0.1" {
+		t.Errorf("attributes = %v", attrs)
+	}
+	if n := len(span["events"].([]any)); n != 2 {
+		t.Errorf("events = %d, want 2 (dns, ttfb)", n)
+	}
+	if s := exp.Stats(); s.Exported != 1 || calls.Load() != 2 {
+		t.Errorf("stats = %+v, calls = %d", s, calls.Load())
+	}
+}
+
+func TestOTLPCloseGivesUpOnAHungCollector(t *testing.T) {
+	release := make(chan struct{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer collector.Close()
+	defer close(release)
+
+	exp, err := newOTLPExporter(otlpConfig{
+		Endpoint:      collector.URL,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		Timeout:       time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.enqueue(testOTLPCapture())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := exp.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Close = %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Close took %s", d)
+	}
+	// The aborted export is counted once the exporter notices.
+	deadline := time.Now().Add(5 * time.Second)
+	for exp.Stats().Failed != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v, want the span counted as failed", exp.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOTLPGRPCExportOverH2C(t *testing.T) {
+	got := make(chan []byte, 1)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpGRPCExportPath || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		got <- b
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Grpc-Status", "0")
+	})
+	collector := httptest.NewServer(h2c.NewHandler(h, &http2.Server{}))
+	defer collector.Close()
+
+	exp, err := newOTLPExporter(otlpConfig{
+		Endpoint:      collector.URL,
+		Protocol:      otlpProtocolGRPC,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.enqueue(testOTLPCapture())
+	if err := exp.Close(context.Background()); err != nil { // flushes the partial batch
+		t.Fatal(err)
+	}
+
+	var b []byte
+	select {
+	case b = <-got:
+	default:
+		t.Fatal("collector received nothing")
+	}
+	if len(b) < 5 || b[0] != 0 || int(binary.BigEndian.Uint32(b[1:5])) != len(b)-5 {
+		t.Fatalf("bad gRPC frame prefix: % x", b[:min(len(b), 5)])
+	}
+	want := (&otlpBatch{}).marshalProto()
+	if len(b)-5 <= len(want) {
+		t.Errorf("payload too small (%d bytes) to contain a span", len(b)-5)
+	}
+	if s := exp.Stats(); s.Exported != 1 || s.Failed != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
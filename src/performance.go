@@ -10,6 +10,7 @@ import (
 
 type phases struct {
 	startRT          time.Time // RoundTrip start
+	getConn, gotConn time.Time // connection requested / obtained (dial or pool)
 	dnsStart, dnsEnd time.Time
 	conStart, conEnd time.Time
 	tlsStart, tlsEnd time.Time
@@ -7,11 +7,12 @@ import (
 )
 
 // persistHelpers: save/load circular buffer to JSON file (atomic write)
-// saveAll writes both captures and color rules atomically.
-func saveAll(path string, caps []Capture, rules []ColorRule) error {
+// saveAll writes captures, color rules and alert rules atomically.
+func saveAll(path string, caps []Capture, rules []ColorRule, alerts []AlertRule) error {
 	payload := PersistedData{
 		Captures:   caps,
 		ColorRules: rules,
+		AlertRules: alerts,
 	}
 	b, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
@@ -24,18 +25,19 @@ func saveAll(path string, caps []Capture, rules []ColorRule) error {
 	return os.Rename(tmp, path)
 }
 
-// loadAll reads captures + rules. Back-compat: if the file is either a plain
-// []Capture or an object containing only captures, we still succeed.
-func loadAll(path string) ([]Capture, []ColorRule, error) {
+// loadAll reads captures + color rules + alert rules. Back-compat: if the
+// file is either a plain []Capture or an object containing only captures, we
+// still succeed.
+func loadAll(path string) ([]Capture, []ColorRule, []AlertRule, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	var pd PersistedData
-	if err := json.Unmarshal(b, &pd); err == nil && (pd.Captures != nil || pd.ColorRules != nil) {
-		return pd.Captures, pd.ColorRules, nil
+	if err := json.Unmarshal(b, &pd); err == nil && (pd.Captures != nil || pd.ColorRules != nil || pd.AlertRules != nil) {
+		return pd.Captures, pd.ColorRules, pd.AlertRules, nil
 	}
 
-	return nil, nil, fmt.Errorf("unrecognized persistence format")
+	return nil, nil, nil, fmt.Errorf("unrecognized persistence format")
 }
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// metricsMaxRoutes caps the number of distinct routes (and clients) exported
+// as label values. Routes take the free slots busiest first and keep them;
+// the rest are folded into a single "other" series so a high-cardinality API
+// cannot blow up the scraper.
+var metricsMaxRoutes = 500
+
+const metricsOtherLabel = "other"
+
+const (
+	contentTypePromText    = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// promWriter renders the Prometheus text format, or OpenMetrics when the
+// scraper asks for it. The two differ only in counter naming and the
+// trailing "# EOF".
+type promWriter struct {
+	buf         bytes.Buffer
+	openMetrics bool
+}
+
+// family writes the HELP/TYPE header. Counter names are passed without the
+// "_total" suffix; the writer adds it where the format requires.
+func (p *promWriter) family(name, typ, help string) {
+	if typ == "counter" && !p.openMetrics {
+		name += "_total"
+	}
+	p.buf.WriteString("# HELP " + name + " " + help + "\n")
+	p.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one series; labels are alternating name/value pairs.
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	p.buf.WriteString(name)
+	if len(labels) > 0 {
+		p.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			p.buf.WriteString(labels[i])
+			p.buf.WriteString(`="`)
+			p.buf.WriteString(escapeLabelValue(labels[i+1]))
+			p.buf.WriteByte('"')
+		}
+		p.buf.WriteByte('}')
+	}
+	p.buf.WriteByte(' ')
+	p.buf.WriteString(formatPromValue(value))
+	p.buf.WriteByte('\n')
+}
+
+func escapeLabelValue(v string) string {
+	if !strings.ContainsAny(v, "\\\"\n") {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+func formatPromValue(v float64) string {
+	switch {
+	case v > 1e308:
+		return "+Inf"
+	case v < -1e308:
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// routeLimiter maps routes onto exported label sets for one scrape: the
+// routes that have their own series, with everything else folded into
+// "other".
+type routeLimiter struct {
+	keep   map[analysis.RouteKey]bool
+	folded int
+}
+
+// routeExports remembers which routes /metrics has given their own series.
+// A route keeps its series once exported, and only routes seen after all
+// metricsMaxRoutes slots are taken fold into "other". Re-ranking on every
+// scrape would move a route's counts in and out of "other", which scrapers
+// read as a counter reset.
+type routeExports struct {
+	mu       sync.Mutex
+	exported map[analysis.RouteKey]bool
+}
+
+var exportedRoutes = &routeExports{exported: make(map[analysis.RouteKey]bool)}
+
+// limiter assigns routes not exported yet to free slots, busiest first.
+func (e *routeExports) limiter(weights map[analysis.RouteKey]int64, max int) *routeLimiter {
+	l := &routeLimiter{keep: make(map[analysis.RouteKey]bool, len(weights))}
+	if max <= 0 {
+		for rk := range weights {
+			l.keep[rk] = true
+		}
+		return l
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var fresh []analysis.RouteKey
+	for rk := range weights {
+		if e.exported[rk] {
+			l.keep[rk] = true
+		} else {
+			fresh = append(fresh, rk)
+		}
+	}
+	sort.Slice(fresh, func(i, j int) bool {
+		wi, wj := weights[fresh[i]], weights[fresh[j]]
+		if wi != wj {
+			return wi > wj
+		}
+		return routeLess(fresh[i], fresh[j])
+	})
+	for _, rk := range fresh {
+		if len(e.exported) >= max {
+			l.folded++
+			continue
+		}
+		e.exported[rk] = true
+		l.keep[rk] = true
+	}
+	return l
+}
+
+// reset forgets the exported routes, e.g. after the analyzers were cleared.
+func (e *routeExports) reset() {
+	e.mu.Lock()
+	e.exported = make(map[analysis.RouteKey]bool)
+	e.mu.Unlock()
+}
+
+// label returns the route as exported, or the "other" route when folded.
+func (l *routeLimiter) label(rk analysis.RouteKey) analysis.RouteKey {
+	if l.keep[rk] {
+		return rk
+	}
+	return analysis.RouteKey{Host: metricsOtherLabel, Path: metricsOtherLabel, Method: metricsOtherLabel}
+}
+
+func routeLess(a, b analysis.RouteKey) bool {
+	if a.Host != b.Host {
+		return a.Host < b.Host
+	}
+	if a.Path != b.Path {
+		return a.Path < b.Path
+	}
+	return a.Method < b.Method
+}
+
+func sortedRoutes[V any](m map[analysis.RouteKey]V) []analysis.RouteKey {
+	out := make([]analysis.RouteKey, 0, len(m))
+	for rk := range m {
+		out = append(out, rk)
+	}
+	sort.Slice(out, func(i, j int) bool { return routeLess(out[i], out[j]) })
+	return out
+}
+
+func routeLabels(rk analysis.RouteKey, extra ...string) []string {
+	return append([]string{"host", rk.Host, "method", rk.Method, "route", rk.Path}, extra...)
+}
+
+// metricsHandler serves the analyzers and proxy internals in the Prometheus
+// text exposition format (OpenMetrics when requested via Accept).
+func metricsHandler(store *captureStore, broker *sseBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		p := &promWriter{openMetrics: strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")}
+		writeAnalysisMetrics(p, analysisRegistry)
+		writeProxyMetrics(p, store, broker)
+		if p.openMetrics {
+			p.buf.WriteString("# EOF\n")
+			w.Header().Set("Content-Type", contentTypeOpenMetrics)
+		} else {
+			w.Header().Set("Content-Type", contentTypePromText)
+		}
+		_, _ = w.Write(p.buf.Bytes())
+	}
+}
+
+type routeHistogram struct {
+	buckets []int64
+	sum     float64
+	count   int64
+}
+
+type routeSummary struct {
+	sum   float64
+	count int64
+}
+
+type routeStatus struct {
+	route analysis.RouteKey
+	code  int
+}
+
+func writeAnalysisMetrics(p *promWriter, reg *analysis.Registry) {
+	if reg == nil {
+		return
+	}
+	lat := reg.Latency().Snapshot(0)
+	sizes := reg.Size().Snapshot(0)
+	usage := reg.MethodPath().Snapshot(0)
+
+	// Busiest routes across analyzers decide which keep their own series.
+	weights := make(map[analysis.RouteKey]int64)
+	bump := func(rk analysis.RouteKey, n int64) {
+		if n > weights[rk] {
+			weights[rk] = n
+		}
+	}
+	for _, s := range lat {
+		bump(s.Route, s.Count)
+	}
+	for _, s := range sizes {
+		bump(s.Route, max(s.ReqCount, s.ResCount))
+	}
+	for _, s := range usage {
+		bump(s.Route, s.Count)
+	}
+	lim := exportedRoutes.limiter(weights, metricsMaxRoutes)
+
+	// Latency histograms.
+	hist := make(map[analysis.RouteKey]*routeHistogram)
+	for _, s := range lat {
+		rk := lim.label(s.Route)
+		h := hist[rk]
+		if h == nil {
+			h = &routeHistogram{buckets: make([]int64, len(analysis.LatencyBucketBounds)+1)}
+			hist[rk] = h
+		}
+		for i, n := range s.Buckets {
+			if i < len(h.buckets) {
+				h.buckets[i] += n
+			}
+		}
+		h.sum += s.Total.Seconds()
+		h.count += s.Count
+	}
+	p.family("breakout_http_request_duration_seconds", "histogram", "Upstream request latency per route.")
+	for _, rk := range sortedRoutes(hist) {
+		h := hist[rk]
+		var cum int64
+		for i, bound := range analysis.LatencyBucketBounds {
+			cum += h.buckets[i]
+			p.sample("breakout_http_request_duration_seconds_bucket", float64(cum),
+				routeLabels(rk, "le", formatPromValue(bound.Seconds()))...)
+		}
+		p.sample("breakout_http_request_duration_seconds_bucket", float64(h.count), routeLabels(rk, "le", "+Inf")...)
+		p.sample("breakout_http_request_duration_seconds_sum", h.sum, routeLabels(rk)...)
+		p.sample("breakout_http_request_duration_seconds_count", float64(h.count), routeLabels(rk)...)
+	}
+
+	// Payload size summaries.
+	reqSize := make(map[analysis.RouteKey]*routeSummary)
+	resSize := make(map[analysis.RouteKey]*routeSummary)
+	for _, s := range sizes {
+		rk := lim.label(s.Route)
+		if reqSize[rk] == nil {
+			reqSize[rk], resSize[rk] = &routeSummary{}, &routeSummary{}
+		}
+		reqSize[rk].sum += float64(s.ReqTotal)
+		reqSize[rk].count += s.ReqCount
+		resSize[rk].sum += float64(s.ResTotal)
+		resSize[rk].count += s.ResCount
+	}
+	for _, fam := range []struct {
+		name, help string
+		m          map[analysis.RouteKey]*routeSummary
+	}{
+		{"breakout_http_request_size_bytes", "Request body size per route.", reqSize},
+		{"breakout_http_response_size_bytes", "Response body size per route.", resSize},
+	} {
+		p.family(fam.name, "summary", fam.help)
+		for _, rk := range sortedRoutes(fam.m) {
+			p.sample(fam.name+"_sum", fam.m[rk].sum, routeLabels(rk)...)
+			p.sample(fam.name+"_count", float64(fam.m[rk].count), routeLabels(rk)...)
+		}
+	}
+
+	// Status code counts.
+	statuses := make(map[routeStatus]int64)
+	for _, s := range usage {
+		rk := lim.label(s.Route)
+		for code, n := range s.StatusCount {
+			statuses[routeStatus{rk, code}] += n
+		}
+	}
+	keys := make([]routeStatus, 0, len(statuses))
+	for k := range statuses {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return routeLess(keys[i].route, keys[j].route)
+		}
+		return keys[i].code < keys[j].code
+	})
+	p.family("breakout_http_responses", "counter", "Responses per route and status code (0 = no response).")
+	for _, k := range keys {
+		p.sample("breakout_http_responses_total", float64(statuses[k]), routeLabels(k.route, "code", strconv.Itoa(k.code))...)
+	}
+
+	// Retry bursts still inside the analyzer window.
+	burstMax := make(map[analysis.RouteKey]int64)
+	bursting := make(map[analysis.RouteKey]int64)
+	for _, s := range reg.Retry().Snapshot(2) {
+		rk := lim.label(s.Route)
+		bursting[rk]++
+		if s.Count > burstMax[rk] {
+			burstMax[rk] = s.Count
+		}
+	}
+	p.family("breakout_retry_burst_max", "gauge", "Largest active retry burst (repeated identical requests) per route.")
+	for _, rk := range sortedRoutes(burstMax) {
+		p.sample("breakout_retry_burst_max", float64(burstMax[rk]), routeLabels(rk)...)
+	}
+	p.family("breakout_retry_bursting_keys", "gauge", "Client/request keys currently retrying per route.")
+	for _, rk := range sortedRoutes(bursting) {
+		p.sample("breakout_retry_bursting_keys", float64(bursting[rk]), routeLabels(rk)...)
+	}
+
+	// Per-client error streaks, keyed by client IP and capped like routes.
+	streaks := make(map[string]int64)
+	for _, s := range reg.ErrorTransitions().Snapshot(0) {
+		if cur, ok := streaks[s.Client.IP]; !ok || s.ConsecutiveErrors > cur {
+			streaks[s.Client.IP] = s.ConsecutiveErrors
+		}
+	}
+	clients := make([]string, 0, len(streaks))
+	for ip := range streaks {
+		clients = append(clients, ip)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if streaks[clients[i]] != streaks[clients[j]] {
+			return streaks[clients[i]] > streaks[clients[j]]
+		}
+		return clients[i] < clients[j]
+	})
+	if metricsMaxRoutes > 0 && len(clients) > metricsMaxRoutes {
+		// Sorted by streak, so the folded remainder's max is its first entry.
+		streaks[metricsOtherLabel] = streaks[clients[metricsMaxRoutes]]
+		clients = append(clients[:metricsMaxRoutes:metricsMaxRoutes], metricsOtherLabel)
+	}
+	sort.Strings(clients)
+	p.family("breakout_client_error_streak", "gauge", "Consecutive 5xx/network errors seen by each client.")
+	for _, ip := range clients {
+		p.sample("breakout_client_error_streak", float64(streaks[ip]), "client", ip)
+	}
+
+	p.family("breakout_metrics_routes_folded", "gauge", "Routes folded into route=\"other\" by -metrics-max-routes.")
+	p.sample("breakout_metrics_routes_folded", float64(lim.folded))
+
+	capStats := reg.Capacity()
+	p.family("breakout_analysis_entries", "gauge", "Keys (routes, clients, ...) held by each analyzer.")
+	for _, c := range capStats {
+		p.sample("breakout_analysis_entries", float64(c.Entries), "analyzer", c.Analyzer)
+	}
+	p.family("breakout_analysis_evicted", "counter", "Analyzer keys evicted by -analysis-max-entries.")
+	for _, c := range capStats {
+		p.sample("breakout_analysis_evicted_total", float64(c.Evicted), "analyzer", c.Analyzer)
+	}
+	p.family("breakout_analysis_expired", "counter", "Analyzer keys dropped by the -analysis-max-age window.")
+	for _, c := range capStats {
+		p.sample("breakout_analysis_expired_total", float64(c.Expired), "analyzer", c.Analyzer)
+	}
+}
+
+func writeProxyMetrics(p *promWriter, store *captureStore, broker *sseBroker) {
+	p.family("breakout_inflight_requests", "gauge", "Captured requests awaiting a response.")
+	p.sample("breakout_inflight_requests", float64(proxyInFlight.Load()))
+
+	if broker != nil {
+		p.family("breakout_sse_clients", "gauge", "Connected live-update (SSE) clients.")
+		p.sample("breakout_sse_clients", float64(broker.clientCount()))
+		p.family("breakout_sse_dropped_events", "counter", "Live-update events dropped because a client was too slow.")
+		p.sample("breakout_sse_dropped_events_total", float64(broker.dropped.Load()))
+	}
+
+	if analysisPipeline != nil {
+		st := analysisPipeline.Stats()
+		p.family("breakout_analysis_queue_depth", "gauge", "Captures waiting to be applied to the analyzers.")
+		p.sample("breakout_analysis_queue_depth", float64(st.Depth))
+		p.family("breakout_analysis_queue_capacity", "gauge", "Capacity of the analysis queue.")
+		p.sample("breakout_analysis_queue_capacity", float64(st.QueueSize))
+		p.family("breakout_analysis_dropped_events", "counter", "Captures skipped by analysis because the queue was full.")
+		p.sample("breakout_analysis_dropped_events_total", float64(st.Dropped))
+		p.family("breakout_analysis_late_events", "counter", "Captures applied after a later-stamped capture (outside the reorder window).")
+		p.sample("breakout_analysis_late_events_total", float64(st.Late))
+	}
+
+	if spanExporter != nil {
+		st := spanExporter.Stats()
+		p.family("breakout_otlp_queue_depth", "gauge", "Spans waiting to be exported over OTLP.")
+		p.sample("breakout_otlp_queue_depth", float64(st.Queued))
+		p.family("breakout_otlp_exported_spans", "counter", "Spans accepted by the OTLP collector.")
+		p.sample("breakout_otlp_exported_spans_total", float64(st.Exported))
+		p.family("breakout_otlp_dropped_spans", "counter", "Spans dropped because the OTLP export queue was full.")
+		p.sample("breakout_otlp_dropped_spans_total", float64(st.Dropped))
+		p.family("breakout_otlp_failed_spans", "counter", "Spans given up on after a rejected or failed export.")
+		p.sample("breakout_otlp_failed_spans_total", float64(st.Failed))
+	}
+
+	if store != nil {
+		n, capacity := store.occupancy()
+		p.family("breakout_store_captures", "gauge", "Captures held in the in-memory ring buffer.")
+		p.sample("breakout_store_captures", float64(n))
+		p.family("breakout_store_capacity", "gauge", "Capacity of the in-memory ring buffer.")
+		p.sample("breakout_store_capacity", float64(capacity))
+	}
+}
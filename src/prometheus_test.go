@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+func scrapeMetrics(t *testing.T, accept string) (string, string) {
+	t.Helper()
+	store := newCaptureStore(10)
+	store.add(Capture{Method: "GET", URL: "http://a/"})
+	broker := newSseBroker()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	metricsHandler(store, broker)(rec, req)
+	return rec.Body.String(), rec.Header().Get("Content-Type")
+}
+
+func TestMetricsExposition(t *testing.T) {
+	oldReg, oldMax := analysisRegistry, metricsMaxRoutes
+	defer func() { analysisRegistry, metricsMaxRoutes = oldReg, oldMax }()
+	exportedRoutes.reset()
+	defer exportedRoutes.reset()
+
+	reg := analysis.NewDefaultRegistry()
+	client := analysis.ClientID{IP: "10.0.0.9"}
+	users := analysis.RouteKey{Host: "api", Path: `/users/"x"`, Method: "GET"}
+	for i := 0; i < 3; i++ {
+		reg.OnRequest(&analysis.ObservedRequest{
+			Timestamp: time.Now(), Client: client, Route: users, Method: "GET",
+			Latency: 20 * time.Millisecond, StatusCode: 503, Outcome: analysis.Outcome5xx,
+			ReqBytes: 10, RespBytes: 100,
+		})
+	}
+	reg.OnRequest(&analysis.ObservedRequest{
+		Timestamp: time.Now(), Client: client, Method: "GET", StatusCode: 200,
+		Route: analysis.RouteKey{Host: "api", Path: "/rare", Method: "GET"},
+	})
+	analysisRegistry = reg
+	metricsMaxRoutes = 1
+
+	oldExp := spanExporter
+	defer SetSpanExporter(oldExp)
+	exp, err := newOTLPExporter(otlpConfig{Endpoint: "http://127.0.0.1:1", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Close(context.Background())
+	exp.dropped.Add(2)
+	SetSpanExporter(exp)
+
+	body, ct := scrapeMetrics(t, "")
+	if !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type = %q", ct)
+	}
+	for _, want := range []string{
+		`breakout_http_request_duration_seconds_bucket{host="api",method="GET",route="/users/\"x\"",le="0.025"} 3`,
+		`breakout_http_request_duration_seconds_count{host="api",method="GET",route="/users/\"x\""} 3`,
+		`breakout_http_request_size_bytes_sum{host="api",method="GET",route="/users/\"x\""} 30`,
+		`breakout_http_responses_total{host="api",method="GET",route="/users/\"x\"",code="503"} 3`,
+		`breakout_http_responses_total{host="other",method="other",route="other",code="200"} 1`,
+		`breakout_retry_burst_max{host="api",method="GET",route="/users/\"x\""} 3`,
+		`breakout_client_error_streak{client="10.0.0.9"} 0`,
+		`breakout_metrics_routes_folded 1`,
+		`# TYPE breakout_sse_dropped_events_total counter`,
+		`breakout_store_captures 1`,
+		`breakout_store_capacity 10`,
+		`breakout_otlp_dropped_spans_total 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+
+	om, ct := scrapeMetrics(t, "application/openmetrics-text; version=1.0.0")
+	if !strings.HasPrefix(ct, "application/openmetrics-text") || !strings.HasSuffix(om, "# EOF\n") {
+		t.Errorf("openmetrics: content type %q, tail %q", ct, om[max(0, len(om)-20):])
+	}
+	if !strings.Contains(om, "# TYPE breakout_sse_dropped_events counter") {
+		t.Errorf("openmetrics counter family should drop _total suffix")
+	}
+}
+
+func TestMetricsKeepExportedRoutes(t *testing.T) {
+	oldReg, oldMax := analysisRegistry, metricsMaxRoutes
+	defer func() { analysisRegistry, metricsMaxRoutes = oldReg, oldMax }()
+	exportedRoutes.reset()
+	defer exportedRoutes.reset()
+
+	reg := analysis.NewDefaultRegistry()
+	send := func(path string, n int) {
+		for i := 0; i < n; i++ {
+			reg.OnRequest(&analysis.ObservedRequest{
+				Timestamp: time.Now(), Method: "GET", StatusCode: 200,
+				Route: analysis.RouteKey{Host: "api", Path: path, Method: "GET"},
+			})
+		}
+	}
+	analysisRegistry = reg
+	metricsMaxRoutes = 1
+
+	send("/first", 1)
+	send("/second", 1)
+	body, _ := scrapeMetrics(t, "")
+	for _, want := range []string{
+		`breakout_http_responses_total{host="api",method="GET",route="/first",code="200"} 1`,
+		`breakout_http_responses_total{host="other",method="other",route="other",code="200"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+
+	// A route that overtakes the exported one folds into "other" instead of
+	// taking its series, so neither counter goes backwards.
+	send("/second", 5)
+	body, _ = scrapeMetrics(t, "")
+	for _, want := range []string{
+		`breakout_http_responses_total{host="api",method="GET",route="/first",code="200"} 1`,
+		`breakout_http_responses_total{host="other",method="other",route="other",code="200"} 6`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handleAnalysisReset(rec, httptest.NewRequest(http.MethodPost, "/metrics/reset", nil))
+	send("/second", 1)
+	body, _ = scrapeMetrics(t, "")
+	if want := `breakout_http_responses_total{host="api",method="GET",route="/second",code="200"} 1`; !strings.Contains(body, want) {
+		t.Errorf("reset should free the exported slots; missing %q in:\n%s", want, body)
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"HTTPBreakoutBox/src/analysis"
@@ -46,10 +47,74 @@ const (
 
 var analysisRegistry *analysis.Registry
 
+// analysisPipeline, when set, takes events off the proxy goroutine; nil
+// feeds the registry synchronously.
+var analysisPipeline *analysis.Pipeline
+
+// routeTemplater normalizes request paths into route templates for analysis.
+// nil disables templating (routes keep the concrete path).
+var routeTemplater = analysis.NewPathTemplater()
+
+func SetRouteTemplater(t *analysis.PathTemplater) {
+	routeTemplater = t
+}
+
+// routeTemplate returns the route template for a concrete path.
+func routeTemplate(host, path string) string {
+	if routeTemplater == nil {
+		return path
+	}
+	return routeTemplater.Template(host, path)
+}
+
+// proxyInFlight counts requests that have been captured but not yet answered.
+var proxyInFlight atomic.Int64
+
+// inFlightCounter breaks proxyInFlight down by upstream host and client IP.
+type inFlightCounter struct {
+	mu      sync.Mutex
+	hosts   map[string]int64
+	clients map[string]int64
+}
+
+var proxyInFlightBy = &inFlightCounter{hosts: make(map[string]int64), clients: make(map[string]int64)}
+
+func (f *inFlightCounter) add(host, client string, delta int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range []struct {
+		counts map[string]int64
+		key    string
+	}{{f.hosts, host}, {f.clients, client}} {
+		if m.counts[m.key] += delta; m.counts[m.key] <= 0 {
+			delete(m.counts, m.key)
+		}
+	}
+}
+
+// snapshot copies the current counts; keys with nothing in flight are absent.
+func (f *inFlightCounter) snapshot() (hosts, clients map[string]int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hosts = make(map[string]int64, len(f.hosts))
+	for k, v := range f.hosts {
+		hosts[k] = v
+	}
+	clients = make(map[string]int64, len(f.clients))
+	for k, v := range f.clients {
+		clients[k] = v
+	}
+	return hosts, clients
+}
+
 func SetAnalysisRegistry(r *analysis.Registry) {
 	analysisRegistry = r
 }
 
+func SetAnalysisPipeline(p *analysis.Pipeline) {
+	analysisPipeline = p
+}
+
 // classifyOutcome maps HTTP status codes into coarse-grained outcomes.
 func classifyOutcome(status int) analysis.Outcome {
 	switch {
@@ -105,19 +170,26 @@ func buildClientID(r *http.Request) analysis.ClientID {
 	}
 }
 
-// buildRouteKey normalizes the route identity.
-func buildRouteKey(r *http.Request) analysis.RouteKey {
+// requestHost returns the authority a request was sent to.
+func requestHost(r *http.Request) string {
 	host := r.Host
 	if host == "" && r.URL != nil {
 		host = r.URL.Host
 	}
-	path := ""
-	if r.URL != nil {
+	return host
+}
+
+// buildRouteKey normalizes the route identity. The path is the capture's route
+// template (/users/{id}), and RPC-over-HTTP calls are keyed by their dissected
+// method rather than the shared endpoint URL.
+func buildRouteKey(r *http.Request, c *Capture) analysis.RouteKey {
+	path := c.RouteTemplate
+	if path == "" && r.URL != nil {
 		path = r.URL.Path
 	}
 	return analysis.RouteKey{
-		Host:   host,
-		Path:   path,
+		Host:   requestHost(r),
+		Path:   rpcRoutePath(path, c.RPC),
 		Method: r.Method,
 	}
 }
@@ -149,15 +221,16 @@ func emitAnalysis(ctx *goproxy.ProxyCtx, resp *http.Response, cap Capture) {
 	respBytes := estimateBodyBytes(cap.ResponseHeaders, cap.ResponseBodyBase64)
 
 	ev := &analysis.ObservedRequest{
-		ID:         strconv.FormatInt(cap.ID, 10), // if Capture does not have ID, you can omit this or set to cap.Name.
+		ID:         strconv.FormatInt(cap.ID, 10),
 		Timestamp:  cap.Time,
 		Client:     buildClientID(r),
-		Route:      buildRouteKey(r),
+		Route:      buildRouteKey(r, &cap),
 		Latency:    latency,
 		StatusCode: resp.StatusCode,
-		Outcome:    classifyOutcome(resp.StatusCode),
+		Outcome:    rpcOutcome(classifyOutcome(resp.StatusCode), cap.RPC),
 
 		Method: r.Method,
+		Scheme: u.Scheme,
 		Proto:  r.Proto,
 		Path:   u.Path,
 		Query:  u.RawQuery,
@@ -171,14 +244,34 @@ func emitAnalysis(ctx *goproxy.ProxyCtx, resp *http.Response, cap Capture) {
 		TLSState: resp.Request.TLS,
 
 		// For now we treat the upstream server as "remote".
-		RemoteIP: net.ParseIP(parseHostPort(cap.ServerAddr)),
+		RemoteIP:   net.ParseIP(parseHostPort(cap.ServerAddr)),
+		ServerAddr: cap.ServerAddr,
+		ReusedConn: cap.ReusedConn,
+		HTTP2:      cap.HTTP2,
 		// LocalIP is not trivially available here; leave zero-valued or
 		// extend your phases struct to capture it via httptrace if desired.
 		LocalIP: nil,
 
 		TransportErr: nil, // you can thread actual transport errors into Capture if you want.
+
+		Phases: capturePhases(cap),
+
+		ReqBody:           []byte(cap.RequestBodyBase64),
+		RespBody:          []byte(cap.ResponseBodyBase64),
+		ReqBodyTruncated:  cap.ReqBodyTruncated,
+		RespBodyTruncated: cap.RespBodyTruncated,
+
+		ContractChecked:    cap.ContractChecked,
+		ContractViolations: cap.ContractViolations,
+
+		SensitiveScanned:  cap.SensitiveScanned,
+		SensitiveFindings: cap.SensitiveFindings,
 	}
 
+	if analysisPipeline != nil {
+		analysisPipeline.Submit(ev)
+		return
+	}
 	analysisRegistry.OnRequest(ev)
 }
 
@@ -223,6 +316,8 @@ func extractCookieKeys(h http.Header) []string {
 
 func startCapture(r *http.Request, start time.Time) Capture {
 	key := reqKey(r)
+	// Runs before the header copy so an injected ID is recorded as sent.
+	correlationID, traceID := assignCorrelation(r)
 	reqHeaders := make(map[string][]string, len(r.Header))
 	for k, v := range r.Header {
 		reqHeaders[k] = append([]string(nil), v...)
@@ -282,6 +377,14 @@ func startCapture(r *http.Request, start time.Time) Capture {
 		UserAgent:         r.UserAgent(),
 		Proto:             r.Proto,
 		Scheme:            r.URL.Scheme,
+		RouteTemplate:     routeTemplate(requestHost(r), r.URL.Path),
+		CorrelationID:     correlationID,
+		TraceID:           traceID,
+	}
+	if tc, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		c.ParentSpanID = tc.ParentID
+		c.TraceFlags = tc.Flags
+		c.TraceState = strings.Join(r.Header.Values("tracestate"), ",")
 	}
 	if len(bodyStr) > maxStoredBody {
 		c.ReqBodyTruncated = true
@@ -386,6 +489,10 @@ func finishCapture(c *Capture, resp http.Response, ctx *goproxy.ProxyCtx) Captur
 		resp.Body = newRespBody
 		c.ResponseBodyBase64 = respBodyStr
 		c.ResponseBodyBytes = int64(len(respBodyStr))
+		if len(respBodyStr) > maxStoredBody {
+			c.RespBodyTruncated = true
+		}
+		c.RPC = dissectCapture(c)
 	}
 
 	// timings you already compute (keep your existing phase merge here)
@@ -400,6 +507,7 @@ func finishCapture(c *Capture, resp http.Response, ctx *goproxy.ProxyCtx) Captur
 		c.TTFBMs = millis(p.wroteReq, p.firstByte)
 		c.RespReadMs = millis(p.firstByte, p.done)
 		c.TotalMs = millis(p.startRT, p.done)
+		c.ConnWaitMs = millis(p.getConn, p.gotConn)
 		c.ServerAddr = p.serverAddr
 		c.ReusedConn = p.reused
 		if resp.Request != nil && resp.Request.TLS != nil {
@@ -470,7 +578,9 @@ func buildProxyHandler(mitmEnabled bool, store *captureStore, broker *sseBroker,
 				p.tlsEnd = time.Now()
 				p.h2 = (cs.NegotiatedProtocol == "h2")
 			},
+			GetConn: func(string) { p.getConn = time.Now() },
 			GotConn: func(ci httptrace.GotConnInfo) {
+				p.gotConn = time.Now()
 				p.reused = ci.Reused
 				if ci.Conn != nil && ci.Conn.RemoteAddr() != nil {
 					p.serverAddr = ci.Conn.RemoteAddr().String()
@@ -484,30 +594,56 @@ func buildProxyHandler(mitmEnabled bool, store *captureStore, broker *sseBroker,
 
 		ctx.UserData = start
 		reqMap.Store(key, c)
+		proxyInFlight.Add(1)
+		proxyInFlightBy.add(requestHost(r), c.ClientIP, 1)
 		r = r.WithContext(httptrace.WithClientTrace(r.Context(), ct))
 		return r, nil
 	})
 
 	// Capture response
 	proxy.OnResponse().DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
-		if isPaused() || resp == nil || ctx == nil || ctx.Req == nil {
+		if ctx == nil || ctx.Req == nil {
 			return resp
 		}
 		key := reqKey(ctx.Req)
-		val, ok := reqMap.Load(key)
+		if isPaused() || resp == nil {
+			// Upstream failed (or capture paused mid-flight): forget the partial.
+			if v, ok := reqMap.LoadAndDelete(key); ok {
+				proxyInFlight.Add(-1)
+				proxyInFlightBy.add(requestHost(ctx.Req), v.(Capture).ClientIP, -1)
+			}
+			return resp
+		}
+		val, ok := reqMap.LoadAndDelete(key)
 		if !ok {
 			return resp
 		}
+		proxyInFlight.Add(-1)
 		partial := val.(Capture)
+		proxyInFlightBy.add(requestHost(ctx.Req), partial.ClientIP, -1)
 
 		finishCapture(&partial, *resp, ctx)
-
-		// Send this capture into the analysis pipeline.
-		emitAnalysis(ctx, resp, partial)
+		validateContract(&partial)
+		scanSensitive(&partial)
 
 		stored := store.add(partial)
+
+		// Send this capture into the analysis pipeline; after store.add so
+		// analyzers see the capture ID.
+		emitAnalysis(ctx, resp, stored)
+
 		broker.publish(stored)
-		reqMap.Delete(key)
+		alerting.observe(&stored)
+		if len(stored.ContractViolations) > 0 {
+			broker.publishEvent("contract", contractEvent{
+				CaptureID:  stored.ID,
+				Method:     stored.Method,
+				URL:        stored.URL,
+				Status:     stored.ResponseStatus,
+				Violations: stored.ContractViolations,
+			})
+		}
+		spanExporter.enqueue(stored)
 
 		log.Printf("Response '%s' Status %s", resp.Request.URL.String(), resp.Status)
 		return resp
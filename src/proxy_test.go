@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elazarl/goproxy"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// captureExchange runs a GET and its response through the proxy's capture
+// path, as the request and response handlers do.
+func captureExchange(t *testing.T, url string, respHeader http.Header, body string) Capture {
+	t.Helper()
+	req := httptest.NewRequest("GET", url, nil)
+	c := startCapture(req, time.Now())
+	resp := http.Response{
+		StatusCode: 200,
+		Header:     respHeader,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+	return finishCapture(&c, resp, &goproxy.ProxyCtx{Req: req, UserData: time.Now()})
+}
+
+func TestFinishCaptureFlagsTruncatedResponses(t *testing.T) {
+	old := maxStoredBody
+	defer func() { maxStoredBody = old }()
+	maxStoredBody = 16
+
+	short := captureExchange(t, "http://cdn/small", http.Header{}, "tiny")
+	if short.RespBodyTruncated {
+		t.Fatalf("short body flagged as truncated")
+	}
+
+	// Two large responses that only differ past the stored prefix.
+	hdr := func() http.Header {
+		return http.Header{"Cache-Control": {"max-age=0"}, "Etag": {`"v"`}}
+	}
+	prefix := strings.Repeat("x", 32)
+	a := analysis.NewCachingAnalyzer()
+	a.MinRequests = 1
+	for i, tail := range []string{"first-version", "second-version"} {
+		c := captureExchange(t, "http://cdn/big", hdr(), prefix+tail)
+		if !c.RespBodyTruncated {
+			t.Fatalf("response %d: body over max-body not flagged as truncated", i)
+		}
+		c.Time = time.Date(2024, 5, 1, 12, i, 0, 0, time.UTC)
+		a.OnRequest(observedFromCapture(c))
+	}
+	snap := a.Snapshot(0)
+	if len(snap) != 1 {
+		t.Fatalf("caching snapshot = %+v", snap)
+	}
+	if s := snap[0]; s.Identical != 0 || s.WastedBytes != 0 {
+		t.Fatalf("truncated bodies compared as identical: %+v", s)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"HTTPBreakoutBox/src/analysis"
+)
+
+// maxSensitiveFindings caps the findings recorded on one capture.
+const maxSensitiveFindings = 20
+
+// maxSensitiveScan bounds the bytes of each body that are scanned. The scan
+// runs on the proxy's response path, so -max-body must not make it slower.
+const maxSensitiveScan = 256 << 10
+
+// credentialHeaders are where credentials are supposed to travel; tokens in
+// them are expected and not reported.
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// scanSensitive looks for secrets and PII in a finished capture's URL, query
+// string, headers and bodies and records the masked findings on it.
+func scanSensitive(c *Capture) {
+	c.SensitiveScanned, c.SensitiveFindings = false, nil
+	if c.Method == http.MethodConnect {
+		return
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return
+	}
+	c.SensitiveScanned = true
+
+	var out []analysis.SensitiveFinding
+	out = append(out, analysis.ScanSensitive([]byte(u.Path), "request", analysis.LocationURL, "")...)
+	q := u.Query()
+	names := make([]string, 0, len(q))
+	for name := range q {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range q[name] {
+			found := analysis.ScanSensitive([]byte(v), "request", analysis.LocationQuery, name)
+			if len(found) == 0 && v != "" && analysis.CredentialParam(name) {
+				found = append(found, analysis.SensitiveFinding{
+					Kind:     analysis.SensitiveCredentialParam,
+					Category: analysis.SensitiveSecret,
+					Where:    "request",
+					Location: analysis.LocationQuery,
+					Field:    name,
+					Masked:   analysis.MaskSensitive(analysis.SensitiveCredentialParam, v),
+				})
+			}
+			out = append(out, found...)
+		}
+	}
+	out = append(out, scanSensitiveHeaders(c.RequestHeaders, "request")...)
+	out = append(out, scanSensitiveHeaders(c.ResponseHeaders, "response")...)
+	if c.GRPC == nil && !c.IsGRPC {
+		if textualBody(c.RequestHeaders) {
+			out = append(out, analysis.ScanSensitive(scanPrefix(c.RequestBodyBase64), "request", analysis.LocationBody, "")...)
+		}
+		if textualBody(c.ResponseHeaders) {
+			out = append(out, analysis.ScanSensitive(scanPrefix(c.ResponseBodyBase64), "response", analysis.LocationBody, "")...)
+		}
+	}
+
+	seen := make(map[analysis.SensitiveFinding]bool, len(out))
+	for _, f := range out {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		c.SensitiveFindings = append(c.SensitiveFindings, f)
+		if len(c.SensitiveFindings) == maxSensitiveFindings {
+			break
+		}
+	}
+}
+
+// scanPrefix returns the part of a body that is scanned.
+func scanPrefix(body string) []byte {
+	if len(body) > maxSensitiveScan {
+		body = body[:maxSensitiveScan]
+	}
+	return []byte(body)
+}
+
+func scanSensitiveHeaders(h map[string][]string, where string) []analysis.SensitiveFinding {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		if !credentialHeaders[http.CanonicalHeaderKey(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var out []analysis.SensitiveFinding
+	for _, name := range names {
+		for _, v := range h[name] {
+			out = append(out, analysis.ScanSensitive([]byte(v), where, analysis.LocationHeader, name)...)
+		}
+	}
+	return out
+}
+
+// textualBody reports whether a body with these headers is worth scanning;
+// media, fonts and archives only produce accidental matches.
+func textualBody(h map[string][]string) bool {
+	mt, _, err := mime.ParseMediaType(headerValue(h, "Content-Type"))
+	if err != nil {
+		return true // untyped bodies are scanned
+	}
+	switch {
+	case strings.HasPrefix(mt, "image/"), strings.HasPrefix(mt, "audio/"),
+		strings.HasPrefix(mt, "video/"), strings.HasPrefix(mt, "font/"):
+		return false
+	case mt == "application/octet-stream", mt == "application/zip", mt == "application/gzip",
+		mt == "application/pdf", strings.HasPrefix(mt, "application/grpc"):
+		return false
+	}
+	return true
+}
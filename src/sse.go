@@ -5,23 +5,32 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// sseMessage is one queued event. An empty name is the default "message"
+// event, whose payload is a Capture.
+type sseMessage struct {
+	name string
+	data any
+}
+
 // SSE broadcaster for live updates
 type sseBroker struct {
 	sync.Mutex
-	clients map[chan Capture]struct{}
+	clients map[chan sseMessage]struct{}
+	dropped atomic.Int64 // events not delivered to a slow client
 }
 
 func newSseBroker() *sseBroker {
 	return &sseBroker{
-		clients: make(map[chan Capture]struct{}),
+		clients: make(map[chan sseMessage]struct{}),
 	}
 }
 
-func (b *sseBroker) addClient() chan Capture {
-	ch := make(chan Capture, 16)
+func (b *sseBroker) addClient() chan sseMessage {
+	ch := make(chan sseMessage, 16)
 	b.Lock()
 	b.clients[ch] = struct{}{}
 	n := len(b.clients)
@@ -29,7 +38,7 @@ func (b *sseBroker) addClient() chan Capture {
 	log.Printf("SSE: clients=%d", n)
 	return ch
 }
-func (b *sseBroker) removeClient(ch chan Capture) {
+func (b *sseBroker) removeClient(ch chan sseMessage) {
 	b.Lock()
 	delete(b.clients, ch)
 	n := len(b.clients)
@@ -38,17 +47,39 @@ func (b *sseBroker) removeClient(ch chan Capture) {
 	log.Printf("SSE: clients=%d", n)
 }
 func (b *sseBroker) publish(c Capture) {
+	n := b.send(sseMessage{data: c})
+	log.Printf("SSE: published id=%d to %d client(s)", c.ID, n)
+}
+
+// publishEvent broadcasts a named event (e.g. "contract"); clients listen
+// for it with EventSource.addEventListener(name, ...).
+func (b *sseBroker) publishEvent(name string, payload any) {
+	n := b.send(sseMessage{name: name, data: payload})
+	if isVerbose() {
+		log.Printf("SSE: published %s event to %d client(s)", name, n)
+	}
+}
+
+func (b *sseBroker) send(m sseMessage) int {
 	b.Lock()
+	defer b.Unlock()
 	n := 0
 	for ch := range b.clients {
 		n++
 		select {
-		case ch <- c:
+		case ch <- m:
 		default: /* drop if slow */
+			b.dropped.Add(1)
 		}
 	}
-	b.Unlock()
-	log.Printf("SSE: published id=%d to %d client(s)", c.ID, n)
+	return n
+}
+
+// clientCount returns the number of connected SSE clients.
+func (b *sseBroker) clientCount() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.clients)
 }
 
 func sseHandler(b *sseBroker) http.HandlerFunc {
@@ -82,11 +113,14 @@ func sseHandler(b *sseBroker) http.HandlerFunc {
 		notify := r.Context().Done()
 		for {
 			select {
-			case c, ok := <-ch:
+			case m, ok := <-ch:
 				if !ok {
 					return
 				}
-				bts, _ := json.Marshal(c)
+				bts, _ := json.Marshal(m.data)
+				if m.name != "" {
+					_, _ = w.Write([]byte("event: " + m.name + "\n"))
+				}
 				_, _ = w.Write([]byte("data: "))
 				_, _ = w.Write(bts)
 				_, _ = w.Write([]byte("\n\n"))
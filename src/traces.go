@@ -0,0 +1,291 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"time"
+)
+
+// traceSegment is one bar of a span's waterfall, positioned relative to the
+// start of the whole trace.
+type traceSegment struct {
+	Phase      string `json:"phase"` // dns | connect | tls | send | ttfb | read
+	OffsetMs   int64  `json:"offset_ms"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// traceSpan is a capture viewed as a span of a distributed trace.
+type traceSpan struct {
+	CaptureID int64 `json:"capture_id"`
+	// SpanID is the server's span from a traceresponse header, if it sent
+	// one; ParentSpanID is the parent-id the caller propagated in
+	// traceparent, i.e. the span that issued this request.
+	SpanID       string `json:"span_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+	// ParentCaptureID is the capture this span was attached to (see
+	// assembleTrace).
+	ParentCaptureID int64  `json:"parent_capture_id,omitempty"`
+	Name            string `json:"name"`
+	Method          string `json:"method"`
+	Host            string `json:"host"`
+	URL             string `json:"url"`
+	Status          int    `json:"status"`
+	Error           bool   `json:"error,omitempty"`
+	TraceState      string `json:"tracestate,omitempty"`
+
+	Start      time.Time `json:"start"`
+	OffsetMs   int64     `json:"offset_ms"`
+	DurationMs int64     `json:"duration_ms"`
+
+	DNSMs      int64 `json:"dns_ms,omitempty"`
+	ConnectMs  int64 `json:"connect_ms,omitempty"`
+	TLSMs      int64 `json:"tls_ms,omitempty"`
+	SendMs     int64 `json:"send_ms,omitempty"`
+	TTFBMs     int64 `json:"ttfb_ms,omitempty"`
+	RespReadMs int64 `json:"resp_read_ms,omitempty"`
+
+	ServerAddr string `json:"server_addr,omitempty"`
+	ReusedConn bool   `json:"reused_conn,omitempty"`
+	HTTP2      bool   `json:"h2,omitempty"`
+
+	Waterfall []traceSegment `json:"waterfall,omitempty"`
+	Children  []*traceSpan   `json:"children,omitempty"`
+
+	end time.Time
+}
+
+// traceTree is a reconstructed trace: root spans with nested children.
+type traceTree struct {
+	TraceID    string       `json:"trace_id"`
+	Start      time.Time    `json:"start"`
+	DurationMs int64        `json:"duration_ms"`
+	SpanCount  int          `json:"span_count"`
+	ErrorCount int          `json:"error_count"`
+	Hosts      []string     `json:"hosts"`
+	Roots      []*traceSpan `json:"roots"`
+}
+
+// traceSummary is the list view of a trace.
+type traceSummary struct {
+	TraceID    string    `json:"trace_id"`
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"duration_ms"`
+	SpanCount  int       `json:"span_count"`
+	ErrorCount int       `json:"error_count"`
+	RootName   string    `json:"root_name"`
+	Hosts      []string  `json:"hosts"`
+}
+
+// spanFromCapture converts a capture into a span with its waterfall phases.
+func spanFromCapture(c Capture) *traceSpan {
+	dur := c.TotalMs
+	if dur <= 0 {
+		dur = c.DurationMs
+	}
+	host, name := "", c.Method+" "+c.URL
+	if u, err := url.Parse(c.URL); err == nil {
+		host = u.Host
+		name = c.Method + " " + u.Host + u.Path
+	}
+	s := &traceSpan{
+		CaptureID:    c.ID,
+		ParentSpanID: c.ParentSpanID,
+		Name:         name,
+		Method:       c.Method,
+		Host:         host,
+		URL:          c.URL,
+		Status:       c.ResponseStatus,
+		Error:        c.ResponseStatus == 0 || c.ResponseStatus >= 500,
+		TraceState:   c.TraceState,
+		Start:        c.Time,
+		DurationMs:   dur,
+		DNSMs:        c.DNSMs,
+		ConnectMs:    c.ConnectMs,
+		TLSMs:        c.TLSMs,
+		SendMs:       c.SendMs,
+		TTFBMs:       c.TTFBMs,
+		RespReadMs:   c.RespReadMs,
+		ServerAddr:   c.ServerAddr,
+		ReusedConn:   c.ReusedConn,
+		HTTP2:        c.HTTP2,
+		end:          c.Time.Add(time.Duration(dur) * time.Millisecond),
+	}
+	if tc, ok := parseTraceparent(headerValue(c.ResponseHeaders, "traceresponse")); ok && tc.TraceID == c.TraceID {
+		s.SpanID = tc.ParentID
+	}
+	return s
+}
+
+// layoutWaterfall fills offsets and phase segments relative to traceStart.
+func (s *traceSpan) layoutWaterfall(traceStart time.Time) {
+	s.OffsetMs = s.Start.Sub(traceStart).Milliseconds()
+	at := s.OffsetMs
+	for _, p := range []struct {
+		name string
+		ms   int64
+	}{
+		{"dns", s.DNSMs},
+		{"connect", s.ConnectMs},
+		{"tls", s.TLSMs},
+		{"send", s.SendMs},
+		{"ttfb", s.TTFBMs},
+		{"read", s.RespReadMs},
+	} {
+		if p.ms <= 0 {
+			continue
+		}
+		s.Waterfall = append(s.Waterfall, traceSegment{Phase: p.name, OffsetMs: at, DurationMs: p.ms})
+		at += p.ms
+	}
+}
+
+// encloses reports whether s started no later and ended no earlier than o.
+func (s *traceSpan) encloses(o *traceSpan) bool {
+	return !s.Start.After(o.Start) && !s.end.Before(o.end)
+}
+
+// tightestEncloser returns the shortest of cands that encloses s in time.
+func tightestEncloser(cands []*traceSpan, s *traceSpan) *traceSpan {
+	var parent *traceSpan
+	for _, cand := range cands {
+		if !cand.encloses(s) {
+			continue
+		}
+		if parent == nil || parent.encloses(cand) {
+			parent = cand
+		}
+	}
+	return parent
+}
+
+// assembleTrace builds the span tree for one trace from its captures.
+//
+// A span whose propagated parent-id names another capture's server span
+// (from traceresponse) is attached to that capture. Spans propagating the
+// same parent-id were issued by the same caller and are kept siblings,
+// however they overlap: the group is attached to the tightest earlier span
+// enclosing all of it. Only spans without a parent-id are placed by their
+// own time containment.
+func assembleTrace(traceID string, caps []Capture) *traceTree {
+	if len(caps) == 0 {
+		return nil
+	}
+	spans := make([]*traceSpan, 0, len(caps))
+	for _, c := range caps {
+		spans = append(spans, spanFromCapture(c))
+	}
+	// Earlier start first; for equal starts the longer span is the outer one.
+	sort.SliceStable(spans, func(i, j int) bool {
+		if !spans[i].Start.Equal(spans[j].Start) {
+			return spans[i].Start.Before(spans[j].Start)
+		}
+		return spans[i].end.After(spans[j].end)
+	})
+
+	// Time extent of each sibling group.
+	groups := make(map[string]*traceSpan)
+	for _, s := range spans {
+		if s.ParentSpanID == "" {
+			continue
+		}
+		g := groups[s.ParentSpanID]
+		if g == nil {
+			groups[s.ParentSpanID] = &traceSpan{Start: s.Start, end: s.end}
+			continue
+		}
+		if s.end.After(g.end) {
+			g.end = s.end
+		}
+	}
+
+	t := &traceTree{TraceID: traceID, Start: spans[0].Start}
+	end := spans[0].end
+	hosts := make(map[string]struct{})
+	bySpanID := make(map[string]*traceSpan)
+	groupParent := make(map[string]*traceSpan)
+	for i, s := range spans {
+		if s.end.After(end) {
+			end = s.end
+		}
+		if s.Error {
+			t.ErrorCount++
+		}
+		if _, dup := hosts[s.Host]; !dup && s.Host != "" {
+			hosts[s.Host] = struct{}{}
+			t.Hosts = append(t.Hosts, s.Host)
+		}
+		s.layoutWaterfall(t.Start)
+
+		// Parents are always chosen among earlier spans, so there are no cycles.
+		var parent *traceSpan
+		if s.ParentSpanID == "" {
+			parent = tightestEncloser(spans[:i], s)
+		} else {
+			p, ok := groupParent[s.ParentSpanID]
+			if !ok {
+				// First member of the group: no sibling comes earlier.
+				if p, ok = bySpanID[s.ParentSpanID]; !ok {
+					p = tightestEncloser(spans[:i], groups[s.ParentSpanID])
+				}
+				groupParent[s.ParentSpanID] = p
+			}
+			parent = p
+		}
+		if s.SpanID != "" {
+			bySpanID[s.SpanID] = s
+		}
+		if parent == nil {
+			t.Roots = append(t.Roots, s)
+			continue
+		}
+		s.ParentCaptureID = parent.CaptureID
+		parent.Children = append(parent.Children, s)
+	}
+	t.SpanCount = len(spans)
+	t.DurationMs = end.Sub(t.Start).Milliseconds()
+	return t
+}
+
+// buildTraces groups captures by trace ID and assembles every trace.
+func buildTraces(caps []Capture) []*traceTree {
+	byTrace := make(map[string][]Capture)
+	var order []string
+	for _, c := range caps {
+		if c.TraceID == "" || c.Deleted {
+			continue
+		}
+		if _, ok := byTrace[c.TraceID]; !ok {
+			order = append(order, c.TraceID)
+		}
+		byTrace[c.TraceID] = append(byTrace[c.TraceID], c)
+	}
+	out := make([]*traceTree, 0, len(order))
+	for _, id := range order {
+		if t := assembleTrace(id, byTrace[id]); t != nil {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// summarizeTraces returns list views, most recent first.
+func summarizeTraces(trees []*traceTree) []traceSummary {
+	out := make([]traceSummary, 0, len(trees))
+	for _, t := range trees {
+		root := ""
+		if len(t.Roots) > 0 {
+			root = t.Roots[0].Name
+		}
+		out = append(out, traceSummary{
+			TraceID:    t.TraceID,
+			Start:      t.Start,
+			DurationMs: t.DurationMs,
+			SpanCount:  t.SpanCount,
+			ErrorCount: t.ErrorCount,
+			RootName:   root,
+			Hosts:      t.Hosts,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.After(out[j].Start) })
+	return out
+}
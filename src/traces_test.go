@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssembleTraceNestsByTimeContainment(t *testing.T) {
+	t0 := time.Unix(1000, 0).UTC()
+	caps := []Capture{
+		// inner call made by the service behind "gateway"
+		{ID: 2, Method: "GET", URL: "http://users.svc/users/1", Time: t0.Add(20 * time.Millisecond),
+			TotalMs: 50, TraceID: "t", ParentSpanID: "bbbb", ResponseStatus: 200, DNSMs: 5, ConnectMs: 10, TTFBMs: 30, RespReadMs: 5},
+		{ID: 1, Method: "GET", URL: "http://gateway/api/profile?x=1", Time: t0,
+			TotalMs: 120, TraceID: "t", ParentSpanID: "aaaa", ResponseStatus: 200},
+		{ID: 3, Method: "GET", URL: "http://billing.svc/plan", Time: t0.Add(80 * time.Millisecond),
+			TotalMs: 30, TraceID: "t", ParentSpanID: "cccc", ResponseStatus: 503},
+	}
+
+	tree := assembleTrace("t", caps)
+	if tree == nil {
+		t.Fatalf("expected a trace tree")
+	}
+	if tree.SpanCount != 3 || tree.ErrorCount != 1 || tree.DurationMs != 120 {
+		t.Fatalf("unexpected tree totals: %#v", tree)
+	}
+	if len(tree.Roots) != 1 || tree.Roots[0].CaptureID != 1 {
+		t.Fatalf("expected capture 1 as sole root, got %#v", tree.Roots)
+	}
+	root := tree.Roots[0]
+	if root.Name != "GET gateway/api/profile" {
+		t.Fatalf("unexpected root name %q", root.Name)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("expected 2 children under root, got %d", len(root.Children))
+	}
+	child := root.Children[0]
+	if child.CaptureID != 2 || child.ParentSpanID != "bbbb" || child.ParentCaptureID != 1 || child.OffsetMs != 20 {
+		t.Fatalf("unexpected first child: %#v", child)
+	}
+	// dns(5) connect(10) ttfb(30) read(5), laid out back to back from offset 20
+	if len(child.Waterfall) != 4 || child.Waterfall[2].Phase != "ttfb" || child.Waterfall[2].OffsetMs != 35 {
+		t.Fatalf("unexpected waterfall: %#v", child.Waterfall)
+	}
+}
+
+func TestAssembleTraceLinksByPropagatedParentID(t *testing.T) {
+	const trace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	t0 := time.Unix(1000, 0).UTC()
+	caps := []Capture{
+		{ID: 1, Method: "GET", URL: "http://gateway/api/profile", Time: t0, TotalMs: 200, TraceID: trace,
+			ParentSpanID:    "00f067aa0ba902b7",
+			ResponseHeaders: map[string][]string{"Traceresponse": {"00-" + trace + "-b7ad6b7169203331-01"}}},
+		// Two concurrent calls from the gateway's span; the second lies
+		// entirely within the first but is its sibling, not its child.
+		{ID: 2, Method: "GET", URL: "http://users.svc/users/1", Time: t0.Add(10 * time.Millisecond), TotalMs: 100,
+			TraceID: trace, ParentSpanID: "b7ad6b7169203331"},
+		{ID: 3, Method: "GET", URL: "http://cache.svc/profile/1", Time: t0.Add(20 * time.Millisecond), TotalMs: 30,
+			TraceID: trace, ParentSpanID: "b7ad6b7169203331"},
+		// Made by the users service, which sends no traceresponse.
+		{ID: 4, Method: "GET", URL: "http://db.svc/q", Time: t0.Add(60 * time.Millisecond), TotalMs: 10,
+			TraceID: trace, ParentSpanID: "e457b5a2e4d86bd1"},
+	}
+
+	tree := assembleTrace(trace, caps)
+	if len(tree.Roots) != 1 || tree.Roots[0].CaptureID != 1 || tree.Roots[0].SpanID != "b7ad6b7169203331" {
+		t.Fatalf("expected capture 1 as sole root, got %#v", tree.Roots)
+	}
+	kids := tree.Roots[0].Children
+	if len(kids) != 2 || kids[0].CaptureID != 2 || kids[1].CaptureID != 3 {
+		t.Fatalf("expected captures 2 and 3 as siblings under the gateway, got %#v", kids)
+	}
+	for _, k := range kids {
+		if k.ParentCaptureID != 1 || k.ParentSpanID != "b7ad6b7169203331" {
+			t.Fatalf("unexpected parent of capture %d: %#v", k.CaptureID, k)
+		}
+	}
+	if len(kids[1].Children) != 0 || len(kids[0].Children) != 1 || kids[0].Children[0].CaptureID != 4 {
+		t.Fatalf("capture 4 should fall back to its enclosing span 2: %#v", kids)
+	}
+}
+
+func TestBuildTracesSkipsUntracedCaptures(t *testing.T) {
+	caps := []Capture{
+		{ID: 1, URL: "http://a/", Time: time.Unix(1, 0), TraceID: "t1"},
+		{ID: 2, URL: "http://b/", Time: time.Unix(2, 0)},
+		{ID: 3, URL: "http://c/", Time: time.Unix(3, 0), TraceID: "t2"},
+	}
+	sums := summarizeTraces(buildTraces(caps))
+	if len(sums) != 2 || sums[0].TraceID != "t2" || sums[1].TraceID != "t1" {
+		t.Fatalf("unexpected summaries: %#v", sums)
+	}
+}
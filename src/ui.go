@@ -4,6 +4,7 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
@@ -64,6 +65,7 @@ func buildUIHandler(store *captureStore, rules *ruleStore, broker *sseBroker, se
 		_ = json.NewEncoder(w).Encode(PersistedData{
 			Captures:   store.list(),
 			ColorRules: rules.getAll(),
+			AlertRules: alerting.getAll(),
 		})
 	})
 
@@ -173,6 +175,213 @@ func buildUIHandler(store *captureStore, rules *ruleStore, broker *sseBroker, se
 		}
 	})
 
+	mux.HandleFunc("/api/alerts", handleAlerts)
+	mux.HandleFunc("/api/alerts/", handleAlert)
+
+	// GET /api/openapi.json[?host=&title=&version=] -> OpenAPI 3.1 inferred from captures
+	// GET /api/openapi.yaml -> same document as a YAML download
+	openAPI := func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		doc := inferOpenAPI(store.list(), openAPIOptions{
+			Title:   q.Get("title"),
+			Version: q.Get("version"),
+			Host:    q.Get("host"),
+		})
+		if strings.HasSuffix(r.URL.Path, ".yaml") {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Header().Set("Content-Disposition", `attachment; filename="openapi.yaml"`)
+			_, _ = w.Write(marshalOpenAPIYAML(doc))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(doc)
+	}
+	mux.HandleFunc("/api/openapi.json", openAPI)
+	mux.HandleFunc("/api/openapi.yaml", openAPI)
+
+	// GET /api/route-templates -> []string override patterns
+	// PUT /api/route-templates <- []string (replaces overrides)
+	mux.HandleFunc("/api/route-templates", func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		if routeTemplater == nil {
+			http.Error(w, "route templating disabled", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(routeTemplater.Overrides())
+		case http.MethodPut:
+			var incoming []string
+			if err := json.NewDecoder(r.Body).Decode(&incoming); err != nil {
+				http.Error(w, "bad json", http.StatusBadRequest)
+				return
+			}
+			routeTemplater.SetOverrides(incoming)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"updated": len(routeTemplater.Overrides())})
+		default:
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// GET    /api/contracts        -> loaded OpenAPI contracts, one per host
+	// PUT    /api/contracts/{host} <- OpenAPI 3.x JSON document (replaces)
+	// DELETE /api/contracts/{host}
+	mux.HandleFunc("/api/contracts", func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(contracts.list())
+	})
+	mux.HandleFunc("/api/contracts/", func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		host := strings.TrimPrefix(r.URL.Path, "/api/contracts/")
+		if host == "" || strings.Contains(host, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			data, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+			if err != nil {
+				http.Error(w, "read body", http.StatusBadRequest)
+				return
+			}
+			spec, err := parseContract(host, "api", data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			installContract(spec, store)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(spec.info())
+		case http.MethodDelete:
+			if !uninstallContract(host) {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/coverage", handleCoverageReport)
+	mux.HandleFunc("/api/coverage.html", handleCoverageReport)
+
+	// GET /api/correlations?min=<N> -> captures grouped by trace/correlation ID
+	mux.HandleFunc("/api/correlations", func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		minCount := 2
+		if s := r.URL.Query().Get("min"); s != "" {
+			if v, err := strconv.Atoi(s); err == nil && v > 0 {
+				minCount = v
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(groupByCorrelation(store.list(), minCount))
+	})
+
+	// GET /api/correlations/{id} -> captures sharing a correlation or trace ID
+	mux.HandleFunc("/api/correlations/", func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/correlations/")
+		if id == "" || strings.Contains(id, "/") {
+			http.Error(w, "missing id", http.StatusBadRequest)
+			return
+		}
+		caps := store.byCorrelation(id)
+		if len(caps) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(caps)
+	})
+
+	// GET /api/traces?limit=<K> -> reconstructed W3C traces, most recent first
+	mux.HandleFunc("/api/traces", func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		limit := 100
+		if s := r.URL.Query().Get("limit"); s != "" {
+			if v, err := strconv.Atoi(s); err == nil && v > 0 {
+				limit = v
+			}
+		}
+		out := summarizeTraces(buildTraces(store.list()))
+		if len(out) > limit {
+			out = out[:limit]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	})
+
+	// GET /api/traces/{traceId} -> span tree with waterfall timing
+	mux.HandleFunc("/api/traces/", func(w http.ResponseWriter, r *http.Request) {
+		if isVerbose() {
+			log.Printf("UI Request URI: %s %s", r.Method, r.RequestURI)
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/traces/"))
+		if id == "" || strings.Contains(id, "/") {
+			http.Error(w, "missing trace id", http.StatusBadRequest)
+			return
+		}
+		var caps []Capture
+		for _, c := range store.byCorrelation(id) {
+			if c.TraceID == id {
+				caps = append(caps, c)
+			}
+		}
+		tree := assembleTrace(id, caps)
+		if tree == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tree)
+	})
+
 	// SSE events
 	mux.HandleFunc("/events", sseHandler(broker))
 
@@ -219,7 +219,7 @@ function renderRouteLatencyTable(rows) {
     if (!rows || !rows.length) {
         const tr = document.createElement('tr');
         const td = document.createElement('td');
-        td.colSpan = 9;
+        td.colSpan = 12;
         td.textContent = 'No routes with sufficient samples yet.';
         tr.appendChild(td);
         tbody.appendChild(tr);
@@ -253,6 +253,15 @@ function renderRouteLatencyTable(rows) {
         const maxCell = document.createElement('td');
         maxCell.textContent = row.max_ms.toFixed(2);
 
+        const p50Cell = document.createElement('td');
+        p50Cell.textContent = (row.p50_ms || 0).toFixed(2);
+
+        const p95Cell = document.createElement('td');
+        p95Cell.textContent = (row.p95_ms || 0).toFixed(2);
+
+        const p99Cell = document.createElement('td');
+        p99Cell.textContent = (row.p99_ms || 0).toFixed(2);
+
         const lastCell = document.createElement('td');
         const last = row.last_updated ? new Date(row.last_updated) : null;
         lastCell.textContent = last ? last.toLocaleString() : '';
@@ -265,6 +274,9 @@ function renderRouteLatencyTable(rows) {
         tr.appendChild(stddevCell);
         tr.appendChild(minCell);
         tr.appendChild(maxCell);
+        tr.appendChild(p50Cell);
+        tr.appendChild(p95Cell);
+        tr.appendChild(p99Cell);
         tr.appendChild(lastCell);
 
         tbody.appendChild(tr);
@@ -967,6 +979,124 @@ async function initResponseProfileTable() {
 }
 
 
+async function fetchSecurityFindings(severity = '', limit = 200) {
+    const params = new URLSearchParams();
+    if (severity) params.set('severity', severity);
+    if (limit > 0) params.set('limit', String(limit));
+
+    const res = await fetch(`/metrics/security/headers?${params.toString()}`);
+    if (!res.ok) {
+        throw new Error('Failed to fetch security header findings: ' + res.status);
+    }
+    return res.json();
+}
+
+function renderSecurityTable(rows) {
+    const table = document.getElementById('securityTable');
+    if (!table) {
+        return;
+    }
+    const tbody = table.querySelector('tbody');
+    if (!tbody) {
+        return;
+    }
+
+    while (tbody.firstChild) {
+        tbody.removeChild(tbody.firstChild);
+    }
+
+    if (!rows || !rows.length) {
+        const tr = document.createElement('tr');
+        const td = document.createElement('td');
+        td.colSpan = 9;
+        td.textContent = 'No security header or cookie findings yet.';
+        tr.appendChild(td);
+        tbody.appendChild(tr);
+        return;
+    }
+
+    const fmtTs = ts => {
+        if (!ts) return '';
+        const d = new Date(ts);
+        return d.toLocaleString();
+    };
+
+    for (const row of rows) {
+        const tr = document.createElement('tr');
+
+        const sevCell = document.createElement('td');
+        const badge = document.createElement('span');
+        badge.className = 'badge badge-' + row.severity;
+        badge.textContent = row.severity;
+        sevCell.appendChild(badge);
+
+        const hostCell = document.createElement('td');
+        hostCell.textContent = row.host;
+
+        const checkCell = document.createElement('td');
+        checkCell.textContent = row.check;
+
+        const detailCell = document.createElement('td');
+        detailCell.textContent = row.detail || '';
+
+        const msgCell = document.createElement('td');
+        msgCell.textContent = row.message;
+
+        const countCell = document.createElement('td');
+        countCell.textContent = String(row.count);
+
+        const routesCell = document.createElement('td');
+        routesCell.textContent = Object.entries(row.routes || {})
+            .sort((a, b) => b[1] - a[1])
+            .map(([route, n]) => `${route} (${n})`)
+            .join(', ');
+
+        const samplesCell = document.createElement('td');
+        samplesCell.textContent = (row.samples || []).map(id => '#' + id).join(' ');
+
+        const lastCell = document.createElement('td');
+        lastCell.textContent = fmtTs(row.last_seen);
+
+        tr.appendChild(sevCell);
+        tr.appendChild(hostCell);
+        tr.appendChild(checkCell);
+        tr.appendChild(detailCell);
+        tr.appendChild(msgCell);
+        tr.appendChild(countCell);
+        tr.appendChild(routesCell);
+        tr.appendChild(samplesCell);
+        tr.appendChild(lastCell);
+
+        tbody.appendChild(tr);
+    }
+}
+
+async function loadSecurityTable() {
+    const select = document.getElementById('securitySeverityFilter');
+    let rows;
+    try {
+        rows = await fetchSecurityFindings(select ? select.value : '', 200);
+    } catch (err) {
+        console.error(err);
+        return;
+    }
+
+    renderSecurityTable(rows);
+}
+
+async function initSecurityTable() {
+    const table = document.getElementById('securityTable');
+    if (!table) {
+        return;
+    }
+
+    const select = document.getElementById('securitySeverityFilter');
+    if (select) {
+        select.addEventListener('change', () => loadSecurityTable());
+    }
+    await loadSecurityTable();
+}
+
 
 //
 // ---- Public entrypoint the rest of the app calls ----
@@ -983,4 +1113,5 @@ export async function initAnalysisUI() {
     await initClientFingerprintTable();
     await initAuthCookieTable();
     await initResponseProfileTable();
+    await initSecurityTable();
 }
\ No newline at end of file
@@ -165,6 +165,12 @@ export function renderDetails(c) {
         const grpcSec = renderGRPCSection(c.grpc);
         detailsPanel.appendChild(grpcSec);
     }
+    if (c.contract_violations && c.contract_violations.length) {
+        detailsPanel.appendChild(renderContractSection(c.contract_violations));
+    }
+    if (c.sensitive_findings && c.sensitive_findings.length) {
+        detailsPanel.appendChild(renderSensitiveSection(c.sensitive_findings));
+    }
     if (detailsPanel) detailsPanel.scrollTo({ top: 0, behavior: 'instant' });
 }
 
@@ -250,6 +256,54 @@ function decodeB64ToUtf8(b64) {
     }
 }
 
+function renderContractSection(violations) {
+    const wrap = document.createElement('div');
+    wrap.className = 'content';
+
+    const h = document.createElement('div');
+    h.innerHTML = `<div class="titleLarge">Contract violations (${violations.length})</div>`;
+    wrap.appendChild(h);
+
+    violations.forEach(v => {
+        const box = document.createElement('div');
+        box.className = 'boxed-text';
+        box.textContent = v.message;
+
+        const meta = document.createElement('div');
+        meta.className = 'subMeta';
+        meta.style.marginBottom = '6px';
+        meta.textContent = [v.kind, v.where, v.pointer, v.spec_path].filter(Boolean).join(' · ');
+
+        wrap.appendChild(box);
+        wrap.appendChild(meta);
+    });
+    return wrap;
+}
+
+function renderSensitiveSection(findings) {
+    const wrap = document.createElement('div');
+    wrap.className = 'content';
+
+    const h = document.createElement('div');
+    h.innerHTML = `<div class="titleLarge">Sensitive data (${findings.length})</div>`;
+    wrap.appendChild(h);
+
+    findings.forEach(f => {
+        const box = document.createElement('div');
+        box.className = 'boxed-text';
+        box.textContent = f.masked;
+
+        const meta = document.createElement('div');
+        meta.className = 'subMeta';
+        meta.style.marginBottom = '6px';
+        meta.textContent = [f.kind, f.category, f.where, f.location, f.field].filter(Boolean).join(' · ');
+
+        wrap.appendChild(box);
+        wrap.appendChild(meta);
+    });
+    return wrap;
+}
+
 function renderGRPCSection(grpc) {
     const wrap = document.createElement('div');
     wrap.className = 'content';
@@ -95,6 +95,26 @@ export function captureMatchesQuery(c, queryLine, opts = {}) {
         if (term.startsWith('resp.body:')) {
             const q = parseMaybeRegex(term.slice(10)); return matches(respBody, q);
         }
+        if (term.startsWith('contract:')) {
+            const spec = term.slice(9);
+            const vs = Array.isArray(c.contract_violations) ? c.contract_violations : [];
+            switch (spec.toLowerCase()) {
+                case 'violation': return vs.length > 0;
+                case 'checked':   return !!c.contract_checked;
+                case 'ok':        return !!c.contract_checked && vs.length === 0;
+            }
+            const q = parseMaybeRegex(spec); return vs.some(v => matches(v.kind, q, true));
+        }
+        if (term.startsWith('sensitive:')) {
+            const spec = term.slice(10);
+            const fs = Array.isArray(c.sensitive_findings) ? c.sensitive_findings : [];
+            switch (spec.toLowerCase()) {
+                case 'any':    return fs.length > 0;
+                case 'secret':
+                case 'pii':    return fs.some(f => f.category === spec.toLowerCase());
+            }
+            const q = parseMaybeRegex(spec); return fs.some(f => matches(f.kind, q, true));
+        }
         if (term.startsWith('header:')) {
             const { nameQ, valueQ } = parseHeaderSpec(term.slice(7));
             return matchHeaderTerm(reqHdrPairs, nameQ, valueQ) || matchHeaderTerm(respHdrPairs, nameQ, valueQ);